@@ -1,5 +1,10 @@
 module github.com/grexie/isolates
 
-go 1.18
+go 1.21
 
-require github.com/grexie/refutils v0.1.1
+require (
+	github.com/grexie/refutils v0.1.1
+	golang.org/x/net v0.21.0
+)
+
+require golang.org/x/text v0.14.0 // indirect
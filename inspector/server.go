@@ -0,0 +1,228 @@
+// Package inspector serves the contexts of an isolates.Inspector over the
+// Chrome DevTools Protocol, so that chrome://inspect and other DevTools
+// clients can attach to them.
+//
+//	i := isolate.NewInspector(nil)
+//	i.AddContext(context, "main")
+//	go inspector.NewServer(i).ListenAndServe("127.0.0.1:9229")
+package inspector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grexie/isolates"
+)
+
+// Server is an http.Handler serving /json/list, /json/version and a WebSocket
+// endpoint per context added to the inspector. Requests must address the
+// server by localhost or an IP address, and browsers may only connect from
+// DevTools.
+type Server struct {
+	inspector *isolates.Inspector
+}
+
+type target struct {
+	Description          string `json:"description"`
+	DevtoolsFrontendURL  string `json:"devtoolsFrontendUrl"`
+	DevtoolsFrontendURLC string `json:"devtoolsFrontendUrlCompat"`
+	FaviconURL           string `json:"faviconUrl,omitempty"`
+	ID                   string `json:"id"`
+	Title                string `json:"title"`
+	Type                 string `json:"type"`
+	URL                  string `json:"url"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+}
+
+func NewServer(inspector *isolates.Inspector) *Server {
+	return &Server{inspector: inspector}
+}
+
+// ListenAndServe listens on addr and serves the inspector until it fails.
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowedHost(r.Host) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return
+	} else if !allowedOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/json", "/json/list":
+		s.serveList(w, r)
+	case "/json/version":
+		s.serveVersion(w, r)
+	default:
+		if id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/")); err != nil {
+			http.NotFound(w, r)
+		} else if ic, ok := s.inspector.Context(id); !ok {
+			http.NotFound(w, r)
+		} else {
+			s.serveWebSocket(w, r, ic)
+		}
+	}
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	targets := []target{}
+
+	for _, ic := range s.inspector.Contexts() {
+		id := strconv.Itoa(ic.ID)
+		ws := fmt.Sprintf("%s/%s", r.Host, id)
+
+		targets = append(targets, target{
+			Description:          "isolates instance",
+			DevtoolsFrontendURL:  "devtools://devtools/bundled/js_app.html?experiments=true&v8only=true&ws=" + ws,
+			DevtoolsFrontendURLC: "devtools://devtools/bundled/inspector.html?experiments=true&v8only=true&ws=" + ws,
+			ID:                   id,
+			Title:                ic.Name,
+			Type:                 "other",
+			URL:                  "file://",
+			WebSocketDebuggerURL: "ws://" + ws,
+		})
+	}
+
+	writeJSON(w, targets)
+}
+
+func (s *Server) serveVersion(w http.ResponseWriter, r *http.Request) {
+	v := isolates.Version
+	writeJSON(w, map[string]string{
+		"Browser":          "isolates",
+		"Protocol-Version": "1.3",
+		"V8-Version":       fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Build, v.Patch),
+	})
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request, ic *isolates.InspectorContext) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+
+	c := newConnection(ws)
+	go c.write()
+
+	session := s.inspector.Connect(ic, c)
+	defer session.Disconnect()
+	defer c.close()
+
+	for {
+		if message, err := ws.ReadMessage(); err != nil {
+			return
+		} else {
+			session.DispatchMessage(string(message))
+		}
+	}
+}
+
+// allowedHost reports whether host names the server by localhost or an IP
+// address. Any other name could have been rebound by a web page's DNS to reach
+// the inspector from the browser (CVE-2018-7160).
+func allowedHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	return host == "localhost" || strings.HasSuffix(host, ".localhost") || net.ParseIP(strings.Trim(host, "[]")) != nil
+}
+
+// allowedOrigin reports whether a request with the Origin header origin may
+// use the inspector. Clients other than browsers don't send one, and the only
+// browser pages allowed are those of DevTools.
+func allowedOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	} else if u, err := url.Parse(origin); err != nil {
+		return false
+	} else {
+		return u.Scheme == "devtools" || u.Scheme == "chrome-devtools"
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+// connection receives protocol messages on the isolate's thread and writes
+// them to the WebSocket from its own goroutine, so that a slow client never
+// blocks the isolate.
+type connection struct {
+	ws     *websocketConn
+	mutex  sync.Mutex
+	queue  [][]byte
+	signal chan bool
+	closed bool
+}
+
+func newConnection(ws *websocketConn) *connection {
+	return &connection{ws: ws, signal: make(chan bool, 1)}
+}
+
+func (c *connection) send(message string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	c.queue = append(c.queue, []byte(message))
+	select {
+	case c.signal <- true:
+	default:
+	}
+}
+
+func (c *connection) write() {
+	for range c.signal {
+		c.mutex.Lock()
+		queue := c.queue
+		c.queue = nil
+		c.mutex.Unlock()
+
+		for _, message := range queue {
+			if err := c.ws.WriteMessage(message); err != nil {
+				c.ws.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *connection) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.signal)
+		c.ws.Close()
+	}
+}
+
+func (c *connection) V8InspectorSendResponse(callId int, message string) {
+	c.send(message)
+}
+
+func (c *connection) V8InspectorSendNotification(message string) {
+	c.send(message)
+}
+
+func (c *connection) V8InspectorFlushProtocolNotifications() {}
@@ -0,0 +1,214 @@
+package inspector
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/grexie/isolates"
+)
+
+func TestMain(m *testing.M) {
+	isolates.Initialize()
+	os.Exit(m.Run())
+}
+
+// newTestServer serves an inspector with a single context named main.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	ctx := isolates.WithContext(context.Background())
+	i := isolates.NewIsolate()
+	t.Cleanup(i.Terminate)
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inspector := i.NewInspector(nil)
+	inspector.AddContext(c, "main")
+
+	server := httptest.NewServer(NewServer(inspector))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+
+	if res, err := http.Get(url); err != nil {
+		t.Fatal(err)
+	} else {
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status %s", url, res.Status)
+		} else if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServerList(t *testing.T) {
+	server := newTestServer(t)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	var targets []target
+	getJSON(t, server.URL+"/json/list", &targets)
+
+	if len(targets) != 1 {
+		t.Fatalf("expected 1 target, got %d", len(targets))
+	} else if targets[0].Title != "main" || targets[0].ID != "1" || targets[0].Type != "other" {
+		t.Errorf("invalid target: %+v", targets[0])
+	} else if targets[0].WebSocketDebuggerURL != "ws://"+host+"/1" {
+		t.Errorf("invalid webSocketDebuggerUrl: %s", targets[0].WebSocketDebuggerURL)
+	} else if targets[0].FaviconURL != "" {
+		t.Errorf("unexpected faviconUrl: %s", targets[0].FaviconURL)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	server := newTestServer(t)
+
+	var version map[string]string
+	getJSON(t, server.URL+"/json/version", &version)
+
+	v := isolates.Version
+	if version["Browser"] != "isolates" {
+		t.Errorf("invalid Browser: %s", version["Browser"])
+	} else if version["V8-Version"] != fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Build, v.Patch) {
+		t.Errorf("invalid V8-Version: %s", version["V8-Version"])
+	}
+}
+
+func TestServerHostAndOrigin(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		host, origin string
+		status       int
+	}{
+		{"", "", http.StatusOK},
+		{"localhost:9229", "", http.StatusOK},
+		{"[::1]:9229", "", http.StatusOK},
+		{"attacker.example:9229", "", http.StatusForbidden},
+		{"", "https://attacker.example", http.StatusForbidden},
+		{"", "devtools://devtools", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", server.URL+"/json/list", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.host != "" {
+			req.Host = test.host
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+
+		if res, err := http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		} else {
+			res.Body.Close()
+
+			if res.StatusCode != test.status {
+				t.Errorf("host %q origin %q: expected status %d, got %d", test.host, test.origin, test.status, res.StatusCode)
+			}
+		}
+	}
+}
+
+// dialWebSocket opens a WebSocket to path on the server, masking the frames
+// written by the returned connection as a client must.
+func dialWebSocket(t *testing.T, server *httptest.Server, path string) *websocketConn {
+	t.Helper()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if _, err := fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path, host); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	if res, err := http.ReadResponse(reader, nil); err != nil {
+		t.Fatal(err)
+	} else if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status %s", res.Status)
+	} else if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("invalid Sec-WebSocket-Accept: %s", accept)
+	}
+
+	return &websocketConn{conn: conn, reader: reader, client: true}
+}
+
+func TestServerEvaluate(t *testing.T) {
+	server := newTestServer(t)
+	ws := dialWebSocket(t, server, "/1")
+
+	if err := ws.WriteMessage([]byte(`{"id":1,"method":"Runtime.evaluate","params":{"expression":"6 * 7"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		var response struct {
+			ID     int `json:"id"`
+			Result struct {
+				Result struct {
+					Type  string `json:"type"`
+					Value any    `json:"value"`
+				} `json:"result"`
+			} `json:"result"`
+		}
+
+		if message, err := ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(message, &response); err != nil {
+			t.Fatal(err)
+		} else if response.ID != 1 {
+			// notifications have no id
+			continue
+		} else if response.Result.Result.Type != "number" || response.Result.Result.Value != float64(42) {
+			t.Errorf("invalid response: %s", message)
+		}
+		return
+	}
+}
+
+func TestServerUnmaskedFrame(t *testing.T) {
+	server := newTestServer(t)
+	ws := dialWebSocket(t, server, "/1")
+
+	// written without a mask, as the server end of a connection would
+	unmasked := &websocketConn{conn: ws.conn, reader: ws.reader}
+	if err := unmasked.WriteMessage([]byte(`{"id":1,"method":"Runtime.evaluate","params":{"expression":"6 * 7"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		if _, opcode, payload, err := ws.readFrame(); err != nil {
+			t.Fatal(err)
+		} else if opcode != opClose {
+			// notifications sent before the frame was read
+			continue
+		} else if len(payload) != 2 || binary.BigEndian.Uint16(payload) != closeProtocolError {
+			t.Errorf("expected close status %d, got %v", closeProtocolError, payload)
+		}
+		return
+	}
+}
@@ -0,0 +1,166 @@
+package node
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/grexie/isolates"
+)
+
+//go:embed buffer.js
+var bufferSource string
+
+var _ = isolates.RegisterRuntime("buffer", "buffer", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if buffer, err := runBootstrap(in.ExecutionContext, in.Context, "buffer", bufferSource, encodeString, decodeString); err != nil {
+		return nil, err
+	} else if err := setModuleExports(in, buffer); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+})
+
+func init() {
+	isolates.RegisterBufferFactory(newBuffer)
+}
+
+// newBuffer returns the contents of a file read by module.fs.readFileSync as a
+// Buffer, as Node's fs does.
+func newBuffer(ctx context.Context, require *isolates.Value, data []byte) (*isolates.Value, error) {
+	// a nil slice would be created as undefined
+	data = append([]byte{}, data...)
+
+	if buffer, err := require.Call(ctx, nil, "buffer"); err != nil {
+		return nil, err
+	} else if Buffer, err := buffer.Get(ctx, "Buffer"); err != nil {
+		return nil, err
+	} else if arrayBuffer, err := require.GetContext().Create(ctx, data); err != nil {
+		return nil, err
+	} else {
+		return Buffer.CallMethod(ctx, "from", arrayBuffer)
+	}
+}
+
+// encodeString returns the bytes of a string in an encoding as an
+// ArrayBuffer. Encodings have been normalized by buffer.js.
+func encodeString(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if s, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if encoding, err := in.Arg(in.ExecutionContext, 1).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, encode(s, encoding))
+	}
+}
+
+// decodeString returns the string of the bytes of a Uint8Array in an
+// encoding, reading them in place.
+func decodeString(in isolates.FunctionArgs) (*isolates.Value, error) {
+	var s string
+	if encoding, err := in.Arg(in.ExecutionContext, 1).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if err := in.Arg(in.ExecutionContext, 0).WithBytes(in.ExecutionContext, func(b []byte) error {
+		s = decode(b, encoding)
+		return nil
+	}); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, s)
+	}
+}
+
+func encode(s string, encoding string) []byte {
+	switch encoding {
+	case "hex":
+		// like Node, decoding stops at the first invalid pair
+		b := make([]byte, 0, len(s)/2)
+		for i := 0; i+1 < len(s); i += 2 {
+			if c, err := hex.DecodeString(s[i : i+2]); err != nil {
+				break
+			} else {
+				b = append(b, c[0])
+			}
+		}
+		return b
+	case "base64", "base64url":
+		return decodeBase64(s)
+	case "latin1", "ascii":
+		runes := []rune(s)
+		b := make([]byte, len(runes))
+		for i, r := range runes {
+			b[i] = byte(r)
+		}
+		return b
+	case "utf16le":
+		units := utf16.Encode([]rune(s))
+		b := make([]byte, len(units)*2)
+		for i, u := range units {
+			binary.LittleEndian.PutUint16(b[i*2:], u)
+		}
+		return b
+	default:
+		return []byte(s)
+	}
+}
+
+func decode(b []byte, encoding string) string {
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(b)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(b)
+	case "latin1", "ascii":
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			if encoding == "ascii" {
+				c &= 0x7f
+			}
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case "utf16le":
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units))
+	default:
+		// converting through runes replaces each invalid byte with U+FFFD
+		return string([]rune(string(b)))
+	}
+}
+
+// decodeBase64 decodes standard and URL-safe base64 leniently, as Node does,
+// ignoring padding and characters outside the alphabet.
+func decodeBase64(s string) []byte {
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		s = s[:i]
+	}
+
+	data := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '+', r == '/':
+			return r
+		case r == '-':
+			return '+'
+		case r == '_':
+			return '/'
+		default:
+			return -1
+		}
+	}, s)
+
+	if len(data)%4 == 1 {
+		data = data[:len(data)-1]
+	}
+
+	b, _ := base64.RawStdEncoding.DecodeString(data)
+	return b
+}
@@ -0,0 +1,313 @@
+(function (encode, decode) {
+	const encodings = {
+		'utf8': 'utf8',
+		'utf-8': 'utf8',
+		'hex': 'hex',
+		'base64': 'base64',
+		'base64url': 'base64url',
+		'latin1': 'latin1',
+		'binary': 'latin1',
+		'ascii': 'ascii',
+		'utf16le': 'utf16le',
+		'utf-16le': 'utf16le',
+		'ucs2': 'utf16le',
+		'ucs-2': 'utf16le',
+	};
+
+	function normalizeEncoding(encoding) {
+		if (encoding === undefined || encoding === null) {
+			return 'utf8';
+		}
+		const normalized = encodings[String(encoding).toLowerCase()];
+		if (normalized === undefined) {
+			throw new TypeError(`Unknown encoding: ${encoding}`);
+		}
+		return normalized;
+	}
+
+	function clamp(value, length, defaultValue) {
+		if (value === undefined) {
+			return defaultValue;
+		}
+		value = Math.trunc(Number(value)) || 0;
+		if (value < 0) {
+			return Math.max(length + value, 0);
+		}
+		return Math.min(value, length);
+	}
+
+	const kMaxLength = 2 ** 32;
+
+	// Buffer is a Uint8Array, so Value.Bytes, Value.SetBytes and
+	// Value.WithBytes work with Buffers from Go.
+	class Buffer extends Uint8Array {
+		static poolSize = 8192;
+
+		static from(value, encodingOrOffset, length) {
+			if (typeof value === 'string') {
+				return new Buffer(encode(value, normalizeEncoding(encodingOrOffset)));
+			} else if (value instanceof ArrayBuffer || (typeof SharedArrayBuffer !== 'undefined' && value instanceof SharedArrayBuffer)) {
+				const offset = encodingOrOffset === undefined ? 0 : Number(encodingOrOffset);
+				return new Buffer(value, offset, length === undefined ? value.byteLength - offset : Number(length));
+			} else if (ArrayBuffer.isView(value) || Array.isArray(value)) {
+				const buffer = new Buffer(value.length);
+				buffer.set(value);
+				return buffer;
+			} else if (value !== null && typeof value === 'object') {
+				if (value.type === 'Buffer' && Array.isArray(value.data)) {
+					return Buffer.from(value.data);
+				} else if (typeof value.length === 'number') {
+					return Buffer.from(Array.from(value));
+				}
+
+				const primitive = value.valueOf?.();
+				if (primitive !== undefined && primitive !== value) {
+					return Buffer.from(primitive, encodingOrOffset, length);
+				}
+			}
+
+			throw new TypeError('The first argument must be of type string or an instance of Buffer, ArrayBuffer, or Array or an Array-like Object.');
+		}
+
+		static alloc(size, fill, encoding) {
+			const buffer = new Buffer(size);
+			if (fill !== undefined && fill !== 0) {
+				buffer.fill(fill, 0, buffer.length, encoding);
+			}
+			return buffer;
+		}
+
+		static allocUnsafe(size) {
+			return new Buffer(size);
+		}
+
+		static allocUnsafeSlow(size) {
+			return new Buffer(size);
+		}
+
+		static byteLength(value, encoding) {
+			if (typeof value !== 'string') {
+				return value.byteLength;
+			}
+			return encode(value, normalizeEncoding(encoding)).byteLength;
+		}
+
+		static isBuffer(value) {
+			return value instanceof Buffer;
+		}
+
+		static isEncoding(encoding) {
+			return typeof encoding === 'string' && encodings[encoding.toLowerCase()] !== undefined;
+		}
+
+		static concat(list, totalLength) {
+			if (totalLength === undefined) {
+				totalLength = list.reduce((length, buffer) => length + buffer.length, 0);
+			}
+
+			const result = Buffer.alloc(totalLength);
+			let offset = 0;
+			for (const buffer of list) {
+				if (offset >= totalLength) {
+					break;
+				}
+				const bytes = buffer.subarray(0, totalLength - offset);
+				result.set(bytes, offset);
+				offset += bytes.length;
+			}
+			return result;
+		}
+
+		static compare(a, b) {
+			const length = Math.min(a.length, b.length);
+			for (let i = 0; i < length; i++) {
+				if (a[i] !== b[i]) {
+					return a[i] < b[i] ? -1 : 1;
+				}
+			}
+			return a.length === b.length ? 0 : a.length < b.length ? -1 : 1;
+		}
+
+		get parent() {
+			return this.buffer;
+		}
+
+		get offset() {
+			return this.byteOffset;
+		}
+
+		toString(encoding, start, end) {
+			start = clamp(start, this.length, 0);
+			end = clamp(end, this.length, this.length);
+			if (start >= end) {
+				return '';
+			}
+			return decode(this.subarray(start, end), normalizeEncoding(encoding));
+		}
+
+		toLocaleString(encoding, start, end) {
+			return this.toString(encoding, start, end);
+		}
+
+		toJSON() {
+			return { type: 'Buffer', data: Array.from(this) };
+		}
+
+		write(string, offset, length, encoding) {
+			if (typeof offset === 'string') {
+				[offset, length, encoding] = [0, this.length, offset];
+			} else if (typeof length === 'string') {
+				[length, encoding] = [this.length - (offset ?? 0), length];
+			}
+
+			offset = clamp(offset, this.length, 0);
+			length = Math.min(clamp(length, this.length, this.length), this.length - offset);
+
+			const bytes = new Uint8Array(encode(String(string), normalizeEncoding(encoding)));
+			const n = Math.min(bytes.length, length);
+			this.set(bytes.subarray(0, n), offset);
+			return n;
+		}
+
+		// slice shares memory with the buffer like subarray, unlike
+		// Uint8Array.prototype.slice
+		slice(start, end) {
+			return this.subarray(start, end);
+		}
+
+		equals(other) {
+			return Buffer.compare(this, other) === 0;
+		}
+
+		compare(target, targetStart, targetEnd, sourceStart, sourceEnd) {
+			return Buffer.compare(
+				this.subarray(clamp(sourceStart, this.length, 0), clamp(sourceEnd, this.length, this.length)),
+				target.subarray(clamp(targetStart, target.length, 0), clamp(targetEnd, target.length, target.length)),
+			);
+		}
+
+		copy(target, targetStart, sourceStart, sourceEnd) {
+			targetStart = clamp(targetStart, target.length, 0);
+			sourceStart = clamp(sourceStart, this.length, 0);
+			sourceEnd = clamp(sourceEnd, this.length, this.length);
+
+			const bytes = this.subarray(sourceStart, Math.max(sourceStart, Math.min(sourceEnd, sourceStart + target.length - targetStart)));
+			target.set(bytes, targetStart);
+			return bytes.length;
+		}
+
+		fill(value, offset, end, encoding) {
+			if (typeof offset === 'string') {
+				[offset, end, encoding] = [0, this.length, offset];
+			} else if (typeof end === 'string') {
+				[end, encoding] = [this.length, end];
+			}
+
+			offset = clamp(offset, this.length, 0);
+			end = clamp(end, this.length, this.length);
+
+			if (typeof value === 'number') {
+				return super.fill(value & 255, offset, end);
+			} else if (typeof value === 'boolean') {
+				return super.fill(Number(value), offset, end);
+			}
+
+			const bytes = typeof value === 'string' ? Buffer.from(value, encoding) : Buffer.from(value);
+			if (bytes.length === 0) {
+				return super.fill(0, offset, end);
+			}
+			for (let i = offset; i < end; i++) {
+				this[i] = bytes[(i - offset) % bytes.length];
+			}
+			return this;
+		}
+
+		indexOf(value, byteOffset, encoding) {
+			if (typeof byteOffset === 'string') {
+				[byteOffset, encoding] = [0, byteOffset];
+			}
+			byteOffset = clamp(byteOffset, this.length, 0);
+
+			if (typeof value === 'number') {
+				return super.indexOf(value & 255, byteOffset);
+			}
+
+			const bytes = typeof value === 'string' ? Buffer.from(value, encoding) : value;
+			if (bytes.length === 0) {
+				return byteOffset;
+			}
+			for (let i = byteOffset; i + bytes.length <= this.length; i++) {
+				let j = 0;
+				while (j < bytes.length && this[i + j] === bytes[j]) {
+					j++;
+				}
+				if (j === bytes.length) {
+					return i;
+				}
+			}
+			return -1;
+		}
+
+		includes(value, byteOffset, encoding) {
+			return this.indexOf(value, byteOffset, encoding) !== -1;
+		}
+
+		[Symbol.for('nodejs.util.inspect.custom')]() {
+			const max = 50;
+			const bytes = Array.from(this.subarray(0, max), (b) => b.toString(16).padStart(2, '0'));
+			const more = this.length > max ? ` ... ${this.length - max} more bytes` : '';
+			return `<Buffer${bytes.length > 0 ? ' ' : ''}${bytes.join(' ')}${more}>`;
+		}
+	}
+
+	// readUInt8, writeUInt8, readInt16LE, writeInt16LE and so on are
+	// implemented with DataView, including the lowercase Uint aliases.
+	const accessors = [
+		['UInt8', 'Uint8', 1],
+		['Int8', 'Int8', 1],
+		['UInt16', 'Uint16', 2],
+		['Int16', 'Int16', 2],
+		['UInt32', 'Uint32', 4],
+		['Int32', 'Int32', 4],
+		['Float', 'Float32', 4],
+		['Double', 'Float64', 8],
+		['BigUInt64', 'BigUint64', 8],
+		['BigInt64', 'BigInt64', 8],
+	];
+
+	function view(buffer, offset, size) {
+		offset = offset === undefined ? 0 : offset;
+		if (!Number.isInteger(offset) || offset < 0 || offset + size > buffer.length) {
+			throw new RangeError(`The value of "offset" is out of range. It must be >= 0 and <= ${buffer.length - size}. Received ${offset}`);
+		}
+		return new DataView(buffer.buffer, buffer.byteOffset + offset, size);
+	}
+
+	for (const [name, type, size] of accessors) {
+		const endians = size === 1 ? [['', false]] : [['LE', true], ['BE', false]];
+		for (const [suffix, littleEndian] of endians) {
+			const read = function (offset) {
+				return view(this, offset, size)[`get${type}`](0, littleEndian);
+			};
+			const write = function (value, offset) {
+				view(this, offset, size)[`set${type}`](0, value, littleEndian);
+				return (offset ?? 0) + size;
+			};
+
+			for (const alias of new Set([name, name.replace('UInt', 'Uint')])) {
+				Buffer.prototype[`read${alias}${suffix}`] = read;
+				Buffer.prototype[`write${alias}${suffix}`] = write;
+			}
+		}
+	}
+
+	return {
+		Buffer,
+		SlowBuffer: Buffer,
+		kMaxLength,
+		constants: {
+			MAX_LENGTH: kMaxLength,
+			MAX_STRING_LENGTH: 2 ** 29 - 24,
+		},
+	};
+})
@@ -0,0 +1,20 @@
+package node
+
+import (
+	_ "embed"
+
+	"github.com/grexie/isolates"
+)
+
+//go:embed events.js
+var eventsSource string
+
+var _ = isolates.RegisterRuntime("events", "events", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if EventEmitter, err := runBootstrap(in.ExecutionContext, in.Context, "events", eventsSource); err != nil {
+		return nil, err
+	} else if err := setModuleExports(in, EventEmitter); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+})
@@ -0,0 +1,213 @@
+(function () {
+	const kErrorMonitor = Symbol('events.errorMonitor');
+
+	// EventEmitter is a function rather than a class so that modules written
+	// for older versions of Node can inherit from it with EventEmitter.call.
+	function EventEmitter(options) {
+		EventEmitter.init.call(this, options);
+	}
+
+	EventEmitter.prototype._events = undefined;
+	EventEmitter.prototype._eventsCount = 0;
+	EventEmitter.prototype._maxListeners = undefined;
+
+	EventEmitter.defaultMaxListeners = 10;
+	EventEmitter.errorMonitor = kErrorMonitor;
+
+	EventEmitter.init = function () {
+		if (this._events === undefined || this._events === Object.getPrototypeOf(this)._events) {
+			this._events = Object.create(null);
+			this._eventsCount = 0;
+		}
+		this._maxListeners = this._maxListeners || undefined;
+	};
+
+	function events(emitter) {
+		if (emitter._events === undefined) {
+			EventEmitter.init.call(emitter);
+		}
+		return emitter._events;
+	}
+
+	function checkListener(listener) {
+		if (typeof listener !== 'function') {
+			throw new TypeError(`The "listener" argument must be of type function. Received ${listener === null ? 'null' : typeof listener}`);
+		}
+	}
+
+	function addListener(emitter, type, listener, prepend) {
+		checkListener(listener);
+
+		if (events(emitter).newListener !== undefined) {
+			emitter.emit('newListener', type, listener.listener ?? listener);
+		}
+
+		const list = events(emitter)[type];
+		if (list === undefined) {
+			events(emitter)[type] = [listener];
+			emitter._eventsCount++;
+		} else if (prepend) {
+			list.unshift(listener);
+		} else {
+			list.push(listener);
+		}
+
+		return emitter;
+	}
+
+	function onceWrapper(emitter, type, listener) {
+		const wrapper = function (...args) {
+			emitter.removeListener(type, wrapper);
+			return listener.apply(emitter, args);
+		};
+		wrapper.listener = listener;
+		return wrapper;
+	}
+
+	EventEmitter.prototype.setMaxListeners = function (n) {
+		if (typeof n !== 'number' || n < 0 || Number.isNaN(n)) {
+			throw new RangeError(`The value of "n" is out of range. It must be a non-negative number. Received ${n}`);
+		}
+		this._maxListeners = n;
+		return this;
+	};
+
+	EventEmitter.prototype.getMaxListeners = function () {
+		return this._maxListeners === undefined ? EventEmitter.defaultMaxListeners : this._maxListeners;
+	};
+
+	EventEmitter.prototype.emit = function (type, ...args) {
+		const list = events(this)[type];
+
+		if (type === 'error') {
+			if (events(this)[kErrorMonitor] !== undefined) {
+				this.emit(kErrorMonitor, ...args);
+			}
+
+			if (list === undefined) {
+				const er = args[0];
+				if (er instanceof Error) {
+					throw er;
+				}
+				const err = new Error(`Unhandled error. (${er})`);
+				err.context = er;
+				throw err;
+			}
+		}
+
+		if (list === undefined) {
+			return false;
+		}
+
+		for (const listener of [...list]) {
+			listener.apply(this, args);
+		}
+		return true;
+	};
+
+	EventEmitter.prototype.addListener = function (type, listener) {
+		return addListener(this, type, listener, false);
+	};
+
+	EventEmitter.prototype.on = EventEmitter.prototype.addListener;
+
+	EventEmitter.prototype.prependListener = function (type, listener) {
+		return addListener(this, type, listener, true);
+	};
+
+	EventEmitter.prototype.once = function (type, listener) {
+		checkListener(listener);
+		return this.on(type, onceWrapper(this, type, listener));
+	};
+
+	EventEmitter.prototype.prependOnceListener = function (type, listener) {
+		checkListener(listener);
+		return this.prependListener(type, onceWrapper(this, type, listener));
+	};
+
+	EventEmitter.prototype.removeListener = function (type, listener) {
+		checkListener(listener);
+
+		const list = events(this)[type];
+		if (list === undefined) {
+			return this;
+		}
+
+		for (let i = list.length - 1; i >= 0; i--) {
+			if (list[i] === listener || list[i].listener === listener) {
+				const [removed] = list.splice(i, 1);
+				if (list.length === 0) {
+					delete events(this)[type];
+					this._eventsCount--;
+				}
+				if (events(this).removeListener !== undefined) {
+					this.emit('removeListener', type, removed.listener ?? removed);
+				}
+				break;
+			}
+		}
+
+		return this;
+	};
+
+	EventEmitter.prototype.off = EventEmitter.prototype.removeListener;
+
+	EventEmitter.prototype.removeAllListeners = function (type) {
+		const types = type === undefined ? Reflect.ownKeys(events(this)) : [type];
+
+		// removeListener listeners are removed last so that they see the others
+		// being removed
+		for (const t of types.filter((t) => t !== 'removeListener').concat(types.filter((t) => t === 'removeListener'))) {
+			const list = events(this)[t];
+			while (list !== undefined && events(this)[t] !== undefined) {
+				this.removeListener(t, list[list.length - 1]);
+			}
+		}
+
+		return this;
+	};
+
+	EventEmitter.prototype.listeners = function (type) {
+		return (events(this)[type] ?? []).map((listener) => listener.listener ?? listener);
+	};
+
+	EventEmitter.prototype.rawListeners = function (type) {
+		return [...(events(this)[type] ?? [])];
+	};
+
+	EventEmitter.prototype.listenerCount = function (type) {
+		return (events(this)[type] ?? []).length;
+	};
+
+	EventEmitter.prototype.eventNames = function () {
+		return Reflect.ownKeys(events(this));
+	};
+
+	EventEmitter.listenerCount = function (emitter, type) {
+		return emitter.listenerCount(type);
+	};
+
+	EventEmitter.once = function (emitter, type) {
+		return new Promise((resolve, reject) => {
+			const listener = (...args) => {
+				if (type !== 'error') {
+					emitter.removeListener('error', error);
+				}
+				resolve(args);
+			};
+			const error = (err) => {
+				emitter.removeListener(type, listener);
+				reject(err);
+			};
+
+			emitter.once(type, listener);
+			if (type !== 'error') {
+				emitter.once('error', error);
+			}
+		});
+	};
+
+	EventEmitter.EventEmitter = EventEmitter;
+
+	return EventEmitter;
+})
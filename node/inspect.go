@@ -0,0 +1,740 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grexie/isolates"
+)
+
+// inspectOptions are the options of util.inspect that are supported. colors,
+// compact and showHidden are ignored.
+type inspectOptions struct {
+	depth           float64
+	breakLength     int
+	maxArrayLength  int
+	maxStringLength int
+	sorted          bool
+}
+
+// inspector formats values like util.inspect. helpers are JavaScript
+// functions from util.js for what can't be done through *isolates.Value,
+// such as reading symbol properties.
+type inspector struct {
+	ctx     context.Context
+	helpers *isolates.Value
+	options inspectOptions
+	seen    []*isolates.Value
+
+	// circular are the objects referenced from within themselves, which are
+	// numbered from 1 in the order the references are found.
+	circular []*isolates.Value
+}
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func newInspector(ctx context.Context, helpers *isolates.Value, options *isolates.Value) (*inspector, error) {
+	i := &inspector{
+		ctx:     ctx,
+		helpers: helpers,
+		options: inspectOptions{depth: 2, breakLength: 80, maxArrayLength: 100, maxStringLength: -1},
+	}
+
+	if isNullish(options) || !options.IsKind(isolates.KindObject) {
+		return i, nil
+	}
+
+	if depth, err := options.Get(ctx, "depth"); err != nil {
+		return nil, err
+	} else if depth.IsKind(isolates.KindNull) {
+		i.options.depth = math.Inf(1)
+	} else if depth.IsKind(isolates.KindNumber) {
+		if i.options.depth, err = depth.Float64(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, option := range map[string]*int{
+		"breakLength":     &i.options.breakLength,
+		"maxArrayLength":  &i.options.maxArrayLength,
+		"maxStringLength": &i.options.maxStringLength,
+	} {
+		if value, err := options.Get(ctx, name); err != nil {
+			return nil, err
+		} else if value.IsKind(isolates.KindNumber) {
+			if f, err := value.Float64(ctx); err != nil {
+				return nil, err
+			} else if math.IsInf(f, 1) || f > math.MaxInt32 {
+				*option = math.MaxInt32
+			} else {
+				*option = int(f)
+			}
+		}
+	}
+
+	if sorted, err := options.Get(ctx, "sorted"); err != nil {
+		return nil, err
+	} else if sorted.IsKind(isolates.KindBoolean) {
+		if i.options.sorted, err = sorted.Bool(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+func (i *inspector) inspect(value *isolates.Value, level int) (string, error) {
+	switch {
+	case value.IsKind(isolates.KindUndefined):
+		return "undefined", nil
+	case value.IsKind(isolates.KindNull):
+		return "null", nil
+	case value.IsKind(isolates.KindString):
+		if s, err := value.StringValue(i.ctx); err != nil {
+			return "", err
+		} else {
+			return i.quote(s), nil
+		}
+	case value.IsKind(isolates.KindSymbol):
+		return i.string(value)
+	case value.IsKind(isolates.KindNumber):
+		return formatNumber(i.ctx, value)
+	case value.IsKind(isolates.KindBigInt):
+		return value.String() + "n", nil
+	case value.IsKind(isolates.KindBoolean):
+		return value.String(), nil
+	}
+
+	if result, err := i.helpers.CallMethod(i.ctx, "custom", value, i.options.depth-float64(level), i.optionsValue()); err != nil {
+		return "", err
+	} else if !isNullish(result) {
+		if result, err := result.GetIndex(i.ctx, 0); err != nil {
+			return "", err
+		} else if result.IsKind(isolates.KindString) {
+			return result.StringValue(i.ctx)
+		} else {
+			return i.inspect(result, level)
+		}
+	}
+
+	for _, seen := range i.seen {
+		if equal, err := seen.StrictEquals(i.ctx, value); err != nil {
+			return "", err
+		} else if equal {
+			if index, err := i.circularIndex(value); err != nil {
+				return "", err
+			} else if index == 0 {
+				i.circular = append(i.circular, value)
+				return fmt.Sprintf("[Circular *%d]", len(i.circular)), nil
+			} else {
+				return fmt.Sprintf("[Circular *%d]", index), nil
+			}
+		}
+	}
+
+	i.seen = append(i.seen, value)
+	defer func() {
+		i.seen = i.seen[:len(i.seen)-1]
+	}()
+
+	// the object is numbered while its properties are inspected, so that its
+	// reference can only be added afterwards
+	if s, err := i.inspectObject(value, level); err != nil {
+		return "", err
+	} else if index, err := i.circularIndex(value); err != nil {
+		return "", err
+	} else if index > 0 {
+		return fmt.Sprintf("<ref *%d> %s", index, s), nil
+	} else {
+		return s, nil
+	}
+}
+
+// circularIndex returns the number of an object referenced from within
+// itself, or 0 if it hasn't been.
+func (i *inspector) circularIndex(value *isolates.Value) (int, error) {
+	for j, circular := range i.circular {
+		if equal, err := circular.StrictEquals(i.ctx, value); err != nil {
+			return 0, err
+		} else if equal {
+			return j + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (i *inspector) inspectObject(value *isolates.Value, level int) (string, error) {
+	className, err := i.className(value)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := ""
+	if className == "" {
+		prefix = "[Object: null prototype] "
+	} else if className != "Object" {
+		prefix = className + " "
+	}
+
+	tooDeep := float64(level) > i.options.depth
+
+	switch {
+	case value.IsKind(isolates.KindFunction):
+		if base, err := i.functionBase(value, className); err != nil {
+			return "", err
+		} else if keys, err := value.Keys(i.ctx); err != nil {
+			return "", err
+		} else if len(keys) == 0 {
+			return base, nil
+		} else if tooDeep {
+			return base, nil
+		} else if entries, err := i.properties(value, keys, level); err != nil {
+			return "", err
+		} else {
+			return i.reduce(base+" ", "{", "}", entries, level), nil
+		}
+
+	case value.IsKind(isolates.KindArray):
+		if tooDeep {
+			return "[Array]", nil
+		} else if entries, err := i.elements(value, level); err != nil {
+			return "", err
+		} else {
+			if className == "Array" {
+				prefix = ""
+			}
+			return i.reduce(prefix, "[", "]", entries, level), nil
+		}
+
+	case value.IsKind(isolates.KindNativeError):
+		if stack, err := value.Get(i.ctx, "stack"); err != nil {
+			return "", err
+		} else if stack.IsKind(isolates.KindString) {
+			return stack.StringValue(i.ctx)
+		} else if s, err := i.string(value); err != nil {
+			return "", err
+		} else {
+			return "[" + s + "]", nil
+		}
+
+	case value.IsKind(isolates.KindDate):
+		if iso, err := value.CallMethod(i.ctx, "toISOString"); err != nil {
+			return "Invalid Date", nil
+		} else {
+			return iso.StringValue(i.ctx)
+		}
+
+	case value.IsKind(isolates.KindRegExp):
+		return value.StringValue(i.ctx)
+
+	case value.IsKind(isolates.KindPromise):
+		if tooDeep {
+			return "[Promise]", nil
+		} else if state, result, err := value.PromiseInfo(i.ctx); err != nil {
+			return "", err
+		} else if state == isolates.PromiseStatePending {
+			return i.reduce("Promise ", "{", "}", []string{"<pending>"}, level), nil
+		} else if s, err := i.inspect(result, level+1); err != nil {
+			return "", err
+		} else if state == isolates.PromiseStateRejected {
+			return i.reduce("Promise ", "{", "}", []string{"<rejected> " + s}, level), nil
+		} else {
+			return i.reduce("Promise ", "{", "}", []string{s}, level), nil
+		}
+
+	case value.IsKind(isolates.KindMap), value.IsKind(isolates.KindSet):
+		size, err := value.Get(i.ctx, "size")
+		if err != nil {
+			return "", err
+		}
+		prefix = fmt.Sprintf("%s(%s) ", className, size.String())
+
+		if tooDeep {
+			return "[" + className + "]", nil
+		} else if entries, err := i.collection(value, value.IsKind(isolates.KindMap), level); err != nil {
+			return "", err
+		} else {
+			return i.reduce(prefix, "{", "}", entries, level), nil
+		}
+
+	case value.IsKind(isolates.KindWeakMap), value.IsKind(isolates.KindWeakSet):
+		return prefix + "{ <items unknown> }", nil
+
+	case value.IsKind(isolates.KindTypedArray):
+		if length, err := value.GetLength(i.ctx); err != nil {
+			return "", err
+		} else if tooDeep {
+			return "[" + className + "]", nil
+		} else if entries, err := i.elements(value, level); err != nil {
+			return "", err
+		} else {
+			return i.reduce(fmt.Sprintf("%s(%d) ", className, length), "[", "]", entries, level), nil
+		}
+
+	case value.IsKind(isolates.KindArrayBuffer), value.IsKind(isolates.KindSharedArrayBuffer):
+		if bytes, err := value.Bytes(i.ctx); err != nil {
+			return "", err
+		} else {
+			contents := make([]string, 0, len(bytes))
+			for j, b := range bytes {
+				if j == i.options.maxArrayLength {
+					contents = append(contents, fmt.Sprintf("... %d more bytes", len(bytes)-j))
+					break
+				}
+				contents = append(contents, fmt.Sprintf("%02x", b))
+			}
+			return i.reduce(prefix, "{", "}", []string{
+				"[Uint8Contents]: <" + strings.Join(contents, " ") + ">",
+				fmt.Sprintf("byteLength: %d", len(bytes)),
+			}, level), nil
+		}
+
+	case value.IsKind(isolates.KindNumberObject), value.IsKind(isolates.KindStringObject),
+		value.IsKind(isolates.KindBooleanObject), value.IsKind(isolates.KindSymbolObject):
+		if primitive, err := value.CallMethod(i.ctx, "valueOf"); err != nil {
+			return "", err
+		} else if s, err := i.inspect(primitive, level); err != nil {
+			return "", err
+		} else {
+			return "[" + className + ": " + s + "]", nil
+		}
+	}
+
+	if tooDeep {
+		if className == "" || className == "Object" {
+			return "[Object]", nil
+		}
+		return "[" + className + "]", nil
+	} else if keys, err := value.Keys(i.ctx); err != nil {
+		return "", err
+	} else if entries, err := i.properties(value, keys, level); err != nil {
+		return "", err
+	} else {
+		return i.reduce(prefix, "{", "}", entries, level), nil
+	}
+}
+
+// reduce joins entries on one line if they fit within breakLength, and on a
+// line each otherwise.
+func (i *inspector) reduce(prefix string, open string, close string, entries []string, level int) string {
+	if len(entries) == 0 {
+		return prefix + open + close
+	}
+
+	length := len(prefix) + len(open) + len(close) + level*2
+	multiline := false
+	for _, entry := range entries {
+		length += len(entry) + 2
+		multiline = multiline || strings.Contains(entry, "\n")
+	}
+
+	if !multiline && length <= i.options.breakLength {
+		return prefix + open + " " + strings.Join(entries, ", ") + " " + close
+	}
+
+	for j, entry := range entries {
+		entries[j] = "  " + strings.ReplaceAll(entry, "\n", "\n  ")
+	}
+	return prefix + open + "\n" + strings.Join(entries, ",\n") + "\n" + close
+}
+
+func (i *inspector) properties(value *isolates.Value, keys []string, level int) ([]string, error) {
+	descriptors, err := value.GetOwnPropertyDescriptors(i.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if i.options.sorted {
+		sort.Strings(keys)
+	}
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		descriptor := descriptors[key]
+		getter, setter := !isNullish(descriptor.Get), !isNullish(descriptor.Set)
+
+		var s string
+		switch {
+		case getter && setter:
+			s = "[Getter/Setter]"
+		case getter:
+			s = "[Getter]"
+		case setter:
+			s = "[Setter]"
+		default:
+			if s, err = i.inspect(descriptor.Value, level+1); err != nil {
+				return nil, err
+			}
+		}
+
+		entries = append(entries, i.key(key)+": "+s)
+	}
+
+	return entries, nil
+}
+
+func (i *inspector) elements(value *isolates.Value, level int) ([]string, error) {
+	length, err := value.GetLength(i.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, 0, min(int(length), i.options.maxArrayLength+1))
+	for j := 0; j < int(length); j++ {
+		if j == i.options.maxArrayLength {
+			entries = append(entries, fmt.Sprintf("... %d more items", int(length)-j))
+			break
+		}
+
+		if element, err := value.GetIndex(i.ctx, j); err != nil {
+			return nil, err
+		} else if s, err := i.inspect(element, level+1); err != nil {
+			return nil, err
+		} else {
+			entries = append(entries, s)
+		}
+	}
+
+	return entries, nil
+}
+
+func (i *inspector) collection(value *isolates.Value, isMap bool, level int) ([]string, error) {
+	items, err := i.helpers.CallMethod(i.ctx, "entries", value)
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := items.GetLength(i.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, 0, length)
+	for j := 0; j < int(length); j++ {
+		if j == i.options.maxArrayLength {
+			entries = append(entries, fmt.Sprintf("... %d more items", int(length)-j))
+			break
+		}
+
+		item, err := items.GetIndex(i.ctx, j)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isMap {
+			if s, err := i.inspect(item, level+1); err != nil {
+				return nil, err
+			} else {
+				entries = append(entries, s)
+			}
+		} else if key, err := item.GetIndex(i.ctx, 0); err != nil {
+			return nil, err
+		} else if value, err := item.GetIndex(i.ctx, 1); err != nil {
+			return nil, err
+		} else if k, err := i.inspect(key, level+1); err != nil {
+			return nil, err
+		} else if v, err := i.inspect(value, level+1); err != nil {
+			return nil, err
+		} else {
+			entries = append(entries, k+" => "+v)
+		}
+	}
+
+	return entries, nil
+}
+
+func (i *inspector) functionBase(value *isolates.Value, className string) (string, error) {
+	name, err := value.Get(i.ctx, "name")
+	if err != nil {
+		return "", err
+	}
+
+	s := ""
+	if name.IsKind(isolates.KindString) {
+		s = name.String()
+	}
+
+	if isClass, err := i.helpers.CallMethod(i.ctx, "isClass", value); err != nil {
+		return "", err
+	} else if isClass, err := isClass.Bool(i.ctx); err != nil {
+		return "", err
+	} else if isClass {
+		if s == "" {
+			return "[class (anonymous)]", nil
+		}
+		return "[class " + s + "]", nil
+	}
+
+	kind := "Function"
+	if className == "AsyncFunction" || className == "GeneratorFunction" || className == "AsyncGeneratorFunction" {
+		kind = className
+	}
+
+	if s == "" {
+		return "[" + kind + " (anonymous)]", nil
+	}
+	return "[" + kind + ": " + s + "]", nil
+}
+
+// className returns the name of the constructor of value, or "" if it has a
+// null prototype.
+func (i *inspector) className(value *isolates.Value) (string, error) {
+	if name, err := i.helpers.CallMethod(i.ctx, "className", value); err != nil {
+		return "", err
+	} else if name.IsKind(isolates.KindString) {
+		return name.StringValue(i.ctx)
+	} else {
+		return "", nil
+	}
+}
+
+func (i *inspector) string(value *isolates.Value) (string, error) {
+	if s, err := i.helpers.CallMethod(i.ctx, "string", value); err != nil {
+		return "", err
+	} else {
+		return s.StringValue(i.ctx)
+	}
+}
+
+func (i *inspector) optionsValue() map[string]any {
+	return map[string]any{
+		"depth":           i.options.depth,
+		"breakLength":     i.options.breakLength,
+		"maxArrayLength":  i.options.maxArrayLength,
+		"maxStringLength": i.options.maxStringLength,
+		"sorted":          i.options.sorted,
+	}
+}
+
+func (i *inspector) key(key string) string {
+	if identifierRe.MatchString(key) {
+		return key
+	}
+	return i.quote(key)
+}
+
+// quote quotes s with single quotes, or with double quotes or backticks if
+// that avoids escaping.
+func (i *inspector) quote(s string) string {
+	more := ""
+	if i.options.maxStringLength >= 0 {
+		if runes := []rune(s); len(runes) > i.options.maxStringLength {
+			more = fmt.Sprintf("... %d more characters", len(runes)-i.options.maxStringLength)
+			s = string(runes[:i.options.maxStringLength])
+		}
+	}
+
+	quote := '\''
+	if strings.ContainsRune(s, '\'') {
+		if !strings.ContainsRune(s, '"') {
+			quote = '"'
+		} else if !strings.ContainsRune(s, '`') && !strings.Contains(s, "${") {
+			quote = '`'
+		}
+	}
+
+	var b strings.Builder
+	b.WriteRune(quote)
+	for _, r := range s {
+		switch {
+		case r == quote || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\b':
+			b.WriteString(`\b`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '\v':
+			b.WriteString(`\v`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteRune(quote)
+
+	return b.String() + more
+}
+
+// formatNumber formats a number as JavaScript does, except that -0 is
+// formatted as -0.
+func formatNumber(ctx context.Context, value *isolates.Value) (string, error) {
+	if f, err := value.Float64(ctx); err != nil {
+		return "", err
+	} else if f == 0 && math.Signbit(f) {
+		return "-0", nil
+	} else {
+		return value.String(), nil
+	}
+}
+
+// formatArgs implements util.format: %s, %d, %i, %f, %j, %o, %O and %c in a
+// leading string are replaced by the arguments after it, and the remaining
+// arguments are appended separated by spaces.
+func (i *inspector) formatArgs(args []*isolates.Value) (string, error) {
+	var b strings.Builder
+	rest := args
+
+	if len(args) > 0 && args[0].IsKind(isolates.KindString) {
+		f, err := args[0].StringValue(i.ctx)
+		if err != nil {
+			return "", err
+		}
+		rest = args[1:]
+
+		for j := 0; j < len(f); j++ {
+			if f[j] != '%' || j+1 == len(f) {
+				b.WriteByte(f[j])
+				continue
+			}
+
+			verb := f[j+1]
+			if verb == '%' {
+				b.WriteByte('%')
+				j++
+				continue
+			} else if !strings.ContainsRune("sdifjoOc", rune(verb)) || len(rest) == 0 {
+				b.WriteByte(f[j])
+				continue
+			}
+
+			arg := rest[0]
+			rest = rest[1:]
+			j++
+
+			if s, err := i.formatVerb(verb, arg); err != nil {
+				return "", err
+			} else {
+				b.WriteString(s)
+			}
+		}
+	}
+
+	for j, arg := range rest {
+		if j > 0 || b.Len() > 0 || len(rest) < len(args) {
+			b.WriteByte(' ')
+		}
+
+		if arg.IsKind(isolates.KindString) {
+			if s, err := arg.StringValue(i.ctx); err != nil {
+				return "", err
+			} else {
+				b.WriteString(s)
+			}
+		} else if s, err := i.inspect(arg, 0); err != nil {
+			return "", err
+		} else {
+			b.WriteString(s)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func (i *inspector) formatVerb(verb byte, arg *isolates.Value) (string, error) {
+	switch verb {
+	case 's':
+		switch {
+		case arg.IsKind(isolates.KindString):
+			return arg.StringValue(i.ctx)
+		case arg.IsKind(isolates.KindBigInt):
+			return arg.String() + "n", nil
+		case arg.IsKind(isolates.KindNumber):
+			return formatNumber(i.ctx, arg)
+		case arg.IsKind(isolates.KindObject) && !arg.IsKind(isolates.KindFunction):
+			depth := i.options.depth
+			i.options.depth = 0
+			defer func() { i.options.depth = depth }()
+			return i.inspect(arg, 0)
+		default:
+			return i.string(arg)
+		}
+	case 'd', 'i', 'f':
+		if arg.IsKind(isolates.KindBigInt) {
+			return arg.String() + "n", nil
+		} else if arg.IsKind(isolates.KindSymbol) {
+			return "NaN", nil
+		}
+
+		f, err := arg.Float64(i.ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if verb == 'f' {
+			// parseFloat rather than Number, so that "1.5px" formats as 1.5
+			if s, err := i.string(arg); err != nil {
+				return "", err
+			} else {
+				f = parseFloatPrefix(s)
+			}
+		} else if verb == 'i' {
+			if s, err := i.string(arg); err != nil {
+				return "", err
+			} else {
+				f = math.Trunc(parseFloatPrefix(s))
+			}
+		}
+
+		if f == 0 && math.Signbit(f) {
+			return "-0", nil
+		} else if math.IsNaN(f) {
+			return "NaN", nil
+		} else if math.IsInf(f, 0) {
+			if f > 0 {
+				return "Infinity", nil
+			}
+			return "-Infinity", nil
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case 'j':
+		if json, err := arg.MarshalJSON(i.ctx); err != nil {
+			if strings.Contains(err.Error(), "circular") {
+				return "[Circular]", nil
+			}
+			return "", err
+		} else {
+			return string(json), nil
+		}
+	case 'o':
+		depth := i.options.depth
+		i.options.depth = 4
+		defer func() { i.options.depth = depth }()
+		return i.inspect(arg, 0)
+	case 'O':
+		return i.inspect(arg, 0)
+	default:
+		// %c is CSS for browser consoles, and is skipped
+		return "", nil
+	}
+}
+
+var floatPrefixRe = regexp.MustCompile(`^[+-]?(Infinity|\d+\.?\d*(e[+-]?\d+)?|\.\d+(e[+-]?\d+)?)`)
+
+// parseFloatPrefix parses the number at the start of s, as parseFloat does.
+func parseFloatPrefix(s string) float64 {
+	s = strings.TrimSpace(s)
+	if m := floatPrefixRe.FindString(s); m == "" {
+		return math.NaN()
+	} else if strings.HasSuffix(m, "Infinity") {
+		if strings.HasPrefix(m, "-") {
+			return math.Inf(-1)
+		}
+		return math.Inf(1)
+	} else {
+		f, _ := strconv.ParseFloat(m, 64)
+		return f
+	}
+}
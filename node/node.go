@@ -0,0 +1,110 @@
+// Package node provides Node.js core modules for scripts run with
+// isolates.Context.RunWithRuntime. Importing it registers the path, events,
+// util, buffer, os and url runtimes, which scripts can then require:
+//
+//	import _ "github.com/grexie/isolates/node"
+//
+// Modules can still be denied per script with RunWithRuntime's security map.
+// Nothing is installed as a global, so scripts that expect Node's globals can
+// have them set up in RunWithRuntime's env function:
+//
+//	func(in isolates.RuntimeFunctionArgs) error {
+//		if buffer, err := in.Require.Call(in.ExecutionContext, nil, "buffer"); err != nil {
+//			return err
+//		} else if Buffer, err := buffer.Get(in.ExecutionContext, "Buffer"); err != nil {
+//			return err
+//		} else {
+//			return in.This.SetValue(in.ExecutionContext, "Buffer", Buffer)
+//		}
+//	}
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grexie/isolates"
+)
+
+// export is a property of a module's exports.
+type export struct {
+	name  string
+	value any
+}
+
+// setExports sets the properties of the exports object passed to a runtime
+// factory, in order.
+func setExports(in isolates.FunctionArgs, exports ...export) error {
+	for _, e := range exports {
+		if err := in.Args[1].Set(in.ExecutionContext, e.name, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newObject returns a plain object with properties, in order.
+func newObject(ctx context.Context, c *isolates.Context, properties ...export) (*isolates.Value, error) {
+	if o, err := c.NewObject(ctx); err != nil {
+		return nil, err
+	} else {
+		for _, p := range properties {
+			if err := o.Set(ctx, p.name, p.value); err != nil {
+				return nil, err
+			}
+		}
+		return o, nil
+	}
+}
+
+// setModuleExports replaces module.exports in a runtime factory.
+func setModuleExports(in isolates.FunctionArgs, exports *isolates.Value) error {
+	return in.Args[0].SetValue(in.ExecutionContext, "exports", exports)
+}
+
+// runBootstrap runs the embedded source of a module, which evaluates to a
+// function, and calls it with args implemented in Go.
+func runBootstrap(ctx context.Context, c *isolates.Context, name string, source string, args ...any) (*isolates.Value, error) {
+	if bootstrap, err := c.Run(ctx, source, "node:"+name, nil); err != nil {
+		return nil, err
+	} else {
+		return bootstrap.Call(ctx, nil, args...)
+	}
+}
+
+// stringArg returns argument i of a function that takes a string, throwing a
+// TypeError like Node does for anything else.
+func stringArg(in isolates.FunctionArgs, i int, name string) (string, error) {
+	if arg := in.Arg(in.ExecutionContext, i); !arg.IsKind(isolates.KindString) {
+		return "", typeError(in, "The %q argument must be of type string", name)
+	} else {
+		return arg.StringValue(in.ExecutionContext)
+	}
+}
+
+// typeError returns a TypeError to throw from a function.
+func typeError(in isolates.FunctionArgs, format string, args ...any) error {
+	if global, err := in.Context.Global(in.ExecutionContext); err != nil {
+		return err
+	} else if TypeError, err := global.Get(in.ExecutionContext, "TypeError"); err != nil {
+		return err
+	} else if e, err := TypeError.New(in.ExecutionContext, fmt.Sprintf(format, args...)); err != nil {
+		return err
+	} else {
+		return e
+	}
+}
+
+// isNullish reports whether v is undefined or null.
+func isNullish(v *isolates.Value) bool {
+	return v == nil || v.IsKind(isolates.KindUndefined) || v.IsKind(isolates.KindNull)
+}
+
+// global returns the property name of the global object.
+func global(ctx context.Context, c *isolates.Context, name string) (*isolates.Value, error) {
+	if global, err := c.Global(ctx); err != nil {
+		return nil, err
+	} else {
+		return global.Get(ctx, name)
+	}
+}
@@ -0,0 +1,189 @@
+package node
+
+import (
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+
+	"github.com/grexie/isolates"
+)
+
+// Host is what the os module reports about the machine and the user scripts
+// run as.
+type Host struct {
+	Hostname string
+	HomeDir  string
+	Username string
+	UID, GID int
+
+	// Shell is reported as null when empty.
+	Shell string
+}
+
+// OSHost is reported by the os module. Scripts are sandboxed, so it defaults
+// to neutral values rather than the host's; set it to CurrentHost() to report
+// the machine and user the process runs as.
+var OSHost = Host{
+	Hostname: "localhost",
+	HomeDir:  "/",
+	Username: "nobody",
+	UID:      -1,
+	GID:      -1,
+}
+
+// CurrentHost returns the machine and user the process runs as.
+func CurrentHost() Host {
+	h := Host{UID: os.Getuid(), GID: os.Getgid(), Shell: os.Getenv("SHELL")}
+	h.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		h.Username, h.HomeDir = u.Username, u.HomeDir
+	} else {
+		h.HomeDir, _ = os.UserHomeDir()
+	}
+	return h
+}
+
+var _ = isolates.RegisterRuntime("os", "os", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+	eol, devNull := "\n", "/dev/null"
+	if runtime.GOOS == "windows" {
+		eol, devNull = "\r\n", `\\.\nul`
+	}
+
+	if err := setExports(in,
+		export{"EOL", eol},
+		export{"devNull", devNull},
+		export{"arch", constant(osArch())},
+		export{"platform", constant(osPlatform())},
+		export{"type", constant(osType())},
+		export{"release", constant(osRelease())},
+		export{"machine", constant(osMachine())},
+		export{"endianness", constant("LE")},
+		export{"hostname", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+			return in.Context.Create(in.ExecutionContext, OSHost.Hostname)
+		}},
+		export{"homedir", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+			return in.Context.Create(in.ExecutionContext, OSHost.HomeDir)
+		}},
+		export{"tmpdir", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+			return in.Context.Create(in.ExecutionContext, strings.TrimSuffix(os.TempDir(), "/"))
+		}},
+		export{"availableParallelism", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+			return in.Context.Create(in.ExecutionContext, runtime.NumCPU())
+		}},
+		export{"cpus", osCPUs},
+		export{"loadavg", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+			return in.Context.Create(in.ExecutionContext, []float64{0, 0, 0})
+		}},
+		export{"userInfo", osUserInfo},
+	); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+})
+
+// constant returns a function that returns v.
+func constant(v any) isolates.Function {
+	return func(in isolates.FunctionArgs) (*isolates.Value, error) {
+		return in.Context.Create(in.ExecutionContext, v)
+	}
+}
+
+func osArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x64"
+	case "386":
+		return "ia32"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+func osPlatform() string {
+	if runtime.GOOS == "windows" {
+		return "win32"
+	}
+	return runtime.GOOS
+}
+
+func osType() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "Linux"
+	case "darwin":
+		return "Darwin"
+	case "windows":
+		return "Windows_NT"
+	default:
+		return strings.ToUpper(runtime.GOOS[:1]) + runtime.GOOS[1:]
+	}
+}
+
+// osRelease returns the kernel release where it can be read without cgo or
+// running uname, and "" otherwise.
+func osRelease() string {
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		return strings.TrimSpace(string(release))
+	}
+	return ""
+}
+
+func osMachine() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "arm64"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+// osCPUs returns an element for each CPU. The model and speed aren't
+// available, and the times are zero.
+func osCPUs(in isolates.FunctionArgs) (*isolates.Value, error) {
+	cpus := make([]*isolates.Value, runtime.NumCPU())
+	for i := range cpus {
+		if times, err := newObject(in.ExecutionContext, in.Context,
+			export{"user", 0},
+			export{"nice", 0},
+			export{"sys", 0},
+			export{"idle", 0},
+			export{"irq", 0},
+		); err != nil {
+			return nil, err
+		} else if cpus[i], err = newObject(in.ExecutionContext, in.Context,
+			export{"model", "unknown"},
+			export{"speed", 0},
+			export{"times", times},
+		); err != nil {
+			return nil, err
+		}
+	}
+	return in.Context.Create(in.ExecutionContext, cpus)
+}
+
+func osUserInfo(in isolates.FunctionArgs) (*isolates.Value, error) {
+	host := OSHost
+
+	var shell any
+	if host.Shell != "" {
+		shell = host.Shell
+	} else if null, err := in.Context.Null(in.ExecutionContext); err != nil {
+		return nil, err
+	} else {
+		shell = null
+	}
+
+	return newObject(in.ExecutionContext, in.Context,
+		export{"uid", host.UID},
+		export{"gid", host.GID},
+		export{"username", host.Username},
+		export{"homedir", host.HomeDir},
+		export{"shell", shell},
+	)
+}
@@ -0,0 +1,249 @@
+package node
+
+import (
+	_path "path"
+	"strings"
+
+	"github.com/grexie/isolates"
+)
+
+var _ = isolates.RegisterRuntime("path", "path", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if err := setExports(in,
+		export{"sep", "/"},
+		export{"delimiter", ":"},
+		export{"normalize", pathFunction(1, func(paths []string) any { return normalize(paths[0]) })},
+		export{"join", pathFunction(-1, func(paths []string) any { return join(paths...) })},
+		export{"resolve", pathFunction(-1, func(paths []string) any { return resolve(paths...) })},
+		export{"relative", pathFunction(2, func(paths []string) any { return relative(paths[0], paths[1]) })},
+		export{"isAbsolute", pathFunction(1, func(paths []string) any { return strings.HasPrefix(paths[0], "/") })},
+		export{"dirname", pathFunction(1, func(paths []string) any { return dirname(paths[0]) })},
+		export{"basename", basenameFunction},
+		export{"extname", pathFunction(1, func(paths []string) any { return extname(paths[0]) })},
+		export{"parse", pathFunction(1, func(paths []string) any { return parsePath(paths[0]) })},
+		export{"format", formatPath},
+		export{"toNamespacedPath", pathFunction(1, func(paths []string) any { return paths[0] })},
+	); err != nil {
+		return nil, err
+	} else if err := in.Args[1].SetValue(in.ExecutionContext, "posix", in.Args[1]); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+})
+
+// pathFunction adapts fn to a function taking n string arguments, or any
+// number of them if n is negative.
+func pathFunction(n int, fn func(paths []string) any) isolates.Function {
+	return func(in isolates.FunctionArgs) (*isolates.Value, error) {
+		count := n
+		if count < 0 {
+			count = len(in.Args)
+		}
+
+		paths := make([]string, count)
+		for i := range paths {
+			if path, err := stringArg(in, i, "path"); err != nil {
+				return nil, err
+			} else {
+				paths[i] = path
+			}
+		}
+
+		return in.Context.Create(in.ExecutionContext, fn(paths))
+	}
+}
+
+func basenameFunction(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if path, err := stringArg(in, 0, "path"); err != nil {
+		return nil, err
+	} else if ext := in.Arg(in.ExecutionContext, 1); ext.IsKind(isolates.KindUndefined) {
+		return in.Context.Create(in.ExecutionContext, basename(path, ""))
+	} else if ext, err := stringArg(in, 1, "ext"); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, basename(path, ext))
+	}
+}
+
+func formatPath(in isolates.FunctionArgs) (*isolates.Value, error) {
+	object := in.Arg(in.ExecutionContext, 0)
+	if !object.IsKind(isolates.KindObject) {
+		return nil, typeError(in, "The \"pathObject\" argument must be of type object")
+	}
+
+	fields := map[string]string{}
+	for _, name := range []string{"root", "dir", "base", "name", "ext"} {
+		if value, err := object.Get(in.ExecutionContext, name); err != nil {
+			return nil, err
+		} else if !isNullish(value) {
+			if fields[name], err = value.StringValue(in.ExecutionContext); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return in.Context.Create(in.ExecutionContext, formatPathObject(fields))
+}
+
+// normalize resolves . and .. segments and repeated slashes like
+// path.Clean, but keeps a trailing slash as Node does.
+func normalize(path string) string {
+	if path == "" {
+		return "."
+	}
+
+	clean := _path.Clean(path)
+	if clean == "/" || !strings.HasSuffix(path, "/") {
+		return clean
+	} else if clean == "." {
+		return "./"
+	} else {
+		return clean + "/"
+	}
+}
+
+func join(paths ...string) string {
+	parts := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path != "" {
+			parts = append(parts, path)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "."
+	}
+	return normalize(strings.Join(parts, "/"))
+}
+
+// resolve joins paths from right to left until an absolute path is formed.
+// Scripts have no working directory, so relative paths resolve from "/".
+func resolve(paths ...string) string {
+	resolved := ""
+	for i := len(paths) - 1; i >= 0 && !strings.HasPrefix(resolved, "/"); i-- {
+		if paths[i] != "" {
+			resolved = paths[i] + "/" + resolved
+		}
+	}
+
+	return _path.Clean("/" + resolved)
+}
+
+func relative(from string, to string) string {
+	from, to = resolve(from), resolve(to)
+	if from == to {
+		return ""
+	}
+
+	fromParts := strings.Split(strings.TrimPrefix(from, "/"), "/")
+	toParts := strings.Split(strings.TrimPrefix(to, "/"), "/")
+	if from == "/" {
+		fromParts = nil
+	}
+	if to == "/" {
+		toParts = nil
+	}
+
+	common := 0
+	for common < len(fromParts) && common < len(toParts) && fromParts[common] == toParts[common] {
+		common++
+	}
+
+	parts := make([]string, 0, len(fromParts)-common+len(toParts)-common)
+	for range fromParts[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, toParts[common:]...)
+
+	return strings.Join(parts, "/")
+}
+
+// dirname returns path up to its last segment, ignoring trailing slashes.
+func dirname(path string) string {
+	if path == "" {
+		return "."
+	}
+
+	trimmed := strings.TrimRight(path, "/")
+	if trimmed == "" {
+		return "/"
+	}
+
+	if i := strings.LastIndex(trimmed, "/"); i < 0 {
+		return "."
+	} else if dir := strings.TrimRight(trimmed[:i], "/"); dir == "" {
+		return "/"
+	} else {
+		return dir
+	}
+}
+
+func basename(path string, ext string) string {
+	base := strings.TrimRight(path, "/")
+	base = base[strings.LastIndex(base, "/")+1:]
+
+	if ext != "" && base != ext && strings.HasSuffix(base, ext) {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+// extname returns the extension of the last segment of path, from its last
+// dot. Segments starting with their only dot, such as .bashrc, have none.
+func extname(path string) string {
+	base := basename(path, "")
+	if i := strings.LastIndex(base, "."); i <= 0 || base == ".." {
+		return ""
+	} else {
+		return base[i:]
+	}
+}
+
+func parsePath(path string) map[string]string {
+	result := map[string]string{"root": "", "dir": "", "base": "", "ext": "", "name": ""}
+	if path == "" {
+		return result
+	}
+
+	if strings.HasPrefix(path, "/") {
+		result["root"] = "/"
+	}
+
+	trimmed := strings.TrimRight(path, "/")
+	if i := strings.LastIndex(trimmed, "/"); i == 0 || (trimmed == "" && result["root"] == "/") {
+		result["dir"] = "/"
+	} else if i > 0 {
+		result["dir"] = trimmed[:i]
+	}
+
+	result["base"] = basename(path, "")
+	result["ext"] = extname(path)
+	result["name"] = strings.TrimSuffix(result["base"], result["ext"])
+
+	return result
+}
+
+func formatPathObject(fields map[string]string) string {
+	dir := fields["dir"]
+	if dir == "" {
+		dir = fields["root"]
+	}
+
+	base := fields["base"]
+	if base == "" {
+		base = fields["name"]
+		if ext := fields["ext"]; ext != "" && !strings.HasPrefix(ext, ".") {
+			base += "." + ext
+		} else {
+			base += ext
+		}
+	}
+
+	if dir == "" {
+		return base
+	} else if dir == fields["root"] {
+		return dir + base
+	} else {
+		return dir + "/" + base
+	}
+}
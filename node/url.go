@@ -0,0 +1,471 @@
+package node
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/grexie/isolates"
+	"github.com/grexie/isolates/webapis"
+)
+
+// The url module's URL and URLSearchParams, and fileURLToPath and
+// pathToFileURL which use them, are the WHATWG implementation of the webapis
+// package. The legacy url.parse, url.format and url.resolve are built on
+// net/url, as like Node's legacy parser they predate the WHATWG URL Standard.
+var _ = isolates.RegisterRuntime("url", "url", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+	URL, URLSearchParams, err := urlClasses(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setExports(in,
+		export{"URL", URL},
+		export{"URLSearchParams", URLSearchParams},
+		export{"parse", urlParse},
+		export{"format", urlFormat},
+		export{"resolve", urlResolve},
+		export{"fileURLToPath", fileURLToPath(URL)},
+		export{"pathToFileURL", pathToFileURL(URL)},
+	); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+})
+
+// urlClasses returns the URL and URLSearchParams globals, such as when the
+// webapis package is installed, so that instanceof works across them, and
+// otherwise creates them for the module.
+func urlClasses(in isolates.FunctionArgs) (*isolates.Value, *isolates.Value, error) {
+	apis, err := in.Context.Global(in.ExecutionContext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if URL, err := apis.Get(in.ExecutionContext, "URL"); err != nil {
+		return nil, nil, err
+	} else if !URL.IsKind(isolates.KindFunction) {
+		if apis, err = webapis.New(in.ExecutionContext, in.Context); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if URL, err := apis.Get(in.ExecutionContext, "URL"); err != nil {
+		return nil, nil, err
+	} else if URLSearchParams, err := apis.Get(in.ExecutionContext, "URLSearchParams"); err != nil {
+		return nil, nil, err
+	} else {
+		return URL, URLSearchParams, nil
+	}
+}
+
+// slashedProtocols are the protocols that url.format writes with "//".
+var slashedProtocols = map[string]bool{
+	"http:":   true,
+	"https:":  true,
+	"ftp:":    true,
+	"gopher:": true,
+	"file:":   true,
+	"ws:":     true,
+	"wss:":    true,
+}
+
+// legacyURL is the result of the legacy url.parse, with nil for the
+// components that are missing.
+type legacyURL struct {
+	protocol, auth, host, port, hostname, hash, search, pathname *string
+	slashes                                                      bool
+	query                                                        url.Values
+}
+
+func optional(s string, ok bool) *string {
+	if !ok {
+		return nil
+	}
+	return &s
+}
+
+func parseLegacyURL(s string) (*legacyURL, error) {
+	s = strings.TrimSpace(s)
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// like url.parse without slashesDenoteHost, "//foo/bar" is a path
+	if u.Scheme == "" && u.Host != "" {
+		if u, err = url.Parse("scheme://host" + s); err != nil {
+			return nil, err
+		}
+		u.Scheme, u.Host = "", ""
+	}
+
+	l := &legacyURL{query: u.Query()}
+	rest := s
+	if u.Scheme != "" {
+		l.protocol = optional(strings.ToLower(u.Scheme)+":", true)
+		rest = s[len(u.Scheme)+1:]
+	}
+	l.slashes = u.Scheme != "" && strings.HasPrefix(rest, "//")
+
+	if u.User != nil {
+		auth, _ := url.PathUnescape(u.User.String())
+		l.auth = &auth
+	}
+	if u.Host != "" {
+		l.host = optional(strings.ToLower(u.Host), true)
+		l.hostname = optional(strings.ToLower(u.Hostname()), true)
+		l.port = optional(u.Port(), u.Port() != "")
+	}
+
+	l.hash = optional("#"+u.EscapedFragment(), strings.Contains(s, "#"))
+	l.search = optional("?"+u.RawQuery, u.ForceQuery || u.RawQuery != "")
+
+	if u.Opaque != "" {
+		l.pathname = &u.Opaque
+	} else if path := u.EscapedPath(); path != "" {
+		l.pathname = &path
+	} else if l.slashes && slashedProtocols[u.Scheme+":"] {
+		l.pathname = optional("/", true)
+	}
+
+	return l, nil
+}
+
+func (l *legacyURL) path() *string {
+	if l.pathname == nil && l.search == nil {
+		return nil
+	}
+	return optional(deref(l.pathname)+deref(l.search), true)
+}
+
+func (l *legacyURL) href() string {
+	return formatLegacyURL(l)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// formatLegacyURL formats the components of a legacy URL object as
+// url.format does, preferring host to hostname and port, and search to
+// query.
+func formatLegacyURL(l *legacyURL) string {
+	var b strings.Builder
+
+	protocol := deref(l.protocol)
+	if protocol != "" && !strings.HasSuffix(protocol, ":") {
+		protocol += ":"
+	}
+	b.WriteString(protocol)
+
+	host := deref(l.host)
+	if host == "" && l.hostname != nil {
+		host = *l.hostname
+		if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+			host = "[" + host + "]"
+		}
+		if port := deref(l.port); port != "" {
+			host += ":" + port
+		}
+	}
+
+	pathname := deref(l.pathname)
+	if l.slashes || (slashedProtocols[protocol] && (host != "" || protocol == "file:")) {
+		b.WriteString("//")
+		if pathname != "" && !strings.HasPrefix(pathname, "/") {
+			pathname = "/" + pathname
+		}
+	}
+
+	if auth := deref(l.auth); auth != "" {
+		b.WriteString(strings.ReplaceAll(url.QueryEscape(auth), "%3A", ":"))
+		b.WriteString("@")
+	}
+	b.WriteString(host)
+
+	b.WriteString(strings.NewReplacer("?", "%3F", "#", "%23").Replace(pathname))
+
+	if search := deref(l.search); search != "" {
+		if !strings.HasPrefix(search, "?") {
+			search = "?" + search
+		}
+		b.WriteString(search)
+	} else if len(l.query) > 0 {
+		b.WriteString("?" + l.query.Encode())
+	}
+
+	if hash := deref(l.hash); hash != "" {
+		if !strings.HasPrefix(hash, "#") {
+			hash = "#" + hash
+		}
+		b.WriteString(hash)
+	}
+
+	return b.String()
+}
+
+func urlParse(in isolates.FunctionArgs) (*isolates.Value, error) {
+	s, err := stringArg(in, 0, "url")
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := parseLegacyURL(s)
+	if err != nil {
+		return nil, typeError(in, "Invalid URL: %s", s)
+	}
+
+	null, err := in.Context.Null(in.ExecutionContext)
+	if err != nil {
+		return nil, err
+	}
+	nullable := func(s *string) any {
+		if s == nil {
+			return null
+		}
+		return *s
+	}
+
+	var query any = nullable(optional(strings.TrimPrefix(deref(l.search), "?"), l.search != nil))
+	if parseQueryString, err := in.Arg(in.ExecutionContext, 1).Bool(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if parseQueryString {
+		if query, err = newQueryObject(in, l.query); err != nil {
+			return nil, err
+		}
+	}
+
+	return newObject(in.ExecutionContext, in.Context,
+		export{"protocol", nullable(l.protocol)},
+		export{"slashes", l.slashes},
+		export{"auth", nullable(l.auth)},
+		export{"host", nullable(l.host)},
+		export{"port", nullable(l.port)},
+		export{"hostname", nullable(l.hostname)},
+		export{"hash", nullable(l.hash)},
+		export{"search", nullable(l.search)},
+		export{"query", query},
+		export{"pathname", nullable(l.pathname)},
+		export{"path", nullable(l.path())},
+		export{"href", l.href()},
+	)
+}
+
+// newQueryObject returns query as querystring.parse does, with a string for
+// each key with one value and an array for each key with several.
+func newQueryObject(in isolates.FunctionArgs, query url.Values) (*isolates.Value, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	properties := make([]export, len(keys))
+	for i, key := range keys {
+		if values := query[key]; len(values) == 1 {
+			properties[i] = export{key, values[0]}
+		} else {
+			properties[i] = export{key, values}
+		}
+	}
+
+	return newObject(in.ExecutionContext, in.Context, properties...)
+}
+
+func urlFormat(in isolates.FunctionArgs) (*isolates.Value, error) {
+	arg := in.Arg(in.ExecutionContext, 0)
+
+	if arg.IsKind(isolates.KindString) {
+		if s, err := arg.StringValue(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if l, err := parseLegacyURL(s); err != nil {
+			return nil, typeError(in, "Invalid URL: %s", s)
+		} else {
+			return in.Context.Create(in.ExecutionContext, l.href())
+		}
+	} else if !arg.IsKind(isolates.KindObject) {
+		return nil, typeError(in, "The \"urlObject\" argument must be one of type object or string")
+	}
+
+	// WHATWG URL objects are formatted by their href
+	if searchParams, err := arg.Get(in.ExecutionContext, "searchParams"); err != nil {
+		return nil, err
+	} else if !isNullish(searchParams) {
+		return arg.Get(in.ExecutionContext, "href")
+	}
+
+	l := &legacyURL{}
+	for name, field := range map[string]**string{
+		"protocol": &l.protocol,
+		"auth":     &l.auth,
+		"host":     &l.host,
+		"port":     &l.port,
+		"hostname": &l.hostname,
+		"hash":     &l.hash,
+		"search":   &l.search,
+		"pathname": &l.pathname,
+	} {
+		if value, err := arg.Get(in.ExecutionContext, name); err != nil {
+			return nil, err
+		} else if !isNullish(value) {
+			if s, err := value.StringValue(in.ExecutionContext); err != nil {
+				return nil, err
+			} else {
+				*field = &s
+			}
+		}
+	}
+
+	if slashes, err := arg.Get(in.ExecutionContext, "slashes"); err != nil {
+		return nil, err
+	} else if l.slashes, err = slashes.Bool(in.ExecutionContext); err != nil {
+		return nil, err
+	}
+
+	if query, err := arg.Get(in.ExecutionContext, "query"); err != nil {
+		return nil, err
+	} else if query.IsKind(isolates.KindString) {
+		if s, err := query.StringValue(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if l.search == nil && s != "" {
+			l.search = &s
+		}
+	} else if query.IsKind(isolates.KindObject) {
+		if err := readQueryObject(in, query, l); err != nil {
+			return nil, err
+		}
+	}
+
+	return in.Context.Create(in.ExecutionContext, formatLegacyURL(l))
+}
+
+func readQueryObject(in isolates.FunctionArgs, query *isolates.Value, l *legacyURL) error {
+	keys, err := query.Keys(in.ExecutionContext)
+	if err != nil {
+		return err
+	}
+
+	l.query = url.Values{}
+	for _, key := range keys {
+		value, err := query.Get(in.ExecutionContext, key)
+		if err != nil {
+			return err
+		}
+
+		if !value.IsKind(isolates.KindArray) {
+			if s, err := value.StringValue(in.ExecutionContext); err != nil {
+				return err
+			} else {
+				l.query.Add(key, s)
+			}
+			continue
+		}
+
+		length, err := value.GetLength(in.ExecutionContext)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(length); i++ {
+			if element, err := value.GetIndex(in.ExecutionContext, i); err != nil {
+				return err
+			} else if s, err := element.StringValue(in.ExecutionContext); err != nil {
+				return err
+			} else {
+				l.query.Add(key, s)
+			}
+		}
+	}
+
+	return nil
+}
+
+func urlResolve(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if from, err := stringArg(in, 0, "from"); err != nil {
+		return nil, err
+	} else if to, err := stringArg(in, 1, "to"); err != nil {
+		return nil, err
+	} else if base, err := url.Parse(from); err != nil {
+		return nil, typeError(in, "Invalid URL: %s", from)
+	} else if ref, err := url.Parse(to); err != nil {
+		return nil, typeError(in, "Invalid URL: %s", to)
+	} else {
+		return in.Context.Create(in.ExecutionContext, base.ResolveReference(ref).String())
+	}
+}
+
+// urlArg returns argument i, which is either a string or a URL object, as a
+// URL object.
+func urlArg(in isolates.FunctionArgs, URL *isolates.Value, i int) (*isolates.Value, error) {
+	if arg := in.Arg(in.ExecutionContext, i); arg.IsKind(isolates.KindString) {
+		return URL.New(in.ExecutionContext, arg)
+	} else if !arg.IsKind(isolates.KindObject) {
+		return nil, typeError(in, "The \"path\" argument must be of type string or an instance of URL")
+	} else if href, err := arg.Get(in.ExecutionContext, "href"); err != nil {
+		return nil, err
+	} else {
+		return URL.New(in.ExecutionContext, href)
+	}
+}
+
+func fileURLToPath(URL *isolates.Value) isolates.Function {
+	return func(in isolates.FunctionArgs) (*isolates.Value, error) {
+		ctx := in.ExecutionContext
+
+		u, err := urlArg(in, URL, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		components := map[string]string{}
+		for _, name := range []string{"protocol", "hostname", "pathname"} {
+			if value, err := u.Get(ctx, name); err != nil {
+				return nil, err
+			} else if components[name], err = value.StringValue(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		if components["protocol"] != "file:" {
+			return nil, typeError(in, "The URL must be of scheme file")
+		} else if components["hostname"] != "" {
+			return nil, typeError(in, "File URL host must be \"localhost\" or empty on %s", osPlatform())
+		} else if strings.Contains(strings.ToLower(components["pathname"]), "%2f") {
+			return nil, typeError(in, "File URL path must not include encoded / characters")
+		} else if path, err := url.PathUnescape(components["pathname"]); err != nil {
+			return nil, typeError(in, "Invalid URL: %s", components["pathname"])
+		} else {
+			return in.Context.Create(ctx, path)
+		}
+	}
+}
+
+// pathEncoder encodes the characters of a path that the URL parser would
+// otherwise remove or treat as escapes, as Node does.
+var pathEncoder = strings.NewReplacer("%", "%25", "\\", "%5C", "\n", "%0A", "\r", "%0D", "\t", "%09")
+
+func pathToFileURL(URL *isolates.Value) isolates.Function {
+	return func(in isolates.FunctionArgs) (*isolates.Value, error) {
+		path, err := stringArg(in, 0, "path")
+		if err != nil {
+			return nil, err
+		}
+
+		resolved := resolve(path)
+		if strings.HasSuffix(path, "/") && resolved != "/" {
+			resolved += "/"
+		}
+
+		if u, err := URL.New(in.ExecutionContext, "file://"); err != nil {
+			return nil, err
+		} else if err := u.Set(in.ExecutionContext, "pathname", pathEncoder.Replace(resolved)); err != nil {
+			return nil, err
+		} else {
+			return u, nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package node
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/grexie/isolates"
+)
+
+//go:embed util.js
+var utilSource string
+
+var _ = isolates.RegisterRuntime("util", "util", func(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if types, err := newTypes(in.ExecutionContext, in.Context); err != nil {
+		return nil, err
+	} else if util, err := runBootstrap(in.ExecutionContext, in.Context, "util", utilSource, formatFunction, inspectFunction, types); err != nil {
+		return nil, err
+	} else if err := setModuleExports(in, util); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+})
+
+// formatFunction is called by util.js as format(helpers, options, ...args).
+func formatFunction(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if len(in.Args) < 2 {
+		return in.Context.Create(in.ExecutionContext, "")
+	} else if i, err := newInspector(in.ExecutionContext, in.Args[0], in.Args[1]); err != nil {
+		return nil, err
+	} else if s, err := i.formatArgs(in.Args[2:]); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, s)
+	}
+}
+
+// inspectFunction is called by util.js as inspect(helpers, value, options).
+func inspectFunction(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if i, err := newInspector(in.ExecutionContext, in.Arg(in.ExecutionContext, 0), in.Arg(in.ExecutionContext, 2)); err != nil {
+		return nil, err
+	} else if s, err := i.inspect(in.Arg(in.ExecutionContext, 1), 0); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, s)
+	}
+}
+
+// typeChecks are the functions of util.types, and the kinds they check for.
+var typeChecks = []struct {
+	name  string
+	kinds []isolates.Kind
+}{
+	{"isAnyArrayBuffer", []isolates.Kind{isolates.KindArrayBuffer, isolates.KindSharedArrayBuffer}},
+	{"isArgumentsObject", []isolates.Kind{isolates.KindArgumentsObject}},
+	{"isArrayBuffer", []isolates.Kind{isolates.KindArrayBuffer}},
+	{"isArrayBufferView", []isolates.Kind{isolates.KindArrayBufferView}},
+	{"isAsyncFunction", []isolates.Kind{isolates.KindAsyncFunction}},
+	{"isBigInt64Array", []isolates.Kind{isolates.KindBigInt64Array}},
+	{"isBigUint64Array", []isolates.Kind{isolates.KindBigUint64Array}},
+	{"isBooleanObject", []isolates.Kind{isolates.KindBooleanObject}},
+	{"isBoxedPrimitive", []isolates.Kind{isolates.KindBooleanObject, isolates.KindNumberObject, isolates.KindStringObject, isolates.KindSymbolObject}},
+	{"isDataView", []isolates.Kind{isolates.KindDataView}},
+	{"isDate", []isolates.Kind{isolates.KindDate}},
+	{"isExternal", []isolates.Kind{isolates.KindExternal}},
+	{"isFloat32Array", []isolates.Kind{isolates.KindFloat32Array}},
+	{"isFloat64Array", []isolates.Kind{isolates.KindFloat64Array}},
+	{"isGeneratorFunction", []isolates.Kind{isolates.KindGeneratorFunction}},
+	{"isGeneratorObject", []isolates.Kind{isolates.KindGeneratorObject}},
+	{"isInt8Array", []isolates.Kind{isolates.KindInt8Array}},
+	{"isInt16Array", []isolates.Kind{isolates.KindInt16Array}},
+	{"isInt32Array", []isolates.Kind{isolates.KindInt32Array}},
+	{"isMap", []isolates.Kind{isolates.KindMap}},
+	{"isMapIterator", []isolates.Kind{isolates.KindMapIterator}},
+	{"isNativeError", []isolates.Kind{isolates.KindNativeError}},
+	{"isNumberObject", []isolates.Kind{isolates.KindNumberObject}},
+	{"isPromise", []isolates.Kind{isolates.KindPromise}},
+	{"isProxy", []isolates.Kind{isolates.KindProxy}},
+	{"isRegExp", []isolates.Kind{isolates.KindRegExp}},
+	{"isSet", []isolates.Kind{isolates.KindSet}},
+	{"isSetIterator", []isolates.Kind{isolates.KindSetIterator}},
+	{"isSharedArrayBuffer", []isolates.Kind{isolates.KindSharedArrayBuffer}},
+	{"isStringObject", []isolates.Kind{isolates.KindStringObject}},
+	{"isSymbolObject", []isolates.Kind{isolates.KindSymbolObject}},
+	{"isTypedArray", []isolates.Kind{isolates.KindTypedArray}},
+	{"isUint8Array", []isolates.Kind{isolates.KindUint8Array}},
+	{"isUint8ClampedArray", []isolates.Kind{isolates.KindUint8ClampedArray}},
+	{"isUint16Array", []isolates.Kind{isolates.KindUint16Array}},
+	{"isUint32Array", []isolates.Kind{isolates.KindUint32Array}},
+	{"isWeakMap", []isolates.Kind{isolates.KindWeakMap}},
+	{"isWeakSet", []isolates.Kind{isolates.KindWeakSet}},
+}
+
+// newTypes returns util.types, which checks the kinds V8 reports for values.
+func newTypes(ctx context.Context, c *isolates.Context) (*isolates.Value, error) {
+	types, err := c.NewObject(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range typeChecks {
+		kinds := check.kinds
+		if err := types.Set(ctx, check.name, func(in isolates.FunctionArgs) (*isolates.Value, error) {
+			value := in.Arg(in.ExecutionContext, 0)
+			for _, kind := range kinds {
+				if value.IsKind(kind) {
+					return in.Context.Create(in.ExecutionContext, true)
+				}
+			}
+			return in.Context.Create(in.ExecutionContext, false)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return types, nil
+}
@@ -0,0 +1,214 @@
+(function (format, inspect, types) {
+	const kCustomInspect = Symbol.for('nodejs.util.inspect.custom');
+	const kCustomPromisify = Symbol.for('nodejs.util.promisify.custom');
+
+	const defaultOptions = {
+		showHidden: false,
+		depth: 2,
+		colors: false,
+		customInspect: true,
+		maxArrayLength: 100,
+		maxStringLength: 10000,
+		breakLength: 80,
+		compact: 3,
+		sorted: false,
+		getters: false,
+	};
+
+	// helpers are what the Go formatter can't do through Value, like reading
+	// symbol properties and calling custom inspect functions.
+	function helpers(options) {
+		return {
+			custom(value, depth, opts) {
+				const fn = options.customInspect ? value[kCustomInspect] : undefined;
+				if (typeof fn === 'function' && fn !== util.inspect) {
+					return [fn.call(value, depth, { ...options, ...opts }, util.inspect)];
+				}
+			},
+			className(value) {
+				for (let proto = value; proto !== null; proto = Object.getPrototypeOf(proto)) {
+					const descriptor = Object.getOwnPropertyDescriptor(proto, 'constructor');
+					if (descriptor !== undefined && typeof descriptor.value === 'function' && descriptor.value.name !== '') {
+						return descriptor.value.name;
+					}
+				}
+				return null;
+			},
+			entries(value) {
+				return Array.from(value);
+			},
+			string(value) {
+				return String(value);
+			},
+			isClass(fn) {
+				return Function.prototype.toString.call(fn).startsWith('class');
+			},
+		};
+	}
+
+	function resolveOptions(options) {
+		return { ...defaultOptions, ...util.inspect.defaultOptions, ...options };
+	}
+
+	const util = {};
+
+	util.format = function (...args) {
+		const options = resolveOptions();
+		return format(helpers(options), options, ...args);
+	};
+
+	util.formatWithOptions = function (inspectOptions, ...args) {
+		if (inspectOptions === null || typeof inspectOptions !== 'object') {
+			throw new TypeError('The "inspectOptions" argument must be of type object.');
+		}
+		const options = resolveOptions(inspectOptions);
+		return format(helpers(options), options, ...args);
+	};
+
+	util.inspect = function (value, options) {
+		// the legacy signature is inspect(value, showHidden, depth, colors)
+		if (typeof options !== 'object' || options === null) {
+			options = { showHidden: options, depth: arguments[2], colors: arguments[3] };
+			for (const key of Object.keys(options)) {
+				if (options[key] === undefined) {
+					delete options[key];
+				}
+			}
+		}
+		options = resolveOptions(options);
+		return inspect(helpers(options), value, options);
+	};
+
+	util.inspect.custom = kCustomInspect;
+	util.inspect.defaultOptions = { ...defaultOptions };
+
+	util.types = types;
+
+	util.inherits = function (ctor, superCtor) {
+		if (typeof ctor !== 'function') {
+			throw new TypeError('The "ctor" argument must be of type function.');
+		} else if (typeof superCtor !== 'function') {
+			throw new TypeError('The "superCtor" argument must be of type function.');
+		} else if (superCtor.prototype === undefined) {
+			throw new TypeError('The "superCtor.prototype" property must be of type object.');
+		}
+		Object.defineProperty(ctor, 'super_', { value: superCtor, writable: true, configurable: true });
+		Object.setPrototypeOf(ctor.prototype, superCtor.prototype);
+	};
+
+	util.promisify = function (original) {
+		if (typeof original !== 'function') {
+			throw new TypeError('The "original" argument must be of type function.');
+		}
+
+		if (typeof original[kCustomPromisify] === 'function') {
+			const fn = original[kCustomPromisify];
+			return Object.defineProperty(fn, kCustomPromisify, { value: fn });
+		}
+
+		function fn(...args) {
+			return new Promise((resolve, reject) => {
+				original.call(this, ...args, (err, ...values) => {
+					if (err) {
+						reject(err);
+					} else {
+						resolve(values[0]);
+					}
+				});
+			});
+		}
+
+		Object.setPrototypeOf(fn, Object.getPrototypeOf(original));
+		Object.defineProperty(fn, kCustomPromisify, { value: fn });
+		return Object.defineProperties(fn, Object.getOwnPropertyDescriptors(original));
+	};
+
+	util.promisify.custom = kCustomPromisify;
+
+	util.callbackify = function (original) {
+		if (typeof original !== 'function') {
+			throw new TypeError('The "original" argument must be of type function.');
+		}
+
+		return function (...args) {
+			const callback = args.pop();
+			if (typeof callback !== 'function') {
+				throw new TypeError('The last argument must be of type function.');
+			}
+
+			original.apply(this, args).then(
+				(value) => queueMicrotask(() => callback(null, value)),
+				(reason) => {
+					if (!reason) {
+						const err = new Error('Promise was rejected with a falsy value');
+						err.reason = reason;
+						reason = err;
+					}
+					queueMicrotask(() => callback(reason));
+				},
+			);
+		};
+	};
+
+	util.deprecate = function (fn, msg, code) {
+		let warned = false;
+		return function (...args) {
+			if (!warned) {
+				warned = true;
+				if (typeof console !== 'undefined') {
+					console.warn(code ? `[${code}] DeprecationWarning: ${msg}` : `DeprecationWarning: ${msg}`);
+				}
+			}
+			return new.target ? Reflect.construct(fn, args, new.target) : fn.apply(this, args);
+		};
+	};
+
+	util.debuglog = function () {
+		const log = function () {};
+		log.enabled = false;
+		return log;
+	};
+
+	util.debug = util.debuglog;
+
+	util.isArray = Array.isArray;
+
+	util.isDeepStrictEqual = function isDeepStrictEqual(a, b) {
+		if (Object.is(a, b)) {
+			return true;
+		} else if (typeof a !== 'object' || typeof b !== 'object' || a === null || b === null) {
+			return false;
+		} else if (Object.getPrototypeOf(a) !== Object.getPrototypeOf(b)) {
+			return false;
+		} else if (a instanceof Date) {
+			return Object.is(a.getTime(), b.getTime());
+		} else if (a instanceof RegExp) {
+			return String(a) === String(b);
+		} else if (a instanceof Map || a instanceof Set) {
+			if (a.size !== b.size) {
+				return false;
+			}
+			for (const [key, value] of a.entries()) {
+				if (!b.has(key) || !isDeepStrictEqual(value, a instanceof Map ? b.get(key) : key)) {
+					return false;
+				}
+			}
+			return true;
+		}
+
+		const keys = Reflect.ownKeys(a);
+		if (keys.length !== Reflect.ownKeys(b).length) {
+			return false;
+		}
+		return keys.every((key) => Object.prototype.hasOwnProperty.call(b, key) && isDeepStrictEqual(a[key], b[key]));
+	};
+
+	if (typeof TextEncoder !== 'undefined') {
+		util.TextEncoder = TextEncoder;
+	}
+	if (typeof TextDecoder !== 'undefined') {
+		util.TextDecoder = TextDecoder;
+	}
+
+	return util;
+})
@@ -6,7 +6,10 @@ import "C"
 
 import (
 	"fmt"
+	"runtime"
+	"strings"
 	"sync"
+	"unsafe"
 )
 
 // Version exposes the compiled-in version of the linked V8 library.  This can
@@ -42,11 +45,25 @@ func (s PromiseState) String() string {
 }
 
 var initOnce sync.Once
+var initFlags []string
+
+// SetFlags adds V8 command line flags, such as --track-gc-object-stats, to
+// those V8 is initialized with. It has no effect once Initialize has been
+// called.
+func SetFlags(flags ...string) {
+	initFlags = append(initFlags, flags...)
+}
 
 func Initialize() {
 	initOnce.Do(func() {
-		C.v8_Initialize()
+		flags := C.CString(strings.Join(initFlags, " "))
+		defer C.free(unsafe.Pointer(flags))
+
+		C.v8_Initialize(flags)
 		go func() {
+			// isolates are created on a single thread
+			runtime.LockOSThread()
+
 			for {
 				v8IsolateInitializer := <-v8IsolateInitializers
 				v8IsolateInitializer.result <- v8IsolateInitializer.fn()
@@ -0,0 +1,238 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// typedArrayKinds maps the element kinds of Go slices to the typed arrays they
+// are created as. []byte is created as an ArrayBuffer instead.
+var typedArrayKinds = map[reflect.Kind]Kind{
+	reflect.Int8:    KindInt8Array,
+	reflect.Int16:   KindInt16Array,
+	reflect.Uint16:  KindUint16Array,
+	reflect.Int32:   KindInt32Array,
+	reflect.Uint32:  KindUint32Array,
+	reflect.Float32: KindFloat32Array,
+	reflect.Float64: KindFloat64Array,
+	reflect.Int64:   KindBigInt64Array,
+	reflect.Uint64:  KindBigUint64Array,
+}
+
+var typedArrayCKinds = map[Kind]C.Kind{
+	KindInt8Array:      C.kInt8Array,
+	KindInt16Array:     C.kInt16Array,
+	KindUint16Array:    C.kUint16Array,
+	KindInt32Array:     C.kInt32Array,
+	KindUint32Array:    C.kUint32Array,
+	KindFloat32Array:   C.kFloat32Array,
+	KindFloat64Array:   C.kFloat64Array,
+	KindBigInt64Array:  C.kBigInt64Array,
+	KindBigUint64Array: C.kBigUint64Array,
+}
+
+var externalArrayBuffers = struct {
+	sync.Mutex
+	nextID  uint64
+	pinners map[uint64]*runtime.Pinner
+}{pinners: map[uint64]*runtime.Pinner{}}
+
+// sliceBytes returns the memory backing a slice or addressable array of
+// numbers.
+func sliceBytes(v reflect.Value) []byte {
+	if v.Kind() == reflect.Array {
+		v = v.Slice(0, v.Len())
+	}
+
+	if v.Len() == 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(v.Pointer())), v.Len()*int(v.Type().Elem().Size()))
+}
+
+func (c *Context) createTypedArray(ctx context.Context, v reflect.Value, kind Kind) (*Value, error) {
+	if v.Kind() == reflect.Array && !v.CanAddr() {
+		a := reflect.New(v.Type()).Elem()
+		a.Set(v)
+		v = a
+	}
+
+	b := sliceBytes(v)
+	var pb *C.char
+	if len(b) > 0 {
+		pb = (*C.char)(unsafe.Pointer(&b[0]))
+	}
+
+	return c.createImmediateValue(ctx, C.ImmediateValue{
+		_type: C.tTYPEDARRAY,
+		_data: C.ByteArray{data: pb, length: C.int(len(b))},
+		_kind: typedArrayCKinds[kind],
+	})
+}
+
+// unmarshalTypedArray copies the contents of a typed array into a new slice of
+// type t, which must have the matching element type.
+func (v *Value) unmarshalTypedArray(ctx context.Context, t reflect.Type) (*reflect.Value, error) {
+	if bytes, err := v.Bytes(ctx); err != nil {
+		return nil, err
+	} else {
+		n := len(bytes) / int(t.Elem().Size())
+		rv := reflect.MakeSlice(t, n, n)
+		copy(sliceBytes(rv), bytes)
+		return &rv, nil
+	}
+}
+
+// NewExternalArrayBuffer creates an ArrayBuffer backed by b rather than a copy
+// of it, so that large buffers can be shared with JavaScript without copying.
+// Writes from either side are visible to the other. b stays pinned until the
+// ArrayBuffer is garbage collected, and must not be appended to in the
+// meantime.
+func (c *Context) NewExternalArrayBuffer(ctx context.Context, b []byte) (*Value, error) {
+	if len(b) == 0 {
+		return c.Create(ctx, b)
+	}
+
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		pinner := &runtime.Pinner{}
+		pinner.Pin(&b[0])
+
+		externalArrayBuffers.Lock()
+		externalArrayBuffers.nextID++
+		id := externalArrayBuffers.nextID
+		externalArrayBuffers.pinners[id] = pinner
+		externalArrayBuffers.Unlock()
+
+		return c.newValueFromTuple(ctx, C.v8_Context_NewExternalArrayBuffer(c.pointer, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.uint64_t(id)))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
+
+//export externalArrayBufferReleaseCallback
+func externalArrayBufferReleaseCallback(id C.uint64_t) {
+	externalArrayBuffers.Lock()
+	pinner := externalArrayBuffers.pinners[uint64(id)]
+	delete(externalArrayBuffers.pinners, uint64(id))
+	externalArrayBuffers.Unlock()
+
+	if pinner != nil {
+		pinner.Unpin()
+	}
+}
+
+// SharedArrayBuffer is memory owned by Go that can be attached as a
+// JavaScript SharedArrayBuffer to contexts in any number of isolates, so that
+// they can share data and coordinate with Atomics.wait and Atomics.notify.
+//
+// Go's reference to the memory is only dropped by Release, never by the
+// garbage collector, as a finalizer could free it while a slice returned by
+// Bytes is still in use. Every SharedArrayBuffer returned by
+// NewSharedArrayBuffer or Value.SharedArrayBuffer, including those unmarshaled
+// into the arguments of a Go function, must be released.
+type SharedArrayBuffer struct {
+	mutex   sync.Mutex
+	pointer C.SharedArrayBufferPtr
+}
+
+var sharedArrayBufferType = reflect.TypeOf((*SharedArrayBuffer)(nil))
+
+// NewSharedArrayBuffer allocates a zeroed SharedArrayBuffer of size bytes,
+// which must be released with Release.
+func NewSharedArrayBuffer(size int) *SharedArrayBuffer {
+	return newSharedArrayBuffer(C.v8_SharedArrayBuffer_New(C.size_t(size)))
+}
+
+func newSharedArrayBuffer(pointer C.SharedArrayBufferPtr) *SharedArrayBuffer {
+	return &SharedArrayBuffer{pointer: pointer}
+}
+
+// Bytes returns the shared memory. It is written concurrently by any isolate
+// the buffer is attached to, so access should be synchronized, for example
+// with sync/atomic. It must not be used after Release.
+func (b *SharedArrayBuffer) Bytes() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pointer == nil {
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(C.v8_SharedArrayBuffer_Data(b.pointer)), int(C.v8_SharedArrayBuffer_ByteLength(b.pointer)))
+}
+
+func (b *SharedArrayBuffer) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pointer == nil {
+		return 0
+	}
+
+	return int(C.v8_SharedArrayBuffer_ByteLength(b.pointer))
+}
+
+// Release drops Go's reference to the memory. It is freed once every
+// SharedArrayBuffer attached to an isolate has also been garbage collected.
+func (b *SharedArrayBuffer) Release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pointer != nil {
+		C.v8_SharedArrayBuffer_Release(b.pointer)
+		b.pointer = nil
+	}
+}
+
+// AttachSharedArrayBuffer creates a JavaScript SharedArrayBuffer in the context
+// backed by the memory of b.
+func (c *Context) AttachSharedArrayBuffer(ctx context.Context, b *SharedArrayBuffer) (*Value, error) {
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if b.pointer == nil {
+			return nil, fmt.Errorf("shared array buffer released")
+		}
+
+		return c.newValueFromTuple(ctx, C.v8_Context_NewSharedArrayBuffer(c.pointer, b.pointer))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
+
+// SharedArrayBuffer returns the memory of a JavaScript SharedArrayBuffer, so
+// that it can be read from Go or attached to contexts in other isolates. The
+// result must be released with Release.
+func (v *Value) SharedArrayBuffer(ctx context.Context) (*SharedArrayBuffer, error) {
+	pb, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if pointer := C.v8_Value_SharedArrayBuffer(v.context.pointer, v.pointer); pointer == nil {
+			return nil, fmt.Errorf("value is not a shared array buffer: %s", v.kinds)
+		} else {
+			return newSharedArrayBuffer(pointer), nil
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pb.(*SharedArrayBuffer), nil
+	}
+}
@@ -0,0 +1,93 @@
+package isolates
+
+import (
+	"context"
+	"reflect"
+)
+
+// AsyncFunction is a Go function exposed to JavaScript as a function that
+// returns a promise. It is called synchronously with the arguments and returns
+// the work to run off the isolate's thread. The result of the work resolves
+// the promise, or its error rejects it.
+type AsyncFunction func(FunctionArgs) func(context.Context) (any, error)
+
+var asyncFunctionType = reflect.TypeOf(AsyncFunction(nil))
+
+// isAsyncChanFunction reports whether t has the signature
+// func(FunctionArgs) (<-chan T, error). The first value received from the
+// channel resolves the promise; receiving a non-nil error rejects it.
+func isAsyncChanFunction(t reflect.Type) bool {
+	return t.Kind() == reflect.Func &&
+		t.NumIn() == 1 && t.In(0) == functionArgsType &&
+		t.NumOut() == 2 && t.Out(1) == errorType &&
+		t.Out(0).Kind() == reflect.Chan && t.Out(0).ChanDir()&reflect.RecvDir != 0
+}
+
+func asyncChanFunction(fn reflect.Value) AsyncFunction {
+	return func(in FunctionArgs) func(context.Context) (any, error) {
+		out := fn.Call([]reflect.Value{reflect.ValueOf(in)})
+
+		if !out[1].IsNil() {
+			err := out[1].Interface().(error)
+			return func(ctx context.Context) (any, error) {
+				return nil, err
+			}
+		}
+
+		ch := out[0]
+		return func(ctx context.Context) (any, error) {
+			if ch.IsNil() {
+				return nil, nil
+			} else if v, ok := ch.Recv(); !ok {
+				return nil, nil
+			} else if err, isError := v.Interface().(error); isError && err != nil {
+				return nil, err
+			} else {
+				return v.Interface(), nil
+			}
+		}
+	}
+}
+
+func (c *Context) CreateAsyncFunction(ctx context.Context, name *string, function AsyncFunction) (*Value, error) {
+	return c.CreateFunction(ctx, name, func(in FunctionArgs) (*Value, error) {
+		return in.Async(function(in))
+	})
+}
+
+// Async runs work in the background and returns a promise for its result. The
+// result is marshalled and the promise settled under Sync, after which the
+// microtask queue is flushed so that continuations run straight away.
+func (c *FunctionArgs) Async(work func(context.Context) (any, error)) (*Value, error) {
+	if resolver, err := c.Context.NewResolver(c.ExecutionContext); err != nil {
+		return nil, err
+	} else if promise, err := resolver.Promise(c.ExecutionContext); err != nil {
+		return nil, err
+	} else {
+		c.Background(func(in FunctionArgs) {
+			var result any
+			var workErr error
+			if work != nil {
+				result, workErr = work(in.ExecutionContext)
+			}
+
+			if _, err := in.Context.isolate.Sync(in.ExecutionContext, func(ctx context.Context) (any, error) {
+				if workErr != nil {
+					if err := resolver.Reject(ctx, workErr); err != nil {
+						return nil, err
+					}
+				} else if err := resolver.Resolve(ctx, result); err != nil {
+					if err := resolver.Reject(ctx, err); err != nil {
+						return nil, err
+					}
+				}
+
+				return nil, in.Context.isolate.PerformMicrotaskCheckpointSync(ctx)
+			}); err != nil {
+				For(in.ExecutionContext).Error(err)
+			}
+		})
+
+		return promise, nil
+	}
+}
@@ -0,0 +1,102 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"unsafe"
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// maxSafeInteger is Number.MAX_SAFE_INTEGER. Go integers beyond it are
+// created as a BigInt so that they round trip without loss.
+const maxSafeInteger = 1<<53 - 1
+
+func (c *Context) createBigInt(ctx context.Context, b *big.Int) (*Value, error) {
+	// V8 takes the magnitude as little endian 64 bit words.
+	bytes := new(big.Int).Abs(b).Bytes()
+	words := make([]uint64, (len(bytes)+7)/8)
+	for j, by := range bytes {
+		k := len(bytes) - 1 - j
+		words[k/8] |= uint64(by) << (8 * (k % 8))
+	}
+
+	var pw *C.char
+	if len(words) > 0 {
+		pw = (*C.char)(C.CBytes(unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), len(words)*8)))
+		defer C.free(unsafe.Pointer(pw))
+	}
+
+	return c.createImmediateValue(ctx, C.ImmediateValue{
+		_type: C.tBIGINT,
+		_data: C.ByteArray{data: pw, length: C.int(len(words) * 8)},
+		_bool: C.bool(b.Sign() < 0),
+	})
+}
+
+// BigInt returns the value of a JavaScript BigInt.
+func (v *Value) BigInt(ctx context.Context) (*big.Int, error) {
+	pb, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if !v.IsKind(KindBigInt) {
+			return nil, fmt.Errorf("value is not a bigint: %s", v.kinds)
+		}
+
+		var signBit C.bool
+		words := C.v8_Value_BigIntWords(v.context.pointer, v.pointer, &signBit)
+
+		b := new(big.Int)
+		if words.data != nil {
+			n := int(words.length) / 8
+			bytes := make([]byte, n*8)
+			for j, w := range (*[1 << (maxArraySize - 18)]uint64)(unsafe.Pointer(words.data))[:n:n] {
+				for k := 0; k < 8; k++ {
+					bytes[len(bytes)-1-(j*8+k)] = byte(w >> (8 * k))
+				}
+			}
+			C.free(unsafe.Pointer(words.data))
+			b.SetBytes(bytes)
+		}
+
+		if signBit {
+			b.Neg(b)
+		}
+
+		return b, nil
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pb.(*big.Int), nil
+	}
+}
+
+func (v *Value) bigIntInt64(ctx context.Context) (int64, error) {
+	if b, err := v.BigInt(ctx); err != nil {
+		return 0, err
+	} else if !b.IsInt64() {
+		return 0, fmt.Errorf("bigint %s overflows int64", b)
+	} else {
+		return b.Int64(), nil
+	}
+}
+
+func (v *Value) bigIntUint64(ctx context.Context) (uint64, error) {
+	if b, err := v.BigInt(ctx); err != nil {
+		return 0, err
+	} else if !b.IsUint64() {
+		return 0, fmt.Errorf("bigint %s overflows uint64", b)
+	} else {
+		return b.Uint64(), nil
+	}
+}
+
+func isSafeInteger(i int64) bool {
+	return i >= -maxSafeInteger && i <= maxSafeInteger
+}
@@ -0,0 +1,113 @@
+#include "v8_c_private.h"
+
+#include <algorithm>
+#include <memory>
+
+v8::Local<v8::TypedArray> v8_TypedArray_New(Kind kind, v8::Local<v8::ArrayBuffer> buffer, size_t byteLength)
+{
+  switch (kind)
+  {
+  case kInt8Array:
+    return v8::Int8Array::New(buffer, 0, byteLength);
+  case kUint8Array:
+    return v8::Uint8Array::New(buffer, 0, byteLength);
+  case kUint8ClampedArray:
+    return v8::Uint8ClampedArray::New(buffer, 0, byteLength);
+  case kInt16Array:
+    return v8::Int16Array::New(buffer, 0, byteLength / 2);
+  case kUint16Array:
+    return v8::Uint16Array::New(buffer, 0, byteLength / 2);
+  case kInt32Array:
+    return v8::Int32Array::New(buffer, 0, byteLength / 4);
+  case kUint32Array:
+    return v8::Uint32Array::New(buffer, 0, byteLength / 4);
+  case kFloat32Array:
+    return v8::Float32Array::New(buffer, 0, byteLength / 4);
+  case kFloat64Array:
+    return v8::Float64Array::New(buffer, 0, byteLength / 8);
+  case kBigInt64Array:
+    return v8::BigInt64Array::New(buffer, 0, byteLength / 8);
+  case kBigUint64Array:
+    return v8::BigUint64Array::New(buffer, 0, byteLength / 8);
+  default:
+    return v8::Local<v8::TypedArray>();
+  }
+}
+
+// v8_ExternalArrayBuffer_Deleter is called by V8, on any thread, once an
+// external ArrayBuffer has been collected so that Go can unpin its memory.
+static void v8_ExternalArrayBuffer_Deleter(void *data, size_t length, void *deleterData)
+{
+  externalArrayBufferReleaseCallback(static_cast<uint64_t>(reinterpret_cast<uintptr_t>(deleterData)));
+}
+
+extern "C"
+{
+  CallResult v8_Context_NewExternalArrayBuffer(ContextPtr pContext, void *data, size_t length, uint64_t id)
+  {
+    VALUE_SCOPE(pContext);
+
+    std::unique_ptr<v8::BackingStore> backingStore = v8::ArrayBuffer::NewBackingStore(data, length, v8_ExternalArrayBuffer_Deleter, reinterpret_cast<void *>(static_cast<uintptr_t>(id)));
+    v8::Local<v8::ArrayBuffer> buffer = v8::ArrayBuffer::New(isolate, std::move(backingStore));
+
+    return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(buffer));
+  }
+}
+
+// SharedArrayBuffer holds a reference to the backing store of a
+// SharedArrayBuffer for Go. The memory is freed once Go and every isolate the
+// buffer was attached to have released it.
+typedef std::shared_ptr<v8::BackingStore> SharedArrayBuffer;
+
+static void v8_SharedArrayBuffer_Deleter(void *data, size_t length, void *deleterData)
+{
+  free(data);
+}
+
+extern "C"
+{
+  SharedArrayBufferPtr v8_SharedArrayBuffer_New(size_t size)
+  {
+    void *data = calloc(std::max(size, size_t(1)), 1);
+    return static_cast<SharedArrayBufferPtr>(new SharedArrayBuffer(v8::SharedArrayBuffer::NewBackingStore(data, size, v8_SharedArrayBuffer_Deleter, NULL)));
+  }
+
+  SharedArrayBufferPtr v8_Value_SharedArrayBuffer(ContextPtr pContext, ValuePtr pValue)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Value> value = static_cast<Value *>(pValue)->Get(isolate);
+
+    if (!value->IsSharedArrayBuffer())
+    {
+      return NULL;
+    }
+
+    return static_cast<SharedArrayBufferPtr>(new SharedArrayBuffer(value.As<v8::SharedArrayBuffer>()->GetBackingStore()));
+  }
+
+  CallResult v8_Context_NewSharedArrayBuffer(ContextPtr pContext, SharedArrayBufferPtr pBuffer)
+  {
+    VALUE_SCOPE(pContext);
+
+    SharedArrayBuffer *backingStore = static_cast<SharedArrayBuffer *>(pBuffer);
+    v8::Local<v8::SharedArrayBuffer> buffer = v8::SharedArrayBuffer::New(isolate, *backingStore);
+
+    return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(buffer));
+  }
+
+  void *v8_SharedArrayBuffer_Data(SharedArrayBufferPtr pBuffer)
+  {
+    return (*static_cast<SharedArrayBuffer *>(pBuffer))->Data();
+  }
+
+  size_t v8_SharedArrayBuffer_ByteLength(SharedArrayBufferPtr pBuffer)
+  {
+    return (*static_cast<SharedArrayBuffer *>(pBuffer))->ByteLength();
+  }
+
+  void v8_SharedArrayBuffer_Release(SharedArrayBufferPtr pBuffer)
+  {
+    delete static_cast<SharedArrayBuffer *>(pBuffer);
+  }
+}
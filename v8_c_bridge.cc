@@ -11,13 +11,14 @@ extern "C"
   static std::unique_ptr<v8::Platform> _platform;
 
   void
-  v8_Initialize()
+  v8_Initialize(const char *flags)
   {
 
     v8::V8::InitializeICU("/usr/local/lib/v8/arm64/macos/release/icudtl.dat");
     _platform = v8::platform::NewDefaultPlatform();
     v8::V8::InitializePlatform(_platform.get());
-    const char *flags = "--harmony-rab-gsab";
+    const char *defaultFlags = "--harmony-rab-gsab";
+    v8::V8::SetFlagsFromString(defaultFlags, strlen(defaultFlags));
     v8::V8::SetFlagsFromString(flags, strlen(flags));
     v8::V8::Initialize();
 
@@ -24,6 +24,12 @@ extern "C"
   typedef void *ExternalPtr;
   typedef void *ResolverPtr;
   typedef void *ReferrerPtr;
+  typedef void *SnapshotCreatorPtr;
+  typedef void *ScriptPtr;
+  typedef void *ModulePtr;
+  typedef void *CPUProfilerPtr;
+  typedef void *SharedArrayBufferPtr;
+  typedef void *CompiledWasmModulePtr;
 
   typedef struct
   {
@@ -48,6 +54,93 @@ extern "C"
     size_t doesZapGarbage;
   } HeapStatistics;
 
+  typedef struct
+  {
+    int id;
+    int parentId;
+    String functionName;
+    String url;
+    int scriptId;
+    int lineNumber;
+    int columnNumber;
+    int hitCount;
+  } CPUProfileNode;
+
+  typedef struct
+  {
+    String title;
+    int64_t startTime;
+    int64_t endTime;
+    int nodeCount;
+    CPUProfileNode *nodes;
+    int sampleCount;
+    int *samples;
+    int64_t *timestamps;
+  } CPUProfile;
+
+  typedef struct
+  {
+    int id;
+    int parentId;
+    String functionName;
+    String url;
+    int scriptId;
+    int lineNumber;
+    int columnNumber;
+    size_t selfSize;
+    size_t selfCount;
+  } HeapProfileNode;
+
+  typedef struct
+  {
+    int nodeCount;
+    HeapProfileNode *nodes;
+  } HeapProfile;
+
+  typedef struct
+  {
+    String spaceName;
+    size_t spaceSize;
+    size_t spaceUsedSize;
+    size_t spaceAvailableSize;
+    size_t physicalSpaceSize;
+  } HeapSpaceStatistics;
+
+  typedef struct
+  {
+    String objectType;
+    String objectSubType;
+    size_t objectCount;
+    size_t objectSize;
+  } HeapObjectStatistics;
+
+  typedef struct
+  {
+    int spaceCount;
+    HeapSpaceStatistics *spaces;
+  } HeapSpaceStatisticsList;
+
+  typedef struct
+  {
+    int objectCount;
+    HeapObjectStatistics *objects;
+  } HeapObjectStatisticsList;
+
+  typedef struct
+  {
+    bool allowCodeGenerationFromStrings;
+    String securityToken;
+  } ContextOptions;
+
+  typedef struct
+  {
+    size_t initialOldSpaceSize;
+    size_t maxOldSpaceSize;
+    size_t initialYoungSpaceSize;
+    size_t maxYoungSpaceSize;
+    size_t maxArrayBufferSize;
+  } ResourceConstraints;
+
   typedef enum
   {
     kUndefined = 0,
@@ -97,6 +190,9 @@ extern "C"
     kSharedArrayBuffer,
     kProxy,
     kWasmModuleObject,
+    kBigInt,
+    kBigInt64Array,
+    kBigUint64Array,
     kNumKinds,
   } Kind;
 
@@ -122,8 +218,16 @@ extern "C"
     ValueTuplePtr result;
     Error error;
     bool isError;
+    bool isTerminated;
   } CallResult;
 
+  typedef struct
+  {
+    ScriptPtr script;
+    bool cacheRejected;
+    CallResult result;
+  } CompileResult;
+
   typedef struct
   {
     String funcname;
@@ -132,6 +236,26 @@ extern "C"
     int column;
   } CallerInfo;
 
+  typedef struct
+  {
+    String function;
+    String script;
+    int line;
+    int column;
+    bool isEval;
+    bool isConstructor;
+  } ExceptionStackFrame;
+
+  typedef struct
+  {
+    String name;
+    String message;
+    String sourceLine;
+    String formatted;
+    int frameCount;
+    ExceptionStackFrame *frames;
+  } ExceptionInfo;
+
   typedef struct
   {
     int major, minor, build, patch;
@@ -142,13 +266,20 @@ extern "C"
   {
     kFunctionCallback,
     kGetterCallback,
-    kSetterCallback
+    kSetterCallback,
+    kPropertyGetterCallback,
+    kPropertySetterCallback,
+    kPropertyQueryCallback,
+    kPropertyDeleterCallback,
+    kPropertyEnumeratorCallback
   } CallbackType;
 
   typedef struct
   {
     CallbackType _type;
     String id;
+    Pointer isolate;
+    int contextId;
     CallerInfo caller;
     CallResult self;
     CallResult holder;
@@ -159,6 +290,9 @@ extern "C"
 
     String key;
     CallResult value;
+
+    bool indexed;
+    uint32_t index;
   } CallbackInfo;
 
   typedef struct
@@ -170,26 +304,67 @@ extern "C"
     int importAssertionsLength;
   } ImportModuleDynamicallyCallbackInfo;
 
+  typedef struct
+  {
+    Pointer isolate;
+    int contextId;
+    int referrer;
+    String specifier;
+  } ResolveModuleCallbackInfo;
+
+  typedef struct
+  {
+    ModulePtr module;
+    int id;
+    CallResult result;
+  } ModuleResult;
+
   // typedef unsigned int uint32_t;
 
   // v8_init must be called once before anything else.
-  extern void v8_Initialize();
+  extern void v8_Initialize(const char *flags);
 
-  extern StartupData v8_CreateSnapshotDataBlob(const char *js);
+  extern SnapshotCreatorPtr v8_SnapshotCreator_New(void *data);
+  extern IsolatePtr v8_SnapshotCreator_GetIsolate(SnapshotCreatorPtr creator);
+  extern StartupData v8_SnapshotCreator_CreateBlob(SnapshotCreatorPtr creator, ContextPtr context);
+  extern void v8_SnapshotCreator_Release(SnapshotCreatorPtr creator);
 
-  extern IsolatePtr v8_Isolate_New(void *data, StartupData startupData);
+  extern IsolatePtr v8_Isolate_New(void *data, StartupData startupData, ResourceConstraints constraints);
   extern void v8_Isolate_Terminate(IsolatePtr isolate);
+  extern void v8_Isolate_CancelTerminateExecution(IsolatePtr isolate);
   extern void v8_Isolate_Release(IsolatePtr isolate);
   extern void v8_Isolate_RequestGarbageCollectionForTesting(IsolatePtr pIsolate);
   extern HeapStatistics v8_Isolate_GetHeapStatistics(IsolatePtr isolate);
+  extern HeapSpaceStatisticsList v8_Isolate_GetHeapSpaceStatistics(IsolatePtr pIsolate);
+  extern HeapObjectStatisticsList v8_Isolate_GetHeapObjectStatistics(IsolatePtr pIsolate);
+  extern Error v8_Isolate_WriteHeapSnapshot(IsolatePtr pIsolate);
+  extern bool v8_Isolate_StartSamplingHeapProfiler(IsolatePtr pIsolate, uint64_t interval, int depth);
+  extern HeapProfile v8_Isolate_StopSamplingHeapProfiler(IsolatePtr pIsolate);
   extern void v8_Isolate_LowMemoryNotification(IsolatePtr isolate);
   extern void v8_Isolate_Enter(IsolatePtr pIsolate);
   extern void v8_Isolate_Exit(IsolatePtr pIsolate);
   extern Error v8_Isolate_EnqueueMicrotask(IsolatePtr pIsolate, ContextPtr pContext, ValuePtr pFunction);
   extern void v8_Isolate_PerformMicrotaskCheckpoint(IsolatePtr pIsolate);
 
-  extern ContextPtr v8_Context_New(IsolatePtr isolate);
+  extern CPUProfilerPtr v8_CPUProfiler_New(IsolatePtr pIsolate);
+  extern int v8_CPUProfiler_Start(CPUProfilerPtr pProfiler, const char *title, int samplingInterval);
+  extern CPUProfile v8_CPUProfiler_Stop(CPUProfilerPtr pProfiler, const char *title);
+  extern void v8_CPUProfiler_Release(CPUProfilerPtr pProfiler);
+
+  extern ContextPtr v8_Context_New(IsolatePtr isolate, int id, ContextOptions options);
   extern CallResult v8_Context_Run(ContextPtr ctx, const char *code, const char *filename, const char *id);
+  extern CompileResult v8_Context_Compile(ContextPtr pContext, const char *code, const char *filename, const char *id, String cache);
+
+  extern ModuleResult v8_Module_Compile(ContextPtr pContext, const char *code, const char *filename, const char *id);
+  extern ModuleResult v8_Module_NewSynthetic(ContextPtr pContext, const char *name, ValuePtr pExports);
+  extern CallResult v8_Module_Instantiate(ContextPtr pContext, ModulePtr pModule);
+  extern CallResult v8_Module_Evaluate(ContextPtr pContext, ModulePtr pModule);
+  extern CallResult v8_Module_GetNamespace(ContextPtr pContext, ModulePtr pModule);
+  extern void v8_Module_Release(ContextPtr pContext, ModulePtr pModule);
+
+  extern CallResult v8_Script_Run(ContextPtr pContext, ScriptPtr pScript);
+  extern String v8_Script_CreateCodeCache(ContextPtr pContext, ScriptPtr pScript);
+  extern void v8_Script_Release(ContextPtr pContext, ScriptPtr pScript);
 
   extern FunctionTemplatePtr v8_FunctionTemplate_New(ContextPtr ctx, const char *id);
   extern void v8_FunctionTemplate_Release(ContextPtr ctxptr, FunctionTemplatePtr fnptr);
@@ -199,6 +374,8 @@ extern "C"
   extern ObjectTemplatePtr v8_FunctionTemplate_PrototypeTemplate(ContextPtr ctxptr, FunctionTemplatePtr function_ptr);
   extern ObjectTemplatePtr v8_FunctionTemplate_InstanceTemplate(ContextPtr ctxptr, FunctionTemplatePtr function_ptr);
   extern void v8_ObjectTemplate_SetAccessor(ContextPtr ctxptr, ObjectTemplatePtr object_ptr, const char *name, const char *id, bool setter);
+  extern void v8_ObjectTemplate_SetNamedPropertyHandler(ContextPtr pContext, ObjectTemplatePtr pObject, const char *id, bool setter, bool query, bool deleter, bool enumerator, bool nonMasking);
+  extern void v8_ObjectTemplate_SetIndexedPropertyHandler(ContextPtr pContext, ObjectTemplatePtr pObject, const char *id, bool setter, bool query, bool deleter, bool enumerator, bool nonMasking);
   extern void v8_ObjectTemplate_SetInternalFieldCount(ContextPtr ctxptr, ObjectTemplatePtr object_ptr, int count);
   extern void v8_ObjectTemplate_Release(ContextPtr pContext, ObjectTemplatePtr pObjectTemplate);
 
@@ -216,7 +393,12 @@ extern "C"
     tARRAYBUFFER,
     tUNDEFINED,
     tNULL,
-    tDATE, // uses Float64 for msec since Unix epoch
+    tDATE,   // uses Float64 for msec since Unix epoch
+    tBIGINT, // uses Data for little endian 64 bit words and Bool for the sign
+    tMAP,
+    tSET,
+    tSYMBOL,     // uses Data for the description and Bool to use the global registry
+    tTYPEDARRAY, // uses Data for the contents and Kind for the type of array
   } ImmediateValueType;
 
   typedef struct
@@ -226,9 +408,34 @@ extern "C"
     bool _bool;
     double _float64;
     int64_t _int64;
+    Kind _kind;
   } ImmediateValue;
 
   extern CallResult v8_Context_Create(ContextPtr ctx, ImmediateValue val);
+  extern CallResult v8_Context_WellKnownSymbol(ContextPtr ctx, const char *name);
+  extern CallResult v8_Context_NewExternalArrayBuffer(ContextPtr ctx, void *data, size_t length, uint64_t id);
+  extern CallResult v8_Context_NewSharedArrayBuffer(ContextPtr ctx, SharedArrayBufferPtr buffer);
+
+  typedef struct
+  {
+    ByteArray data;
+    Error error;
+  } SerializedData;
+
+  extern SerializedData v8_Value_Serialize(ContextPtr ctx, ValuePtr value, uint32_t serializationId);
+  extern CallResult v8_Context_Deserialize(ContextPtr ctx, ByteArray data, uint32_t serializationId);
+
+  extern SharedArrayBufferPtr v8_SharedArrayBuffer_New(size_t size);
+  extern SharedArrayBufferPtr v8_Value_SharedArrayBuffer(ContextPtr ctx, ValuePtr value);
+  extern void *v8_SharedArrayBuffer_Data(SharedArrayBufferPtr buffer);
+  extern size_t v8_SharedArrayBuffer_ByteLength(SharedArrayBufferPtr buffer);
+  extern void v8_SharedArrayBuffer_Release(SharedArrayBufferPtr buffer);
+
+  extern CallResult v8_Context_CompileWasm(ContextPtr ctx, ByteArray data);
+  extern CallResult v8_Context_NewWasmModule(ContextPtr ctx, CompiledWasmModulePtr compiled);
+  extern CompiledWasmModulePtr v8_Value_CompiledWasmModule(ContextPtr ctx, ValuePtr value);
+  extern ByteArray v8_CompiledWasmModule_WireBytes(CompiledWasmModulePtr compiled);
+  extern void v8_CompiledWasmModule_Release(CompiledWasmModulePtr compiled);
 
   extern void v8_Value_SetWeak(ContextPtr pContext, ValuePtr pValue, const char *id);
   extern CallResult v8_Value_Get(ContextPtr ctx, ValuePtr value, const char *field);
@@ -252,6 +459,10 @@ extern "C"
 
   extern double v8_Value_Float64(ContextPtr ctx, ValuePtr value);
   extern int64_t v8_Value_Int64(ContextPtr ctx, ValuePtr value);
+  extern ByteArray v8_Value_BigIntWords(ContextPtr ctx, ValuePtr value, bool *signBit);
+  extern Error v8_Map_Set(ContextPtr ctx, ValuePtr map, ValuePtr key, ValuePtr value);
+  extern Error v8_Set_Add(ContextPtr ctx, ValuePtr set, ValuePtr value);
+  extern CallResult v8_Value_AsArray(ContextPtr ctx, ValuePtr value);
   extern int v8_Value_Bool(ContextPtr ctx, ValuePtr value);
   extern bool v8_Value_Equals(ContextPtr ctx, ValuePtr left, ValuePtr right);
   extern bool v8_Value_StrictEquals(ContextPtr ctx, ValuePtr left, ValuePtr right);
@@ -265,13 +476,17 @@ extern "C"
   extern CallResult v8_Resolver_GetPromise(ContextPtr pContext, ResolverPtr pResolver);
   extern void v8_Resolver_Release(ContextPtr pContext, ResolverPtr pResolver);
   extern CallResult v8_Value_PromiseInfo(ContextPtr ctx, ValuePtr value, int *promise_state);
+  extern ExceptionInfo v8_Value_ExceptionInfo(ContextPtr pContext, ValuePtr pValue);
 
   extern PrivatePtr v8_Private_New(IsolatePtr isoptr, const char *name);
 
   extern InspectorPtr v8_Inspector_New(IsolatePtr isolate_ptr, int id);
-  extern void v8_Inspector_AddContext(InspectorPtr inspector_ptr, ContextPtr ctxptr, const char *name);
+  extern void v8_Inspector_AddContext(InspectorPtr inspector_ptr, ContextPtr ctxptr, int contextGroupId, const char *name);
   extern void v8_Inspector_RemoveContext(InspectorPtr inspector_ptr, ContextPtr ctxptr);
-  extern void v8_Inspector_DispatchMessage(InspectorPtr inspector_ptr, const char *message);
+  extern void v8_Inspector_Connect(InspectorPtr pInspector, int sessionId, int contextGroupId);
+  extern void v8_Inspector_Disconnect(InspectorPtr pInspector, int sessionId);
+  extern void v8_Inspector_DispatchMessage(InspectorPtr inspector_ptr, int sessionId, const char *message);
+  extern void v8_Inspector_RequestInterrupt(InspectorPtr pInspector);
   extern void v8_Inspector_Release(InspectorPtr pInspector);
 
   extern CallResult v8_JSON_Parse(ContextPtr pContext, const char *data);
@@ -3,7 +3,7 @@
 
 extern "C"
 {
-  ContextPtr v8_Context_New(IsolatePtr pIsolate)
+  ContextPtr v8_Context_New(IsolatePtr pIsolate, int id, ContextOptions options)
   {
     ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
     v8::HandleScope handleScope(isolate);
@@ -26,6 +26,16 @@ extern "C"
     v8::Local<v8::String> key = v8::String::NewFromUtf8(isolate, "solid::info").ToLocalChecked();
     v8::Persistent<v8::Private> *privateKey = new v8::Persistent<v8::Private>(isolate, v8::Private::New(isolate, key));
     context->SetAlignedPointerInEmbedderData(2, privateKey);
+    context->SetEmbedderData(CONTEXT_ID_INDEX, v8::Integer::New(isolate, id));
+
+    // When code generation is disallowed V8 asks the isolate's
+    // ModifyCodeGenerationFromStringsCallback about each source instead.
+    context->AllowCodeGenerationFromStrings(options.allowCodeGenerationFromStrings);
+
+    if (options.securityToken.data != NULL)
+    {
+      context->SetSecurityToken(v8::String::NewFromUtf8(isolate, options.securityToken.data, v8::NewStringType::kNormal, options.securityToken.length).ToLocalChecked());
+    }
 
     return static_cast<ContextPtr>(pContext);
   }
@@ -63,14 +73,14 @@ extern "C"
 
     if (script.IsEmpty())
     {
-      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch.Exception());
+      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
     }
 
     v8::MaybeLocal<v8::Value> result = script.ToLocalChecked()->Run(context);
 
     if (result.IsEmpty())
     {
-      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch.Exception());
+      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
     }
     else
     {
@@ -152,10 +162,83 @@ extern "C"
     {
       return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(v8::Undefined(isolate)));
     }
+    case tBIGINT:
+    {
+      int wordCount = value._data.length / sizeof(uint64_t);
+      v8::MaybeLocal<v8::BigInt> bigint = v8::BigInt::NewFromWords(context, value._bool ? 1 : 0, wordCount, reinterpret_cast<const uint64_t *>(value._data.data));
+      if (!bigint.IsEmpty())
+      {
+        return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(bigint.ToLocalChecked()));
+      }
+      break;
+    }
+    case tMAP:
+    {
+      return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(v8::Map::New(isolate)));
+    }
+    case tSET:
+    {
+      return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(v8::Set::New(isolate)));
+    }
+    case tTYPEDARRAY:
+    {
+      v8::Local<v8::ArrayBuffer> buffer = v8::ArrayBuffer::New(isolate, value._data.length);
+      memcpy(buffer->GetBackingStore()->Data(), value._data.data, value._data.length);
+      v8::Local<v8::TypedArray> array = v8_TypedArray_New(value._kind, buffer, value._data.length);
+      if (!array.IsEmpty())
+      {
+        return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(array));
+      }
+      break;
+    }
+    case tSYMBOL:
+    {
+      v8::Local<v8::String> description = v8::String::NewFromUtf8(isolate, value._data.data, v8::NewStringType::kNormal, value._data.length).ToLocalChecked();
+      if (value._bool)
+      {
+        return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(v8::Symbol::For(isolate, description)));
+      }
+      return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(v8::Symbol::New(isolate, description)));
+    }
     }
 
     CallResult r = v8_CallResult();
 
     return r;
   }
+
+  CallResult v8_Context_WellKnownSymbol(ContextPtr pContext, const char *name)
+  {
+    VALUE_SCOPE(pContext);
+
+    std::string n(name);
+    v8::Local<v8::Symbol> symbol;
+
+    if (n == "asyncIterator")
+      symbol = v8::Symbol::GetAsyncIterator(isolate);
+    else if (n == "hasInstance")
+      symbol = v8::Symbol::GetHasInstance(isolate);
+    else if (n == "isConcatSpreadable")
+      symbol = v8::Symbol::GetIsConcatSpreadable(isolate);
+    else if (n == "iterator")
+      symbol = v8::Symbol::GetIterator(isolate);
+    else if (n == "match")
+      symbol = v8::Symbol::GetMatch(isolate);
+    else if (n == "replace")
+      symbol = v8::Symbol::GetReplace(isolate);
+    else if (n == "search")
+      symbol = v8::Symbol::GetSearch(isolate);
+    else if (n == "split")
+      symbol = v8::Symbol::GetSplit(isolate);
+    else if (n == "toPrimitive")
+      symbol = v8::Symbol::GetToPrimitive(isolate);
+    else if (n == "toStringTag")
+      symbol = v8::Symbol::GetToStringTag(isolate);
+    else if (n == "unscopables")
+      symbol = v8::Symbol::GetUnscopables(isolate);
+    else
+      return v8_Value_ValueTuple_Error(isolate, v8_String_FromString(isolate, "unknown well-known symbol: " + n));
+
+    return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(symbol));
+  }
 }
@@ -0,0 +1,101 @@
+#include "v8_c_private.h"
+
+#include <vector>
+#include <v8-profiler.h>
+
+typedef struct
+{
+  v8::Isolate *isolate;
+  v8::CpuProfiler *profiler;
+} CPUProfiler;
+
+static void v8_CPUProfileNode_Flatten(const v8::CpuProfileNode *node, int parentId, std::vector<CPUProfileNode> &nodes)
+{
+  nodes.push_back(CPUProfileNode{
+      int(node->GetNodeId()),
+      parentId,
+      v8_String_Create(node->GetFunctionNameStr()),
+      v8_String_Create(node->GetScriptResourceNameStr()),
+      node->GetScriptId(),
+      node->GetLineNumber(),
+      node->GetColumnNumber(),
+      int(node->GetHitCount())});
+
+  for (int i = 0; i < node->GetChildrenCount(); i++)
+  {
+    v8_CPUProfileNode_Flatten(node->GetChild(i), int(node->GetNodeId()), nodes);
+  }
+}
+
+extern "C"
+{
+  CPUProfilerPtr v8_CPUProfiler_New(IsolatePtr pIsolate)
+  {
+    ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
+
+    return static_cast<CPUProfilerPtr>(new CPUProfiler{isolate, v8::CpuProfiler::New(isolate)});
+  }
+
+  int v8_CPUProfiler_Start(CPUProfilerPtr pProfiler, const char *title, int samplingInterval)
+  {
+    CPUProfiler *profiler = static_cast<CPUProfiler *>(pProfiler);
+    ISOLATE_SCOPE(profiler->isolate);
+    v8::HandleScope handleScope(isolate);
+
+    v8::CpuProfilingOptions options(v8::kLeafNodeLineNumbers, v8::CpuProfilingOptions::kNoSampleLimit, samplingInterval);
+    return static_cast<int>(profiler->profiler->StartProfiling(v8_String_FromString(isolate, title), options));
+  }
+
+  CPUProfile v8_CPUProfiler_Stop(CPUProfilerPtr pProfiler, const char *title)
+  {
+    CPUProfiler *profiler = static_cast<CPUProfiler *>(pProfiler);
+    ISOLATE_SCOPE(profiler->isolate);
+    v8::HandleScope handleScope(isolate);
+
+    CPUProfile result;
+    memset(&result, 0, sizeof(CPUProfile));
+
+    v8::CpuProfile *profile = profiler->profiler->StopProfiling(v8_String_FromString(isolate, title));
+    if (profile == nullptr)
+    {
+      return result;
+    }
+
+    std::vector<CPUProfileNode> nodes;
+    v8_CPUProfileNode_Flatten(profile->GetTopDownRoot(), 0, nodes);
+
+    result.title = v8_String_Create(isolate, profile->GetTitle());
+    result.startTime = profile->GetStartTime();
+    result.endTime = profile->GetEndTime();
+
+    result.nodeCount = nodes.size();
+    result.nodes = static_cast<CPUProfileNode *>(malloc(sizeof(CPUProfileNode) * nodes.size()));
+    memcpy(result.nodes, nodes.data(), sizeof(CPUProfileNode) * nodes.size());
+
+    result.sampleCount = profile->GetSamplesCount();
+    if (result.sampleCount > 0)
+    {
+      result.samples = static_cast<int *>(malloc(sizeof(int) * result.sampleCount));
+      result.timestamps = static_cast<int64_t *>(malloc(sizeof(int64_t) * result.sampleCount));
+      for (int i = 0; i < result.sampleCount; i++)
+      {
+        result.samples[i] = int(profile->GetSample(i)->GetNodeId());
+        result.timestamps[i] = profile->GetSampleTimestamp(i);
+      }
+    }
+
+    profile->Delete();
+
+    return result;
+  }
+
+  void v8_CPUProfiler_Release(CPUProfilerPtr pProfiler)
+  {
+    CPUProfiler *profiler = static_cast<CPUProfiler *>(pProfiler);
+    {
+      ISOLATE_SCOPE(profiler->isolate);
+      profiler->profiler->Dispose();
+    }
+    delete profiler;
+  }
+}
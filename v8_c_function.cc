@@ -21,6 +21,7 @@ extern "C"
     ISOLATE_SCOPE(static_cast<Context *>(pContext)->isolate);
 
     FunctionTemplate *function = static_cast<FunctionTemplate *>(pFunction);
+    function->Reset();
     delete function;
   }
 
@@ -101,6 +102,7 @@ extern "C"
     ISOLATE_SCOPE(static_cast<Context *>(pContext)->isolate);
 
     ObjectTemplate *object = static_cast<ObjectTemplate *>(pObject);
+    object->Reset();
     delete object;
   }
 
@@ -131,6 +133,8 @@ extern "C"
       result = callbackHandler(CallbackInfo{
           kFunctionCallback,
           id,
+          isolate->GetData(0),
+          v8_Context_GetID(context),
           callerInfo,
           self,
           holder,
@@ -142,6 +146,12 @@ extern "C"
     }
     isolate->Enter();
 
+    if (isolate->IsExecutionTerminating())
+    {
+      v8_Value_ValueTuple_Release(context, result.result);
+      return;
+    }
+
     if (result.error.data != NULL)
     {
       v8::Local<v8::Value> error = v8::Exception::Error(v8_String_FromString(isolate, result.error));
@@ -186,6 +196,8 @@ extern "C"
       result = callbackHandler(CallbackInfo{
           kGetterCallback,
           id,
+          isolate->GetData(0),
+          v8_Context_GetID(context),
           callerInfo,
           self,
           holder,
@@ -197,6 +209,12 @@ extern "C"
     }
     isolate->Enter();
 
+    if (isolate->IsExecutionTerminating())
+    {
+      v8_Value_ValueTuple_Release(context, result.result);
+      return;
+    }
+
     if (result.error.data != NULL)
     {
       v8::Local<v8::Value> error = v8::Exception::Error(v8_String_FromString(isolate, result.error));
@@ -242,6 +260,8 @@ extern "C"
       result = callbackHandler(CallbackInfo{
           kSetterCallback,
           id,
+          isolate->GetData(0),
+          v8_Context_GetID(context),
           callerInfo,
           self,
           holder,
@@ -253,6 +273,12 @@ extern "C"
     }
     isolate->Enter();
 
+    if (isolate->IsExecutionTerminating())
+    {
+      v8_Value_ValueTuple_Release(context, result.result);
+      return;
+    }
+
     if (result.error.data != NULL)
     {
       v8::Local<v8::Value> error = v8::Exception::Error(v8_String_FromString(isolate, result.error));
@@ -0,0 +1,105 @@
+#include "v8_c_private.h"
+
+#include <algorithm>
+#include <vector>
+#include <v8-profiler.h>
+
+// HeapSnapshotOutputStream hands each chunk of a serialized snapshot to the
+// Go isolate, which writes it to the io.Writer passed to WriteHeapSnapshot.
+class HeapSnapshotOutputStream : public v8::OutputStream
+{
+public:
+  HeapSnapshotOutputStream(Pointer isolate) : isolate(isolate) {}
+
+  void EndOfStream() override {}
+
+  int GetChunkSize() override
+  {
+    return 64 * 1024;
+  }
+
+  WriteResult WriteAsciiChunk(char *data, int size) override
+  {
+    return heapSnapshotWriteChunk(isolate, data, size) ? kContinue : kAbort;
+  }
+
+private:
+  Pointer isolate;
+};
+
+static void v8_HeapProfileNode_Flatten(v8::Isolate *isolate, v8::AllocationProfile::Node *node, int parentId, std::vector<HeapProfileNode> &nodes)
+{
+  size_t selfSize = 0;
+  size_t selfCount = 0;
+  for (auto &allocation : node->allocations)
+  {
+    selfSize += allocation.size * allocation.count;
+    selfCount += allocation.count;
+  }
+
+  nodes.push_back(HeapProfileNode{
+      int(node->node_id),
+      parentId,
+      v8_String_Create(isolate, node->name),
+      v8_String_Create(isolate, node->script_name),
+      node->script_id,
+      node->line_number,
+      node->column_number,
+      selfSize,
+      selfCount});
+
+  for (auto child : node->children)
+  {
+    v8_HeapProfileNode_Flatten(isolate, child, int(node->node_id), nodes);
+  }
+}
+
+extern "C"
+{
+  Error v8_Isolate_WriteHeapSnapshot(IsolatePtr pIsolate)
+  {
+    ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
+    v8::HandleScope handleScope(isolate);
+
+    const v8::HeapSnapshot *snapshot = isolate->GetHeapProfiler()->TakeHeapSnapshot();
+    if (snapshot == NULL)
+    {
+      return v8_String_Create("Failed to take heap snapshot");
+    }
+
+    HeapSnapshotOutputStream stream(isolate->GetData(0));
+    snapshot->Serialize(&stream, v8::HeapSnapshot::kJSON);
+    const_cast<v8::HeapSnapshot *>(snapshot)->Delete();
+
+    return Error{NULL, 0};
+  }
+
+  bool v8_Isolate_StartSamplingHeapProfiler(IsolatePtr pIsolate, uint64_t interval, int depth)
+  {
+    ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
+
+    return isolate->GetHeapProfiler()->StartSamplingHeapProfiler(interval, depth);
+  }
+
+  HeapProfile v8_Isolate_StopSamplingHeapProfiler(IsolatePtr pIsolate)
+  {
+    ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
+    v8::HandleScope handleScope(isolate);
+
+    v8::HeapProfiler *profiler = isolate->GetHeapProfiler();
+    v8::AllocationProfile *profile = profiler->GetAllocationProfile();
+    if (profile == NULL)
+    {
+      return HeapProfile{0, NULL};
+    }
+
+    std::vector<HeapProfileNode> nodes;
+    v8_HeapProfileNode_Flatten(isolate, profile->GetRootNode(), 0, nodes);
+    delete profile;
+    profiler->StopSamplingHeapProfiler();
+
+    HeapProfileNode *out = (HeapProfileNode *)malloc(sizeof(HeapProfileNode) * nodes.size());
+    std::copy(nodes.begin(), nodes.end(), out);
+    return HeapProfile{int(nodes.size()), out};
+  }
+}
@@ -1,6 +1,7 @@
-
 #include "v8_c_private.h"
 
+#include <map>
+#include <vector>
 #include <v8-inspector.h>
 
 String StringFromStringView(v8::Isolate *isolate, const v8_inspector::StringView &view)
@@ -19,98 +20,135 @@ String StringFromStringView(v8::Isolate *isolate, const v8_inspector::StringView
   return v8_String_Create(isolate, s.ToLocalChecked());
 }
 
-class Inspector : public v8_inspector::V8Inspector::Channel, public v8_inspector::V8InspectorClient
+class Inspector;
+
+class InspectorSession : public v8_inspector::V8Inspector::Channel
+{
+public:
+  InspectorSession(Inspector *inspector, int sessionId, int contextGroupId);
+  void dispatchProtocolMessage(const v8_inspector::StringView &message);
+  void sendResponse(int callId, std::unique_ptr<v8_inspector::StringBuffer> message) override;
+  void sendNotification(std::unique_ptr<v8_inspector::StringBuffer> message) override;
+  void flushProtocolNotifications() override;
+
+private:
+  Inspector *inspector_;
+  int sessionId_;
+  std::unique_ptr<v8_inspector::V8InspectorSession> session_;
+};
+
+class Inspector : public v8_inspector::V8InspectorClient
 {
 public:
   Inspector(v8::Isolate *isolate, int inspectorId) : isolate_(isolate), inspectorId_(inspectorId)
   {
     inspector_ = v8_inspector::V8Inspector::create(isolate, this);
-    session_ = inspector_->connect(1, this, v8_inspector::StringView(), v8_inspector::V8Inspector::ClientTrustLevel::kUntrusted);
   }
   void contextCreated(const v8_inspector::V8ContextInfo &contextInfo);
   void contextDestroyed(v8::Local<v8::Context> context);
-  void dispatchProtocolMessage(v8_inspector::StringView &message);
-  void sendResponse(int callId, std::unique_ptr<v8_inspector::StringBuffer> message) override;
-  void sendNotification(std::unique_ptr<v8_inspector::StringBuffer> message) override;
-  void flushProtocolNotifications() override;
+  void connect(int sessionId, int contextGroupId);
+  void disconnect(int sessionId);
+  void dispatchProtocolMessage(int sessionId, const v8_inspector::StringView &message);
   void runMessageLoopOnPause(int contextGroupId) override;
   void quitMessageLoopOnPause() override;
+  void runIfWaitingForDebugger(int contextGroupId) override;
+
+  v8::Isolate *isolate() { return isolate_; }
+  int id() { return inspectorId_; }
+  v8_inspector::V8Inspector *inspector() { return inspector_.get(); }
 
 private:
   v8::Isolate *isolate_;
-  v8::Eternal<v8::Context> context_;
   std::unique_ptr<v8_inspector::V8Inspector> inspector_;
-  std::unique_ptr<v8_inspector::V8InspectorSession> session_;
+  std::map<int, std::unique_ptr<InspectorSession>> sessions_;
   int inspectorId_;
   bool runningNestedLoop_ = false;
-  bool terminated_ = false;
 };
 
-void Inspector::contextCreated(const v8_inspector::V8ContextInfo &contextInfo)
+InspectorSession::InspectorSession(Inspector *inspector, int sessionId, int contextGroupId) : inspector_(inspector), sessionId_(sessionId)
 {
-  v8::HandleScope handleScope(isolate_);
-  context_.Set(isolate_, contextInfo.context);
-  inspector_->contextCreated(contextInfo);
+  session_ = inspector->inspector()->connect(contextGroupId, this, v8_inspector::StringView(), v8_inspector::V8Inspector::ClientTrustLevel::kUntrusted);
 }
 
-void Inspector::contextDestroyed(v8::Local<v8::Context> context)
+void InspectorSession::dispatchProtocolMessage(const v8_inspector::StringView &message)
 {
-  inspector_->contextDestroyed(context);
+  session_->dispatchProtocolMessage(message);
 }
 
-void Inspector::dispatchProtocolMessage(v8_inspector::StringView &message)
+void InspectorSession::sendResponse(int callId, std::unique_ptr<v8_inspector::StringBuffer> message)
 {
-  ISOLATE_SCOPE(isolate_);
-  session_->dispatchProtocolMessage(message);
+  v8::HandleScope handle_scope(inspector_->isolate());
+
+  inspectorSendResponse(inspector_->id(), sessionId_, callId, StringFromStringView(inspector_->isolate(), message->string()));
 }
 
-void Inspector::sendResponse(int callId, std::unique_ptr<v8_inspector::StringBuffer> message)
+void InspectorSession::sendNotification(std::unique_ptr<v8_inspector::StringBuffer> message)
 {
-  ISOLATE_SCOPE(isolate_);
-  v8::HandleScope handle_scope(isolate);
+  v8::HandleScope handle_scope(inspector_->isolate());
 
-  inspectorSendResponse(inspectorId_, callId, StringFromStringView(isolate, message->string()));
+  inspectorSendNotification(inspector_->id(), sessionId_, StringFromStringView(inspector_->isolate(), message->string()));
 }
 
-void Inspector::sendNotification(std::unique_ptr<v8_inspector::StringBuffer> message)
+void InspectorSession::flushProtocolNotifications()
 {
-  ISOLATE_SCOPE(isolate_);
-  v8::HandleScope handle_scope(isolate);
+  inspectorFlushProtocolNotifications(inspector_->id(), sessionId_);
+}
 
-  inspectorSendNotification(inspectorId_, StringFromStringView(isolate, message->string()));
+void Inspector::contextCreated(const v8_inspector::V8ContextInfo &contextInfo)
+{
+  inspector_->contextCreated(contextInfo);
 }
 
-void Inspector::flushProtocolNotifications()
+void Inspector::contextDestroyed(v8::Local<v8::Context> context)
 {
-  ISOLATE_SCOPE(isolate_);
-  inspectorFlushProtocolNotifications(inspectorId_);
+  inspector_->contextDestroyed(context);
 }
 
-void Inspector::runMessageLoopOnPause(int contextGroupId)
+void Inspector::connect(int sessionId, int contextGroupId)
 {
-  if (runningNestedLoop_)
-    return;
+  sessions_[sessionId] = std::make_unique<InspectorSession>(this, sessionId, contextGroupId);
+}
 
-  terminated_ = false;
-  runningNestedLoop_ = true;
+void Inspector::disconnect(int sessionId)
+{
+  sessions_.erase(sessionId);
+}
 
-  while (!terminated_)
+void Inspector::dispatchProtocolMessage(int sessionId, const v8_inspector::StringView &message)
+{
+  auto session = sessions_.find(sessionId);
+  if (session != sessions_.end())
   {
-    bool more = true;
-    while (more)
-    {
-      // ISOLATE_SCOPE(isolate_);
-      more = v8::platform::PumpMessageLoop(platform, isolate_);
-    }
+    session->second->dispatchProtocolMessage(message);
   }
+}
 
-  terminated_ = false;
+// runMessageLoopOnPause is called on the isolate's thread while JavaScript is
+// paused. Go dispatches the messages that arrive for the inspector until
+// quitMessageLoopOnPause is called by one of them.
+void Inspector::runMessageLoopOnPause(int contextGroupId)
+{
+  if (runningNestedLoop_)
+    return;
+
+  runningNestedLoop_ = true;
+  inspectorRunMessageLoopOnPause(inspectorId_, contextGroupId);
   runningNestedLoop_ = false;
 }
 
 void Inspector::quitMessageLoopOnPause()
 {
-  terminated_ = true;
+  inspectorQuitMessageLoopOnPause(inspectorId_);
+}
+
+void Inspector::runIfWaitingForDebugger(int contextGroupId)
+{
+  inspectorRunIfWaitingForDebugger(inspectorId_, contextGroupId);
+}
+
+static void InspectorInterruptCallback(v8::Isolate *isolate, void *data)
+{
+  inspectorDispatchPendingMessages(static_cast<int>(reinterpret_cast<intptr_t>(data)));
 }
 
 extern "C"
@@ -122,13 +160,13 @@ extern "C"
     return (InspectorPtr)inspector;
   }
 
-  void v8_Inspector_AddContext(InspectorPtr pInspector, ContextPtr pContext, const char *name)
+  void v8_Inspector_AddContext(InspectorPtr pInspector, ContextPtr pContext, int contextGroupId, const char *name)
   {
     VALUE_SCOPE(pContext);
     Inspector *inspector = static_cast<Inspector *>(pInspector);
 
     v8_inspector::StringView contextName((const uint8_t *)name, strlen(name));
-    inspector->contextCreated(v8_inspector::V8ContextInfo(context, 1, contextName));
+    inspector->contextCreated(v8_inspector::V8ContextInfo(context, contextGroupId, contextName));
   }
 
   void v8_Inspector_RemoveContext(InspectorPtr pInspector, ContextPtr pContext)
@@ -139,17 +177,50 @@ extern "C"
     inspector->contextDestroyed(context);
   }
 
-  void v8_Inspector_DispatchMessage(InspectorPtr pInspector, const char *message)
+  void v8_Inspector_Connect(InspectorPtr pInspector, int sessionId, int contextGroupId)
   {
     Inspector *inspector = static_cast<Inspector *>(pInspector);
+    ISOLATE_SCOPE(inspector->isolate());
+    v8::HandleScope handleScope(isolate);
 
-    v8_inspector::StringView messageView((const uint8_t *)message, strlen(message));
-    inspector->dispatchProtocolMessage(messageView);
+    inspector->connect(sessionId, contextGroupId);
+  }
+
+  void v8_Inspector_Disconnect(InspectorPtr pInspector, int sessionId)
+  {
+    Inspector *inspector = static_cast<Inspector *>(pInspector);
+    ISOLATE_SCOPE(inspector->isolate());
+    v8::HandleScope handleScope(isolate);
+
+    inspector->disconnect(sessionId);
+  }
+
+  void v8_Inspector_DispatchMessage(InspectorPtr pInspector, int sessionId, const char *message)
+  {
+    Inspector *inspector = static_cast<Inspector *>(pInspector);
+    ISOLATE_SCOPE(inspector->isolate());
+    v8::HandleScope handleScope(isolate);
+
+    // Protocol messages are UTF-8, which StringView only accepts as UTF-16.
+    v8::Local<v8::String> s = v8_String_FromString(isolate, message);
+    std::vector<uint16_t> buffer(s->Length());
+    s->Write(isolate, buffer.data(), 0, s->Length());
+
+    v8_inspector::StringView messageView(buffer.data(), buffer.size());
+    inspector->dispatchProtocolMessage(sessionId, messageView);
+  }
+
+  void v8_Inspector_RequestInterrupt(InspectorPtr pInspector)
+  {
+    Inspector *inspector = static_cast<Inspector *>(pInspector);
+    inspector->isolate()->RequestInterrupt(InspectorInterruptCallback, reinterpret_cast<void *>(static_cast<intptr_t>(inspector->id())));
   }
 
   void v8_Inspector_Release(InspectorPtr pInspector)
   {
     Inspector *inspector = static_cast<Inspector *>(pInspector);
+    ISOLATE_SCOPE(inspector->isolate());
+
     delete inspector;
   }
 }
@@ -1,26 +1,206 @@
 
 #include "v8_c_private.h"
 
+#include <algorithm>
+#include <atomic>
+#include <vector>
+
 auto allocator = v8::ArrayBuffer::Allocator::NewDefaultAllocator();
 void v8_Isolate_AddImportModuleDynamicallyCallbackHandler(IsolatePtr pIsolate);
 void BeforeCallEnteredCallback(v8::Isolate *isolate);
 void CallCompletedCallback(v8::Isolate *isolate);
+size_t NearHeapLimitCallback(void *data, size_t currentHeapLimit, size_t initialHeapLimit);
+v8::ModifyCodeGenerationFromStringsResult ModifyCodeGenerationFromStringsCallback(v8::Local<v8::Context> context, v8::Local<v8::Value> source, bool isCodeLike);
+bool AllowWasmCodeGenerationCallback(v8::Local<v8::Context> context, v8::Local<v8::String> source);
+
+const intptr_t externalReferences[] = {
+    reinterpret_cast<intptr_t>(FunctionCallbackHandler),
+    reinterpret_cast<intptr_t>(GetterCallbackHandler),
+    reinterpret_cast<intptr_t>(SetterCallbackHandler),
+    reinterpret_cast<intptr_t>(SyntheticModuleEvaluationSteps),
+    reinterpret_cast<intptr_t>(NamedPropertyGetterCallbackHandler),
+    reinterpret_cast<intptr_t>(NamedPropertySetterCallbackHandler),
+    reinterpret_cast<intptr_t>(NamedPropertyQueryCallbackHandler),
+    reinterpret_cast<intptr_t>(NamedPropertyDeleterCallbackHandler),
+    reinterpret_cast<intptr_t>(NamedPropertyEnumeratorCallbackHandler),
+    reinterpret_cast<intptr_t>(IndexedPropertyGetterCallbackHandler),
+    reinterpret_cast<intptr_t>(IndexedPropertySetterCallbackHandler),
+    reinterpret_cast<intptr_t>(IndexedPropertyQueryCallbackHandler),
+    reinterpret_cast<intptr_t>(IndexedPropertyDeleterCallbackHandler),
+    reinterpret_cast<intptr_t>(IndexedPropertyEnumeratorCallbackHandler),
+    0};
+
+// internal fields hold pointers to value tuples owned by the Go side of the
+// bridge, which are not carried over into a snapshot
+v8::StartupData SerializeInternalFieldCallback(v8::Local<v8::Object> holder, int index, void *data)
+{
+  return v8::StartupData{nullptr, 0};
+}
+
+class LimitedArrayBufferAllocator : public v8::ArrayBuffer::Allocator
+{
+public:
+  LimitedArrayBufferAllocator(size_t limit) : allocator_(v8::ArrayBuffer::Allocator::NewDefaultAllocator()), limit_(limit), allocated_(0) {}
+  ~LimitedArrayBufferAllocator() override { delete allocator_; }
+
+  void *Allocate(size_t length) override
+  {
+    if (!reserve(length))
+    {
+      return nullptr;
+    }
+
+    void *data = allocator_->Allocate(length);
+    if (data == nullptr)
+    {
+      allocated_ -= length;
+    }
+    return data;
+  }
+
+  void *AllocateUninitialized(size_t length) override
+  {
+    if (!reserve(length))
+    {
+      return nullptr;
+    }
+
+    void *data = allocator_->AllocateUninitialized(length);
+    if (data == nullptr)
+    {
+      allocated_ -= length;
+    }
+    return data;
+  }
+
+  void Free(void *data, size_t length) override
+  {
+    allocator_->Free(data, length);
+    allocated_ -= length;
+  }
+
+private:
+  bool reserve(size_t length)
+  {
+    size_t current = allocated_.load();
+    do
+    {
+      if (current + length > limit_)
+      {
+        return false;
+      }
+    } while (!allocated_.compare_exchange_weak(current, current + length));
+    return true;
+  }
+
+  v8::ArrayBuffer::Allocator *allocator_;
+  size_t limit_;
+  std::atomic<size_t> allocated_;
+};
 
 
 extern "C"
 {
-  // StartupData v8_CreateSnapshotDataBlob(const char *js)
-  // {
-  //   v8::StartupData data = v8::V8::CreateSnapshotDataBlob(js);
-  //   return StartupData{data.data, data.raw_size};
-  // }
+  SnapshotCreatorPtr v8_SnapshotCreator_New(void *data)
+  {
+    v8::SnapshotCreator *creator = new v8::SnapshotCreator(externalReferences);
+    v8::Isolate *isolate = creator->GetIsolate();
+    isolate->SetData(0, data);
+
+    v8_Isolate_AddImportModuleDynamicallyCallbackHandler(isolate);
+    isolate->AddBeforeCallEnteredCallback(BeforeCallEnteredCallback);
+    isolate->AddCallCompletedCallback(CallCompletedCallback);
+    isolate->AddNearHeapLimitCallback(NearHeapLimitCallback, isolate);
+    isolate->AutomaticallyRestoreInitialHeapLimit();
 
-  IsolatePtr v8_Isolate_New(void *data, StartupData startupData)
+    return static_cast<SnapshotCreatorPtr>(creator);
+  }
+
+  IsolatePtr v8_SnapshotCreator_GetIsolate(SnapshotCreatorPtr pCreator)
   {
-    std::shared_ptr<v8::ArrayBuffer::Allocator> allocator(v8::ArrayBuffer::Allocator::NewDefaultAllocator());
+    return static_cast<IsolatePtr>(static_cast<v8::SnapshotCreator *>(pCreator)->GetIsolate());
+  }
+
+  StartupData v8_SnapshotCreator_CreateBlob(SnapshotCreatorPtr pCreator, ContextPtr pContext)
+  {
+    v8::SnapshotCreator *creator = static_cast<v8::SnapshotCreator *>(pCreator);
+    v8::Isolate *isolate = creator->GetIsolate();
+    v8::Locker locker(isolate);
+
+    {
+      v8::HandleScope handleScope(isolate);
+
+      Context *context = static_cast<Context *>(pContext);
+      v8::Local<v8::Context> local = context->pointer.Get(isolate);
+
+      // the private key is recreated for every context, including those
+      // restored from the snapshot
+      Private *privateKey = static_cast<Private *>(local->GetAlignedPointerFromEmbedderData(2));
+      local->SetAlignedPointerInEmbedderData(2, nullptr);
+      privateKey->Reset();
+      delete privateKey;
+
+      creator->SetDefaultContext(local, v8::SerializeInternalFieldsCallback(SerializeInternalFieldCallback, nullptr));
+      context->pointer.Reset();
+    }
+
+    v8_Isolate_ReleaseSyntheticModuleExports(isolate);
+
+    v8::StartupData blob = creator->CreateBlob(v8::SnapshotCreator::FunctionCodeHandling::kKeep);
+    if (blob.data == nullptr)
+    {
+      return StartupData{NULL, 0};
+    }
+
+    char *data = static_cast<char *>(malloc(blob.raw_size));
+    memcpy(data, blob.data, blob.raw_size);
+    delete[] blob.data;
+
+    return StartupData{data, blob.raw_size};
+  }
+
+  void v8_SnapshotCreator_Release(SnapshotCreatorPtr pCreator)
+  {
+    v8::SnapshotCreator *creator = static_cast<v8::SnapshotCreator *>(pCreator);
+    {
+      v8::Locker locker(creator->GetIsolate());
+      v8_Isolate_ReleaseSyntheticModuleExports(creator->GetIsolate());
+    }
+    delete creator;
+  }
+
+  IsolatePtr v8_Isolate_New(void *data, StartupData startupData, ResourceConstraints constraints)
+  {
+    std::shared_ptr<v8::ArrayBuffer::Allocator> allocator;
+    if (constraints.maxArrayBufferSize > 0)
+    {
+      allocator.reset(new LimitedArrayBufferAllocator(constraints.maxArrayBufferSize));
+    }
+    else
+    {
+      allocator.reset(v8::ArrayBuffer::Allocator::NewDefaultAllocator());
+    }
 
     v8::Isolate::CreateParams createParams;
     createParams.array_buffer_allocator_shared = allocator;
+    createParams.external_references = externalReferences;
+
+    if (constraints.initialOldSpaceSize > 0)
+    {
+      createParams.constraints.set_initial_old_generation_size_in_bytes(constraints.initialOldSpaceSize);
+    }
+    if (constraints.maxOldSpaceSize > 0)
+    {
+      createParams.constraints.set_max_old_generation_size_in_bytes(constraints.maxOldSpaceSize);
+    }
+    if (constraints.initialYoungSpaceSize > 0)
+    {
+      createParams.constraints.set_initial_young_generation_size_in_bytes(constraints.initialYoungSpaceSize);
+    }
+    if (constraints.maxYoungSpaceSize > 0)
+    {
+      createParams.constraints.set_max_young_generation_size_in_bytes(constraints.maxYoungSpaceSize);
+    }
 
     if (startupData.length > 0 && startupData.data != NULL)
     {
@@ -37,6 +217,10 @@ extern "C"
     v8_Isolate_AddImportModuleDynamicallyCallbackHandler(isolate);
     isolate->AddBeforeCallEnteredCallback(BeforeCallEnteredCallback);
     isolate->AddCallCompletedCallback(CallCompletedCallback);
+    isolate->AddNearHeapLimitCallback(NearHeapLimitCallback, isolate);
+    isolate->AutomaticallyRestoreInitialHeapLimit();
+    isolate->SetModifyCodeGenerationFromStringsCallback(ModifyCodeGenerationFromStringsCallback);
+    isolate->SetAllowWasmCodeGenerationCallback(AllowWasmCodeGenerationCallback);
 
     return isolate;
   }
@@ -86,6 +270,13 @@ extern "C"
     isolate->TerminateExecution();
   }
 
+  void v8_Isolate_CancelTerminateExecution(IsolatePtr pIsolate)
+  {
+    ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
+
+    isolate->CancelTerminateExecution();
+  }
+
   void v8_Isolate_RequestGarbageCollectionForTesting(IsolatePtr pIsolate)
   {
     ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
@@ -117,6 +308,72 @@ extern "C"
         hs.does_zap_garbage()};
   }
 
+  HeapSpaceStatisticsList v8_Isolate_GetHeapSpaceStatistics(IsolatePtr pIsolate)
+  {
+    if (pIsolate == NULL)
+    {
+      return HeapSpaceStatisticsList{0, NULL};
+    }
+
+    ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
+
+    int count = int(isolate->NumberOfHeapSpaces());
+    HeapSpaceStatistics *spaces = (HeapSpaceStatistics *)malloc(sizeof(HeapSpaceStatistics) * count);
+
+    for (int i = 0; i < count; i++)
+    {
+      v8::HeapSpaceStatistics hss;
+      isolate->GetHeapSpaceStatistics(&hss, i);
+
+      spaces[i] = HeapSpaceStatistics{
+          v8_String_Create(hss.space_name()),
+          hss.space_size(),
+          hss.space_used_size(),
+          hss.space_available_size(),
+          hss.physical_space_size()};
+    }
+
+    return HeapSpaceStatisticsList{count, spaces};
+  }
+
+  HeapObjectStatisticsList v8_Isolate_GetHeapObjectStatistics(IsolatePtr pIsolate)
+  {
+    if (pIsolate == NULL)
+    {
+      return HeapObjectStatisticsList{0, NULL};
+    }
+
+    ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
+
+    std::vector<HeapObjectStatistics> objects;
+
+    // V8 only tracks object statistics when started with --track-gc-object-stats.
+    for (size_t i = 0; i < isolate->NumberOfTrackedHeapObjectTypes(); i++)
+    {
+      v8::HeapObjectStatistics hos;
+      // some type indexes are unnamed, and are reported as untracked
+      if (!isolate->GetHeapObjectStatisticsAtLastGC(&hos, i) || hos.object_count() == 0)
+      {
+        continue;
+      }
+
+      objects.push_back(HeapObjectStatistics{
+          v8_String_Create(hos.object_type()),
+          v8_String_Create(hos.object_sub_type()),
+          hos.object_count(),
+          hos.object_size()});
+    }
+
+    if (objects.empty())
+    {
+      return HeapObjectStatisticsList{0, NULL};
+    }
+
+    HeapObjectStatistics *out = (HeapObjectStatistics *)malloc(sizeof(HeapObjectStatistics) * objects.size());
+    std::copy(objects.begin(), objects.end(), out);
+    return HeapObjectStatisticsList{int(objects.size()), out};
+  }
+
   void v8_Isolate_LowMemoryNotification(IsolatePtr pIsolate)
   {
     if (pIsolate == NULL)
@@ -134,6 +391,16 @@ extern "C"
       return;
     }
     v8::Isolate *isolate = static_cast<v8::Isolate *>(isolate_ptr);
+    {
+      // the call releasing the isolate has entered it, and V8 refuses to
+      // dispose of an isolate that is still entered
+      v8::Locker locker(isolate);
+      v8_Isolate_ReleaseSyntheticModuleExports(isolate);
+      while (isolate->IsInUse())
+      {
+        isolate->Exit();
+      }
+    }
     isolate->Dispose();
   }
 }
@@ -145,3 +412,53 @@ void BeforeCallEnteredCallback(v8::Isolate *isolate) {
 void CallCompletedCallback(v8::Isolate *isolate) {
   callCompletedCallback(isolate->GetData(0));
 }
+
+size_t NearHeapLimitCallback(void *data, size_t currentHeapLimit, size_t initialHeapLimit)
+{
+  v8::Isolate *isolate = static_cast<v8::Isolate *>(data);
+
+  return nearHeapLimitCallback(isolate->GetData(0), currentHeapLimit, initialHeapLimit);
+}
+
+v8::ModifyCodeGenerationFromStringsResult ModifyCodeGenerationFromStringsCallback(v8::Local<v8::Context> context, v8::Local<v8::Value> source, bool isCodeLike)
+{
+  ISOLATE_SCOPE(context->GetIsolate());
+  v8::HandleScope handleScope(isolate);
+
+  // eval of anything but a string returns it unchanged without compiling.
+  if (!source->IsString())
+  {
+    return {true, v8::MaybeLocal<v8::String>()};
+  }
+
+  v8::String::Utf8Value value(isolate, source);
+  int contextId = v8_Context_GetID(context);
+
+  bool allowed;
+  {
+    isolate->Exit();
+    v8::Unlocker unlocker(isolate);
+
+    allowed = allowCodeGenerationCallback(isolate->GetData(0), contextId, String{*value, value.length()});
+  }
+  isolate->Enter();
+
+  return {allowed, v8::MaybeLocal<v8::String>()};
+}
+
+bool AllowWasmCodeGenerationCallback(v8::Local<v8::Context> context, v8::Local<v8::String> source)
+{
+  ISOLATE_SCOPE(context->GetIsolate());
+  int contextId = v8_Context_GetID(context);
+
+  bool allowed;
+  {
+    isolate->Exit();
+    v8::Unlocker unlocker(isolate);
+
+    allowed = allowWasmCodeGenerationCallback(isolate->GetData(0), contextId);
+  }
+  isolate->Enter();
+
+  return allowed;
+}
@@ -1,6 +1,321 @@
 
 #include "v8_c_private.h"
 
+#include <unordered_map>
+#include <vector>
+
+typedef struct
+{
+  v8::Global<v8::Module> module;
+  v8::Global<v8::Value> exports;
+} SyntheticModuleExports;
+
+// exports of an isolate's synthetic modules waiting to be evaluated, keyed by
+// the identity hash of the module
+typedef std::unordered_multimap<int, SyntheticModuleExports *> SyntheticModuleExportsMap;
+
+inline SyntheticModuleExportsMap *v8_Isolate_SyntheticModuleExports(v8::Isolate *isolate, bool create)
+{
+  SyntheticModuleExportsMap *exports = static_cast<SyntheticModuleExportsMap *>(isolate->GetData(SYNTHETIC_MODULE_EXPORTS_SLOT));
+  if (exports == nullptr && create)
+  {
+    exports = new SyntheticModuleExportsMap();
+    isolate->SetData(SYNTHETIC_MODULE_EXPORTS_SLOT, exports);
+  }
+  return exports;
+}
+
+// takeSyntheticModuleExports removes the exports of module from those of its
+// isolate, returning nullptr if it has none.
+SyntheticModuleExports *takeSyntheticModuleExports(v8::Isolate *isolate, v8::Local<v8::Module> module)
+{
+  SyntheticModuleExportsMap *exports = v8_Isolate_SyntheticModuleExports(isolate, false);
+  if (exports == nullptr)
+  {
+    return nullptr;
+  }
+
+  auto range = exports->equal_range(module->GetIdentityHash());
+  for (auto it = range.first; it != range.second; it++)
+  {
+    if (it->second->module.Get(isolate) == module)
+    {
+      SyntheticModuleExports *entry = it->second;
+      exports->erase(it);
+      return entry;
+    }
+  }
+
+  return nullptr;
+}
+
+void v8_Isolate_ReleaseSyntheticModuleExports(v8::Isolate *isolate)
+{
+  SyntheticModuleExportsMap *exports = v8_Isolate_SyntheticModuleExports(isolate, false);
+  if (exports == nullptr)
+  {
+    return;
+  }
+
+  for (auto it = exports->begin(); it != exports->end(); it++)
+  {
+    delete it->second;
+  }
+  delete exports;
+  isolate->SetData(SYNTHETIC_MODULE_EXPORTS_SLOT, nullptr);
+}
+
+v8::MaybeLocal<v8::Module> ResolveModuleCallback(v8::Local<v8::Context> context, v8::Local<v8::String> specifier, v8::Local<v8::FixedArray> importAssertions, v8::Local<v8::Module> referrer)
+{
+  ISOLATE_SCOPE(context->GetIsolate());
+  v8::EscapableHandleScope handleScope(isolate);
+
+  String rSpecifier = v8_String_Create(isolate, specifier);
+
+  ModuleResult result;
+  {
+    isolate->Exit();
+    v8::Unlocker unlocker(isolate);
+
+    result = resolveModuleCallbackHandler(ResolveModuleCallbackInfo{
+        isolate->GetData(0),
+        v8_Context_GetID(context),
+        referrer->ScriptId(),
+        rSpecifier,
+    });
+  }
+  isolate->Enter();
+
+  free((void *)rSpecifier.data);
+
+  if (result.module == NULL)
+  {
+    if (result.result.error.data != NULL)
+    {
+      isolate->ThrowException(v8::Exception::Error(v8_String_FromString(isolate, result.result.error)));
+      free((void *)result.result.error.data);
+    }
+    else if (result.result.result != NULL)
+    {
+      isolate->ThrowException(static_cast<Value *>(result.result.result->value)->Get(isolate));
+    }
+    v8_Value_ValueTuple_Release(context, result.result.result);
+    return v8::MaybeLocal<v8::Module>();
+  }
+
+  return handleScope.Escape(static_cast<Module *>(result.module)->Get(isolate));
+}
+
+void ImportMetaCallbackHandler(v8::Local<v8::Context> context, v8::Local<v8::Module> module, v8::Local<v8::Object> meta)
+{
+  ISOLATE_SCOPE(context->GetIsolate());
+  v8::HandleScope handleScope(isolate);
+
+  String url;
+  {
+    isolate->Exit();
+    v8::Unlocker unlocker(isolate);
+
+    url = importMetaCallbackHandler(isolate->GetData(0), v8_Context_GetID(context), module->ScriptId());
+  }
+  isolate->Enter();
+
+  if (url.data != NULL)
+  {
+    meta->CreateDataProperty(context, v8::String::NewFromUtf8Literal(isolate, "url"), v8_String_FromString(isolate, url)).Check();
+    free((void *)url.data);
+  }
+}
+
+v8::MaybeLocal<v8::Value> SyntheticModuleEvaluationSteps(v8::Local<v8::Context> context, v8::Local<v8::Module> module)
+{
+  v8::Isolate *isolate = context->GetIsolate();
+  v8::EscapableHandleScope handleScope(isolate);
+
+  SyntheticModuleExports *entry = takeSyntheticModuleExports(isolate, module);
+  if (entry != nullptr)
+  {
+    v8::Local<v8::Value> exports = entry->exports.Get(isolate);
+    delete entry;
+
+    if (module->SetSyntheticModuleExport(isolate, v8::String::NewFromUtf8Literal(isolate, "default"), exports).IsNothing())
+    {
+      return v8::MaybeLocal<v8::Value>();
+    }
+
+    if (exports->IsObject())
+    {
+      v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(exports);
+      v8::Local<v8::Array> names = object->GetOwnPropertyNames(context).ToLocalChecked();
+      for (uint32_t i = 0; i < names->Length(); i++)
+      {
+        v8::Local<v8::Value> name = names->Get(context, i).ToLocalChecked();
+        if (!name->IsString() || name->StrictEquals(v8::String::NewFromUtf8Literal(isolate, "default")))
+        {
+          continue;
+        }
+
+        v8::Local<v8::Value> value;
+        if (!object->Get(context, name).ToLocal(&value) ||
+            module->SetSyntheticModuleExport(isolate, v8::Local<v8::String>::Cast(name), value).IsNothing())
+        {
+          return v8::MaybeLocal<v8::Value>();
+        }
+      }
+    }
+  }
+
+  v8::Local<v8::Promise::Resolver> resolver = v8::Promise::Resolver::New(context).ToLocalChecked();
+  resolver->Resolve(context, v8::Undefined(isolate)).Check();
+  return handleScope.Escape(resolver->GetPromise());
+}
+
+extern "C"
+{
+  ModuleResult v8_Module_Compile(ContextPtr pContext, const char *code, const char *filename, const char *id)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::TryCatch tryCatch(isolate);
+    tryCatch.SetVerbose(false);
+
+    filename = filename ? filename : "(no file)";
+
+    v8::Local<v8::PrimitiveArray> hostDefinedOptions = v8::PrimitiveArray::New(isolate, 1);
+    hostDefinedOptions->Set(isolate, 0, v8::String::NewFromUtf8(isolate, id).ToLocalChecked());
+
+    v8::ScriptOrigin origin(
+      isolate,
+      v8::String::NewFromUtf8(isolate, filename).ToLocalChecked(),
+      0,
+      0,
+      false,
+      -1,
+      v8::Local<v8::Value>(),
+      false,
+      false,
+      true,
+      hostDefinedOptions
+    );
+
+    v8::ScriptCompiler::Source source(v8::String::NewFromUtf8(isolate, code).ToLocalChecked(), origin);
+    v8::MaybeLocal<v8::Module> module = v8::ScriptCompiler::CompileModule(isolate, &source);
+
+    if (module.IsEmpty())
+    {
+      return ModuleResult{NULL, 0, v8_Value_ValueTuple_Exception(isolate, context, tryCatch)};
+    }
+
+    v8::Local<v8::Module> local = module.ToLocalChecked();
+    return ModuleResult{static_cast<ModulePtr>(new Module(isolate, local)), local->ScriptId(), CallResult{}};
+  }
+
+  ModuleResult v8_Module_NewSynthetic(ContextPtr pContext, const char *name, ValuePtr pExports)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Value> exports = static_cast<Value *>(pExports)->Get(isolate);
+
+    std::vector<v8::Local<v8::String>> exportNames;
+    exportNames.push_back(v8::String::NewFromUtf8Literal(isolate, "default"));
+
+    if (exports->IsObject())
+    {
+      v8::Local<v8::Array> names;
+      if (!v8::Local<v8::Object>::Cast(exports)->GetOwnPropertyNames(context).ToLocal(&names))
+      {
+        return ModuleResult{NULL, 0, v8_Value_ValueTuple_Error(isolate, v8::String::NewFromUtf8Literal(isolate, "unable to read module exports"))};
+      }
+
+      for (uint32_t i = 0; i < names->Length(); i++)
+      {
+        v8::Local<v8::Value> name = names->Get(context, i).ToLocalChecked();
+        if (name->IsString() && !name->StrictEquals(exportNames[0]))
+        {
+          exportNames.push_back(v8::Local<v8::String>::Cast(name));
+        }
+      }
+    }
+
+    v8::Local<v8::Module> module = v8::Module::CreateSyntheticModule(
+        isolate,
+        v8::String::NewFromUtf8(isolate, name).ToLocalChecked(),
+        exportNames,
+        SyntheticModuleEvaluationSteps);
+
+    SyntheticModuleExports *entry = new SyntheticModuleExports{v8::Global<v8::Module>(isolate, module), v8::Global<v8::Value>(isolate, exports)};
+    v8_Isolate_SyntheticModuleExports(isolate, true)->emplace(module->GetIdentityHash(), entry);
+
+    return ModuleResult{static_cast<ModulePtr>(new Module(isolate, module)), 0, CallResult{}};
+  }
+
+  CallResult v8_Module_Instantiate(ContextPtr pContext, ModulePtr pModule)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::TryCatch tryCatch(isolate);
+    tryCatch.SetVerbose(false);
+
+    v8::Local<v8::Module> module = static_cast<Module *>(pModule)->Get(isolate);
+    if (module->InstantiateModule(context, ResolveModuleCallback).IsNothing())
+    {
+      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
+    }
+
+    return v8_Value_ValueTuple(isolate, context, v8::Undefined(isolate));
+  }
+
+  CallResult v8_Module_Evaluate(ContextPtr pContext, ModulePtr pModule)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::TryCatch tryCatch(isolate);
+    tryCatch.SetVerbose(false);
+
+    v8::Local<v8::Module> module = static_cast<Module *>(pModule)->Get(isolate);
+    v8::MaybeLocal<v8::Value> result = module->Evaluate(context);
+
+    if (result.IsEmpty())
+    {
+      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
+    }
+
+    return v8_Value_ValueTuple(isolate, context, result.ToLocalChecked());
+  }
+
+  CallResult v8_Module_GetNamespace(ContextPtr pContext, ModulePtr pModule)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Module> module = static_cast<Module *>(pModule)->Get(isolate);
+    if (module->GetStatus() < v8::Module::kInstantiated)
+    {
+      return v8_Value_ValueTuple_Error(isolate, v8::String::NewFromUtf8Literal(isolate, "module is not instantiated"));
+    }
+
+    return v8_Value_ValueTuple(isolate, context, module->GetModuleNamespace());
+  }
+
+  void v8_Module_Release(ContextPtr pContext, ModulePtr pModule)
+  {
+    if (pModule == NULL)
+    {
+      return;
+    }
+
+    ISOLATE_SCOPE(static_cast<Context *>(pContext)->isolate);
+    v8::HandleScope handleScope(isolate);
+
+    Module *module = static_cast<Module *>(pModule);
+
+    // a synthetic module that was never evaluated still holds its exports
+    delete takeSyntheticModuleExports(isolate, module->Get(isolate));
+
+    module->Reset();
+    delete module;
+  }
+}
+
 v8::MaybeLocal<v8::Promise> ImportModuleDynamicallyCallbackHandler(v8::Local<v8::Context> context, v8::Local<v8::Data> hostDefinedOptions, v8::Local<v8::Value> resourceName, v8::Local<v8::String> specifier, v8::Local<v8::FixedArray> importAssertions)
 {
   ISOLATE_SCOPE(context->GetIsolate());
@@ -44,4 +359,5 @@ v8::MaybeLocal<v8::Promise> ImportModuleDynamicallyCallbackHandler(v8::Local<v8:
 void v8_Isolate_AddImportModuleDynamicallyCallbackHandler(IsolatePtr pIsolate) {
   v8::Isolate *isolate = static_cast<v8::Isolate *>(pIsolate);
   isolate->SetHostImportModuleDynamicallyCallback(ImportModuleDynamicallyCallbackHandler);
+  isolate->SetHostInitializeImportMetaObjectCallback(ImportMetaCallbackHandler);
 }
\ No newline at end of file
@@ -40,6 +40,21 @@ typedef v8::Persistent<v8::ObjectTemplate> ObjectTemplate;
 typedef v8::Persistent<v8::Value> Value;
 typedef v8::Persistent<v8::Private> Private;
 typedef v8::Persistent<v8::ScriptOrModule> Referrer;
+typedef v8::Persistent<v8::UnboundScript> Script;
+typedef v8::Persistent<v8::Module> Module;
+
+#define CONTEXT_ID_INDEX 3
+
+// isolate data slot holding the exports of synthetic modules that are yet to
+// be evaluated
+#define SYNTHETIC_MODULE_EXPORTS_SLOT 1
+
+void v8_Isolate_ReleaseSyntheticModuleExports(v8::Isolate *isolate);
+
+inline int v8_Context_GetID(v8::Local<v8::Context> context)
+{
+  return v8::Local<v8::Integer>::Cast(context->GetEmbedderData(CONTEXT_ID_INDEX))->Value();
+}
 
 // inline v8::Local<v8::String> v8_StackTrace_FormatException(v8::Isolate *isolate, v8::Local<v8::Context> ctx, v8::TryCatch &try_catch);
 inline CallerInfo v8_StackTrace_CallerInfo(v8::Isolate *isolate);
@@ -48,23 +63,55 @@ extern "C"
 {
   CallResult callbackHandler(const CallbackInfo &info);
   CallResult importModuleDynamicallyCallbackHandler(const ImportModuleDynamicallyCallbackInfo &info);
+  ModuleResult resolveModuleCallbackHandler(const ResolveModuleCallbackInfo &info);
+  String importMetaCallbackHandler(Pointer isolate, int contextId, int moduleId);
   void GetterCallbackHandler(v8::Local<v8::String> property, const v8::PropertyCallbackInfo<v8::Value> &info);
   void SetterCallbackHandler(v8::Local<v8::String> property, v8::Local<v8::Value> value, const v8::PropertyCallbackInfo<void> &info);
   void FunctionCallbackHandler(const v8::FunctionCallbackInfo<v8::Value> &args);
+  void NamedPropertyGetterCallbackHandler(v8::Local<v8::Name> property, const v8::PropertyCallbackInfo<v8::Value> &info);
+  void NamedPropertySetterCallbackHandler(v8::Local<v8::Name> property, v8::Local<v8::Value> value, const v8::PropertyCallbackInfo<v8::Value> &info);
+  void NamedPropertyQueryCallbackHandler(v8::Local<v8::Name> property, const v8::PropertyCallbackInfo<v8::Integer> &info);
+  void NamedPropertyDeleterCallbackHandler(v8::Local<v8::Name> property, const v8::PropertyCallbackInfo<v8::Boolean> &info);
+  void NamedPropertyEnumeratorCallbackHandler(const v8::PropertyCallbackInfo<v8::Array> &info);
+  void IndexedPropertyGetterCallbackHandler(uint32_t index, const v8::PropertyCallbackInfo<v8::Value> &info);
+  void IndexedPropertySetterCallbackHandler(uint32_t index, v8::Local<v8::Value> value, const v8::PropertyCallbackInfo<v8::Value> &info);
+  void IndexedPropertyQueryCallbackHandler(uint32_t index, const v8::PropertyCallbackInfo<v8::Integer> &info);
+  void IndexedPropertyDeleterCallbackHandler(uint32_t index, const v8::PropertyCallbackInfo<v8::Boolean> &info);
+  void IndexedPropertyEnumeratorCallbackHandler(const v8::PropertyCallbackInfo<v8::Array> &info);
+  v8::MaybeLocal<v8::Value> SyntheticModuleEvaluationSteps(v8::Local<v8::Context> context, v8::Local<v8::Module> module);
 
   void callCompletedCallback(Pointer isolate);
   void beforeCallEnteredCallback(Pointer isolate);
-
-  void inspectorSendResponse(int inspectorId, int callId, String message);
-  void inspectorSendNotification(int inspectorId, String message);
-  void inspectorFlushProtocolNotifications(int inspectorId);
+  size_t nearHeapLimitCallback(Pointer isolate, size_t currentHeapLimit, size_t initialHeapLimit);
+  bool heapSnapshotWriteChunk(Pointer isolate, char *data, int size);
+  bool allowCodeGenerationCallback(Pointer isolate, int contextId, String source);
+  bool allowWasmCodeGenerationCallback(Pointer isolate, int contextId);
+  void externalArrayBufferReleaseCallback(uint64_t id);
+  uint32_t valueSerializerWriteHostObject(Pointer isolate, int contextId, uint32_t serializationId, CallResult object);
+  CallResult valueDeserializerReadHostObject(Pointer isolate, int contextId, uint32_t serializationId, uint32_t index);
+  uint32_t valueSerializerWriteWasmModule(uint32_t serializationId, CompiledWasmModulePtr compiled);
+  CompiledWasmModulePtr valueDeserializerReadWasmModule(uint32_t serializationId, uint32_t index);
+
+  void inspectorSendResponse(int inspectorId, int sessionId, int callId, String message);
+  void inspectorSendNotification(int inspectorId, int sessionId, String message);
+  void inspectorFlushProtocolNotifications(int inspectorId, int sessionId);
+  void inspectorRunMessageLoopOnPause(int inspectorId, int contextGroupId);
+  void inspectorQuitMessageLoopOnPause(int inspectorId);
+  void inspectorRunIfWaitingForDebugger(int inspectorId, int contextGroupId);
+  void inspectorDispatchPendingMessages(int inspectorId);
 }
 
+// externalReferences lists the native callbacks reachable from templates so
+// that snapshots can be created and restored. It is null terminated.
+extern const intptr_t externalReferences[];
+
 void v8_Value_ValueTuple_Release(v8::Local<v8::Context> context, ValueTuplePtr vt);
 ValueTuplePtr v8_Value_ValueTuple();
 CallResult v8_Value_ValueTuple(v8::Isolate *isolate, v8::Local<v8::Context> context, v8::Local<v8::Value> value);
 CallResult v8_Value_ValueTuple_Error(v8::Isolate *isolate, const v8::Local<v8::Value> &value);
 CallResult v8_Value_ValueTuple_Exception(v8::Isolate *isolate, v8::Local<v8::Context> context, v8::Local<v8::Value> value);
+CallResult v8_Value_ValueTuple_Exception(v8::Isolate *isolate, v8::Local<v8::Context> context, const v8::TryCatch &tryCatch);
+v8::Local<v8::TypedArray> v8_TypedArray_New(Kind kind, v8::Local<v8::ArrayBuffer> buffer, size_t byteLength);
 
 #include "v8_c_string.h"
 #include "v8_c_value.h"
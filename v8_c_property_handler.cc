@@ -0,0 +1,198 @@
+#include "v8_c_private.h"
+
+// v8_PropertyCallback calls the Go handler of a named or indexed property
+// interceptor. It returns false if the handler threw or didn't intercept the
+// request, in which case V8 carries on with the object's own properties.
+template <typename T>
+static bool v8_PropertyCallback(CallbackType type, const v8::PropertyCallbackInfo<T> &info, v8::Local<v8::Name> property, bool indexed, uint32_t index, v8::Local<v8::Value> value, v8::Local<v8::Value> *out)
+{
+  ISOLATE_SCOPE(info.GetIsolate());
+  v8::EscapableHandleScope handleScope(isolate);
+
+  v8::Local<v8::Context> context = isolate->GetCurrentContext();
+
+  String id = v8_String_Create(isolate, info.Data());
+  CallerInfo callerInfo = v8_StackTrace_CallerInfo(isolate);
+  CallResult self = v8_Value_ValueTuple(isolate, context, info.This());
+  CallResult holder = v8_Value_ValueTuple(isolate, context, info.Holder());
+  String key = property.IsEmpty() ? String{NULL, 0} : v8_String_Create(isolate, property);
+  CallResult valueTuple = value.IsEmpty() ? v8_CallResult() : v8_Value_ValueTuple(isolate, context, value);
+
+  CallResult result;
+  {
+    isolate->Exit();
+    v8::Unlocker unlocker(isolate);
+
+    result = callbackHandler(CallbackInfo{
+        type,
+        id,
+        isolate->GetData(0),
+        v8_Context_GetID(context),
+        callerInfo,
+        self,
+        holder,
+        false,
+        0,
+        NULL,
+        key,
+        valueTuple,
+        indexed,
+        index});
+  }
+  isolate->Enter();
+
+  if (isolate->IsExecutionTerminating())
+  {
+    v8_Value_ValueTuple_Release(context, result.result);
+    return false;
+  }
+
+  bool intercepted = false;
+
+  if (result.error.data != NULL)
+  {
+    v8::Local<v8::Value> error = v8::Exception::Error(v8_String_FromString(isolate, result.error));
+    isolate->ThrowException(error);
+  }
+  else if (result.isError)
+  {
+    v8::Local<v8::Value> error = static_cast<Value *>(result.result->value)->Get(isolate);
+    isolate->ThrowException(error);
+  }
+  else if (result.result != NULL && result.result->value != NULL)
+  {
+    *out = handleScope.Escape(static_cast<Value *>(result.result->value)->Get(isolate));
+    intercepted = true;
+  }
+
+  v8_Value_ValueTuple_Release(context, result.result);
+  return intercepted;
+}
+
+static void v8_PropertyGetter(const v8::PropertyCallbackInfo<v8::Value> &info, v8::Local<v8::Name> property, bool indexed, uint32_t index)
+{
+  v8::Local<v8::Value> out;
+  if (v8_PropertyCallback(kPropertyGetterCallback, info, property, indexed, index, v8::Local<v8::Value>(), &out))
+  {
+    info.GetReturnValue().Set(out);
+  }
+}
+
+static void v8_PropertySetter(const v8::PropertyCallbackInfo<v8::Value> &info, v8::Local<v8::Name> property, bool indexed, uint32_t index, v8::Local<v8::Value> value)
+{
+  v8::Local<v8::Value> out;
+  if (v8_PropertyCallback(kPropertySetterCallback, info, property, indexed, index, value, &out))
+  {
+    info.GetReturnValue().Set(value);
+  }
+}
+
+static void v8_PropertyQuery(const v8::PropertyCallbackInfo<v8::Integer> &info, v8::Local<v8::Name> property, bool indexed, uint32_t index)
+{
+  v8::Local<v8::Value> out;
+  if (v8_PropertyCallback(kPropertyQueryCallback, info, property, indexed, index, v8::Local<v8::Value>(), &out) && out->IsInt32())
+  {
+    info.GetReturnValue().Set(out.As<v8::Int32>()->Value());
+  }
+}
+
+static void v8_PropertyDeleter(const v8::PropertyCallbackInfo<v8::Boolean> &info, v8::Local<v8::Name> property, bool indexed, uint32_t index)
+{
+  v8::Local<v8::Value> out;
+  if (v8_PropertyCallback(kPropertyDeleterCallback, info, property, indexed, index, v8::Local<v8::Value>(), &out) && out->IsBoolean())
+  {
+    info.GetReturnValue().Set(out.As<v8::Boolean>()->Value());
+  }
+}
+
+static void v8_PropertyEnumerator(const v8::PropertyCallbackInfo<v8::Array> &info, bool indexed)
+{
+  v8::Local<v8::Value> out;
+  if (v8_PropertyCallback(kPropertyEnumeratorCallback, info, v8::Local<v8::Name>(), indexed, 0, v8::Local<v8::Value>(), &out) && out->IsArray())
+  {
+    info.GetReturnValue().Set(out.As<v8::Array>());
+  }
+}
+
+extern "C"
+{
+  void v8_ObjectTemplate_SetNamedPropertyHandler(ContextPtr pContext, ObjectTemplatePtr pObject, const char *id, bool setter, bool query, bool deleter, bool enumerator, bool nonMasking)
+  {
+    VALUE_SCOPE(pContext);
+    v8::Local<v8::ObjectTemplate> object = static_cast<ObjectTemplate *>(pObject)->Get(isolate);
+
+    object->SetHandler(v8::NamedPropertyHandlerConfiguration(
+        NamedPropertyGetterCallbackHandler,
+        setter ? NamedPropertySetterCallbackHandler : 0,
+        query ? NamedPropertyQueryCallbackHandler : 0,
+        deleter ? NamedPropertyDeleterCallbackHandler : 0,
+        enumerator ? NamedPropertyEnumeratorCallbackHandler : 0,
+        v8::String::NewFromUtf8(isolate, id).ToLocalChecked(),
+        nonMasking ? v8::PropertyHandlerFlags(int(v8::PropertyHandlerFlags::kOnlyInterceptStrings) | int(v8::PropertyHandlerFlags::kNonMasking)) : v8::PropertyHandlerFlags::kOnlyInterceptStrings));
+  }
+
+  void v8_ObjectTemplate_SetIndexedPropertyHandler(ContextPtr pContext, ObjectTemplatePtr pObject, const char *id, bool setter, bool query, bool deleter, bool enumerator, bool nonMasking)
+  {
+    VALUE_SCOPE(pContext);
+    v8::Local<v8::ObjectTemplate> object = static_cast<ObjectTemplate *>(pObject)->Get(isolate);
+
+    object->SetHandler(v8::IndexedPropertyHandlerConfiguration(
+        IndexedPropertyGetterCallbackHandler,
+        setter ? IndexedPropertySetterCallbackHandler : 0,
+        query ? IndexedPropertyQueryCallbackHandler : 0,
+        deleter ? IndexedPropertyDeleterCallbackHandler : 0,
+        enumerator ? IndexedPropertyEnumeratorCallbackHandler : 0,
+        v8::String::NewFromUtf8(isolate, id).ToLocalChecked(),
+        nonMasking ? v8::PropertyHandlerFlags::kNonMasking : v8::PropertyHandlerFlags::kNone));
+  }
+
+  void NamedPropertyGetterCallbackHandler(v8::Local<v8::Name> property, const v8::PropertyCallbackInfo<v8::Value> &info)
+  {
+    v8_PropertyGetter(info, property, false, 0);
+  }
+
+  void NamedPropertySetterCallbackHandler(v8::Local<v8::Name> property, v8::Local<v8::Value> value, const v8::PropertyCallbackInfo<v8::Value> &info)
+  {
+    v8_PropertySetter(info, property, false, 0, value);
+  }
+
+  void NamedPropertyQueryCallbackHandler(v8::Local<v8::Name> property, const v8::PropertyCallbackInfo<v8::Integer> &info)
+  {
+    v8_PropertyQuery(info, property, false, 0);
+  }
+
+  void NamedPropertyDeleterCallbackHandler(v8::Local<v8::Name> property, const v8::PropertyCallbackInfo<v8::Boolean> &info)
+  {
+    v8_PropertyDeleter(info, property, false, 0);
+  }
+
+  void NamedPropertyEnumeratorCallbackHandler(const v8::PropertyCallbackInfo<v8::Array> &info)
+  {
+    v8_PropertyEnumerator(info, false);
+  }
+
+  void IndexedPropertyGetterCallbackHandler(uint32_t index, const v8::PropertyCallbackInfo<v8::Value> &info)
+  {
+    v8_PropertyGetter(info, v8::Local<v8::Name>(), true, index);
+  }
+
+  void IndexedPropertySetterCallbackHandler(uint32_t index, v8::Local<v8::Value> value, const v8::PropertyCallbackInfo<v8::Value> &info)
+  {
+    v8_PropertySetter(info, v8::Local<v8::Name>(), true, index, value);
+  }
+
+  void IndexedPropertyQueryCallbackHandler(uint32_t index, const v8::PropertyCallbackInfo<v8::Integer> &info)
+  {
+    v8_PropertyQuery(info, v8::Local<v8::Name>(), true, index);
+  }
+
+  void IndexedPropertyDeleterCallbackHandler(uint32_t index, const v8::PropertyCallbackInfo<v8::Boolean> &info)
+  {
+    v8_PropertyDeleter(info, v8::Local<v8::Name>(), true, index);
+  }
+
+  void IndexedPropertyEnumeratorCallbackHandler(const v8::PropertyCallbackInfo<v8::Array> &info)
+  {
+    v8_PropertyEnumerator(info, true);
+  }
+}
@@ -0,0 +1,113 @@
+#include "v8_c_private.h"
+
+extern "C"
+{
+  CompileResult v8_Context_Compile(ContextPtr pContext, const char *code, const char *filename, const char *id, String cache)
+  {
+    VALUE_SCOPE(static_cast<Context *>(pContext));
+
+    v8::TryCatch tryCatch(isolate);
+    tryCatch.SetVerbose(false);
+
+    filename = filename ? filename : "(no file)";
+
+    v8::Local<v8::PrimitiveArray> hostDefinedOptions = v8::PrimitiveArray::New(isolate, 1);
+    hostDefinedOptions->Set(isolate, 0, v8::String::NewFromUtf8(isolate, id).ToLocalChecked());
+
+    v8::ScriptOrigin origin(
+      isolate,
+      v8::String::NewFromUtf8(isolate, filename).ToLocalChecked(),
+      0,
+      0,
+      false,
+      -1,
+      v8::Local<v8::Value>(),
+      false,
+      false,
+      false,
+      hostDefinedOptions
+    );
+
+    v8::ScriptCompiler::CachedData *cachedData = nullptr;
+    v8::ScriptCompiler::CompileOptions options = v8::ScriptCompiler::kNoCompileOptions;
+    if (cache.data != NULL && cache.length > 0)
+    {
+      cachedData = new v8::ScriptCompiler::CachedData(
+          reinterpret_cast<const uint8_t *>(cache.data),
+          cache.length,
+          v8::ScriptCompiler::CachedData::BufferNotOwned);
+      options = v8::ScriptCompiler::kConsumeCodeCache;
+    }
+
+    // the source takes ownership of cachedData
+    v8::ScriptCompiler::Source source(v8::String::NewFromUtf8(isolate, code).ToLocalChecked(), origin, cachedData);
+    v8::MaybeLocal<v8::UnboundScript> script = v8::ScriptCompiler::CompileUnboundScript(isolate, &source, options);
+
+    CompileResult result{NULL, false, CallResult{}};
+    if (cachedData != nullptr)
+    {
+      result.cacheRejected = source.GetCachedData()->rejected;
+    }
+
+    if (script.IsEmpty())
+    {
+      result.result = v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
+      return result;
+    }
+
+    result.script = static_cast<ScriptPtr>(new Script(isolate, script.ToLocalChecked()));
+    return result;
+  }
+
+  CallResult v8_Script_Run(ContextPtr pContext, ScriptPtr pScript)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::TryCatch tryCatch(isolate);
+    tryCatch.SetVerbose(false);
+
+    v8::Local<v8::Script> script = static_cast<Script *>(pScript)->Get(isolate)->BindToCurrentContext();
+    v8::MaybeLocal<v8::Value> result = script->Run(context);
+
+    if (result.IsEmpty())
+    {
+      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
+    }
+    else
+    {
+      return v8_Value_ValueTuple(isolate, context, result.ToLocalChecked());
+    }
+  }
+
+  String v8_Script_CreateCodeCache(ContextPtr pContext, ScriptPtr pScript)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::ScriptCompiler::CachedData *cachedData = v8::ScriptCompiler::CreateCodeCache(static_cast<Script *>(pScript)->Get(isolate));
+    if (cachedData == nullptr)
+    {
+      return String{NULL, 0};
+    }
+
+    char *data = static_cast<char *>(malloc(cachedData->length));
+    memcpy(data, cachedData->data, cachedData->length);
+    int length = cachedData->length;
+    delete cachedData;
+
+    return String{data, length};
+  }
+
+  void v8_Script_Release(ContextPtr pContext, ScriptPtr pScript)
+  {
+    if (pScript == NULL)
+    {
+      return;
+    }
+
+    ISOLATE_SCOPE(static_cast<Context *>(pContext)->isolate);
+
+    Script *script = static_cast<Script *>(pScript);
+    script->Reset();
+    delete script;
+  }
+}
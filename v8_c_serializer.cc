@@ -0,0 +1,159 @@
+#include "v8_c_private.h"
+
+// SerializerDelegate writes host objects as an index into the Go table of the
+// serialization, which the deserializing context exchanges for an object
+// created by its delegate, so that host objects can be transferred between
+// isolates in the same process. WebAssembly modules are written the same
+// way, sharing their compiled code.
+class SerializerDelegate : public v8::ValueSerializer::Delegate
+{
+public:
+  SerializerDelegate(v8::Isolate *isolate, v8::Local<v8::Context> context, uint32_t serializationId) : isolate(isolate), context(context), serializationId(serializationId), serializer(NULL) {}
+
+  void ThrowDataCloneError(v8::Local<v8::String> message) override
+  {
+    isolate->ThrowException(v8::Exception::Error(message));
+  }
+
+  v8::Maybe<bool> WriteHostObject(v8::Isolate *isolate, v8::Local<v8::Object> object) override
+  {
+    uint32_t index = valueSerializerWriteHostObject(isolate->GetData(0), v8_Context_GetID(context), serializationId, v8_Value_ValueTuple(isolate, context, object));
+
+    if (index == 0)
+    {
+      ThrowDataCloneError(v8::String::NewFromUtf8Literal(isolate, "host object could not be cloned"));
+      return v8::Nothing<bool>();
+    }
+
+    serializer->WriteUint32(index);
+    return v8::Just(true);
+  }
+
+  v8::Maybe<uint32_t> GetWasmModuleTransferId(v8::Isolate *isolate, v8::Local<v8::WasmModuleObject> module) override
+  {
+    uint32_t index = valueSerializerWriteWasmModule(serializationId, new v8::CompiledWasmModule(module->GetCompiledModule()));
+
+    if (index == 0)
+    {
+      ThrowDataCloneError(v8::String::NewFromUtf8Literal(isolate, "wasm module could not be cloned"));
+      return v8::Nothing<uint32_t>();
+    }
+
+    return v8::Just(index);
+  }
+
+  v8::Isolate *isolate;
+  v8::Local<v8::Context> context;
+  uint32_t serializationId;
+  v8::ValueSerializer *serializer;
+};
+
+class DeserializerDelegate : public v8::ValueDeserializer::Delegate
+{
+public:
+  DeserializerDelegate(v8::Isolate *isolate, v8::Local<v8::Context> context, uint32_t serializationId) : isolate(isolate), context(context), serializationId(serializationId), deserializer(NULL) {}
+
+  v8::MaybeLocal<v8::Object> ReadHostObject(v8::Isolate *isolate) override
+  {
+    uint32_t index;
+    if (!deserializer->ReadUint32(&index))
+    {
+      return v8::MaybeLocal<v8::Object>();
+    }
+
+    CallResult result = valueDeserializerReadHostObject(isolate->GetData(0), v8_Context_GetID(context), serializationId, index);
+
+    v8::MaybeLocal<v8::Object> object;
+    if (result.result != NULL && result.result->value != NULL)
+    {
+      v8::Local<v8::Value> value = static_cast<Value *>(result.result->value)->Get(isolate);
+      if (value->IsObject())
+      {
+        object = value.As<v8::Object>();
+      }
+    }
+    v8_Value_ValueTuple_Release(context, result.result);
+
+    if (object.IsEmpty())
+    {
+      isolate->ThrowException(v8::Exception::Error(v8::String::NewFromUtf8Literal(isolate, "host object could not be deserialized")));
+    }
+
+    return object;
+  }
+
+  v8::MaybeLocal<v8::WasmModuleObject> GetWasmModuleFromId(v8::Isolate *isolate, uint32_t id) override
+  {
+    // the compiled module is owned by the serialization, and freed when the
+    // data is released
+    v8::CompiledWasmModule *compiled = static_cast<v8::CompiledWasmModule *>(valueDeserializerReadWasmModule(serializationId, id));
+
+    if (compiled == NULL)
+    {
+      isolate->ThrowException(v8::Exception::Error(v8::String::NewFromUtf8Literal(isolate, "wasm module could not be deserialized")));
+      return v8::MaybeLocal<v8::WasmModuleObject>();
+    }
+
+    return v8::WasmModuleObject::FromCompiledModule(isolate, *compiled);
+  }
+
+  v8::Isolate *isolate;
+  v8::Local<v8::Context> context;
+  uint32_t serializationId;
+  v8::ValueDeserializer *deserializer;
+};
+
+extern "C"
+{
+  SerializedData v8_Value_Serialize(ContextPtr pContext, ValuePtr pValue, uint32_t serializationId)
+  {
+    VALUE_SCOPE(pContext);
+    v8::TryCatch tryCatch(isolate);
+
+    v8::Local<v8::Value> value = static_cast<Value *>(pValue)->Get(isolate);
+
+    SerializerDelegate delegate(isolate, context, serializationId);
+    v8::ValueSerializer serializer(isolate, &delegate);
+    delegate.serializer = &serializer;
+
+    serializer.WriteHeader();
+    if (serializer.WriteValue(context, value).IsNothing())
+    {
+      if (tryCatch.HasCaught())
+      {
+        return SerializedData{ByteArray{NULL, 0}, v8_String_Create(isolate, tryCatch.Exception())};
+      }
+      return SerializedData{ByteArray{NULL, 0}, v8_String_Create("value could not be serialized")};
+    }
+
+    std::pair<uint8_t *, size_t> data = serializer.Release();
+    return SerializedData{ByteArray{(const char *)data.first, static_cast<int>(data.second)}, Error{NULL, 0}};
+  }
+
+  CallResult v8_Context_Deserialize(ContextPtr pContext, ByteArray data, uint32_t serializationId)
+  {
+    VALUE_SCOPE(pContext);
+    v8::TryCatch tryCatch(isolate);
+
+    DeserializerDelegate delegate(isolate, context, serializationId);
+    v8::ValueDeserializer deserializer(isolate, reinterpret_cast<const uint8_t *>(data.data), data.length, &delegate);
+    delegate.deserializer = &deserializer;
+
+    v8::MaybeLocal<v8::Value> value;
+    if (deserializer.ReadHeader(context).FromMaybe(false))
+    {
+      value = deserializer.ReadValue(context);
+    }
+
+    if (value.IsEmpty())
+    {
+      if (tryCatch.HasCaught())
+      {
+        return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
+      }
+      return v8_Value_ValueTuple_Error(isolate, v8_String_FromString(isolate, "value could not be deserialized"));
+    }
+
+    return v8_Value_ValueTuple(isolate, context, value.ToLocalChecked());
+  }
+}
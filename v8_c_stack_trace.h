@@ -5,73 +5,61 @@
 #include <string>
 #include <sstream>
 
-// inline v8::Local<v8::String> v8_StackTrace_FormatException(v8::Isolate *isolate, v8::Local<v8::Context> ctx, v8::TryCatch &try_catch)
-// {
-//   v8::EscapableHandleScope handleScope(isolate);
-
-//   std::stringstream ss;
-//   ss << "Uncaught exception: ";
-
-//   std::string exceptionStr = v8_String_ToStdString(isolate, try_catch.Exception());
-//   ss << exceptionStr; // TODO(aroman) JSON-ify objects?
-
-//   if (!try_catch.Message().IsEmpty())
-//   {
-//     if (!try_catch.Message()->GetScriptResourceName()->IsUndefined())
-//     {
-//       ss << std::endl
-//          << "at " << v8_String_ToStdString(isolate, try_catch.Message()->GetScriptResourceName());
-
-//       v8::Maybe<int> line_no = try_catch.Message()->GetLineNumber(ctx);
-//       v8::Maybe<int> start = try_catch.Message()->GetStartColumn(ctx);
-//       v8::Maybe<int> end = try_catch.Message()->GetEndColumn(ctx);
-//       v8::MaybeLocal<v8::String> sourceLine = try_catch.Message()->GetSourceLine(ctx);
-
-//       if (line_no.IsJust())
-//       {
-//         ss << ":" << line_no.ToChecked();
-//       }
-//       if (start.IsJust())
-//       {
-//         ss << ":" << start.ToChecked();
-//       }
-//       if (!sourceLine.IsEmpty())
-//       {
-//         ss << std::endl
-//            << "  " << v8_String_ToStdString(isolate, sourceLine.ToLocalChecked());
-//       }
-//       if (start.IsJust() && end.IsJust())
-//       {
-//         ss << std::endl
-//            << "  ";
-//         for (int i = 0; i < start.ToChecked(); i++)
-//         {
-//           ss << " ";
-//         }
-//         for (int i = start.ToChecked(); i < end.ToChecked(); i++)
-//         {
-//           ss << "^";
-//         }
-//       }
-//     }
-//   }
-
-//   if (!try_catch.StackTrace(ctx).IsEmpty())
-//   {
-//     v8::Local<v8::Value> stack;
-
-//     if (try_catch.StackTrace(ctx).ToLocal(&stack))
-//     {
-//       ss
-//           << std::endl
-//           << "Stack trace: " << v8_String_ToStdString(isolate, stack);
-//     }
-//   }
-
-//   std::string string = ss.str();
-
-//   return handleScope.Escape(v8::String::NewFromUtf8(isolate, string.c_str(), v8::NewStringType::kNormal, string.length()).ToLocalChecked());
-// }
+inline std::string v8_StackTrace_FormatException(v8::Isolate *isolate, v8::Local<v8::Context> ctx, v8::Local<v8::Message> message, v8::Local<v8::Value> exception)
+{
+  v8::HandleScope handleScope(isolate);
+
+  std::stringstream ss;
+
+  if (!message.IsEmpty() && !message->GetScriptResourceName()->IsUndefined())
+  {
+    ss << v8_String_ToStdString(isolate, message->GetScriptResourceName());
+
+    v8::Maybe<int> line_no = message->GetLineNumber(ctx);
+    if (line_no.IsJust())
+    {
+      ss << ":" << line_no.ToChecked();
+    }
+
+    v8::MaybeLocal<v8::String> sourceLine = message->GetSourceLine(ctx);
+    int start = message->GetStartColumn();
+    int end = message->GetEndColumn();
+
+    if (!sourceLine.IsEmpty())
+    {
+      ss << std::endl
+         << v8_String_ToStdString(isolate, sourceLine.ToLocalChecked());
+
+      if (start >= 0 && end > start)
+      {
+        ss << std::endl;
+        for (int i = 0; i < start; i++)
+        {
+          ss << " ";
+        }
+        for (int i = start; i < end; i++)
+        {
+          ss << "^";
+        }
+      }
+    }
+
+    ss << std::endl
+       << std::endl;
+  }
+
+  v8::Local<v8::Value> stack;
+  if (exception->IsObject() && exception.As<v8::Object>()->Get(ctx, v8::String::NewFromUtf8Literal(isolate, "stack")).ToLocal(&stack) && stack->IsString())
+  {
+    ss << v8_String_ToStdString(isolate, stack);
+  }
+  else
+  {
+    ss << v8_String_ToStdString(isolate, exception);
+  }
+
+  return ss.str();
+}
 
 inline CallerInfo v8_StackTrace_CallerInfo(v8::Isolate *isolate)
 {
@@ -383,7 +383,7 @@ extern "C"
 
     if (result.IsEmpty())
     {
-      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch.Exception());
+      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
     }
 
     return v8_Value_ValueTuple(isolate, context, result.ToLocalChecked());
@@ -416,7 +416,7 @@ extern "C"
 
     if (result.IsEmpty())
     {
-      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch.Exception());
+      return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
     }
 
     return v8_Value_ValueTuple(isolate, context, result.ToLocalChecked());
@@ -458,6 +458,89 @@ extern "C"
     return maybe.ToChecked();
   }
 
+  ByteArray v8_Value_BigIntWords(ContextPtr pContext, ValuePtr pValue, bool *signBit)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Value> value = static_cast<Value *>(pValue)->Get(isolate);
+
+    if (!value->IsBigInt())
+    {
+      return ByteArray{NULL, 0};
+    }
+
+    v8::Local<v8::BigInt> bigint = value.As<v8::BigInt>();
+    int wordCount = bigint->WordCount();
+    int sign = 0;
+
+    uint64_t *words = (uint64_t *)malloc(wordCount * sizeof(uint64_t));
+    bigint->ToWordsArray(&sign, &wordCount, words);
+    *signBit = sign != 0;
+
+    return ByteArray{(const char *)words, static_cast<int>(wordCount * sizeof(uint64_t))};
+  }
+
+  Error v8_Map_Set(ContextPtr pContext, ValuePtr pMap, ValuePtr pKey, ValuePtr pValue)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Value> map = static_cast<Value *>(pMap)->Get(isolate);
+
+    if (!map->IsMap())
+    {
+      return v8_String_Create("Not a map");
+    }
+
+    v8::Local<v8::Value> key = static_cast<Value *>(pKey)->Get(isolate);
+    v8::Local<v8::Value> value = static_cast<Value *>(pValue)->Get(isolate);
+
+    if (map.As<v8::Map>()->Set(context, key, value).IsEmpty())
+    {
+      return v8_String_Create("Something went wrong: set failed.");
+    }
+
+    return Error{NULL, 0};
+  }
+
+  Error v8_Set_Add(ContextPtr pContext, ValuePtr pSet, ValuePtr pValue)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Value> set = static_cast<Value *>(pSet)->Get(isolate);
+
+    if (!set->IsSet())
+    {
+      return v8_String_Create("Not a set");
+    }
+
+    v8::Local<v8::Value> value = static_cast<Value *>(pValue)->Get(isolate);
+
+    if (set.As<v8::Set>()->Add(context, value).IsEmpty())
+    {
+      return v8_String_Create("Something went wrong: add failed.");
+    }
+
+    return Error{NULL, 0};
+  }
+
+  CallResult v8_Value_AsArray(ContextPtr pContext, ValuePtr pValue)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Value> value = static_cast<Value *>(pValue)->Get(isolate);
+
+    if (value->IsMap())
+    {
+      return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(value.As<v8::Map>()->AsArray()));
+    }
+    else if (value->IsSet())
+    {
+      return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(value.As<v8::Set>()->AsArray()));
+    }
+
+    return v8_Value_ValueTuple_Error(isolate, v8_String_FromString(isolate, "not a map or set"));
+  }
+
   bool v8_Value_Equals(ContextPtr pContext, ValuePtr pValueLeft, ValuePtr pValueRight)
   {
     VALUE_SCOPE(pContext);
@@ -605,6 +688,72 @@ extern "C"
     return v8_Value_ValueTuple(isolate, context, result);
   }
 
+  ExceptionInfo v8_Value_ExceptionInfo(ContextPtr pContext, ValuePtr pValue)
+  {
+    VALUE_SCOPE(pContext);
+    v8::TryCatch tryCatch(isolate);
+
+    ExceptionInfo info;
+    memset(&info, 0, sizeof(ExceptionInfo));
+
+    v8::Local<v8::Value> exception = static_cast<Value *>(pValue)->Get(isolate);
+    v8::Local<v8::Message> message = v8::Exception::CreateMessage(isolate, exception);
+
+    if (exception->IsObject())
+    {
+      v8::Local<v8::Object> object = exception.As<v8::Object>();
+      v8::Local<v8::Value> value;
+
+      if (object->Get(context, v8::String::NewFromUtf8Literal(isolate, "name")).ToLocal(&value) && !value->IsUndefined())
+      {
+        info.name = v8_String_Create(isolate, value);
+      }
+      if (object->Get(context, v8::String::NewFromUtf8Literal(isolate, "message")).ToLocal(&value) && !value->IsUndefined())
+      {
+        info.message = v8_String_Create(isolate, value);
+      }
+    }
+
+    if (info.message.data == NULL)
+    {
+      info.message = v8_String_Create(isolate, exception);
+    }
+
+    v8::Local<v8::String> sourceLine;
+    if (message->GetSourceLine(context).ToLocal(&sourceLine))
+    {
+      info.sourceLine = v8_String_Create(isolate, sourceLine);
+    }
+
+    v8::Local<v8::StackTrace> stackTrace = message->GetStackTrace();
+    if (stackTrace.IsEmpty())
+    {
+      stackTrace = v8::Exception::GetStackTrace(exception);
+    }
+
+    if (!stackTrace.IsEmpty() && stackTrace->GetFrameCount() > 0)
+    {
+      info.frameCount = stackTrace->GetFrameCount();
+      info.frames = static_cast<ExceptionStackFrame *>(malloc(sizeof(ExceptionStackFrame) * info.frameCount));
+
+      for (int i = 0; i < info.frameCount; i++)
+      {
+        v8::Local<v8::StackFrame> frame = stackTrace->GetFrame(isolate, i);
+        info.frames[i] = ExceptionStackFrame{
+            v8_String_Create(isolate, frame->GetFunctionName()),
+            v8_String_Create(isolate, frame->GetScriptName()),
+            frame->GetLineNumber(),
+            frame->GetColumn(),
+            frame->IsEval(),
+            frame->IsConstructor()};
+      }
+    }
+
+    info.formatted = v8_String_Create(v8_StackTrace_FormatException(isolate, context, message, exception));
+
+    return info;
+  }
+
   PrivatePtr v8_Private_New(IsolatePtr pIsolate, const char *name)
   {
     ISOLATE_SCOPE(static_cast<v8::Isolate *>(pIsolate));
@@ -671,7 +820,7 @@ extern "C"
 
 void v8_Value_ValueTuple_Release(v8::Local<v8::Context> context, ValueTuplePtr vt)
 {
-  if (vt->refCount == 0)
+  if (vt == NULL || vt->refCount == 0)
   {
     return;
   }
@@ -806,6 +955,19 @@ CallResult v8_Value_ValueTuple_Exception(v8::Isolate *isolate, v8::Local<v8::Con
   return r;
 }
 
+CallResult v8_Value_ValueTuple_Exception(v8::Isolate *isolate, v8::Local<v8::Context> context, const v8::TryCatch &tryCatch)
+{
+  if (tryCatch.HasTerminated() || tryCatch.Exception().IsEmpty())
+  {
+    CallResult r = v8_CallResult();
+    r.isError = true;
+    r.isTerminated = true;
+    return r;
+  }
+
+  return v8_Value_ValueTuple_Exception(isolate, context, tryCatch.Exception());
+}
+
 extern "C" CallResult v8_CallResult() {
   CallResult r = CallResult();
   memset(&r, 0, sizeof(CallResult));
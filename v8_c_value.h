@@ -100,6 +100,12 @@ inline Kinds v8_Value_KindsFromLocal(v8::Local<v8::Value> value)
     kinds |= (1ULL << Kind::kProxy);
   if (value->IsWasmModuleObject())
     kinds |= (1ULL << Kind::kWasmModuleObject);
+  if (value->IsBigInt())
+    kinds |= (1ULL << Kind::kBigInt);
+  if (value->IsBigInt64Array())
+    kinds |= (1ULL << Kind::kBigInt64Array);
+  if (value->IsBigUint64Array())
+    kinds |= (1ULL << Kind::kBigUint64Array);
 
   return kinds;
 }
@@ -0,0 +1,68 @@
+#include "v8_c_private.h"
+
+extern "C"
+{
+  CallResult v8_Context_CompileWasm(ContextPtr pContext, ByteArray data)
+  {
+    VALUE_SCOPE(pContext);
+    v8::TryCatch tryCatch(isolate);
+
+    v8::MemorySpan<const uint8_t> wireBytes(reinterpret_cast<const uint8_t *>(data.data), data.length);
+    v8::MaybeLocal<v8::WasmModuleObject> module = v8::WasmModuleObject::Compile(isolate, wireBytes);
+
+    if (module.IsEmpty())
+    {
+      if (tryCatch.HasCaught())
+      {
+        return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
+      }
+      return v8_Value_ValueTuple_Error(isolate, v8_String_FromString(isolate, "wasm module could not be compiled"));
+    }
+
+    return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(module.ToLocalChecked()));
+  }
+
+  CallResult v8_Context_NewWasmModule(ContextPtr pContext, CompiledWasmModulePtr pCompiled)
+  {
+    VALUE_SCOPE(pContext);
+    v8::TryCatch tryCatch(isolate);
+
+    v8::MaybeLocal<v8::WasmModuleObject> module = v8::WasmModuleObject::FromCompiledModule(isolate, *static_cast<v8::CompiledWasmModule *>(pCompiled));
+
+    if (module.IsEmpty())
+    {
+      if (tryCatch.HasCaught())
+      {
+        return v8_Value_ValueTuple_Exception(isolate, context, tryCatch);
+      }
+      return v8_Value_ValueTuple_Error(isolate, v8_String_FromString(isolate, "wasm module could not be created"));
+    }
+
+    return v8_Value_ValueTuple(isolate, context, static_cast<v8::Local<v8::Value>>(module.ToLocalChecked()));
+  }
+
+  CompiledWasmModulePtr v8_Value_CompiledWasmModule(ContextPtr pContext, ValuePtr pValue)
+  {
+    VALUE_SCOPE(pContext);
+
+    v8::Local<v8::Value> value = static_cast<Value *>(pValue)->Get(isolate);
+
+    if (!value->IsWasmModuleObject())
+    {
+      return NULL;
+    }
+
+    return static_cast<CompiledWasmModulePtr>(new v8::CompiledWasmModule(value.As<v8::WasmModuleObject>()->GetCompiledModule()));
+  }
+
+  ByteArray v8_CompiledWasmModule_WireBytes(CompiledWasmModulePtr pCompiled)
+  {
+    v8::MemorySpan<const uint8_t> wireBytes = static_cast<v8::CompiledWasmModule *>(pCompiled)->GetWireBytesRef();
+    return ByteArray{reinterpret_cast<const char *>(wireBytes.data()), static_cast<int>(wireBytes.size())};
+  }
+
+  void v8_CompiledWasmModule_Release(CompiledWasmModulePtr pCompiled)
+  {
+    delete static_cast<v8::CompiledWasmModule *>(pCompiled);
+  }
+}
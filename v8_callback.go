@@ -15,15 +15,17 @@ import (
 )
 
 type callbackArgs struct {
-	Context *Context
-	Caller  CallerInfo
-	This    *Value
-	Holder  *Value
+	Context   *Context
+	Caller    CallerInfo
+	This      *Value
+	Holder    *Value
+	Functions *refutils.RefMap
+	Accessors *refutils.RefMap
 }
 
 func functionCallbackHandler(ctx context.Context, v8Context *Context, info C.CallbackInfo, args callbackArgs, functionId refutils.ID) (*Value, error) {
 	pv, err := v8Context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
-		functionRef := v8Context.functions.Get(functionId)
+		functionRef := args.Functions.Get(functionId)
 		if functionRef == nil {
 			panic(fmt.Errorf("missing function pointer during callback for function #%d", functionId))
 		}
@@ -62,7 +64,7 @@ func functionCallbackHandler(ctx context.Context, v8Context *Context, info C.Cal
 func getterCallbackHandler(ctx context.Context, v8Context *Context, info C.CallbackInfo, args callbackArgs, accessorId refutils.ID) (*Value, error) {
 	pv, err := v8Context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 
-		accessorRef := v8Context.accessors.Get(accessorId)
+		accessorRef := args.Accessors.Get(accessorId)
 		if accessorRef == nil {
 			panic(fmt.Errorf("missing function pointer during callback for getter #%d", accessorId))
 		}
@@ -87,7 +89,7 @@ func getterCallbackHandler(ctx context.Context, v8Context *Context, info C.Callb
 
 func setterCallbackHandler(ctx context.Context, v8Context *Context, info C.CallbackInfo, args callbackArgs, accessorId refutils.ID) (*Value, error) {
 	pv, err := v8Context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
-		accessorRef := v8Context.accessors.Get(accessorId)
+		accessorRef := args.Accessors.Get(accessorId)
 		if accessorRef == nil {
 			panic(fmt.Errorf("missing function pointer during callback for setter #%d", accessorId))
 		}
@@ -117,10 +119,94 @@ func setterCallbackHandler(ctx context.Context, v8Context *Context, info C.Callb
 	}
 }
 
+func propertyCallbackHandler(ctx context.Context, v8Context *Context, info C.CallbackInfo, args callbackArgs, handlerId refutils.ID) (*Value, error) {
+	pv, err := v8Context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		handlerRef := args.Accessors.Get(handlerId)
+		if handlerRef == nil {
+			panic(fmt.Errorf("missing handler pointer during callback for property handler #%d", handlerId))
+		}
+		handler := handlerRef.(*propertyHandlerInfo)
+
+		in := PropertyArgs{
+			ExecutionContext: ctx,
+			Context:          v8Context,
+			Caller:           args.Caller,
+			This:             args.This,
+			Holder:           args.Holder,
+			Indexed:          bool(info.indexed),
+		}
+
+		if in.Indexed {
+			in.Index = uint32(info.index)
+			in.Key = strconv.FormatUint(uint64(in.Index), 10)
+		} else {
+			in.Key = C.GoStringN(info.key.data, info.key.length)
+		}
+
+		switch info._type {
+		case C.kPropertyGetterCallback:
+			if handler.Getter == nil {
+				return nil, nil
+			}
+			return handler.Getter(in)
+		case C.kPropertySetterCallback:
+			if v, err := v8Context.newValueFromTuple(ctx, info.value); err != nil {
+				return nil, err
+			} else {
+				in.Value = v
+			}
+
+			if intercepted, err := handler.Setter(in); err != nil || !intercepted {
+				return nil, err
+			}
+			return v8Context.True(ctx)
+		case C.kPropertyQueryCallback:
+			if found, err := handler.Query(in); err != nil || !found {
+				return nil, err
+			}
+			return v8Context.Create(ctx, 0)
+		case C.kPropertyDeleterCallback:
+			if deleted, err := handler.Deleter(in); err != nil || !deleted {
+				return nil, err
+			}
+			return v8Context.True(ctx)
+		default:
+			if keys, err := handler.Enumerator(in); err != nil {
+				return nil, err
+			} else if in.Indexed {
+				// V8 expects an array, and a []uint32 would be created as a
+				// Uint32Array
+				indexes := make([]any, 0, len(keys))
+				for _, key := range keys {
+					if index, err := strconv.ParseUint(key, 10, 32); err == nil {
+						indexes = append(indexes, uint32(index))
+					}
+				}
+				return v8Context.Create(ctx, indexes)
+			} else {
+				return v8Context.Create(ctx, keys)
+			}
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	} else if pv != nil {
+		return pv.(*Value), nil
+	} else {
+		return nil, nil
+	}
+}
+
 var callbackHandlers = map[C.CallbackType]func(context.Context, *Context, C.CallbackInfo, callbackArgs, refutils.ID) (*Value, error){
-	C.kFunctionCallback: functionCallbackHandler,
-	C.kGetterCallback:   getterCallbackHandler,
-	C.kSetterCallback:   setterCallbackHandler,
+	C.kFunctionCallback:           functionCallbackHandler,
+	C.kGetterCallback:             getterCallbackHandler,
+	C.kSetterCallback:             setterCallbackHandler,
+	C.kPropertyGetterCallback:     propertyCallbackHandler,
+	C.kPropertySetterCallback:     propertyCallbackHandler,
+	C.kPropertyQueryCallback:      propertyCallbackHandler,
+	C.kPropertyDeleterCallback:    propertyCallbackHandler,
+	C.kPropertyEnumeratorCallback: propertyCallbackHandler,
 }
 
 //export callbackHandler
@@ -133,23 +219,25 @@ func callbackHandler(info *C.CallbackInfo) (r C.CallResult) {
 
 	ids := C.GoStringN(info.id.data, info.id.length)
 
-	parts := strings.SplitN(ids, ":", 3)
-	isolateId, _ := strconv.Atoi(parts[0])
-	contextId, _ := strconv.Atoi(parts[1])
-	callbackId, _ := strconv.Atoi(parts[2])
+	parts := strings.Split(ids, ":")
+	callbackId, _ := strconv.Atoi(parts[len(parts)-1])
 
-	isolateRef := isolateRefs.Get(refutils.ID(isolateId))
-	if isolateRef == nil {
-		panic(fmt.Errorf("missing isolate pointer during callback for isolate #%d", isolateId))
-	}
-	isolate := isolateRef.(*Isolate)
+	isolate := (*Isolate)(info.isolate)
 
-	contextRef := isolate.contexts.Get(refutils.ID(contextId))
+	contextRef := isolate.contexts.Get(refutils.ID(info.contextId))
 	if contextRef == nil {
-		panic(fmt.Errorf("missing context pointer during callback for context #%d", contextId))
+		panic(fmt.Errorf("missing context pointer during callback for context #%d", info.contextId))
 	}
 	v8Context := contextRef.(*Context)
 
+	functions, accessors := v8Context.functions, v8Context.accessors
+	if parts[0] == "snapshot" {
+		if v8Context.snapshot == nil || v8Context.snapshot.functions == nil {
+			panic(fmt.Errorf("missing snapshot during callback for %s, snapshots only restore Go callbacks in the process that created them", ids))
+		}
+		functions, accessors = v8Context.snapshot.functions, v8Context.snapshot.accessors
+	}
+
 	ctx := isolate.GetExecutionContext()
 	For(ctx).SetContext(v8Context)
 
@@ -164,11 +252,15 @@ func callbackHandler(info *C.CallbackInfo) (r C.CallResult) {
 		self, _ := v8Context.newValueFromTuple(ctx, info.self)
 		holder, _ := v8Context.newValueFromTuple(ctx, info.holder)
 
-		args := callbackArgs{v8Context, callerInfo, self, holder}
+		args := callbackArgs{v8Context, callerInfo, self, holder, functions, accessors}
 
 		v, err := callbackHandlers[info._type](ctx, v8Context, *info, args, refutils.ID(callbackId))
 
-		if v == nil && err == nil {
+		// An empty result tells a property interceptor to fall through to the
+		// object's own properties.
+		if v == nil && err == nil && info._type >= C.kPropertyGetterCallback {
+			return C.v8_CallResult(), nil
+		} else if v == nil && err == nil {
 			v, err = v8Context.Undefined(ctx)
 		}
 
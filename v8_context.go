@@ -52,14 +52,23 @@ type Context struct {
 	weakCallbacks     map[string]*weakCallbackInfo
 	weakCallbackMutex sync.Mutex
 
+	snapshot           *Snapshot
+	snapshotHandles    []snapshotHandle
+	esModules          map[int]*Module
+	options            ContextOptions
+	hostObjectDelegate HostObjectDelegate
+
 	data sync.Map
 }
 
 func (i *Isolate) NewContext(ctx context.Context) (*Context, error) {
+	return i.NewContextWithOptions(ctx, ContextOptions{})
+}
+
+func (i *Isolate) NewContextWithOptions(ctx context.Context, options ContextOptions) (*Context, error) {
 	c, err := i.Sync(ctx, func(ctx context.Context) (any, error) {
 		context := &Context{
 			isolate:       i,
-			pointer:       C.v8_Context_New(i.pointer),
 			functions:     refutils.NewRefMap("f"),
 			accessors:     refutils.NewRefMap("a"),
 			receivers:     map[uintptr]*Value{},
@@ -67,12 +76,24 @@ func (i *Isolate) NewContext(ctx context.Context) (*Context, error) {
 			constructors:  map[reflect.Type]*FunctionTemplate{},
 			prototypes:    map[reflect.Type]*FunctionTemplate{},
 			weakCallbacks: map[string]*weakCallbackInfo{},
+			esModules:     map[int]*Module{},
+			snapshot:      i.options.Snapshot,
+			options:       options,
 		}
 
+		if context.snapshot != nil && context.snapshot.creating {
+			context.functions = context.snapshot.functions
+			context.accessors = context.snapshot.accessors
+		}
+
+		cid := context.ref()
+		coptions, free := options.toC()
+		context.pointer = C.v8_Context_New(i.pointer, C.int(cid), coptions)
+		free()
+
 		For(ctx).SetContext(context)
 
-		context.ref()
-		runtime.SetFinalizer(context, (*Context).release)
+		runtime.SetFinalizer(context, (*Context).finalize)
 
 		if global, err := context.Global(ctx); err != nil {
 			return nil, err
@@ -100,6 +121,20 @@ func (i *Isolate) NewContext(ctx context.Context) (*Context, error) {
 			return nil, err
 		}
 
+		if context.snapshot == nil || !context.snapshot.creating {
+			if err := context.installEventLoop(ctx); err != nil {
+				return nil, err
+			} else if err := context.InstallStructuredClone(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		if options.FreezeIntrinsics {
+			if err := context.freezeIntrinsics(ctx); err != nil {
+				return nil, err
+			}
+		}
+
 		return context, nil
 	})
 
@@ -130,6 +165,23 @@ func (c *Context) unref() {
 	c.isolate.contexts.Unref(c)
 }
 
+// callbackID identifies a function or accessor to callbackHandler. Callbacks
+// bound while creating a snapshot are looked up through the snapshot, so that
+// they resolve in every context restored from it.
+func (c *Context) callbackID(id refutils.ID) string {
+	if c.snapshot != nil && c.snapshot.creating {
+		return fmt.Sprintf("snapshot:%d", id)
+	}
+
+	iid := c.isolate.ref()
+	defer c.isolate.unref()
+
+	cid := c.ref()
+	defer c.unref()
+
+	return fmt.Sprintf("%d:%d:%d", iid, cid, id)
+}
+
 func (c *Context) AddMicrotask(ctx context.Context, fn func(in FunctionArgs) error) error {
 	_, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 
@@ -158,7 +210,10 @@ func (c *Context) Run(ctx context.Context, code string, filename string, module
 		iid := c.isolate.ref()
 		defer c.isolate.unref()
 
-		mid := c.isolate.modules.Ref(module)
+		var mid refutils.ID
+		if module != nil {
+			mid = c.isolate.modules.Ref(module)
+		}
 		pid := C.CString(fmt.Sprintf("%d:%d", iid, mid))
 
 		c.ref()
@@ -369,6 +424,10 @@ func (c *Context) ParseJSON(ctx context.Context, json string) (*Value, error) {
 	}
 }
 
+func (c *Context) finalize() {
+	c.isolate.finalize(c.release)
+}
+
 func (c *Context) release() {
 	ctx := c.isolate.GetExecutionContext()
 
@@ -0,0 +1,125 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"unsafe"
+
+	refutils "github.com/grexie/refutils"
+)
+
+// ContextOptions sandboxes the code run in a context. The zero value creates
+// a context with V8's defaults.
+type ContextOptions struct {
+	// DisallowCodeGenerationFromStrings makes eval and new Function throw an
+	// EvalError, unless AllowCodeGenerationFromStrings returns true for the
+	// source being compiled.
+	DisallowCodeGenerationFromStrings bool
+	AllowCodeGenerationFromStrings    func(source string) bool
+
+	// DisallowWasmCodeGeneration makes WebAssembly.compile, instantiate and
+	// the Module constructor throw a CompileError.
+	DisallowWasmCodeGeneration bool
+
+	// FreezeIntrinsics deep-freezes the builtin objects of the context, such
+	// as Object.prototype and Array.prototype, so that code run in it can't
+	// change their behaviour for other code. The global object itself is left
+	// extensible.
+	FreezeIntrinsics bool
+
+	// SecurityToken controls access between contexts: code in one context can
+	// only access the global object of another with the same token. By default
+	// each context has its own token.
+	SecurityToken string
+}
+
+const freezeIntrinsicsBootstrap = `(function () {
+	const seen = new WeakSet([globalThis]);
+
+	const freeze = (value) => {
+		if ((typeof value !== 'object' && typeof value !== 'function') || value === null || seen.has(value)) {
+			return;
+		}
+
+		seen.add(value);
+		Object.freeze(value);
+		freeze(Object.getPrototypeOf(value));
+
+		for (const key of Reflect.ownKeys(value)) {
+			const descriptor = Reflect.getOwnPropertyDescriptor(value, key);
+			if ('value' in descriptor) {
+				freeze(descriptor.value);
+			} else {
+				freeze(descriptor.get);
+				freeze(descriptor.set);
+			}
+		}
+	};
+
+	// Intrinsics that aren't reachable from a global property.
+	const hidden = [
+		Object.getPrototypeOf(function* () {}),
+		Object.getPrototypeOf(async function () {}),
+		Object.getPrototypeOf(async function* () {}),
+		Object.getPrototypeOf([][Symbol.iterator]()),
+		Object.getPrototypeOf(new Map()[Symbol.iterator]()),
+		Object.getPrototypeOf(new Set()[Symbol.iterator]()),
+		Object.getPrototypeOf(''[Symbol.iterator]()),
+		Object.getPrototypeOf(/./[Symbol.matchAll]('')),
+	];
+
+	for (const key of Reflect.ownKeys(globalThis)) {
+		const descriptor = Reflect.getOwnPropertyDescriptor(globalThis, key);
+		freeze(descriptor.value ?? descriptor.get);
+	}
+
+	hidden.forEach(freeze);
+	freeze(Object.getPrototypeOf(globalThis));
+})()`
+
+func (o ContextOptions) toC() (C.ContextOptions, func()) {
+	options := C.ContextOptions{
+		allowCodeGenerationFromStrings: C.bool(!o.DisallowCodeGenerationFromStrings),
+	}
+
+	if o.SecurityToken == "" {
+		return options, func() {}
+	}
+
+	options.securityToken = C.String{data: C.CString(o.SecurityToken), length: C.int(len(o.SecurityToken))}
+	return options, func() {
+		C.free(unsafe.Pointer(options.securityToken.data))
+	}
+}
+
+func (c *Context) freezeIntrinsics(ctx context.Context) error {
+	_, err := c.Run(ctx, freezeIntrinsicsBootstrap, "isolates:freeze_intrinsics.js", nil)
+	return err
+}
+
+//export allowCodeGenerationCallback
+func allowCodeGenerationCallback(pIsolate C.Pointer, contextId C.int, source C.String) C.bool {
+	isolate := (*Isolate)(pIsolate)
+
+	if contextRef := isolate.contexts.Get(refutils.ID(contextId)); contextRef == nil {
+		return false
+	} else if allow := contextRef.(*Context).options.AllowCodeGenerationFromStrings; allow == nil {
+		return false
+	} else {
+		return C.bool(allow(C.GoStringN(source.data, source.length)))
+	}
+}
+
+//export allowWasmCodeGenerationCallback
+func allowWasmCodeGenerationCallback(pIsolate C.Pointer, contextId C.int) C.bool {
+	isolate := (*Isolate)(pIsolate)
+
+	if contextRef := isolate.contexts.Get(refutils.ID(contextId)); contextRef == nil {
+		return false
+	} else {
+		return C.bool(!contextRef.(*Context).options.DisallowWasmCodeGeneration)
+	}
+}
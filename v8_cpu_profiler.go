@@ -0,0 +1,253 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// CPUProfile is a profile recorded by Isolate.StartCPUProfile. It can be
+// written as a Chrome .cpuprofile with WriteCPUProfile or in the pprof format
+// with WritePprof.
+type CPUProfile struct {
+	Title string
+
+	// StartTime and EndTime are in microseconds on V8's monotonic clock.
+	StartTime int64
+	EndTime   int64
+
+	Root *CPUProfileNode
+
+	// Samples holds the ID of the node sampled at each timestamp in
+	// Timestamps.
+	Samples    []int
+	Timestamps []int64
+}
+
+type CPUProfileNode struct {
+	ID           int
+	FunctionName string
+	URL          string
+	ScriptID     int
+	LineNumber   int
+	ColumnNumber int
+	HitCount     int
+	Children     []*CPUProfileNode
+}
+
+var ErrCPUProfileAlreadyStarted = errors.New("isolates: cpu profile already started")
+var ErrTooManyCPUProfiles = errors.New("isolates: too many cpu profiles")
+
+// StartCPUProfile starts recording a CPU profile identified by title,
+// sampling the JavaScript stack every samplingInterval. A zero interval uses
+// the V8 default.
+func (i *Isolate) StartCPUProfile(ctx context.Context, title string, samplingInterval time.Duration) error {
+	_, err := i.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if i.cpuProfiler == nil {
+			i.cpuProfiler = C.v8_CPUProfiler_New(i.pointer)
+		}
+
+		ptitle := C.CString(title)
+		defer C.free(unsafe.Pointer(ptitle))
+
+		switch C.v8_CPUProfiler_Start(i.cpuProfiler, ptitle, C.int(samplingInterval.Microseconds())) {
+		case 0:
+			return nil, nil
+		case 1:
+			return nil, ErrCPUProfileAlreadyStarted
+		default:
+			return nil, ErrTooManyCPUProfiles
+		}
+	})
+
+	return err
+}
+
+// StopCPUProfile stops the CPU profile identified by title and returns it.
+func (i *Isolate) StopCPUProfile(ctx context.Context, title string) (*CPUProfile, error) {
+	p, err := i.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if i.cpuProfiler == nil {
+			return nil, fmt.Errorf("cpu profile not started: %s", title)
+		}
+
+		ptitle := C.CString(title)
+		defer C.free(unsafe.Pointer(ptitle))
+
+		cp := C.v8_CPUProfiler_Stop(i.cpuProfiler, ptitle)
+		if cp.nodeCount == 0 {
+			return nil, fmt.Errorf("cpu profile not started: %s", title)
+		}
+
+		profile := &CPUProfile{
+			Title:     goStringFree(cp.title),
+			StartTime: int64(cp.startTime),
+			EndTime:   int64(cp.endTime),
+		}
+
+		nodes := map[int]*CPUProfileNode{}
+		for _, n := range (*[1 << (maxArraySize - 18)]C.CPUProfileNode)(unsafe.Pointer(cp.nodes))[:cp.nodeCount:cp.nodeCount] {
+			node := &CPUProfileNode{
+				ID:           int(n.id),
+				FunctionName: goStringFree(n.functionName),
+				URL:          goStringFree(n.url),
+				ScriptID:     int(n.scriptId),
+				LineNumber:   int(n.lineNumber),
+				ColumnNumber: int(n.columnNumber),
+				HitCount:     int(n.hitCount),
+			}
+			nodes[node.ID] = node
+
+			if parent, ok := nodes[int(n.parentId)]; ok {
+				parent.Children = append(parent.Children, node)
+			} else {
+				profile.Root = node
+			}
+		}
+		C.free(unsafe.Pointer(cp.nodes))
+
+		if cp.sampleCount > 0 {
+			samples := (*[1 << (maxArraySize - 18)]C.int)(unsafe.Pointer(cp.samples))[:cp.sampleCount:cp.sampleCount]
+			timestamps := (*[1 << (maxArraySize - 18)]C.int64_t)(unsafe.Pointer(cp.timestamps))[:cp.sampleCount:cp.sampleCount]
+
+			profile.Samples = make([]int, len(samples))
+			profile.Timestamps = make([]int64, len(timestamps))
+			for j := range samples {
+				profile.Samples[j] = int(samples[j])
+				profile.Timestamps[j] = int64(timestamps[j])
+			}
+
+			C.free(unsafe.Pointer(cp.samples))
+			C.free(unsafe.Pointer(cp.timestamps))
+		}
+
+		return profile, nil
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return p.(*CPUProfile), nil
+	}
+}
+
+func (p *CPUProfile) walk(fn func(node *CPUProfileNode, stack []*CPUProfileNode)) {
+	var walk func(node *CPUProfileNode, stack []*CPUProfileNode)
+	walk = func(node *CPUProfileNode, stack []*CPUProfileNode) {
+		stack = append(stack, node)
+		fn(node, stack)
+		for _, child := range node.Children {
+			walk(child, stack)
+		}
+	}
+
+	if p.Root != nil {
+		walk(p.Root, nil)
+	}
+}
+
+// WriteCPUProfile writes the profile in the JSON format of Chrome DevTools
+// .cpuprofile files.
+func (p *CPUProfile) WriteCPUProfile(w io.Writer) error {
+	type callFrame struct {
+		FunctionName string `json:"functionName"`
+		ScriptID     string `json:"scriptId"`
+		URL          string `json:"url"`
+		LineNumber   int    `json:"lineNumber"`
+		ColumnNumber int    `json:"columnNumber"`
+	}
+
+	type node struct {
+		ID        int       `json:"id"`
+		CallFrame callFrame `json:"callFrame"`
+		HitCount  int       `json:"hitCount"`
+		Children  []int     `json:"children,omitempty"`
+	}
+
+	out := struct {
+		Nodes      []node  `json:"nodes"`
+		StartTime  int64   `json:"startTime"`
+		EndTime    int64   `json:"endTime"`
+		Samples    []int   `json:"samples"`
+		TimeDeltas []int64 `json:"timeDeltas"`
+	}{
+		Nodes:      []node{},
+		StartTime:  p.StartTime,
+		EndTime:    p.EndTime,
+		Samples:    p.Samples,
+		TimeDeltas: make([]int64, len(p.Timestamps)),
+	}
+
+	p.walk(func(n *CPUProfileNode, stack []*CPUProfileNode) {
+		children := make([]int, len(n.Children))
+		for j, child := range n.Children {
+			children[j] = child.ID
+		}
+
+		// DevTools line and column numbers are zero based.
+		out.Nodes = append(out.Nodes, node{
+			ID: n.ID,
+			CallFrame: callFrame{
+				FunctionName: n.FunctionName,
+				ScriptID:     strconv.Itoa(n.ScriptID),
+				URL:          n.URL,
+				LineNumber:   n.LineNumber - 1,
+				ColumnNumber: n.ColumnNumber - 1,
+			},
+			HitCount: n.HitCount,
+			Children: children,
+		})
+	})
+
+	last := p.StartTime
+	for j, timestamp := range p.Timestamps {
+		out.TimeDeltas[j] = timestamp - last
+		last = timestamp
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+// WritePprof writes the profile in the gzipped protobuf format read by go
+// tool pprof, with sample counts and CPU time per JavaScript stack.
+func (p *CPUProfile) WritePprof(w io.Writer) error {
+	pp := newPprofProfile(pprofValueType{"samples", "count"}, pprofValueType{"cpu", "nanoseconds"})
+	pp.periodType = &pprofValueType{"cpu", "nanoseconds"}
+	pp.durationNanos = (p.EndTime - p.StartTime) * int64(time.Microsecond)
+
+	if len(p.Samples) > 0 {
+		pp.period = pp.durationNanos / int64(len(p.Samples))
+	}
+
+	// Attribute the time since the previous sample to each sampled node.
+	cpu := map[int]int64{}
+	last := p.StartTime
+	for j, id := range p.Samples {
+		cpu[id] += (p.Timestamps[j] - last) * int64(time.Microsecond)
+		last = p.Timestamps[j]
+	}
+
+	p.walk(func(node *CPUProfileNode, stack []*CPUProfileNode) {
+		if node.HitCount == 0 {
+			return
+		}
+
+		// The first node of the stack is V8's synthetic (root) node.
+		locations := make([]uint64, 0, len(stack)-1)
+		for j := len(stack) - 1; j > 0; j-- {
+			locations = append(locations, pp.location(stack[j].FunctionName, stack[j].URL, int64(stack[j].LineNumber)))
+		}
+
+		pp.addSample(locations, int64(node.HitCount), cpu[node.ID])
+	})
+
+	return pp.write(w)
+}
@@ -7,9 +7,11 @@ import "C"
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unsafe"
@@ -46,7 +48,35 @@ func (s stringKeys) Less(a, b int) bool {
 	return s[a].String() < s[b].String()
 }
 
+// mapKeys orders the keys of a map so that Maps and Sets are created in a
+// stable order: numerically for numbers, and by their formatted value
+// otherwise.
+type mapKeys []reflect.Value
+
+func (s mapKeys) Len() int {
+	return len(s)
+}
+
+func (s mapKeys) Swap(a, b int) {
+	s[a], s[b] = s[b], s[a]
+}
+
+func (s mapKeys) Less(a, b int) bool {
+	ka, kb := s[a], s[b]
+	switch {
+	case ka.CanInt() && kb.CanInt():
+		return ka.Int() < kb.Int()
+	case ka.CanUint() && kb.CanUint():
+		return ka.Uint() < kb.Uint()
+	case ka.CanFloat() && kb.CanFloat():
+		return ka.Float() < kb.Float()
+	default:
+		return fmt.Sprint(ka.Interface()) < fmt.Sprint(kb.Interface())
+	}
+}
+
 var float64Type = reflect.TypeOf(float64(0))
+var emptyStructType = reflect.TypeOf(struct{}{})
 var functionType = reflect.TypeOf(Function(nil))
 var getterType = reflect.TypeOf(Getter(nil))
 var setterType = reflect.TypeOf(Setter(nil))
@@ -193,6 +223,12 @@ func (c *Context) create(ctx context.Context, v reflect.Value, name *string, wit
 			return value, nil
 		}
 
+		if v.Type() == jsErrorType {
+			if jsErr := v.Interface().(*JSError); jsErr.Exception != nil {
+				return jsErr.Exception, nil
+			}
+		}
+
 		v = marshalValue(ctx, v)
 
 		if withMarshallers {
@@ -238,6 +274,19 @@ func (c *Context) create(ctx context.Context, v reflect.Value, name *string, wit
 			return c.createImmediateValue(ctx, C.ImmediateValue{_type: C.tFLOAT64, _float64: msec})
 		}
 
+		if v.Type() == sharedArrayBufferType {
+			return c.AttachSharedArrayBuffer(ctx, v.Interface().(*SharedArrayBuffer))
+		}
+
+		if v.Type() == bigIntType {
+			if v.CanAddr() {
+				return c.createBigInt(ctx, v.Addr().Interface().(*big.Int))
+			} else {
+				b := v.Interface().(big.Int)
+				return c.createBigInt(ctx, &b)
+			}
+		}
+
 		switch v.Kind() {
 		case reflect.Bool:
 			b := C.bool(false)
@@ -248,6 +297,12 @@ func (c *Context) create(ctx context.Context, v reflect.Value, name *string, wit
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 			reflect.Float32, reflect.Float64:
+			if v.CanInt() && !isSafeInteger(v.Int()) {
+				return c.createBigInt(ctx, big.NewInt(v.Int()))
+			} else if v.CanUint() && v.Uint() > maxSafeInteger {
+				return c.createBigInt(ctx, new(big.Int).SetUint64(v.Uint()))
+			}
+
 			n := C.double(v.Convert(float64Type).Float())
 			return c.createImmediateValue(ctx, C.ImmediateValue{_type: C.tFLOAT64, _float64: n})
 		case reflect.String:
@@ -267,6 +322,10 @@ func (c *Context) create(ctx context.Context, v reflect.Value, name *string, wit
 		case reflect.Func:
 			if v.Type().ConvertibleTo(functionType) {
 				return c.CreateFunction(ctx, name, v.Convert(functionType).Interface().(Function))
+			} else if v.Type().ConvertibleTo(asyncFunctionType) {
+				return c.CreateAsyncFunction(ctx, name, v.Convert(asyncFunctionType).Interface().(AsyncFunction))
+			} else if isAsyncChanFunction(v.Type()) {
+				return c.CreateAsyncFunction(ctx, name, asyncChanFunction(v))
 			} else if err := isConstructor(v.Type()); err == nil {
 				return c.createConstructor(ctx, name, v.Interface())
 			}
@@ -274,8 +333,10 @@ func (c *Context) create(ctx context.Context, v reflect.Value, name *string, wit
 		case reflect.Interface, reflect.Ptr:
 			return c.create(ctx, v.Elem(), name, withMarshallers)
 		case reflect.Map:
-			if v.Type().Key() != stringType {
-				return nil, fmt.Errorf("map keys must be strings, %s not permissable in v8", v.Type().Key())
+			if v.Type().Elem() == emptyStructType {
+				return c.createSet(ctx, v, name, withMarshallers)
+			} else if v.Type().Key() != stringType {
+				return c.createMap(ctx, v, name, withMarshallers)
 			}
 
 			if o, err := c.createImmediateValue(ctx, C.ImmediateValue{_type: C.tOBJECT}); err != nil {
@@ -351,6 +412,8 @@ func (c *Context) create(ctx context.Context, v reflect.Value, name *string, wit
 						_data: C.ByteArray{data: pb, length: C.int(v.Len())},
 					},
 				)
+			} else if kind, ok := typedArrayKinds[v.Type().Elem().Kind()]; ok {
+				return c.createTypedArray(ctx, v, kind)
 			} else {
 				if o, err := c.createImmediateValue(ctx,
 					C.ImmediateValue{
@@ -384,6 +447,47 @@ func (c *Context) create(ctx context.Context, v reflect.Value, name *string, wit
 
 }
 
+// createMap creates a JavaScript Map from a Go map with keys other than
+// strings.
+func (c *Context) createMap(ctx context.Context, v reflect.Value, name *string, withMarshallers bool) (*Value, error) {
+	if m, err := c.createImmediateValue(ctx, C.ImmediateValue{_type: C.tMAP}); err != nil {
+		return nil, err
+	} else {
+		keys := v.MapKeys()
+		sort.Sort(mapKeys(keys))
+		for _, k := range keys {
+			if vk, err := c.create(ctx, k, name, withMarshallers); err != nil {
+				return nil, fmt.Errorf("map key %v: %v", k, err)
+			} else if vv, err := c.create(ctx, v.MapIndex(k), name, withMarshallers); err != nil {
+				return nil, fmt.Errorf("map key %v: %v", k, err)
+			} else if err := m.mapSet(ctx, vk, vv); err != nil {
+				return nil, err
+			}
+		}
+
+		return m, nil
+	}
+}
+
+// createSet creates a JavaScript Set from the keys of a map[T]struct{}.
+func (c *Context) createSet(ctx context.Context, v reflect.Value, name *string, withMarshallers bool) (*Value, error) {
+	if s, err := c.createImmediateValue(ctx, C.ImmediateValue{_type: C.tSET}); err != nil {
+		return nil, err
+	} else {
+		keys := v.MapKeys()
+		sort.Sort(mapKeys(keys))
+		for _, k := range keys {
+			if vk, err := c.create(ctx, k, name, withMarshallers); err != nil {
+				return nil, fmt.Errorf("set value %v: %v", k, err)
+			} else if err := s.setAdd(ctx, vk); err != nil {
+				return nil, err
+			}
+		}
+
+		return s, nil
+	}
+}
+
 func (c *Context) CreateFunction(ctx context.Context, name *string, function Function) (*Value, error) {
 	v, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		if ft, err := c.NewFunctionTemplate(ctx, function); err != nil {
@@ -909,8 +1013,176 @@ func (c *Context) writePrototypeFields(ctx context.Context, v *ObjectTemplate, o
 			return nil, c.writePrototypeFields(ctx, v, o, value, reflect.PtrTo(prototype))
 		}
 
-		return nil, nil
+		return nil, c.writePropertyHandlers(ctx, v, prototype)
 	})
 
 	return err
 }
+
+// writePropertyHandlers exposes dynamic shapes through property handlers on
+// the instance template. V8GetIndex(int) (T, error), V8SetIndex(int, T) error
+// and V8Len() int back indexed properties, and V8GetKey(string) (T, error),
+// V8SetKey(string, T) error, V8DeleteKey(string) error and V8Keys() []string
+// named ones. The handlers are non-masking, so fields and methods exposed to
+// JavaScript take precedence.
+func (c *Context) writePropertyHandlers(ctx context.Context, v *ObjectTemplate, prototype reflect.Type) error {
+	call := func(in PropertyArgs, name string, args ...reflect.Value) ([]reflect.Value, error) {
+		r, err := c.Receiver(in.ExecutionContext, in.Holder, prototype)
+		if err != nil {
+			return nil, err
+		}
+
+		m := r.MethodByName(name)
+		if !m.IsValid() {
+			return nil, fmt.Errorf("method %s not found", name)
+		}
+
+		for j := range args {
+			if args[j].Type() == valueType {
+				if rv, err := args[j].Interface().(*Value).Unmarshal(in.ExecutionContext, m.Type().In(j)); err != nil {
+					return nil, err
+				} else {
+					args[j] = *rv
+				}
+			}
+		}
+
+		out := m.Call(args)
+		if n := len(out); n > 0 && out[n-1].Type() == errorType {
+			if !out[n-1].IsNil() {
+				return nil, out[n-1].Interface().(error)
+			}
+			out = out[:n-1]
+		}
+
+		return out, nil
+	}
+
+	get := func(in PropertyArgs, name string, arg reflect.Value) (*Value, error) {
+		if out, err := call(in, name, arg); err != nil {
+			return nil, err
+		} else if len(out) == 0 {
+			return in.Context.Undefined(in.ExecutionContext)
+		} else {
+			return in.Context.create(in.ExecutionContext, out[0], nil, true)
+		}
+	}
+
+	length := func(in PropertyArgs) (int, error) {
+		if out, err := call(in, "V8Len"); err != nil {
+			return 0, err
+		} else {
+			return int(out[0].Int()), nil
+		}
+	}
+
+	keys := func(in PropertyArgs) ([]string, error) {
+		if out, err := call(in, "V8Keys"); err != nil {
+			return nil, err
+		} else {
+			return out[0].Interface().([]string), nil
+		}
+	}
+
+	has := func(name string) bool {
+		_, ok := prototype.MethodByName(name)
+		return ok
+	}
+
+	if has("V8GetIndex") {
+		handler := PropertyHandler{NonMasking: true}
+
+		handler.Getter = func(in PropertyArgs) (*Value, error) {
+			if has("V8Len") {
+				if n, err := length(in); err != nil || int(in.Index) >= n {
+					return nil, err
+				}
+			}
+			return get(in, "V8GetIndex", reflect.ValueOf(int(in.Index)))
+		}
+
+		if has("V8SetIndex") {
+			handler.Setter = func(in PropertyArgs) (bool, error) {
+				_, err := call(in, "V8SetIndex", reflect.ValueOf(int(in.Index)), reflect.ValueOf(in.Value))
+				return err == nil, err
+			}
+		}
+
+		if has("V8Len") {
+			handler.Query = func(in PropertyArgs) (bool, error) {
+				n, err := length(in)
+				return err == nil && int(in.Index) < n, err
+			}
+
+			handler.Enumerator = func(in PropertyArgs) ([]string, error) {
+				if n, err := length(in); err != nil {
+					return nil, err
+				} else {
+					indexes := make([]string, n)
+					for j := range indexes {
+						indexes[j] = strconv.Itoa(j)
+					}
+					return indexes, nil
+				}
+			}
+		}
+
+		if err := v.SetIndexedPropertyHandler(ctx, handler); err != nil {
+			return err
+		}
+	}
+
+	if has("V8GetKey") {
+		handler := PropertyHandler{NonMasking: true}
+
+		contains := func(in PropertyArgs) (bool, error) {
+			if !has("V8Keys") {
+				return true, nil
+			} else if keys, err := keys(in); err != nil {
+				return false, err
+			} else {
+				for _, key := range keys {
+					if key == in.Key {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+		}
+
+		handler.Getter = func(in PropertyArgs) (*Value, error) {
+			if ok, err := contains(in); err != nil || !ok {
+				return nil, err
+			}
+			return get(in, "V8GetKey", reflect.ValueOf(in.Key))
+		}
+
+		if has("V8SetKey") {
+			handler.Setter = func(in PropertyArgs) (bool, error) {
+				_, err := call(in, "V8SetKey", reflect.ValueOf(in.Key), reflect.ValueOf(in.Value))
+				return err == nil, err
+			}
+		}
+
+		if has("V8DeleteKey") {
+			handler.Deleter = func(in PropertyArgs) (bool, error) {
+				if ok, err := contains(in); err != nil || !ok {
+					return false, err
+				}
+				_, err := call(in, "V8DeleteKey", reflect.ValueOf(in.Key))
+				return err == nil, err
+			}
+		}
+
+		if has("V8Keys") {
+			handler.Query = contains
+			handler.Enumerator = keys
+		}
+
+		if err := v.SetNamedPropertyHandler(ctx, handler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
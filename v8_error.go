@@ -0,0 +1,126 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// StackFrame is a frame of the stack trace captured with a JavaScript
+// exception.
+type StackFrame struct {
+	Function      string
+	Script        string
+	Line          int
+	Column        int
+	IsEval        bool
+	IsConstructor bool
+}
+
+func (f StackFrame) String() string {
+	function := f.Function
+	if function == "" {
+		function = "<anonymous>"
+	}
+	if f.IsConstructor {
+		function = "new " + function
+	}
+	return fmt.Sprintf("%s (%s:%d:%d)", function, f.Script, f.Line, f.Column)
+}
+
+// JSError is an exception thrown by JavaScript. Errors returned from Run,
+// Call, Await and friends can be inspected with errors.As:
+//
+//	var jsErr *isolates.JSError
+//	if errors.As(err, &jsErr) {
+//		log.Println(jsErr.StackTrace[0].Script, jsErr.StackTrace[0].Line)
+//	}
+type JSError struct {
+	Name       string
+	Message    string
+	StackTrace []StackFrame
+	SourceLine string
+
+	// Exception is the value that was thrown.
+	Exception *Value
+
+	formatted string
+	cause     error
+}
+
+var jsErrorType = reflect.TypeOf((*JSError)(nil))
+
+func (e *JSError) Error() string {
+	if e.cause != nil {
+		return e.cause.Error()
+	} else if e.formatted != "" {
+		return e.formatted
+	} else if e.Name != "" {
+		return fmt.Sprintf("%s: %s", e.Name, e.Message)
+	} else {
+		return e.Message
+	}
+}
+
+// Unwrap returns the Go error that was thrown into JavaScript, if the
+// exception originated from a Go callback.
+func (e *JSError) Unwrap() error {
+	return e.cause
+}
+
+func (v *Value) newJSError(ctx context.Context) *JSError {
+	pe, _ := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		e := &JSError{Exception: v}
+
+		if rv := v.Receiver(ctx); !isZero(rv) && rv.Type().ConvertibleTo(errorType) {
+			if cause, ok := rv.Interface().(*JSError); ok {
+				return cause, nil
+			}
+			e.cause = rv.Interface().(error)
+		}
+
+		v.context.ref()
+		info := C.v8_Value_ExceptionInfo(v.context.pointer, v.pointer)
+		v.context.unref()
+
+		e.Name = goStringFree(info.name)
+		e.Message = goStringFree(info.message)
+		e.SourceLine = goStringFree(info.sourceLine)
+		e.formatted = goStringFree(info.formatted)
+
+		if info.frameCount > 0 {
+			frames := (*[1 << (maxArraySize - 18)]C.ExceptionStackFrame)(unsafe.Pointer(info.frames))[:info.frameCount:info.frameCount]
+			e.StackTrace = make([]StackFrame, len(frames))
+			for i, frame := range frames {
+				e.StackTrace[i] = StackFrame{
+					Function:      goStringFree(frame.function),
+					Script:        goStringFree(frame.script),
+					Line:          int(frame.line),
+					Column:        int(frame.column),
+					IsEval:        bool(frame.isEval),
+					IsConstructor: bool(frame.isConstructor),
+				}
+			}
+		}
+		if info.frames != nil {
+			C.free(unsafe.Pointer(info.frames))
+		}
+
+		return e, nil
+	})
+
+	return pe.(*JSError)
+}
+
+func goStringFree(s C.String) string {
+	if s.data == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(s.data))
+	return C.GoStringN(s.data, s.length)
+}
@@ -0,0 +1,437 @@
+package isolates
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// eventLoop runs the timers and immediates scheduled by the JavaScript in an
+// isolate and keeps track of the work that Isolate.Wait waits for: ref'd
+// timers, Go async operations started with Background or KeepAlive and
+// unsettled Resolvers.
+type eventLoop struct {
+	isolate *Isolate
+
+	mutex   sync.Mutex
+	timers  map[int]*timer
+	nextID  int
+	queue   []*timer
+	running bool
+	pending int
+	drained chan bool
+	closed  bool
+	err     error
+}
+
+type timer struct {
+	id       int
+	context  *Context
+	callback *Value
+	delay    time.Duration
+	repeat   bool
+	ref      bool
+	queued   bool
+	t        *time.Timer
+}
+
+const eventLoopBootstrap = `(function (schedule, clear, setRef, refresh, enqueueMicrotask) {
+	class Timeout {
+		#id;
+		#ref = true;
+
+		constructor(id) {
+			this.#id = id;
+		}
+
+		ref() {
+			this.#ref = true;
+			setRef(this.#id, true);
+			return this;
+		}
+
+		unref() {
+			this.#ref = false;
+			setRef(this.#id, false);
+			return this;
+		}
+
+		hasRef() {
+			return this.#ref;
+		}
+
+		refresh() {
+			refresh(this.#id);
+			return this;
+		}
+
+		[Symbol.toPrimitive]() {
+			return this.#id;
+		}
+	}
+
+	class Immediate extends Timeout {}
+
+	const checkCallback = (callback) => {
+		if (typeof callback !== 'function') {
+			throw new TypeError('The "callback" argument must be of type function');
+		}
+	};
+
+	const clearTimer = (handle) => {
+		if (handle !== undefined && handle !== null) {
+			clear(Number(handle));
+		}
+	};
+
+	return {
+		setTimeout(callback, delay, ...args) {
+			checkCallback(callback);
+			return new Timeout(schedule(() => callback(...args), Number(delay) || 0, false, false));
+		},
+		setInterval(callback, delay, ...args) {
+			checkCallback(callback);
+			return new Timeout(schedule(() => callback(...args), Number(delay) || 0, true, false));
+		},
+		setImmediate(callback, ...args) {
+			checkCallback(callback);
+			return new Immediate(schedule(() => callback(...args), 0, false, true));
+		},
+		clearTimeout: clearTimer,
+		clearInterval: clearTimer,
+		clearImmediate: clearTimer,
+		queueMicrotask(callback) {
+			checkCallback(callback);
+			enqueueMicrotask(callback);
+		},
+	};
+})`
+
+func newEventLoop(isolate *Isolate) *eventLoop {
+	return &eventLoop{
+		isolate: isolate,
+		timers:  map[int]*timer{},
+		drained: make(chan bool),
+	}
+}
+
+// hold registers pending work. The loop isn't drained until every hold is
+// released.
+func (l *eventLoop) hold() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.holdLocked()
+}
+
+func (l *eventLoop) holdLocked() {
+	if l.closed {
+		return
+	}
+	if l.pending == 0 {
+		l.drained = make(chan bool)
+	}
+	l.pending++
+}
+
+func (l *eventLoop) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.releaseLocked()
+}
+
+func (l *eventLoop) releaseLocked() {
+	if l.closed || l.pending == 0 {
+		return
+	}
+	l.pending--
+	if l.pending == 0 {
+		close(l.drained)
+	}
+}
+
+func (l *eventLoop) schedule(c *Context, callback *Value, delay time.Duration, repeat bool, immediate bool) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if immediate {
+		delay = 0
+	} else if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+
+	l.nextID++
+	t := &timer{
+		id:       l.nextID,
+		context:  c,
+		callback: callback,
+		delay:    delay,
+		repeat:   repeat,
+		ref:      true,
+	}
+
+	if l.closed {
+		return t.id
+	}
+
+	l.timers[t.id] = t
+	l.holdLocked()
+
+	if immediate {
+		l.enqueueLocked(t)
+	} else {
+		l.startLocked(t)
+	}
+
+	return t.id
+}
+
+func (l *eventLoop) startLocked(t *timer) {
+	t.t = time.AfterFunc(t.delay, func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		if _, ok := l.timers[t.id]; ok {
+			l.enqueueLocked(t)
+		}
+	})
+}
+
+func (l *eventLoop) enqueueLocked(t *timer) {
+	if t.queued {
+		return
+	}
+	t.queued = true
+	l.queue = append(l.queue, t)
+
+	if !l.running {
+		l.running = true
+		l.holdLocked()
+		go l.run()
+	}
+}
+
+// run calls queued timers in order until the queue is empty.
+func (l *eventLoop) run() {
+	for {
+		l.mutex.Lock()
+		if len(l.queue) == 0 || l.closed {
+			l.running = false
+			l.releaseLocked()
+			l.mutex.Unlock()
+			return
+		}
+		t := l.queue[0]
+		l.queue = l.queue[1:]
+		t.queued = false
+		_, active := l.timers[t.id]
+		l.mutex.Unlock()
+
+		if active {
+			l.call(t)
+		}
+	}
+}
+
+func (l *eventLoop) call(t *timer) {
+	if t.context.pointer == nil {
+		l.clear(t.id)
+		return
+	}
+
+	ctx := withIsolateContext(context.Background(), l.isolate)
+	For(ctx).SetContext(t.context)
+
+	if !t.repeat {
+		l.clear(t.id)
+	}
+
+	_, err := t.callback.Call(ctx, nil)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err != nil && l.err == nil {
+		l.err = err
+	}
+
+	if _, ok := l.timers[t.id]; ok && t.repeat {
+		l.startLocked(t)
+	}
+}
+
+// fail records an error thrown by a callback the loop didn't call itself,
+// such as a worker's message listener, to be returned by Wait.
+func (l *eventLoop) fail(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+func (l *eventLoop) clear(id int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if t, ok := l.timers[id]; ok {
+		delete(l.timers, id)
+		if t.t != nil {
+			t.t.Stop()
+		}
+		if t.ref {
+			l.releaseLocked()
+		}
+	}
+}
+
+func (l *eventLoop) setRef(id int, ref bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if t, ok := l.timers[id]; ok && t.ref != ref {
+		t.ref = ref
+		if ref {
+			l.holdLocked()
+		} else {
+			l.releaseLocked()
+		}
+	}
+}
+
+func (l *eventLoop) refresh(id int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if t, ok := l.timers[id]; ok && t.t != nil && !t.queued {
+		t.t.Stop()
+		l.startLocked(t)
+	}
+}
+
+func (l *eventLoop) wait(ctx context.Context) error {
+	for {
+		l.mutex.Lock()
+		if l.pending == 0 || l.closed {
+			err := l.err
+			l.err = nil
+			l.mutex.Unlock()
+			return err
+		}
+		drained := l.drained
+		l.mutex.Unlock()
+
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *eventLoop) close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return
+	}
+
+	for _, t := range l.timers {
+		if t.t != nil {
+			t.t.Stop()
+		}
+	}
+	l.timers = map[int]*timer{}
+	l.queue = nil
+	l.closed = true
+
+	if l.pending > 0 {
+		l.pending = 0
+		close(l.drained)
+	}
+}
+
+// installEventLoop defines setTimeout, setInterval, setImmediate, their clear
+// functions and queueMicrotask on the global object of the context.
+func (c *Context) installEventLoop(ctx context.Context) error {
+	loop := c.isolate.loop
+
+	schedule := func(in FunctionArgs) (*Value, error) {
+		if delay, err := in.Arg(in.ExecutionContext, 1).Float64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if repeat, err := in.Arg(in.ExecutionContext, 2).Bool(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if immediate, err := in.Arg(in.ExecutionContext, 3).Bool(in.ExecutionContext); err != nil {
+			return nil, err
+		} else {
+			id := loop.schedule(c, in.Arg(in.ExecutionContext, 0), time.Duration(delay*float64(time.Millisecond)), repeat, immediate)
+			return c.Create(in.ExecutionContext, id)
+		}
+	}
+
+	clear := func(in FunctionArgs) (*Value, error) {
+		if id, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else {
+			loop.clear(int(id))
+			return nil, nil
+		}
+	}
+
+	setRef := func(in FunctionArgs) (*Value, error) {
+		if id, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if ref, err := in.Arg(in.ExecutionContext, 1).Bool(in.ExecutionContext); err != nil {
+			return nil, err
+		} else {
+			loop.setRef(int(id), ref)
+			return nil, nil
+		}
+	}
+
+	refresh := func(in FunctionArgs) (*Value, error) {
+		if id, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else {
+			loop.refresh(int(id))
+			return nil, nil
+		}
+	}
+
+	enqueueMicrotask := func(in FunctionArgs) (*Value, error) {
+		return nil, c.isolate.EnqueueMicrotaskWithValue(in.ExecutionContext, in.Arg(in.ExecutionContext, 0))
+	}
+
+	if global, err := c.Global(ctx); err != nil {
+		return err
+	} else if bootstrap, err := c.Run(ctx, eventLoopBootstrap, "isolates:event_loop.js", nil); err != nil {
+		return err
+	} else if timers, err := bootstrap.Call(ctx, nil, schedule, clear, setRef, refresh, enqueueMicrotask); err != nil {
+		return err
+	} else if _, err := c.assign.Call(ctx, nil, global, timers); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// KeepAlive registers Go work that Wait should wait for. Call the returned
+// function once the work has completed.
+func (i *Isolate) KeepAlive() func() {
+	i.loop.hold()
+
+	var once sync.Once
+	return func() {
+		once.Do(i.loop.release)
+	}
+}
+
+// Wait returns once the event loop has drained: no ref'd timers or
+// immediates remain and all Go async operations have completed. It returns
+// the first error thrown by a timer callback since the last call to Wait.
+func (i *Isolate) Wait(ctx context.Context) error {
+	return i.loop.wait(ctx)
+}
@@ -0,0 +1,357 @@
+package isolates
+
+import (
+	"context"
+	"errors"
+	"io"
+	_fs "io/fs"
+	_path "path"
+	"sort"
+	"strings"
+)
+
+// moduleFS is the file system modules are resolved and read from. It is
+// either a Go fs.FS, which is read without calling into JavaScript, or a
+// JavaScript object with the statSync, readFileSync and realpathSync methods
+// of Node's fs module.
+type moduleFS struct {
+	fs    _fs.FS
+	value *Value
+}
+
+func (c *Context) newModuleFS(ctx context.Context, fs any) (*moduleFS, error) {
+	switch fs := fs.(type) {
+	case *moduleFS:
+		return fs, nil
+	case _fs.FS:
+		return &moduleFS{fs: fs}, nil
+	default:
+		if value, err := c.Create(ctx, fs); err != nil {
+			return nil, err
+		} else {
+			return &moduleFS{value: value}, nil
+		}
+	}
+}
+
+// source returns the fs.FS or JavaScript object the file system was created
+// from, which modules expose as Module.FS.
+func (m *moduleFS) source() any {
+	if m.fs != nil {
+		return m.fs
+	}
+	return m.value
+}
+
+// fsName returns the fs.FS name of a module path. Module paths are absolute,
+// with "/" being the root of the file system.
+func fsName(path string) string {
+	if name := strings.TrimPrefix(_path.Clean(path), "/"); name == "" {
+		return "."
+	} else {
+		return name
+	}
+}
+
+func (m *moduleFS) stat(ctx context.Context, path string) (isFile bool, isDirectory bool, err error) {
+	if m.fs != nil {
+		if info, err := _fs.Stat(m.fs, fsName(path)); err != nil {
+			return false, false, err
+		} else {
+			return info.Mode().IsRegular(), info.IsDir(), nil
+		}
+	} else if stats, err := m.value.CallMethod(ctx, "statSync", path); err != nil {
+		return false, false, err
+	} else if isFile, err := stats.CallMethod(ctx, "isFile"); err != nil {
+		return false, false, err
+	} else if isDirectory, err := stats.CallMethod(ctx, "isDirectory"); err != nil {
+		return false, false, err
+	} else if isFile, err := isFile.Bool(ctx); err != nil {
+		return false, false, err
+	} else if isDirectory, err := isDirectory.Bool(ctx); err != nil {
+		return false, false, err
+	} else {
+		return isFile, isDirectory, nil
+	}
+}
+
+func (m *moduleFS) isFile(ctx context.Context, path string) bool {
+	isFile, _, err := m.stat(ctx, path)
+	return err == nil && isFile
+}
+
+func (m *moduleFS) readFile(ctx context.Context, path string) ([]byte, error) {
+	if m.fs != nil {
+		return _fs.ReadFile(m.fs, fsName(path))
+	} else if buffer, err := m.value.CallMethod(ctx, "readFileSync", path); err != nil {
+		return nil, err
+	} else if data, err := buffer.CallMethod(ctx, "toString", "utf8"); err != nil {
+		return nil, err
+	} else {
+		return []byte(data.String()), nil
+	}
+}
+
+// realpath returns the path modules at path are cached under. Paths in an
+// fs.FS have no symbolic links to resolve, so they are only cleaned.
+func (m *moduleFS) realpath(ctx context.Context, path string) (string, error) {
+	if m.fs != nil {
+		return _path.Clean(path), nil
+	} else if realpath, err := m.value.CallMethod(ctx, "realpathSync", path); err != nil {
+		return "", err
+	} else {
+		return realpath.StringValue(ctx)
+	}
+}
+
+// binding returns the file system as module.fs, wrapping an fs.FS in an
+// object with the subset of Node's fs module that require.extensions
+// handlers use.
+func (m *moduleFS) binding(ctx context.Context, c *Context, module *Module) (*Value, error) {
+	if m.fs == nil {
+		return m.value, nil
+	}
+	return c.Create(ctx, &fsBinding{m, module})
+}
+
+type fsBinding struct {
+	fs     *moduleFS
+	module *Module
+}
+
+type fsStats struct {
+	info _fs.FileInfo
+}
+
+// fsBuffer is the contents of a file read without an encoding when no
+// BufferFactory is registered.
+type fsBuffer struct {
+	data []byte
+}
+
+func (b *fsBinding) V8FuncStatSync(in FunctionArgs) (*Value, error) {
+	if path, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if info, err := _fs.Stat(b.fs.fs, fsName(path)); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, &fsStats{info})
+	}
+}
+
+func (b *fsBinding) V8FuncExistsSync(in FunctionArgs) (*Value, error) {
+	if path, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else {
+		_, err := _fs.Stat(b.fs.fs, fsName(path))
+		return in.Context.Create(in.ExecutionContext, err == nil)
+	}
+}
+
+func (b *fsBinding) V8FuncReadFileSync(in FunctionArgs) (*Value, error) {
+	if path, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if data, err := b.fs.readFile(in.ExecutionContext, path); err != nil {
+		return nil, err
+	} else if encoding := in.Arg(in.ExecutionContext, 1); encoding.IsKind(KindString) {
+		return in.Context.Create(in.ExecutionContext, string(data))
+	} else {
+		return b.newBuffer(in.ExecutionContext, in.Context, data)
+	}
+}
+
+// BufferFactory returns the contents of a file read by module.fs.readFileSync
+// without an encoding as a Buffer. require is the require function of the
+// module reading the file.
+type BufferFactory func(ctx context.Context, require *Value, data []byte) (*Value, error)
+
+var bufferFactory BufferFactory
+
+// RegisterBufferFactory sets the factory module.fs.readFileSync creates
+// Buffers with, as the node package does for its buffer runtime. Without one,
+// files read without an encoding are objects with toString, buffer and length.
+func RegisterBufferFactory(factory BufferFactory) {
+	bufferFactory = factory
+}
+
+func (b *fsBinding) newBuffer(ctx context.Context, c *Context, data []byte) (*Value, error) {
+	if bufferFactory != nil && b.module.Require != nil {
+		return bufferFactory(ctx, b.module.Require, data)
+	}
+
+	return c.Create(ctx, &fsBuffer{data})
+}
+
+func (b *fsBinding) V8FuncRealpathSync(in FunctionArgs) (*Value, error) {
+	if path, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if _, err := _fs.Stat(b.fs.fs, fsName(path)); err != nil {
+		return nil, err
+	} else if realpath, err := b.fs.realpath(in.ExecutionContext, path); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, realpath)
+	}
+}
+
+func (s *fsStats) V8FuncIsFile(in FunctionArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, s.info.Mode().IsRegular())
+}
+
+func (s *fsStats) V8FuncIsDirectory(in FunctionArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, s.info.IsDir())
+}
+
+func (s *fsStats) V8GetSize(in GetterArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, s.info.Size())
+}
+
+func (s *fsStats) V8GetMtime(in GetterArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, s.info.ModTime())
+}
+
+func (b *fsBuffer) V8FuncToString(in FunctionArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, string(b.data))
+}
+
+func (b *fsBuffer) V8GetBuffer(in GetterArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, b.data)
+}
+
+func (b *fsBuffer) V8GetLength(in GetterArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, len(b.data))
+}
+
+// NewOverlayFS returns a read-only file system of layers, where a file in one
+// layer hides the same name in the layers after it and directories list the
+// entries of every layer. Nothing can write to it: for a file system that
+// WebAssembly modules write to in memory over a read-only base, see
+// wasi.Overlay. It can be passed to RunWithRuntime to serve files generated in
+// memory alongside sources on disk:
+//
+//	fs := isolates.NewOverlayFS(fstest.MapFS{
+//		"app/config.json": {Data: config},
+//	}, os.DirFS("/"))
+func NewOverlayFS(layers ..._fs.FS) _fs.FS {
+	return overlayFS(layers)
+}
+
+type overlayFS []_fs.FS
+
+func (o overlayFS) Open(name string) (_fs.File, error) {
+	if !_fs.ValidPath(name) {
+		return nil, &_fs.PathError{Op: "open", Path: name, Err: _fs.ErrInvalid}
+	}
+
+	for _, layer := range o {
+		if f, err := layer.Open(name); errors.Is(err, _fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if info, err := f.Stat(); err != nil {
+			f.Close()
+			return nil, err
+		} else if !info.IsDir() {
+			return f, nil
+		} else if err := f.Close(); err != nil {
+			return nil, err
+		} else if entries, err := o.ReadDir(name); err != nil {
+			return nil, err
+		} else {
+			return &overlayDir{info: info, entries: entries}, nil
+		}
+	}
+
+	return nil, &_fs.PathError{Op: "open", Path: name, Err: _fs.ErrNotExist}
+}
+
+func (o overlayFS) Stat(name string) (_fs.FileInfo, error) {
+	if !_fs.ValidPath(name) {
+		return nil, &_fs.PathError{Op: "stat", Path: name, Err: _fs.ErrInvalid}
+	}
+
+	for _, layer := range o {
+		if info, err := _fs.Stat(layer, name); !errors.Is(err, _fs.ErrNotExist) {
+			return info, err
+		}
+	}
+
+	return nil, &_fs.PathError{Op: "stat", Path: name, Err: _fs.ErrNotExist}
+}
+
+func (o overlayFS) ReadFile(name string) ([]byte, error) {
+	if !_fs.ValidPath(name) {
+		return nil, &_fs.PathError{Op: "read", Path: name, Err: _fs.ErrInvalid}
+	}
+
+	for _, layer := range o {
+		if data, err := _fs.ReadFile(layer, name); !errors.Is(err, _fs.ErrNotExist) {
+			return data, err
+		}
+	}
+
+	return nil, &_fs.PathError{Op: "read", Path: name, Err: _fs.ErrNotExist}
+}
+
+func (o overlayFS) ReadDir(name string) ([]_fs.DirEntry, error) {
+	if info, err := o.Stat(name); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, &_fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	entries := map[string]_fs.DirEntry{}
+
+	// layers where name is missing or isn't a directory are skipped
+	for _, layer := range o {
+		if layerEntries, err := _fs.ReadDir(layer, name); err == nil {
+			for _, entry := range layerEntries {
+				if _, ok := entries[entry.Name()]; !ok {
+					entries[entry.Name()] = entry
+				}
+			}
+		}
+	}
+
+	result := make([]_fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+
+	return result, nil
+}
+
+type overlayDir struct {
+	info    _fs.FileInfo
+	entries []_fs.DirEntry
+}
+
+func (d *overlayDir) Stat() (_fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *overlayDir) Read([]byte) (int, error) {
+	return 0, &_fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *overlayDir) Close() error {
+	return nil
+}
+
+func (d *overlayDir) ReadDir(n int) ([]_fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	} else if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -39,6 +39,9 @@ type ObjectTemplate struct {
 	pointer C.ObjectTemplatePtr
 
 	accessors map[string]*accessorInfo
+
+	namedPropertyHandler   *PropertyHandler
+	indexedPropertyHandler *PropertyHandler
 }
 
 type Function func(FunctionArgs) (*Value, error)
@@ -122,6 +125,35 @@ type SetterArgs struct {
 	Value            *Value
 }
 
+type PropertyArgs struct {
+	ExecutionContext context.Context
+	Context          *Context
+	Caller           CallerInfo
+	This             *Value
+	Holder           *Value
+	Key              string
+	Indexed          bool
+	Index            uint32
+	Value            *Value
+}
+
+// PropertyHandler intercepts access to the properties of objects created from
+// an ObjectTemplate. A Getter returning a nil *Value, or a Setter, Query or
+// Deleter returning false, leaves the access to the object's own properties.
+// Enumerator returns the keys of the object, or its indexes for an indexed
+// handler.
+type PropertyHandler struct {
+	Getter     func(PropertyArgs) (*Value, error)
+	Setter     func(PropertyArgs) (bool, error)
+	Query      func(PropertyArgs) (bool, error)
+	Deleter    func(PropertyArgs) (bool, error)
+	Enumerator func(PropertyArgs) ([]string, error)
+
+	// NonMasking only calls the handler for properties that aren't found on
+	// the object or its prototype chain.
+	NonMasking bool
+}
+
 type functionInfo struct {
 	refutils.RefHolder
 
@@ -140,19 +172,19 @@ type accessorInfo struct {
 	Setter
 }
 
-func (c *Context) NewFunctionTemplate(ctx context.Context, cb Function) (*FunctionTemplate, error) {
-	ft, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
-		iid := c.isolate.ref()
-		defer c.isolate.unref()
+type propertyHandlerInfo struct {
+	refutils.RefHolder
 
-		cid := c.ref()
-		defer c.unref()
+	PropertyHandler
+}
 
+func (c *Context) NewFunctionTemplate(ctx context.Context, cb Function) (*FunctionTemplate, error) {
+	ft, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		info := &functionInfo{
 			Function: cb,
 		}
 		id := c.functions.Ref(info)
-		pid := C.CString(fmt.Sprintf("%d:%d:%d", iid, cid, id))
+		pid := C.CString(c.callbackID(id))
 		defer C.free(unsafe.Pointer(pid))
 
 		pf := C.v8_FunctionTemplate_New(c.pointer, pid)
@@ -165,7 +197,8 @@ func (c *Context) NewFunctionTemplate(ctx context.Context, cb Function) (*Functi
 
 		f.context.functions.Ref(f)
 
-		runtime.SetFinalizer(f, (*FunctionTemplate).release)
+		runtime.SetFinalizer(f, (*FunctionTemplate).finalize)
+		c.trackSnapshotHandle(f)
 
 		return f, nil
 	})
@@ -246,7 +279,8 @@ func (f *FunctionTemplate) GetInstanceTemplate(ctx context.Context) (*ObjectTemp
 			context: f.context,
 			pointer: po,
 		}
-		runtime.SetFinalizer(ot, (*ObjectTemplate).release)
+		runtime.SetFinalizer(ot, (*ObjectTemplate).finalize)
+		f.context.trackSnapshotHandle(ot)
 
 		f.instance = ot
 		return ot, nil
@@ -275,7 +309,8 @@ func (f *FunctionTemplate) GetPrototypeTemplate(ctx context.Context) (*ObjectTem
 			context: f.context,
 			pointer: pp,
 		}
-		runtime.SetFinalizer(ot, (*ObjectTemplate).release)
+		runtime.SetFinalizer(ot, (*ObjectTemplate).finalize)
+		f.context.trackSnapshotHandle(ot)
 
 		f.prototype = ot
 
@@ -289,6 +324,10 @@ func (f *FunctionTemplate) GetPrototypeTemplate(ctx context.Context) (*ObjectTem
 	}
 }
 
+func (f *FunctionTemplate) finalize() {
+	f.context.isolate.finalize(f.release)
+}
+
 func (f *FunctionTemplate) release() {
 	ctx := f.context.isolate.GetExecutionContext()
 
@@ -327,12 +366,6 @@ func (o *ObjectTemplate) SetAccessor(ctx context.Context, name string, getter Ge
 			o.accessors = map[string]*accessorInfo{}
 		}
 
-		iid := o.context.isolate.ref()
-		defer o.context.isolate.unref()
-
-		cid := o.context.ref()
-		defer o.context.unref()
-
 		accessor := &accessorInfo{
 			Getter: getter,
 			Setter: setter,
@@ -342,7 +375,7 @@ func (o *ObjectTemplate) SetAccessor(ctx context.Context, name string, getter Ge
 
 		id := o.context.accessors.Ref(accessor)
 
-		pid := C.CString(fmt.Sprintf("%d:%d:%d", iid, cid, id))
+		pid := C.CString(o.context.callbackID(id))
 		defer C.free(unsafe.Pointer(pid))
 
 		pname := C.CString(name)
@@ -355,6 +388,42 @@ func (o *ObjectTemplate) SetAccessor(ctx context.Context, name string, getter Ge
 	return err
 }
 
+// SetNamedPropertyHandler intercepts access to the string keyed properties of
+// objects created from the template.
+func (o *ObjectTemplate) SetNamedPropertyHandler(ctx context.Context, handler PropertyHandler) error {
+	return o.setPropertyHandler(ctx, handler, false)
+}
+
+// SetIndexedPropertyHandler intercepts access to the integer indexed
+// properties of objects created from the template.
+func (o *ObjectTemplate) SetIndexedPropertyHandler(ctx context.Context, handler PropertyHandler) error {
+	return o.setPropertyHandler(ctx, handler, true)
+}
+
+func (o *ObjectTemplate) setPropertyHandler(ctx context.Context, handler PropertyHandler, indexed bool) error {
+	_, err := o.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		info := &propertyHandlerInfo{PropertyHandler: handler}
+		id := o.context.accessors.Ref(info)
+
+		pid := C.CString(o.context.callbackID(id))
+		defer C.free(unsafe.Pointer(pid))
+
+		setter, query, deleter, enumerator := C.bool(handler.Setter != nil), C.bool(handler.Query != nil), C.bool(handler.Deleter != nil), C.bool(handler.Enumerator != nil)
+
+		if indexed {
+			o.indexedPropertyHandler = &handler
+			C.v8_ObjectTemplate_SetIndexedPropertyHandler(o.context.pointer, o.pointer, pid, setter, query, deleter, enumerator, C.bool(handler.NonMasking))
+		} else {
+			o.namedPropertyHandler = &handler
+			C.v8_ObjectTemplate_SetNamedPropertyHandler(o.context.pointer, o.pointer, pid, setter, query, deleter, enumerator, C.bool(handler.NonMasking))
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
 func (o *ObjectTemplate) Copy(ctx context.Context, other *ObjectTemplate) error {
 	_, err := o.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		if o.accessors != nil {
@@ -365,12 +434,28 @@ func (o *ObjectTemplate) Copy(ctx context.Context, other *ObjectTemplate) error
 			}
 		}
 
+		if o.namedPropertyHandler != nil {
+			if err := other.SetNamedPropertyHandler(ctx, *o.namedPropertyHandler); err != nil {
+				return nil, err
+			}
+		}
+
+		if o.indexedPropertyHandler != nil {
+			if err := other.SetIndexedPropertyHandler(ctx, *o.indexedPropertyHandler); err != nil {
+				return nil, err
+			}
+		}
+
 		return nil, nil
 	})
 
 	return err
 }
 
+func (o *ObjectTemplate) finalize() {
+	o.context.isolate.finalize(o.release)
+}
+
 func (o *ObjectTemplate) release() {
 	ctx := o.context.isolate.GetExecutionContext()
 
@@ -0,0 +1,186 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// SamplingHeapProfile is the allocation profile recorded by
+// Isolate.StartSamplingHeapProfiler, a tree of JavaScript call stacks with the
+// sampled allocations made by each.
+type SamplingHeapProfile struct {
+	// Interval is the average number of bytes allocated between samples.
+	Interval uint64
+
+	Root *SamplingHeapProfileNode
+}
+
+type SamplingHeapProfileNode struct {
+	ID           int
+	FunctionName string
+	URL          string
+	ScriptID     int
+	LineNumber   int
+	ColumnNumber int
+
+	// SelfSize and SelfCount are the bytes and number of sampled allocations
+	// made by the function itself, excluding its children.
+	SelfSize  uint64
+	SelfCount uint64
+
+	Children []*SamplingHeapProfileNode
+}
+
+var ErrSamplingHeapProfilerAlreadyStarted = errors.New("isolates: sampling heap profiler already started")
+var ErrSamplingHeapProfilerNotStarted = errors.New("isolates: sampling heap profiler not started")
+
+// WriteHeapSnapshot takes a snapshot of the isolate's heap and writes it to w
+// in the JSON format of Chrome DevTools .heapsnapshot files.
+func (i *Isolate) WriteHeapSnapshot(ctx context.Context, w io.Writer) error {
+	_, err := i.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		i.heapSnapshotWriter = w
+		i.heapSnapshotErr = nil
+		defer func() {
+			i.heapSnapshotWriter = nil
+			i.heapSnapshotErr = nil
+		}()
+
+		if err := i.newError(C.v8_Isolate_WriteHeapSnapshot(i.pointer)); err != nil {
+			return nil, err
+		}
+
+		return nil, i.heapSnapshotErr
+	})
+
+	return err
+}
+
+//export heapSnapshotWriteChunk
+func heapSnapshotWriteChunk(pIsolate C.Pointer, data *C.char, size C.int) C.bool {
+	i := (*Isolate)(pIsolate)
+
+	if i.heapSnapshotWriter == nil || i.heapSnapshotErr != nil {
+		return false
+	}
+
+	chunk := (*[1 << (maxArraySize - 13)]byte)(unsafe.Pointer(data))[:size:size]
+	if _, err := i.heapSnapshotWriter.Write(chunk); err != nil {
+		i.heapSnapshotErr = err
+		return false
+	}
+
+	return true
+}
+
+// StartSamplingHeapProfiler starts sampling allocations on the heap, taking a
+// sample on average every interval bytes and recording up to depth frames of
+// the JavaScript stack that made it. Zero values use the V8 defaults of 512KiB
+// and 16 frames.
+func (i *Isolate) StartSamplingHeapProfiler(ctx context.Context, interval uint64, depth int) error {
+	if interval == 0 {
+		interval = 512 * 1024
+	}
+	if depth == 0 {
+		depth = 16
+	}
+
+	_, err := i.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if !C.v8_Isolate_StartSamplingHeapProfiler(i.pointer, C.uint64_t(interval), C.int(depth)) {
+			return nil, ErrSamplingHeapProfilerAlreadyStarted
+		}
+
+		i.samplingHeapProfilerInterval = interval
+		return nil, nil
+	})
+
+	return err
+}
+
+// StopSamplingHeapProfiler stops sampling allocations and returns the profile
+// recorded since StartSamplingHeapProfiler.
+func (i *Isolate) StopSamplingHeapProfiler(ctx context.Context) (*SamplingHeapProfile, error) {
+	p, err := i.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		hp := C.v8_Isolate_StopSamplingHeapProfiler(i.pointer)
+		if hp.nodeCount == 0 {
+			return nil, ErrSamplingHeapProfilerNotStarted
+		}
+		defer C.free(unsafe.Pointer(hp.nodes))
+
+		profile := &SamplingHeapProfile{Interval: i.samplingHeapProfilerInterval}
+
+		nodes := map[int]*SamplingHeapProfileNode{}
+		for _, n := range (*[1 << (maxArraySize - 20)]C.HeapProfileNode)(unsafe.Pointer(hp.nodes))[:hp.nodeCount:hp.nodeCount] {
+			node := &SamplingHeapProfileNode{
+				ID:           int(n.id),
+				FunctionName: goStringFree(n.functionName),
+				URL:          goStringFree(n.url),
+				ScriptID:     int(n.scriptId),
+				LineNumber:   int(n.lineNumber),
+				ColumnNumber: int(n.columnNumber),
+				SelfSize:     uint64(n.selfSize),
+				SelfCount:    uint64(n.selfCount),
+			}
+			nodes[node.ID] = node
+
+			if parent, ok := nodes[int(n.parentId)]; ok {
+				parent.Children = append(parent.Children, node)
+			} else {
+				profile.Root = node
+			}
+		}
+
+		return profile, nil
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return p.(*SamplingHeapProfile), nil
+	}
+}
+
+func (p *SamplingHeapProfile) walk(fn func(node *SamplingHeapProfileNode, stack []*SamplingHeapProfileNode)) {
+	var walk func(node *SamplingHeapProfileNode, stack []*SamplingHeapProfileNode)
+	walk = func(node *SamplingHeapProfileNode, stack []*SamplingHeapProfileNode) {
+		stack = append(stack, node)
+		fn(node, stack)
+		for _, child := range node.Children {
+			walk(child, stack)
+		}
+	}
+
+	if p.Root != nil {
+		walk(p.Root, nil)
+	}
+}
+
+// WritePprof writes the profile in the gzipped protobuf format read by go
+// tool pprof, with the alloc_objects and alloc_space sample types of Go heap
+// profiles.
+func (p *SamplingHeapProfile) WritePprof(w io.Writer) error {
+	pp := newPprofProfile(pprofValueType{"alloc_objects", "count"}, pprofValueType{"alloc_space", "bytes"})
+	pp.periodType = &pprofValueType{"space", "bytes"}
+	pp.period = int64(p.Interval)
+
+	p.walk(func(node *SamplingHeapProfileNode, stack []*SamplingHeapProfileNode) {
+		if node.SelfCount == 0 {
+			return
+		}
+
+		// The first node of the stack is V8's synthetic (root) node.
+		locations := make([]uint64, 0, len(stack)-1)
+		for j := len(stack) - 1; j > 0; j-- {
+			locations = append(locations, pp.location(stack[j].FunctionName, stack[j].URL, int64(stack[j].LineNumber)))
+		}
+
+		pp.addSample(locations, int64(node.SelfCount), int64(node.SelfSize))
+	})
+
+	return pp.write(w)
+}
@@ -5,12 +5,15 @@ package isolates
 import "C"
 
 import (
+	"context"
 	"runtime"
+	"sync"
 	"unsafe"
 )
 
 var nextInspectorID = 0
 var inspectors = map[int]*Inspector{}
+var inspectorsMutex sync.Mutex
 
 type InspectorCallbacks interface {
 	V8InspectorSendResponse(callId int, message string)
@@ -18,17 +21,88 @@ type InspectorCallbacks interface {
 	V8InspectorFlushProtocolNotifications()
 }
 
+// Inspector exposes the contexts of an isolate to debuggers speaking the
+// Chrome DevTools Protocol. Each context added with AddContext is a separate
+// target that sessions connect to. See the inspector package for a server
+// that chrome://inspect can attach to.
 type Inspector struct {
 	ptr       C.InspectorPtr
 	id        int
+	isolate   *Isolate
 	callbacks InspectorCallbacks
+
+	mutex         sync.Mutex
+	contexts      []*InspectorContext
+	nextGroupID   int
+	sessions      map[int]*InspectorSession
+	nextSessionID int
+	waiting       map[int]chan bool
+
+	queue       []inspectorMessage
+	signal      chan bool
+	pumping     bool
+	dispatching bool
+	paused      bool
+	quit        bool
+}
+
+// InspectorContext is a context added to an Inspector.
+type InspectorContext struct {
+	ID      int
+	Name    string
+	Context *Context
+}
+
+// InspectorSession is a debugger connected to an InspectorContext.
+type InspectorSession struct {
+	inspector *Inspector
+	id        int
+	context   *InspectorContext
+	callbacks InspectorCallbacks
+}
+
+type inspectorMessage struct {
+	session    *InspectorSession
+	message    string
+	connect    bool
+	disconnect bool
 }
 
+// NewInspector creates an inspector for the isolate. If callbacks is not nil
+// it receives the messages of a session connected to the first context added
+// to the inspector, driven through DispatchMessage.
 func (i *Isolate) NewInspector(callbacks InspectorCallbacks) *Inspector {
+	inspectorsMutex.Lock()
 	inspectorID := nextInspectorID
 	nextInspectorID++
-	inspector := &Inspector{C.v8_Inspector_New(i.pointer, C.int(inspectorID)), inspectorID, callbacks}
+	inspectorsMutex.Unlock()
+
+	inspector := &Inspector{
+		id:          inspectorID,
+		isolate:     i,
+		callbacks:   callbacks,
+		nextGroupID: 1,
+		sessions:    map[int]*InspectorSession{},
+		waiting:     map[int]chan bool{},
+		signal:      make(chan bool, 1),
+	}
+
+	i.Sync(i.GetExecutionContext(), func(ctx context.Context) (interface{}, error) {
+		inspector.ptr = C.v8_Inspector_New(i.pointer, C.int(inspectorID))
+
+		if callbacks != nil {
+			inspector.sessions[0] = &InspectorSession{inspector, 0, nil, callbacks}
+			inspector.nextSessionID = 1
+			C.v8_Inspector_Connect(inspector.ptr, 0, 1)
+		}
+
+		return nil, nil
+	})
+
+	inspectorsMutex.Lock()
 	inspectors[inspectorID] = inspector
+	inspectorsMutex.Unlock()
+
 	runtime.SetFinalizer(inspector, (*Inspector).release)
 	return inspector
 }
@@ -37,44 +111,370 @@ func (i *Inspector) AddContext(context *Context, name string) {
 	pname := C.CString(name)
 	defer C.free(unsafe.Pointer(pname))
 
+	i.mutex.Lock()
+	ic := &InspectorContext{ID: i.nextGroupID, Name: name, Context: context}
+	i.nextGroupID++
+	i.contexts = append(i.contexts, ic)
+	i.mutex.Unlock()
+
 	context.ref()
-	C.v8_Inspector_AddContext(i.ptr, context.pointer, pname)
+	C.v8_Inspector_AddContext(i.ptr, context.pointer, C.int(ic.ID), pname)
 }
 
 func (i *Inspector) RemoveContext(context *Context) {
+	i.mutex.Lock()
+	for j, ic := range i.contexts {
+		if ic.Context == context {
+			i.contexts = append(i.contexts[:j], i.contexts[j+1:]...)
+			break
+		}
+	}
+	i.mutex.Unlock()
+
 	C.v8_Inspector_RemoveContext(i.ptr, context.pointer)
 	context.unref()
 }
 
+// Contexts returns the contexts added to the inspector.
+func (i *Inspector) Contexts() []*InspectorContext {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return append([]*InspectorContext{}, i.contexts...)
+}
+
+// Context returns the context added to the inspector with the given ID.
+func (i *Inspector) Context(id int) (*InspectorContext, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, ic := range i.contexts {
+		if ic.ID == id {
+			return ic, true
+		}
+	}
+	return nil, false
+}
+
+// DispatchMessage dispatches a message to the session created by
+// NewInspector.
 func (i *Inspector) DispatchMessage(message string) {
-	messageCStr := C.CString(message)
-	C.v8_Inspector_DispatchMessage(i.ptr, messageCStr)
-	C.free(unsafe.Pointer(messageCStr))
+	i.mutex.Lock()
+	session, ok := i.sessions[0]
+	i.mutex.Unlock()
+
+	if ok {
+		session.DispatchMessage(message)
+	}
+}
+
+// Connect starts a session for the context. Messages are dispatched on the
+// isolate's thread, including while JavaScript is paused on a breakpoint, and
+// callbacks are called on that thread so must not block on the isolate.
+func (i *Inspector) Connect(ic *InspectorContext, callbacks InspectorCallbacks) *InspectorSession {
+	i.mutex.Lock()
+	session := &InspectorSession{i, i.nextSessionID, ic, callbacks}
+	i.nextSessionID++
+	i.sessions[session.id] = session
+	i.mutex.Unlock()
+
+	i.enqueue(inspectorMessage{session: session, connect: true})
+	return session
+}
+
+// WaitForDebugger blocks until a debugger connected to the context sends
+// Runtime.runIfWaitingForDebugger, so that breakpoints can be set before any
+// script runs.
+func (i *Inspector) WaitForDebugger(ctx context.Context, ic *InspectorContext) error {
+	i.mutex.Lock()
+	ch, ok := i.waiting[ic.ID]
+	if !ok {
+		ch = make(chan bool)
+		i.waiting[ic.ID] = ch
+	}
+	i.mutex.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *InspectorSession) ID() int {
+	return s.id
+}
+
+func (s *InspectorSession) Context() *InspectorContext {
+	return s.context
+}
+
+func (s *InspectorSession) DispatchMessage(message string) {
+	s.inspector.enqueue(inspectorMessage{session: s, message: message})
+}
+
+func (s *InspectorSession) Disconnect() {
+	s.inspector.enqueue(inspectorMessage{session: s, disconnect: true})
+}
+
+// enqueue queues a message for the isolate's thread. Messages are picked up
+// by the message loop if the isolate is paused, by an interrupt if it is
+// running JavaScript, or otherwise by the pump once it is free.
+func (i *Inspector) enqueue(m inspectorMessage) {
+	i.mutex.Lock()
+	if i.ptr == nil {
+		i.mutex.Unlock()
+		return
+	}
+
+	i.queue = append(i.queue, m)
+
+	select {
+	case i.signal <- true:
+	default:
+	}
+
+	pump := !i.pumping
+	i.pumping = true
+
+	// the interrupt is requested under the mutex, as release frees the
+	// inspector once it has cleared ptr
+	C.v8_Inspector_RequestInterrupt(i.ptr)
+	i.mutex.Unlock()
+
+	if pump {
+		go i.pump()
+	}
+}
+
+// pump dispatches queued messages on the isolate's thread until the queue is
+// empty. At most one pump runs at a time, started by enqueue.
+func (i *Inspector) pump() {
+	ctx := WithContext(context.Background())
+
+	for {
+		i.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+			i.dispatchPending()
+			return nil, nil
+		})
+
+		i.mutex.Lock()
+		if len(i.queue) == 0 || i.ptr == nil {
+			i.pumping = false
+			i.mutex.Unlock()
+			return
+		}
+		i.mutex.Unlock()
+	}
+}
+
+// dispatchPending dispatches queued messages. It must be called on the
+// isolate's thread.
+func (i *Inspector) dispatchPending() {
+	i.mutex.Lock()
+	if i.dispatching || i.ptr == nil {
+		i.mutex.Unlock()
+		return
+	}
+	i.dispatching = true
+	i.mutex.Unlock()
+
+	defer func() {
+		i.mutex.Lock()
+		i.dispatching = false
+		i.mutex.Unlock()
+	}()
+
+	for {
+		i.mutex.Lock()
+		if len(i.queue) == 0 || (i.paused && i.quit) {
+			i.mutex.Unlock()
+			return
+		}
+		m := i.queue[0]
+		i.queue = i.queue[1:]
+		i.mutex.Unlock()
+
+		i.dispatch(m)
+	}
+}
+
+func (i *Inspector) dispatch(m inspectorMessage) {
+	if m.connect {
+		group := 1
+		if m.session.context != nil {
+			group = m.session.context.ID
+		}
+		C.v8_Inspector_Connect(i.ptr, C.int(m.session.id), C.int(group))
+	} else if m.disconnect {
+		C.v8_Inspector_Disconnect(i.ptr, C.int(m.session.id))
+
+		i.mutex.Lock()
+		delete(i.sessions, m.session.id)
+		i.mutex.Unlock()
+	} else {
+		pmessage := C.CString(m.message)
+		defer C.free(unsafe.Pointer(pmessage))
+
+		C.v8_Inspector_DispatchMessage(i.ptr, C.int(m.session.id), pmessage)
+	}
+}
+
+func (i *Inspector) session(id C.int) (*InspectorSession, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	session, ok := i.sessions[int(id)]
+	return session, ok
 }
 
 func (i *Inspector) release() {
+	i.mutex.Lock()
+	ptr := i.ptr
+	i.ptr = nil
+	i.quit = true
+	if ptr != nil {
+		close(i.signal)
+	}
+	i.mutex.Unlock()
+
 	// TODO remove all contexts that have been referenced in AddContext, RemoveContext
-	if i.ptr != nil {
-		C.v8_Inspector_Release(i.ptr)
+	if ptr != nil {
+		C.v8_Inspector_Release(ptr)
 	}
-	i.ptr = nil
 
+	inspectorsMutex.Lock()
 	delete(inspectors, i.id)
+	inspectorsMutex.Unlock()
 }
 
-//export inspectorSendResponse
-func inspectorSendResponse(inspectorID C.int, callID C.int, message C.String) {
+func getInspector(inspectorID C.int) (*Inspector, bool) {
+	inspectorsMutex.Lock()
+	defer inspectorsMutex.Unlock()
+
+	inspector, ok := inspectors[int(inspectorID)]
+	return inspector, ok
+}
+
+func inspectorString(message C.String) string {
 	m := C.GoStringN(message.data, message.length)
-	go inspectors[int(inspectorID)].callbacks.V8InspectorSendResponse(int(callID), m)
+	C.free(unsafe.Pointer(message.data))
+	return m
+}
+
+//export inspectorSendResponse
+func inspectorSendResponse(inspectorID C.int, sessionID C.int, callID C.int, message C.String) {
+	m := inspectorString(message)
+	if inspector, ok := getInspector(inspectorID); !ok {
+		return
+	} else if session, ok := inspector.session(sessionID); !ok {
+		return
+	} else if session.id == 0 {
+		go session.callbacks.V8InspectorSendResponse(int(callID), m)
+	} else {
+		session.callbacks.V8InspectorSendResponse(int(callID), m)
+	}
 }
 
 //export inspectorSendNotification
-func inspectorSendNotification(inspectorID C.int, message C.String) {
-	m := C.GoStringN(message.data, message.length)
-	go inspectors[int(inspectorID)].callbacks.V8InspectorSendNotification(m)
+func inspectorSendNotification(inspectorID C.int, sessionID C.int, message C.String) {
+	m := inspectorString(message)
+	if inspector, ok := getInspector(inspectorID); !ok {
+		return
+	} else if session, ok := inspector.session(sessionID); !ok {
+		return
+	} else if session.id == 0 {
+		go session.callbacks.V8InspectorSendNotification(m)
+	} else {
+		session.callbacks.V8InspectorSendNotification(m)
+	}
 }
 
 //export inspectorFlushProtocolNotifications
-func inspectorFlushProtocolNotifications(inspectorID C.int) {
-	go inspectors[int(inspectorID)].callbacks.V8InspectorFlushProtocolNotifications()
+func inspectorFlushProtocolNotifications(inspectorID C.int, sessionID C.int) {
+	if inspector, ok := getInspector(inspectorID); !ok {
+		return
+	} else if session, ok := inspector.session(sessionID); !ok {
+		return
+	} else if session.id == 0 {
+		go session.callbacks.V8InspectorFlushProtocolNotifications()
+	} else {
+		session.callbacks.V8InspectorFlushProtocolNotifications()
+	}
 }
+
+// inspectorRunMessageLoopOnPause pumps inspector messages on the isolate's
+// thread while JavaScript is paused, until a message resumes it.
+//
+//export inspectorRunMessageLoopOnPause
+func inspectorRunMessageLoopOnPause(inspectorID C.int, contextGroupID C.int) {
+	inspector, ok := getInspector(inspectorID)
+	if !ok {
+		return
+	}
+
+	inspector.mutex.Lock()
+	dispatching := inspector.dispatching
+	inspector.dispatching = false
+	inspector.paused = true
+	inspector.quit = false
+	inspector.mutex.Unlock()
+
+	defer func() {
+		inspector.mutex.Lock()
+		inspector.dispatching = dispatching
+		inspector.paused = false
+		inspector.quit = false
+		inspector.mutex.Unlock()
+	}()
+
+	for {
+		inspector.dispatchPending()
+
+		inspector.mutex.Lock()
+		quit := inspector.quit
+		inspector.mutex.Unlock()
+
+		if quit {
+			return
+		} else if _, ok := <-inspector.signal; !ok {
+			return
+		}
+	}
+}
+
+//export inspectorQuitMessageLoopOnPause
+func inspectorQuitMessageLoopOnPause(inspectorID C.int) {
+	if inspector, ok := getInspector(inspectorID); ok {
+		inspector.mutex.Lock()
+		inspector.quit = true
+		inspector.mutex.Unlock()
+	}
+}
+
+//export inspectorRunIfWaitingForDebugger
+func inspectorRunIfWaitingForDebugger(inspectorID C.int, contextGroupID C.int) {
+	if inspector, ok := getInspector(inspectorID); ok {
+		inspector.mutex.Lock()
+		defer inspector.mutex.Unlock()
+
+		if ch, ok := inspector.waiting[int(contextGroupID)]; ok && ch != closedChannel {
+			close(ch)
+		}
+		inspector.waiting[int(contextGroupID)] = closedChannel
+	}
+}
+
+//export inspectorDispatchPendingMessages
+func inspectorDispatchPendingMessages(inspectorID C.int) {
+	if inspector, ok := getInspector(inspectorID); ok {
+		inspector.dispatchPending()
+	}
+}
+
+var closedChannel = func() chan bool {
+	ch := make(chan bool)
+	close(ch)
+	return ch
+}()
@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"runtime"
 	"runtime/debug"
@@ -151,10 +152,66 @@ type Isolate struct {
 	executionContext context.Context
 	callbacks        chan callbackInfo
 	close            chan bool
+
+	finalizersMutex sync.Mutex
+	finalizers      []func()
+
+	options           IsolateOptions
+	heapLimitMutex    sync.Mutex
+	heapLimitRaised   bool
+	heapLimitExceeded bool
+
+	// heapLimitTerminating is set while the execution the heap limit
+	// terminated unwinds
+	heapLimitTerminating bool
+
+	terminationMutex sync.Mutex
+	executing        bool
+	terminationCause error
+
+	loop *eventLoop
+
+	cpuProfiler C.CPUProfilerPtr
+
+	heapSnapshotWriter io.Writer
+	heapSnapshotErr    error
+
+	samplingHeapProfilerInterval uint64
+}
+
+// IsolateOptions configures the resource constraints of a new isolate. Zero
+// values leave the V8 defaults in place.
+type IsolateOptions struct {
+	InitialOldSpaceSize   uint64
+	MaxOldSpaceSize       uint64
+	InitialYoungSpaceSize uint64
+	MaxYoungSpaceSize     uint64
+
+	// MaxArrayBufferSize limits the total bytes backing ArrayBuffers allocated
+	// by the isolate. Allocations beyond the limit throw a RangeError.
+	MaxArrayBufferSize uint64
+
+	// HeapLimitExtension is the number of bytes the heap limit is raised by
+	// the first time the isolate approaches it. V8 restores the initial limit
+	// once the heap has shrunk to half of it, after which the limit can be
+	// raised again.
+	HeapLimitExtension uint64
+
+	// NearHeapLimit, if set, is called the first time the isolate approaches
+	// its heap limit and returns the new heap limit. Returning a limit no
+	// greater than currentHeapLimit terminates execution.
+	NearHeapLimit func(currentHeapLimit uint64, initialHeapLimit uint64) uint64
+
+	Snapshot *Snapshot
 }
 
+// Snapshot is a serialized V8 heap that new isolates can start from. See
+// CreateSnapshot.
 type Snapshot struct {
-	data C.StartupData
+	data      C.StartupData
+	functions *refutils.RefMap
+	accessors *refutils.RefMap
+	creating  bool
 }
 
 type HeapStatistics struct {
@@ -169,29 +226,80 @@ type HeapStatistics struct {
 	DoesZapGarbage          bool
 }
 
+type HeapSpaceStatistics struct {
+	SpaceName          string
+	SpaceSize          uint64
+	SpaceUsedSize      uint64
+	SpaceAvailableSize uint64
+	PhysicalSpaceSize  uint64
+}
+
+// HeapObjectStatistics counts the objects of one type on the heap at the last
+// garbage collection.
+type HeapObjectStatistics struct {
+	ObjectType    string
+	ObjectSubType string
+	ObjectCount   uint64
+	ObjectSize    uint64
+}
+
+var ErrHeapLimitExceeded = errors.New("isolates: heap limit exceeded")
+var ErrExecutionTerminated = errors.New("isolates: execution terminated")
+
+// ExecutionTerminatedError is returned when the context.Context passed to a
+// call is cancelled while JavaScript is running. It matches
+// ErrExecutionTerminated and unwraps to the context's error.
+type ExecutionTerminatedError struct {
+	Cause error
+}
+
+func (e *ExecutionTerminatedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrExecutionTerminated, e.Cause)
+}
+
+func (e *ExecutionTerminatedError) Is(target error) bool {
+	return target == ErrExecutionTerminated
+}
+
+func (e *ExecutionTerminatedError) Unwrap() error {
+	return e.Cause
+}
+
 var isolateRefs = refutils.NewWeakRefMap("i")
 var executionContextRefs = refutils.NewWeakRefMap("ec")
 
 func NewIsolate() *Isolate {
+	return NewIsolateWithOptions(IsolateOptions{})
+}
+
+func NewIsolateWithSnapshot(snapshot *Snapshot) *Isolate {
+	return NewIsolateWithOptions(IsolateOptions{Snapshot: snapshot})
+}
+
+func NewIsolateWithOptions(options IsolateOptions) *Isolate {
 	Initialize()
 
 	callback := func() *Isolate {
-		isolate := &Isolate{
-			contexts:      refutils.NewWeakRefMap("c"),
-			modules:       refutils.NewWeakRefMap("m"),
-			running:       true,
-			data:          map[string]interface{}{},
-			shutdownHooks: []interface{}{},
-			callbacks:     make(chan callbackInfo),
-			close:         make(chan bool),
+		isolate := newIsolate(options)
+
+		startupData := C.StartupData{data: nil, length: 0}
+		if options.Snapshot != nil {
+			startupData = options.Snapshot.data
+		}
+
+		constraints := C.ResourceConstraints{
+			initialOldSpaceSize:   C.size_t(options.InitialOldSpaceSize),
+			maxOldSpaceSize:       C.size_t(options.MaxOldSpaceSize),
+			initialYoungSpaceSize: C.size_t(options.InitialYoungSpaceSize),
+			maxYoungSpaceSize:     C.size_t(options.MaxYoungSpaceSize),
+			maxArrayBufferSize:    C.size_t(options.MaxArrayBufferSize),
 		}
 
 		pIsolate := unsafe.Pointer(isolate)
 		pinner.Pin(pIsolate)
+		//nolint
 		_cgoCheckPointer := func(interface{}, interface{}) {}
-		isolate.pointer = C.v8_Isolate_New(pIsolate, C.StartupData{data: nil, length: 0})
-
-		isolate.enter()
+		isolate.pointer = C.v8_Isolate_New(pIsolate, startupData, constraints)
 
 		isolate.ref()
 		runtime.SetFinalizer(isolate, (*Isolate).release)
@@ -204,9 +312,7 @@ func NewIsolate() *Isolate {
 	return <-ch
 }
 
-func NewIsolateWithSnapshot(snapshot *Snapshot) *Isolate {
-	Initialize()
-
+func newIsolate(options IsolateOptions) *Isolate {
 	isolate := &Isolate{
 		contexts:      refutils.NewWeakRefMap("c"),
 		modules:       refutils.NewWeakRefMap("m"),
@@ -215,19 +321,9 @@ func NewIsolateWithSnapshot(snapshot *Snapshot) *Isolate {
 		shutdownHooks: []interface{}{},
 		callbacks:     make(chan callbackInfo),
 		close:         make(chan bool),
+		options:       options,
 	}
-
-	pIsolate := unsafe.Pointer(isolate)
-	pinner.Pin(pIsolate)
-	//nolint
-	_cgoCheckPointer := func(interface{}, interface{}) {}
-	isolate.pointer = C.v8_Isolate_New(pIsolate, snapshot.data)
-
-	isolate.enter()
-
-	isolate.ref()
-	runtime.SetFinalizer(isolate, (*Isolate).release)
-
+	isolate.loop = newEventLoop(isolate)
 	return isolate
 }
 
@@ -275,11 +371,20 @@ func (i *Isolate) Sync(ctx context.Context, fn func(context.Context) (interface{
 			i.executionContext = nil
 		}()
 
+		// V8 tracks the entered isolate per thread, so it must be exited on
+		// the thread that entered it
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
 		i.enter()
 		defer i.exit()
 
+		defer i.watchCancellation(ctx)()
+
 		executionContext.enter()
 		defer executionContext.exit()
+
+		defer i.runFinalizers()
 	}
 
 	executionContext.isolate = i
@@ -295,11 +400,86 @@ func (i *Isolate) Sync(ctx context.Context, fn func(context.Context) (interface{
 	return result, err
 }
 
-func (i *Isolate) Wait(ctx context.Context) error {
-	ch := make(chan bool)
+// finalize queues release, which frees a handle that has been garbage
+// collected, to run the next time the isolate is held. Finalizers run on their
+// own goroutine, and would otherwise race the goroutine holding the isolate
+// while a callback has unlocked it.
+func (i *Isolate) finalize(release func()) {
+	i.finalizersMutex.Lock()
+	defer i.finalizersMutex.Unlock()
+
+	i.finalizers = append(i.finalizers, release)
+
+	if len(i.finalizers) == 1 {
+		go i.Sync(WithContext(context.Background()), func(ctx context.Context) (interface{}, error) {
+			return nil, nil
+		})
+	}
+}
+
+// runFinalizers runs the releases queued by finalize. It is called by Sync
+// before the isolate is let go.
+func (i *Isolate) runFinalizers() {
+	for {
+		i.finalizersMutex.Lock()
+		finalizers := i.finalizers
+		i.finalizers = nil
+		i.finalizersMutex.Unlock()
+
+		if len(finalizers) == 0 {
+			return
+		}
 
-	<-ch
-	return nil
+		for _, release := range finalizers {
+			release()
+		}
+	}
+}
+
+// watchCancellation terminates the JavaScript running in the isolate when
+// ctx is cancelled. The returned function stops watching and makes the isolate
+// usable again if execution was terminated.
+func (i *Isolate) watchCancellation(ctx context.Context) func() {
+	i.terminationMutex.Lock()
+	i.executing = true
+	i.terminationCause = nil
+	i.terminationMutex.Unlock()
+
+	stop := make(chan bool)
+	done := ctx.Done()
+
+	if done != nil {
+		go func() {
+			select {
+			case <-done:
+				i.terminationMutex.Lock()
+				defer i.terminationMutex.Unlock()
+
+				if i.executing && i.pointer != nil {
+					i.terminationCause = ctx.Err()
+					C.v8_Isolate_Terminate(i.pointer)
+				}
+			case <-stop:
+			}
+		}()
+	}
+
+	return func() {
+		close(stop)
+
+		i.terminationMutex.Lock()
+		defer i.terminationMutex.Unlock()
+
+		i.heapLimitMutex.Lock()
+		heapLimitTerminating := i.heapLimitTerminating
+		i.heapLimitTerminating = false
+		i.heapLimitMutex.Unlock()
+
+		i.executing = false
+		if (i.terminationCause != nil || heapLimitTerminating) && i.pointer != nil {
+			C.v8_Isolate_CancelTerminateExecution(i.pointer)
+		}
+	}
 }
 
 func (i *Isolate) Contexts(ctx context.Context) ([]*Context, error) {
@@ -346,7 +526,9 @@ func (i *Isolate) RequestGarbageCollectionForTesting(ctx context.Context) {
 }
 
 func (i *Isolate) enter() {
-	C.v8_Isolate_Enter(i.pointer)
+	if i.pointer != nil {
+		C.v8_Isolate_Enter(i.pointer)
+	}
 	for _, callback := range i.enterCallbacks {
 		callback()
 	}
@@ -356,7 +538,9 @@ func (i *Isolate) exit() {
 	for _, callback := range i.exitCallbacks {
 		callback()
 	}
-	C.v8_Isolate_Exit(i.pointer)
+	if i.pointer != nil {
+		C.v8_Isolate_Exit(i.pointer)
+	}
 }
 
 func (i *Isolate) PerformMicrotaskCheckpointSync(ctx context.Context) error {
@@ -394,9 +578,86 @@ func (i *Isolate) EnqueueMicrotaskWithValue(ctx context.Context, fn *Value) erro
 	return err
 }
 
+// HeapLimitExceeded reports whether the last execution in the isolate was
+// terminated because it ran out of heap. It is cleared when script next runs,
+// by which time V8 has restored the initial heap limit if enough of the heap
+// was freed.
+func (i *Isolate) HeapLimitExceeded() bool {
+	i.heapLimitMutex.Lock()
+	defer i.heapLimitMutex.Unlock()
+
+	return i.heapLimitExceeded
+}
+
+func (i *Isolate) terminationError() error {
+	if i.HeapLimitExceeded() {
+		return ErrHeapLimitExceeded
+	}
+
+	i.terminationMutex.Lock()
+	defer i.terminationMutex.Unlock()
+
+	if i.terminationCause != nil {
+		return &ExecutionTerminatedError{i.terminationCause}
+	}
+
+	return ErrExecutionTerminated
+}
+
+// maxHeapLimitHeadroom caps the headroom the heap limit is raised by for a
+// script terminated by the heap limit to unwind.
+const maxHeapLimitHeadroom = 64 * 1024 * 1024
+
+//export nearHeapLimitCallback
+func nearHeapLimitCallback(pIsolate C.Pointer, currentHeapLimit C.size_t, initialHeapLimit C.size_t) C.size_t {
+	i := (*Isolate)(pIsolate)
+
+	i.heapLimitMutex.Lock()
+	defer i.heapLimitMutex.Unlock()
+
+	// V8 restores the initial limit once the heap shrinks, after which the
+	// limit may be raised again
+	if currentHeapLimit <= initialHeapLimit {
+		i.heapLimitRaised = false
+	}
+
+	if !i.heapLimitRaised {
+		i.heapLimitRaised = true
+
+		heapLimit := uint64(currentHeapLimit) + i.options.HeapLimitExtension
+		if i.options.NearHeapLimit != nil {
+			heapLimit = i.options.NearHeapLimit(uint64(currentHeapLimit), uint64(initialHeapLimit))
+		}
+
+		if heapLimit > uint64(currentHeapLimit) {
+			return C.size_t(heapLimit)
+		}
+	}
+
+	if i.heapLimitTerminating {
+		// the headroom has been granted for this termination already, and
+		// V8 aborts the process rather than let the heap grow further
+		return currentHeapLimit
+	}
+
+	// V8 aborts the process if the limit isn't raised, so leave enough
+	// headroom for the termination exception to unwind the running script
+	i.heapLimitExceeded = true
+	i.heapLimitTerminating = true
+	C.v8_Isolate_Terminate(i.pointer)
+	return currentHeapLimit + min(currentHeapLimit/4, maxHeapLimitHeadroom)
+}
+
 //export beforeCallEnteredCallback
 func beforeCallEnteredCallback(pIsolate C.Pointer) {
-	// i := (*Isolate)(pIsolate)
+	i := (*Isolate)(pIsolate)
+
+	i.heapLimitMutex.Lock()
+	defer i.heapLimitMutex.Unlock()
+
+	if !i.heapLimitTerminating {
+		i.heapLimitExceeded = false
+	}
 }
 
 //export callCompletedCallback
@@ -405,7 +666,10 @@ func callCompletedCallback(pIsolate C.Pointer) {
 }
 
 func (i *Isolate) Background(ctx context.Context, callback func(ctx context.Context)) {
+	done := i.KeepAlive()
+
 	go func() {
+		defer done()
 		defer func() {
 			if v := recover(); v != nil {
 				fmt.Printf("%+v\n", v)
@@ -432,6 +696,7 @@ func (i *Isolate) Terminate() {
 		isolateRefs.Release(i)
 		C.v8_Isolate_Terminate(i.pointer)
 		i.running = false
+		i.loop.close()
 
 		contexts := i.contexts.Refs()
 		for _, c := range contexts {
@@ -442,8 +707,15 @@ func (i *Isolate) Terminate() {
 			}
 		}
 
+		if i.cpuProfiler != nil {
+			C.v8_CPUProfiler_Release(i.cpuProfiler)
+			i.cpuProfiler = nil
+		}
+
+		i.terminationMutex.Lock()
 		C.v8_Isolate_Release(i.pointer)
 		i.pointer = nil
+		i.terminationMutex.Unlock()
 
 		for _, context := range i.contexts.Refs() {
 			context.(*Context).release()
@@ -477,6 +749,54 @@ func (i *Isolate) GetHeapStatistics(ctx context.Context) (HeapStatistics, error)
 	}, nil
 }
 
+// GetHeapSpaceStatistics returns the statistics of each space in the heap,
+// such as new_space, old_space and code_space.
+func (i *Isolate) GetHeapSpaceStatistics(ctx context.Context) ([]HeapSpaceStatistics, error) {
+	list := C.v8_Isolate_GetHeapSpaceStatistics(i.pointer)
+	if list.spaceCount == 0 {
+		return nil, nil
+	}
+	defer C.free(unsafe.Pointer(list.spaces))
+
+	spaces := (*[1 << (maxArraySize - 18)]C.HeapSpaceStatistics)(unsafe.Pointer(list.spaces))[:list.spaceCount:list.spaceCount]
+	out := make([]HeapSpaceStatistics, len(spaces))
+	for j, s := range spaces {
+		out[j] = HeapSpaceStatistics{
+			SpaceName:          goStringFree(s.spaceName),
+			SpaceSize:          uint64(s.spaceSize),
+			SpaceUsedSize:      uint64(s.spaceUsedSize),
+			SpaceAvailableSize: uint64(s.spaceAvailableSize),
+			PhysicalSpaceSize:  uint64(s.physicalSpaceSize),
+		}
+	}
+
+	return out, nil
+}
+
+// GetHeapObjectStatistics returns the number and size of the objects of each
+// type on the heap at the last garbage collection. V8 only tracks these when
+// --track-gc-object-stats is passed to SetFlags, and returns none otherwise.
+func (i *Isolate) GetHeapObjectStatistics(ctx context.Context) ([]HeapObjectStatistics, error) {
+	list := C.v8_Isolate_GetHeapObjectStatistics(i.pointer)
+	if list.objectCount == 0 {
+		return nil, nil
+	}
+	defer C.free(unsafe.Pointer(list.objects))
+
+	objects := (*[1 << (maxArraySize - 18)]C.HeapObjectStatistics)(unsafe.Pointer(list.objects))[:list.objectCount:list.objectCount]
+	out := make([]HeapObjectStatistics, len(objects))
+	for j, o := range objects {
+		out[j] = HeapObjectStatistics{
+			ObjectType:    goStringFree(o.objectType),
+			ObjectSubType: goStringFree(o.objectSubType),
+			ObjectCount:   uint64(o.objectCount),
+			ObjectSize:    uint64(o.objectSize),
+		}
+	}
+
+	return out, nil
+}
+
 func (i *Isolate) newError(err C.Error) error {
 	if err.data == nil {
 		return nil
@@ -491,22 +811,163 @@ func (i *Isolate) release() {
 	i.Terminate()
 }
 
-// func newSnapshot(data C.StartupData) *Snapshot {
-// 	s := &Snapshot{data}
-// 	runtime.SetFinalizer(s, (*Snapshot).release)
-// 	return s
-// }
+func newSnapshot(data C.StartupData) *Snapshot {
+	s := &Snapshot{data: data}
+	runtime.SetFinalizer(s, (*Snapshot).release)
+	return s
+}
+
+// CreateSnapshot runs setup against a new context and serializes the
+// resulting heap. Isolates created from the snapshot with
+// NewIsolateWithSnapshot start every new context with that state.
+//
+// Functions and accessors bound from Go during setup, such as those installed
+// by Context.Create or RegisterRuntime, are called with the restored context.
+// They are kept in memory by the snapshot, so they must not hold on to values
+// from the setup context, and an exported snapshot imported into another
+// process only restores its JavaScript state. Every Value, template and script
+// of the setup context is released before the heap is serialized, so none of
+// them can be used once setup returns.
+func CreateSnapshot(ctx context.Context, setup func(ctx context.Context, c *Context) error) (*Snapshot, error) {
+	Initialize()
+
+	var snapshot *Snapshot
+	var err error
+
+	// the snapshot creator enters its isolate on creation and exits it when
+	// released, both of which must happen on the same thread
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
 
-// func CreateSnapshot(code string) *Snapshot {
-// 	initOnce.Do(func() {
-// 		C.v8_Initialize()
-// 	})
+		snapshot, err = createSnapshot(ctx, setup)
+	}()
+	<-done
 
-// 	pcode := C.CString(code)
-// 	defer C.free(unsafe.Pointer(pcode))
+	return snapshot, err
+}
 
-// 	return newSnapshot(C.v8_CreateSnapshotDataBlob(pcode))
-// }
+func createSnapshot(ctx context.Context, setup func(ctx context.Context, c *Context) error) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		functions: refutils.NewRefMap("f"),
+		accessors: refutils.NewRefMap("a"),
+		creating:  true,
+	}
+
+	isolate := newIsolate(IsolateOptions{Snapshot: snapshot})
+
+	pIsolate := unsafe.Pointer(isolate)
+	pinner.Pin(pIsolate)
+	//nolint
+	_cgoCheckPointer := func(interface{}, interface{}) {}
+	creator := C.v8_SnapshotCreator_New(pIsolate)
+	isolate.pointer = C.v8_SnapshotCreator_GetIsolate(creator)
+	isolate.ref()
+
+	ctx = withIsolateContext(ctx, isolate)
+
+	data, err := isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		c, err := isolate.NewContext(ctx)
+		if err != nil {
+			return nil, err
+		} else if err := setup(ctx, c); err != nil {
+			return nil, err
+		}
+
+		// V8 requires every persistent handle to be reset before the blob is
+		// created, other than that of the default context
+		for _, ref := range isolate.contexts.Refs() {
+			context := ref.(*Context)
+			context.releaseSnapshotHandles()
+			if context != c && context.pointer != nil {
+				C.v8_Context_Release(context.pointer)
+				context.pointer = nil
+			}
+		}
+
+		if data := C.v8_SnapshotCreator_CreateBlob(creator, c.pointer); data.data == nil {
+			return nil, fmt.Errorf("isolates: failed to create snapshot")
+		} else {
+			return data, nil
+		}
+	})
+
+	for _, c := range isolate.contexts.Refs() {
+		context := c.(*Context)
+		context.releaseSnapshotHandles()
+		if context.pointer != nil {
+			C.v8_Context_Release(context.pointer)
+			context.pointer = nil
+		}
+		// the bound callbacks now belong to the snapshot
+		context.functions = refutils.NewRefMap("f")
+		context.accessors = refutils.NewRefMap("a")
+	}
+
+	isolate.terminationMutex.Lock()
+	C.v8_SnapshotCreator_Release(creator)
+	isolate.pointer = nil
+	isolate.running = false
+	isolate.terminationMutex.Unlock()
+
+	for _, context := range isolate.contexts.Refs() {
+		context.(*Context).release()
+	}
+	isolateRefs.Release(isolate)
+
+	snapshot.creating = false
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.data = data.(C.StartupData)
+	runtime.SetFinalizer(snapshot, (*Snapshot).release)
+	return snapshot, nil
+}
+
+// snapshotHandle is a Go object holding a V8 persistent handle.
+type snapshotHandle interface {
+	release()
+}
+
+// trackSnapshotHandle records h if c is being snapshotted, so that its handle
+// can be reset before the heap is serialized.
+func (c *Context) trackSnapshotHandle(h snapshotHandle) {
+	if c.snapshot != nil && c.snapshot.creating {
+		c.snapshotHandles = append(c.snapshotHandles, h)
+	}
+}
+
+// releaseSnapshotHandles resets every handle held by a context being
+// snapshotted.
+func (c *Context) releaseSnapshotHandles() {
+	handles := c.snapshotHandles
+	c.snapshotHandles = nil
+
+	for _, h := range handles {
+		h.release()
+	}
+
+	c.global = nil
+	c.objectCreate = nil
+	c.assign = nil
+	c.keys = nil
+	c.getOwnPropertyDescriptors = nil
+	c.getPrototypeOf = nil
+	c.undefined = nil
+	c.null = nil
+	c.vfalse = nil
+	c.vtrue = nil
+	c.errorConstructor = nil
+	c.baseConstructor = nil
+	c.constructors = map[reflect.Type]*FunctionTemplate{}
+	c.prototypes = map[reflect.Type]*FunctionTemplate{}
+	c.receivers = map[uintptr]*Value{}
+}
 
 func (s *Snapshot) release() {
 	if s.data.data != nil {
@@ -521,11 +982,14 @@ func (s *Snapshot) Export() []byte {
 	return []byte(C.GoStringN(s.data.data, s.data.length))
 }
 
-// func ImportSnapshot(data []byte) *Snapshot {
-// 	pdata := C.String{
-// 		data:   (*C.char)(C.malloc(C.size_t(len(data)))),
-// 		length: C.int(len(data)),
-// 	}
-// 	C.memcpy(unsafe.Pointer(pdata.data), unsafe.Pointer(&data[0]), C.size_t(len(data)))
-// 	return newSnapshot(pdata)
-// }
+// ImportSnapshot loads a snapshot previously returned by Snapshot.Export.
+func ImportSnapshot(data []byte) *Snapshot {
+	pdata := C.StartupData{
+		data:   (*C.char)(C.malloc(C.size_t(len(data)))),
+		length: C.int(len(data)),
+	}
+	if len(data) > 0 {
+		C.memcpy(unsafe.Pointer(pdata.data), unsafe.Pointer(&data[0]), C.size_t(len(data)))
+	}
+	return newSnapshot(pdata)
+}
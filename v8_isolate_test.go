@@ -1,32 +1,40 @@
 package isolates
 
 import (
-	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"os"
+	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
 func TestMain(m *testing.M) {
-	StartTracer(SimpleTracer)
+	SetFlags("--track-gc-object-stats")
 	Initialize()
 	os.Exit(m.Run())
 }
 
-func DumpTracerForBenchmark(b *testing.B) {
-	ctx := v.context.isolate.GetExecutionContext().ctx
-	var buf bytes.Buffer
-	w := bufio.NewWriter(&buf)
-	DumpTracer(ctx, w, false)
-	w.Flush()
-	b.Logf("\n%s", string(buf.Bytes()))
+// dumpGoroutinesForBenchmark logs every goroutine's stack, showing where a
+// locked isolate is stuck.
+func dumpGoroutinesForBenchmark(b *testing.B) {
+	buf := make([]byte, 1<<20)
+	b.Logf("\n%s", buf[:runtime.Stack(buf, true)])
 }
 
 func TestIsolateCreate(t *testing.T) {
-	ctx := v.context.isolate.GetExecutionContext().ctx
+	ctx := WithContext(context.Background())
 	i := NewIsolate()
 	if c, err := i.NewContext(ctx); err != nil {
 		t.Error(err)
@@ -42,7 +50,7 @@ func TestIsolateCreate(t *testing.T) {
 			}
 			return fib;
 		})()
-	`, "index.js"); err != nil {
+	`, "index.js", nil); err != nil {
 		t.Error(err)
 	} else if result, err := fn.Call(ctx, nil, value); err != nil {
 		t.Error(err)
@@ -55,6 +63,880 @@ func TestIsolateCreate(t *testing.T) {
 	i.Terminate()
 }
 
+func TestIsolateHeapLimitExceeded(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolateWithOptions(IsolateOptions{
+		MaxOldSpaceSize: 32 * 1024 * 1024,
+	})
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the initial limit is restored after each termination, so the isolate
+	// runs out of heap the same way twice
+	for n := 0; n < 2; n++ {
+		if _, err := c.Run(ctx, `
+			(() => {
+				const leak = [];
+				while (true) {
+					leak.push(new Array(1024).fill({}));
+				}
+			})();
+		`, "index.js", nil); !errors.Is(err, ErrHeapLimitExceeded) {
+			t.Fatalf("expected ErrHeapLimitExceeded, got %v", err)
+		} else if !i.HeapLimitExceeded() {
+			t.Fatal("expected isolate to report heap limit exceeded")
+		}
+
+		if result, err := c.Run(ctx, `1 + 1`, "index.js", nil); err != nil {
+			t.Fatalf("expected the isolate to run again, got %v", err)
+		} else if result.String() != "2" {
+			t.Fatalf("invalid result: %v", result)
+		} else if i.HeapLimitExceeded() {
+			t.Fatal("expected heap limit exceeded to be cleared by the next run")
+		}
+	}
+}
+
+func TestIsolateContextDeadline(t *testing.T) {
+	i := NewIsolate()
+	defer i.Terminate()
+
+	ctx := WithContext(context.Background())
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadlineCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Run(WithContext(deadlineCtx), `while (true) {}`, "index.js", nil); !errors.Is(err, ErrExecutionTerminated) {
+		t.Errorf("expected ErrExecutionTerminated, got %v", err)
+	} else if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if result, err := c.Run(ctx, `1 + 1`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if n, err := result.Int64(ctx); err != nil {
+		t.Error(err)
+	} else if n != 2 {
+		t.Errorf("invalid result: %v", result)
+	}
+}
+
+func TestIsolateSnapshot(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	snapshot, err := CreateSnapshot(ctx, func(ctx context.Context, c *Context) error {
+		if global, err := c.Global(ctx); err != nil {
+			return err
+		} else if err := global.Set(ctx, "double", func(in FunctionArgs) (*Value, error) {
+			if n, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+				return nil, err
+			} else {
+				return in.Context.Create(in.ExecutionContext, n*2)
+			}
+		}); err != nil {
+			return err
+		}
+
+		_, err := c.Run(ctx, `globalThis.answer = double(21);`, "snapshot.js", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIsolateWithSnapshot(snapshot)
+	defer i.Terminate()
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Error(err)
+	} else if result, err := c.Run(ctx, `answer + double(4)`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if n, err := result.Int64(ctx); err != nil {
+		t.Error(err)
+	} else if n != 50 {
+		t.Errorf("invalid result: %v", result)
+	}
+}
+
+func TestIsolateSnapshotWithHandles(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	// values, templates and scripts still referenced from Go when setup
+	// returns are released before the heap is serialized
+	var held []any
+
+	snapshot, err := CreateSnapshot(ctx, func(ctx context.Context, c *Context) error {
+		greet, err := c.CreateWithName(ctx, "greet", func(in FunctionArgs) (*Value, error) {
+			if name, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+				return nil, err
+			} else {
+				return in.Context.Create(in.ExecutionContext, "hello "+name)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if global, err := c.Global(ctx); err != nil {
+			return err
+		} else if err := global.SetValue(ctx, "greet", greet); err != nil {
+			return err
+		} else if point, err := c.Create(ctx, &testPoint{X: 1, Y: 2}); err != nil {
+			return err
+		} else if script, err := c.Compile(ctx, `globalThis.greeting = greet("snapshot");`, "snapshot.js"); err != nil {
+			return err
+		} else if result, err := script.Run(ctx); err != nil {
+			return err
+		} else {
+			held = append(held, greet, global, point, script, result)
+			return nil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIsolateWithSnapshot(snapshot)
+	defer i.Terminate()
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Error(err)
+	} else if result, err := c.Run(ctx, `greeting + ", " + greet("restored")`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "hello snapshot, hello restored" {
+		t.Errorf("invalid result: %s", s)
+	}
+
+	runtime.KeepAlive(held)
+}
+
+func TestIsolateSnapshotWithModules(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	// modules imported during setup, and the exports of CommonJS modules
+	// wrapped for importing, are released before the heap is serialized
+	snapshot, err := CreateSnapshot(ctx, func(ctx context.Context, c *Context) error {
+		if value, err := c.RunWithRuntime(ctx, esModuleInteropFS, "/app/index.cjs", func(RuntimeFunctionArgs) error { return nil }, nil); err != nil {
+			return err
+		} else if result, err := value.Await(ctx); err != nil {
+			return err
+		} else if global, err := c.Global(ctx); err != nil {
+			return err
+		} else {
+			return global.SetValue(ctx, "interop", result)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIsolateWithSnapshot(snapshot)
+	defer i.Terminate()
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Error(err)
+	} else if result, err := c.Run(ctx, `interop`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "1 true true cjs 1" {
+		t.Errorf("invalid result: %s", s)
+	}
+}
+
+func TestIsolateSnapshotWithResolver(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	// a resolver left unsettled by setup is released before the heap is
+	// serialized, leaving its promise pending in the snapshot
+	snapshot, err := CreateSnapshot(ctx, func(ctx context.Context, c *Context) error {
+		if r, err := c.NewResolver(ctx); err != nil {
+			return err
+		} else if promise, err := r.Promise(ctx); err != nil {
+			return err
+		} else if global, err := c.Global(ctx); err != nil {
+			return err
+		} else {
+			return global.SetValue(ctx, "pending", promise)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIsolateWithSnapshot(snapshot)
+	defer i.Terminate()
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Error(err)
+	} else if result, err := c.Run(ctx, `pending instanceof Promise`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if pending, err := result.Bool(ctx); err != nil {
+		t.Error(err)
+	} else if !pending {
+		t.Errorf("invalid result: %v", result)
+	}
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := i.Wait(waitCtx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsolateSnapshotSetupCreatesIsolate(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	// setup runs on its own thread, so it can create isolates while the
+	// snapshot is being created
+	snapshot, err := CreateSnapshot(ctx, func(ctx context.Context, c *Context) error {
+		i := NewIsolate()
+		defer i.Terminate()
+
+		ictx := WithContext(context.Background())
+		if ic, err := i.NewContext(ictx); err != nil {
+			return err
+		} else if result, err := ic.Run(ictx, `6 * 7`, "index.js", nil); err != nil {
+			return err
+		} else if n, err := result.Int64(ictx); err != nil {
+			return err
+		} else {
+			_, err := c.Run(ctx, fmt.Sprintf(`globalThis.answer = %d;`, n), "snapshot.js", nil)
+			return err
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIsolateWithSnapshot(snapshot)
+	defer i.Terminate()
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Error(err)
+	} else if result, err := c.Run(ctx, `answer`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if n, err := result.Int64(ctx); err != nil {
+		t.Error(err)
+	} else if n != 42 {
+		t.Errorf("invalid result: %v", result)
+	}
+}
+
+func TestContextCompileCodeCache(t *testing.T) {
+	ctx := WithContext(context.Background())
+	code := `[1, 2, 3].map(n => n * 2).reduce((a, b) => a + b)`
+
+	i1 := NewIsolate()
+	defer i1.Terminate()
+
+	var cache []byte
+	if c, err := i1.NewContext(ctx); err != nil {
+		t.Fatal(err)
+	} else if script, err := c.Compile(ctx, code, "index.js"); err != nil {
+		t.Fatal(err)
+	} else if _, err := script.Run(ctx); err != nil {
+		t.Fatal(err)
+	} else if cache, err = script.CreateCodeCache(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	i2 := NewIsolate()
+	defer i2.Terminate()
+
+	if c, err := i2.NewContext(ctx); err != nil {
+		t.Error(err)
+	} else if script, err := c.CompileWithOptions(ctx, code, "index.js", CompileOptions{CodeCache: cache}); err != nil {
+		t.Error(err)
+	} else if script.CacheRejected() {
+		t.Error("expected code cache to be accepted")
+	} else if result, err := script.Run(ctx); err != nil {
+		t.Error(err)
+	} else if n, err := result.Int64(ctx); err != nil {
+		t.Error(err)
+	} else if n != 12 {
+		t.Errorf("invalid result: %v", result)
+	}
+}
+
+func TestRunWithRuntimeCodeCacheStore(t *testing.T) {
+	ctx := WithContext(context.Background())
+	store := &MemoryCodeCacheStore{}
+	fs := fstest.MapFS{
+		"app/index.js": {Data: []byte(`module.exports = require('./lib.js').double(21);`)},
+		"app/lib.js":   {Data: []byte(`exports.double = (n) => n * 2;`)},
+	}
+
+	for run := 0; run < 2; run++ {
+		i := NewIsolate()
+
+		if c, err := i.NewContext(ctx); err != nil {
+			t.Error(err)
+		} else if value, err := c.RunWithRuntime(ctx, fs, "/app/index.js", func(RuntimeFunctionArgs) error { return nil }, nil, RuntimeOptions{CodeCacheStore: store}); err != nil {
+			t.Error(err)
+		} else if n, err := value.Int64(ctx); err != nil {
+			t.Error(err)
+		} else if n != 42 {
+			t.Errorf("invalid result: %v", value)
+		}
+
+		i.Terminate()
+	}
+
+	count := 0
+	store.caches.Range(func(key, value any) bool {
+		count++
+		return true
+	})
+	if count != 2 {
+		t.Errorf("expected 2 code caches, got %d", count)
+	}
+}
+
+func TestRunWithRuntimeCodeCacheStoreDynamicImport(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	fs := fstest.MapFS{
+		"app/index.js": {Data: []byte(`
+			module.exports = new Promise((resolve) => {
+				setTimeout(() => resolve(import('./lib.mjs').then((lib) => lib.answer)), 1);
+			});
+		`)},
+		"app/lib.mjs": {Data: []byte(`export const answer = 42;`)},
+	}
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Error(err)
+	} else if value, err := c.RunWithRuntime(ctx, fs, "/app/index.js", func(RuntimeFunctionArgs) error { return nil }, nil, RuntimeOptions{CodeCacheStore: &MemoryCodeCacheStore{}}); err != nil {
+		t.Error(err)
+	} else if result, err := value.Await(ctx); err != nil {
+		t.Error(err)
+	} else if n, err := result.Int64(ctx); err != nil {
+		t.Error(err)
+	} else if n != 42 {
+		t.Errorf("invalid result: %v", result)
+	}
+}
+
+func TestContextJSError(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Run(ctx, `
+		function fail() {
+			throw new TypeError("bad input");
+		}
+		fail();
+	`, "error.js", nil)
+
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) {
+		t.Fatalf("expected *JSError, got %v", err)
+	} else if jsErr.Name != "TypeError" || jsErr.Message != "bad input" {
+		t.Errorf("unexpected error: %s: %s", jsErr.Name, jsErr.Message)
+	} else if len(jsErr.StackTrace) == 0 {
+		t.Error("expected stack frames")
+	} else if frame := jsErr.StackTrace[0]; frame.Function != "fail" || frame.Script != "error.js" || frame.Line != 3 {
+		t.Errorf("unexpected stack frame: %v", frame)
+	} else if jsErr.Exception == nil {
+		t.Error("expected exception value")
+	}
+}
+
+func TestIsolateEventLoop(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Run(ctx, `
+		globalThis.events = [];
+		setTimeout(() => events.push("timeout"), 20);
+		setImmediate(() => events.push("immediate"));
+		queueMicrotask(() => events.push("microtask"));
+		let ticks = 0;
+		const interval = setInterval(() => {
+			if (++ticks === 3) {
+				clearInterval(interval);
+				events.push("interval");
+			}
+		}, 1);
+		setTimeout(() => events.push("unref"), 60000).unref();
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// microtasks run before immediates, and immediates before any timer, but
+	// the interval and the timeout race each other, so only the events they
+	// push are checked, along with the interval not firing once cleared
+	if err := i.Wait(waitCtx); err != nil {
+		t.Fatal(err)
+	} else if result, err := c.Run(ctx, `[
+		events.slice(0, 2).join(","),
+		events.slice(2).sort().join(","),
+		ticks,
+	].join(" ")`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "microtask,immediate interval,timeout 3" {
+		t.Errorf("unexpected events: %s", s)
+	}
+}
+
+func TestContextAsyncFunction(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	double := AsyncFunction(func(in FunctionArgs) func(context.Context) (any, error) {
+		n, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext)
+		return func(ctx context.Context) (any, error) {
+			if err != nil {
+				return nil, err
+			}
+			time.Sleep(10 * time.Millisecond)
+			return n * 2, nil
+		}
+	})
+
+	produce := func(in FunctionArgs) (<-chan string, error) {
+		ch := make(chan string, 1)
+		go func() {
+			ch <- "done"
+		}()
+		return ch, nil
+	}
+
+	if global, err := c.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "double", double); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "produce", produce); err != nil {
+		t.Fatal(err)
+	} else if promise, err := c.Run(ctx, `
+		(async () => (await double(21)) + ":" + (await produce()))()
+	`, "index.js", nil); err != nil {
+		t.Error(err)
+	} else if result, err := promise.Await(ctx); err != nil {
+		t.Error(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "42:done" {
+		t.Errorf("invalid result: %s", s)
+	}
+}
+
+func TestIsolateCPUProfile(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.StartCPUProfile(ctx, "fib", 100*time.Microsecond); err != nil {
+		t.Fatal(err)
+	} else if err := i.StartCPUProfile(ctx, "fib", 0); err != ErrCPUProfileAlreadyStarted {
+		t.Errorf("expected ErrCPUProfileAlreadyStarted, got %v", err)
+	}
+
+	if _, err := c.Run(ctx, `
+		const fib = (n) => n < 2 ? n : fib(n - 1) + fib(n - 2);
+		fib(27);
+	`, "fib.js", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var cpuprofile, pprof bytes.Buffer
+	if profile, err := i.StopCPUProfile(ctx, "fib"); err != nil {
+		t.Fatal(err)
+	} else if profile.Root == nil {
+		t.Error("expected a root node")
+	} else if profile.Title != "fib" {
+		t.Errorf("invalid title: %s", profile.Title)
+	} else if err := profile.WriteCPUProfile(&cpuprofile); err != nil {
+		t.Fatal(err)
+	} else if err := profile.WritePprof(&pprof); err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		Nodes []struct {
+			CallFrame struct {
+				FunctionName string `json:"functionName"`
+			} `json:"callFrame"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(cpuprofile.Bytes(), &out); err != nil {
+		t.Error(err)
+	} else {
+		found := false
+		for _, node := range out.Nodes {
+			found = found || node.CallFrame.FunctionName == "fib"
+		}
+		if !found {
+			t.Error("expected a fib frame in the .cpuprofile")
+		}
+	}
+
+	if names, err := pprofSampledFunctions(pprof.Bytes()); err != nil {
+		t.Error(err)
+	} else if !names["fib"] {
+		t.Errorf("expected a fib frame in the pprof samples, got %v", names)
+	}
+
+	if _, err := i.StopCPUProfile(ctx, "fib"); err == nil {
+		t.Error("expected an error stopping a stopped profile")
+	}
+}
+
+// protoField is a field of protobuf wire format, with varints kept in n and
+// length-delimited values in b.
+type protoField struct {
+	number int
+	n      uint64
+	b      []byte
+}
+
+// protoFields splits protobuf wire format into its fields.
+func protoFields(data []byte) ([]protoField, error) {
+	var fields []protoField
+
+	for len(data) > 0 {
+		key, k := binary.Uvarint(data)
+		if k <= 0 {
+			return nil, errors.New("invalid key")
+		}
+		data = data[k:]
+
+		field := protoField{number: int(key >> 3)}
+
+		switch key & 7 {
+		case 0:
+			v, k := binary.Uvarint(data)
+			if k <= 0 {
+				return nil, errors.New("invalid varint")
+			}
+			field.n, data = v, data[k:]
+		case 2:
+			length, k := binary.Uvarint(data)
+			if k <= 0 || uint64(len(data)-k) < length {
+				return nil, errors.New("invalid length")
+			}
+			field.b, data = data[k:k+int(length)], data[k+int(length):]
+		default:
+			return nil, fmt.Errorf("unexpected wire type %d", key&7)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// pprofSampledFunctions returns the names of the functions in the stacks of
+// the samples of a gzipped pprof profile.
+func pprofSampledFunctions(data []byte) (map[string]bool, error) {
+	var strings []string
+	functions := map[uint64]uint64{}
+	locations := map[uint64]uint64{}
+	var samples [][]byte
+
+	if r, err := gzip.NewReader(bytes.NewReader(data)); err != nil {
+		return nil, err
+	} else if data, err := io.ReadAll(r); err != nil {
+		return nil, err
+	} else if fields, err := protoFields(data); err != nil {
+		return nil, err
+	} else {
+		for _, field := range fields {
+			switch field.number {
+			case 2:
+				if sample, err := protoFields(field.b); err != nil {
+					return nil, err
+				} else {
+					for _, f := range sample {
+						if f.number == 1 {
+							samples = append(samples, f.b)
+						}
+					}
+				}
+			case 4:
+				var id, function uint64
+				if location, err := protoFields(field.b); err != nil {
+					return nil, err
+				} else {
+					for _, f := range location {
+						if f.number == 1 {
+							id = f.n
+						} else if line, err := protoFields(f.b); f.number == 4 && err == nil {
+							for _, l := range line {
+								if l.number == 1 {
+									function = l.n
+								}
+							}
+						}
+					}
+				}
+				locations[id] = function
+			case 5:
+				var id, name uint64
+				if function, err := protoFields(field.b); err != nil {
+					return nil, err
+				} else {
+					for _, f := range function {
+						if f.number == 1 {
+							id = f.n
+						} else if f.number == 2 {
+							name = f.n
+						}
+					}
+				}
+				functions[id] = name
+			case 6:
+				strings = append(strings, string(field.b))
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	for _, packed := range samples {
+		for len(packed) > 0 {
+			id, k := binary.Uvarint(packed)
+			if k <= 0 {
+				return nil, errors.New("invalid location id")
+			}
+			packed = packed[k:]
+
+			if name := functions[locations[id]]; name < uint64(len(strings)) {
+				names[strings[name]] = true
+			}
+		}
+	}
+	return names, nil
+}
+
+func TestIsolateHeapSnapshot(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Run(ctx, `
+		class Retained {}
+		globalThis.retained = Array.from({ length: 100 }, () => new Retained());
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshot bytes.Buffer
+	if err := i.WriteHeapSnapshot(ctx, &snapshot); err != nil {
+		t.Fatal(err)
+	} else if !json.Valid(snapshot.Bytes()) {
+		t.Error("invalid heap snapshot")
+	} else if !bytes.Contains(snapshot.Bytes(), []byte(`"Retained"`)) {
+		t.Error("expected heap snapshot to contain Retained")
+	}
+
+	i.SendLowMemoryNotification(ctx)
+
+	if spaces, err := i.GetHeapSpaceStatistics(ctx); err != nil {
+		t.Error(err)
+	} else if len(spaces) == 0 {
+		t.Error("expected heap space statistics")
+	}
+
+	if objects, err := i.GetHeapObjectStatistics(ctx); err != nil {
+		t.Error(err)
+	} else if len(objects) == 0 {
+		t.Error("expected heap object statistics")
+	}
+}
+
+func TestIsolateSamplingHeapProfiler(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.StartSamplingHeapProfiler(ctx, 1024, 0); err != nil {
+		t.Fatal(err)
+	} else if err := i.StartSamplingHeapProfiler(ctx, 1024, 0); err != ErrSamplingHeapProfilerAlreadyStarted {
+		t.Errorf("expected ErrSamplingHeapProfilerAlreadyStarted, got %v", err)
+	}
+
+	if _, err := c.Run(ctx, `
+		function allocate() {
+			return Array.from({ length: 10000 }, (_, i) => ({ i }));
+		}
+		globalThis.retained = allocate();
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var pprof bytes.Buffer
+	if profile, err := i.StopSamplingHeapProfiler(ctx); err != nil {
+		t.Fatal(err)
+	} else if profile.Root == nil {
+		t.Error("expected a root node")
+	} else if err := profile.WritePprof(&pprof); err != nil {
+		t.Error(err)
+	} else if pprof.Len() == 0 {
+		t.Error("expected profile output")
+	}
+
+	if _, err := i.StopSamplingHeapProfiler(ctx); err != ErrSamplingHeapProfilerNotStarted {
+		t.Errorf("expected ErrSamplingHeapProfilerNotStarted, got %v", err)
+	}
+}
+
+func TestIsolatePool(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	pool, err := NewIsolatePool(ctx, IsolatePoolOptions{
+		MinSize: 1,
+		MaxSize: 2,
+		MaxUses: 2,
+		Setup: func(ctx context.Context, c *Context) error {
+			_, err := c.Run(ctx, `globalThis.answer = 42`, "setup.js", nil)
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	for j := 0; j < 2; j++ {
+		if pi, err := pool.Get(ctx); err != nil {
+			t.Fatal(err)
+		} else if result, err := pi.Context.Run(ctx, `answer`, "index.js", nil); err != nil {
+			t.Error(err)
+		} else if n, err := result.Int64(ctx); err != nil {
+			t.Error(err)
+		} else if n != 42 {
+			t.Errorf("invalid result: %d", n)
+		} else {
+			pi.Release()
+		}
+	}
+
+	if metrics := pool.Metrics(); metrics.Recycled != 1 {
+		t.Errorf("expected 1 recycled isolate, got %d", metrics.Recycled)
+	} else if metrics.Checkouts != 2 {
+		t.Errorf("expected 2 checkouts, got %d", metrics.Checkouts)
+	}
+
+	a, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Release()
+
+	b, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Release()
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := pool.Get(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	} else if metrics := pool.Metrics(); metrics.Timeouts != 1 || metrics.InUse != 2 {
+		t.Errorf("invalid metrics: %+v", metrics)
+	}
+}
+
+func TestContextOptions(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContextWithOptions(ctx, ContextOptions{
+		DisallowCodeGenerationFromStrings: true,
+		AllowCodeGenerationFromStrings: func(source string) bool {
+			return source == "2 + 2"
+		},
+		DisallowWasmCodeGeneration: true,
+		FreezeIntrinsics:           true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := c.Run(ctx, `
+		const results = [];
+		const attempt = (fn) => {
+			try {
+				return String(fn());
+			} catch (err) {
+				return err.name;
+			}
+		};
+
+		results.push(attempt(() => eval("1 + 1")));
+		results.push(attempt(() => eval("2 + 2")));
+		results.push(attempt(() => new Function("return 1")()));
+		results.push(attempt(() => new WebAssembly.Module(new Uint8Array([0, 97, 115, 109, 1, 0, 0, 0]))));
+		results.push(attempt(() => {
+			"use strict";
+			Object.prototype.polluted = true;
+		}));
+		results.push(String(Object.isFrozen(Array.prototype)));
+		results.join(",");
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "EvalError,4,EvalError,CompileError,TypeError,true" {
+		t.Errorf("invalid result: %s", s)
+	}
+}
+
 func BenchmarkIsolateCreate(b *testing.B) {
 	runtime.GC()
 	finished := make(chan bool)
@@ -70,7 +952,7 @@ func BenchmarkIsolateCreate(b *testing.B) {
 			go func() {
 				time.Sleep(1 * time.Second)
 				if !done {
-					DumpTracerForBenchmark(b)
+					dumpGoroutinesForBenchmark(b)
 					b.Error("isolate is locked")
 				}
 			}()
@@ -89,7 +971,7 @@ func BenchmarkIsolateCreate(b *testing.B) {
 					}
 					return fib;
 				})()
-			`, "index.js"); err != nil {
+			`, "index.js", nil); err != nil {
 				b.Error(err)
 			} else if result, err := fn.Call(ctx, nil, value); err != nil {
 				b.Error(err)
@@ -109,7 +991,7 @@ func BenchmarkIsolateCreate(b *testing.B) {
 	for {
 		select {
 		case <-time.After(20 * time.Second):
-			DumpTracerForBenchmark(b)
+			dumpGoroutinesForBenchmark(b)
 			b.Error("v8 locked")
 		case <-finished:
 			i++
@@ -132,3 +1014,842 @@ FINISHED:
 	}
 
 }
+
+type testRow struct {
+	columns []string
+	values  map[string]any
+}
+
+func (r *testRow) V8Len() int {
+	return len(r.columns)
+}
+
+func (r *testRow) V8GetIndex(i int) (any, error) {
+	return r.values[r.columns[i]], nil
+}
+
+func (r *testRow) V8Keys() []string {
+	return r.columns
+}
+
+func (r *testRow) V8GetKey(key string) (any, error) {
+	return r.values[key], nil
+}
+
+func (r *testRow) V8SetKey(key string, value string) error {
+	if _, ok := r.values[key]; !ok {
+		r.columns = append(r.columns, key)
+	}
+	r.values[key] = value
+	return nil
+}
+
+func TestContextPropertyHandlers(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := &testRow{
+		columns: []string{"id", "name"},
+		values:  map[string]any{"id": 1, "name": "alice"},
+	}
+
+	if global, err := c.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "row", row); err != nil {
+		t.Fatal(err)
+	} else if result, err := c.Run(ctx, `
+		row.email = "alice@example.com";
+		[row.id, row[1], Object.keys(row).join("|"), "name" in row, "missing" in row, row.missing].join(",");
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "1,alice,0|1|2|id|name|email,true,false," {
+		t.Errorf("invalid result: %s", s)
+	} else if row.values["email"] != "alice@example.com" {
+		t.Errorf("expected email to be set on the Go row, got %v", row.values["email"])
+	}
+}
+
+func TestContextMapSetBigInt(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+
+	if global, err := c.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "scores", map[int]string{2: "b", 1: "a"}); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "tags", map[string]struct{}{"x": {}, "y": {}}); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "huge", huge); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "max", uint64(math.MaxUint64)); err != nil {
+		t.Fatal(err)
+	} else if tag, err := c.SymbolFor(ctx, "app.tag"); err != nil {
+		t.Fatal(err)
+	} else if err := global.SetValue(ctx, "tag", tag); err != nil {
+		t.Fatal(err)
+	} else if iterator, err := c.WellKnownSymbol(ctx, SymbolIterator); err != nil {
+		t.Fatal(err)
+	} else if err := global.SetValue(ctx, "iterator", iterator); err != nil {
+		t.Fatal(err)
+	} else if result, err := c.Run(ctx, `
+		[
+			scores instanceof Map, [...scores.keys()].join("|"), scores.get(2),
+			tags instanceof Set, tags.has("x"),
+			typeof huge, huge * 2n,
+			max,
+			tag === Symbol.for("app.tag"), iterator === Symbol.iterator,
+		].join(",");
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "true,1|2,b,true,true,bigint,-246913578024691357802469135780,18446744073709551615,true,true" {
+		t.Errorf("invalid result: %s", s)
+	}
+
+	if v, err := c.Run(ctx, `new Map([[1n, "one"], [2n, "two"]])`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if m, err := v.Unmarshal(ctx, reflect.TypeOf(map[int64]string{})); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(m.Interface(), map[int64]string{1: "one", 2: "two"}) {
+		t.Errorf("invalid map: %v", m.Interface())
+	}
+
+	if v, err := c.Run(ctx, `new Set(["a", "b"])`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if s, err := v.Unmarshal(ctx, reflect.TypeOf(map[string]struct{}{})); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(s.Interface(), map[string]struct{}{"a": {}, "b": {}}) {
+		t.Errorf("invalid set: %v", s.Interface())
+	}
+
+	if v, err := c.Run(ctx, `2n ** 64n - 1n`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if u, err := v.Unmarshal(ctx, reflect.TypeOf(uint64(0))); err != nil {
+		t.Fatal(err)
+	} else if u.Uint() != math.MaxUint64 {
+		t.Errorf("invalid uint64: %d", u.Uint())
+	} else if _, err := v.Unmarshal(ctx, reflect.TypeOf(int64(0))); err == nil {
+		t.Error("expected int64 overflow error")
+	} else if b, err := v.BigInt(ctx); err != nil {
+		t.Fatal(err)
+	} else if b.Cmp(new(big.Int).SetUint64(math.MaxUint64)) != 0 {
+		t.Errorf("invalid bigint: %s", b)
+	}
+}
+
+func TestContextTypedArrays(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pixels := make([]byte, 4)
+
+	if global, err := c.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "samples", []float32{0.5, 1.5}); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "counts", []int64{1, 2}); err != nil {
+		t.Fatal(err)
+	} else if buffer, err := c.NewExternalArrayBuffer(ctx, pixels); err != nil {
+		t.Fatal(err)
+	} else if err := global.SetValue(ctx, "pixels", buffer); err != nil {
+		t.Fatal(err)
+	} else if result, err := c.Run(ctx, `
+		new Uint8Array(pixels).set([1, 2, 3, 4]);
+		[samples instanceof Float32Array, samples[1], counts instanceof BigInt64Array, counts[1]].join(",");
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "true,1.5,true,2" {
+		t.Errorf("invalid result: %s", s)
+	} else if !bytes.Equal(pixels, []byte{1, 2, 3, 4}) {
+		t.Errorf("expected writes to the external buffer to be visible in Go, got %v", pixels)
+	}
+
+	if v, err := c.Run(ctx, `new Float64Array([0.25, 0.5, 0.75])`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if f, err := v.Unmarshal(ctx, reflect.TypeOf([]float64{})); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(f.Interface(), []float64{0.25, 0.5, 0.75}) {
+		t.Errorf("invalid float64 slice: %v", f.Interface())
+	}
+}
+
+func TestSharedArrayBuffer(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	shared := NewSharedArrayBuffer(8)
+	defer shared.Release()
+
+	contexts := make([]*Context, 2)
+	for j := range contexts {
+		i := NewIsolate()
+		defer i.Terminate()
+
+		if c, err := i.NewContext(ctx); err != nil {
+			t.Fatal(err)
+		} else if global, err := c.Global(ctx); err != nil {
+			t.Fatal(err)
+		} else if err := global.Set(ctx, "shared", shared); err != nil {
+			t.Fatal(err)
+		} else {
+			contexts[j] = c
+		}
+	}
+
+	waited := make(chan string, 1)
+	go func() {
+		if result, err := contexts[0].Run(ctx, `Atomics.wait(new Int32Array(shared), 0, 0, 5000)`, "wait.js", nil); err != nil {
+			waited <- err.Error()
+		} else if s, err := result.StringValue(ctx); err != nil {
+			waited <- err.Error()
+		} else {
+			waited <- s
+		}
+	}()
+
+	if _, err := contexts[1].Run(ctx, `
+		const view = new Int32Array(shared);
+		Atomics.store(view, 0, 42);
+		Atomics.notify(view, 0);
+	`, "notify.js", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := <-waited; s != "ok" && s != "not-equal" {
+		t.Errorf("invalid wait result: %s", s)
+	} else if b := shared.Bytes(); b[0] != 42 {
+		t.Errorf("expected the store to be visible in Go, got %v", b)
+	}
+}
+
+type testPoint struct {
+	X int `v8:"x"`
+	Y int `v8:"y"`
+}
+
+func TestValueSerialize(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	i1 := NewIsolate()
+	defer i1.Terminate()
+	i2 := NewIsolate()
+	defer i2.Terminate()
+
+	c1, err := i1.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := i2.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	point := &testPoint{X: 1, Y: 2}
+
+	if global, err := c1.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else if err := global.Set(ctx, "point", point); err != nil {
+		t.Fatal(err)
+	} else if v, err := c1.Run(ctx, `
+		const value = { date: new Date(0), map: new Map([[1, "one"]]), bytes: new Uint8Array([1, 2]), missing: undefined, point };
+		value.self = value;
+		value;
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if data, err := v.Serialize(ctx); err != nil {
+		t.Fatal(err)
+	} else if clone, err := c2.Deserialize(ctx, data); err != nil {
+		t.Fatal(err)
+	} else if global, err := c2.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else if err := global.SetValue(ctx, "clone", clone); err != nil {
+		t.Fatal(err)
+	} else if result, err := c2.Run(ctx, `
+		[
+			clone.date.getTime(), clone.map.get(1), clone.bytes[1], "missing" in clone, clone.self === clone,
+			clone.point.x, structuredClone(new Set([1])).has(1),
+		].join(",");
+	`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if s, err := result.StringValue(ctx); err != nil {
+		t.Error(err)
+	} else if s != "0,one,2,true,true,1,true" {
+		t.Errorf("invalid result: %s", s)
+	}
+
+	if _, err := c1.Run(ctx, `structuredClone(() => {})`, "index.js", nil); err == nil {
+		t.Error("expected functions not to be cloneable")
+	}
+}
+
+// testPointDelegate transfers a testPoint as the sum of its coordinates.
+type testPointDelegate struct{}
+
+func (testPointDelegate) WriteHostObject(ctx context.Context, object *Value) (any, error) {
+	if receiver := object.Receiver(ctx); !receiver.IsValid() {
+		return nil, errors.New("not a point")
+	} else if point, ok := receiver.Interface().(*testPoint); !ok {
+		return nil, errors.New("not a point")
+	} else {
+		return point.X + point.Y, nil
+	}
+}
+
+func (testPointDelegate) ReadHostObject(ctx context.Context, c *Context, value any) (*Value, error) {
+	return c.Create(ctx, map[string]any{"sum": value})
+}
+
+func TestValueSerializeHostObjectDelegate(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetHostObjectDelegate(testPointDelegate{})
+
+	var data []byte
+	if point, err := c.Create(ctx, &testPoint{X: 1, Y: 2}); err != nil {
+		t.Fatal(err)
+	} else if data, err = point.Serialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// data can be deserialized until it is released
+	for j := 0; j < 2; j++ {
+		if clone, err := c.Deserialize(ctx, data); err != nil {
+			t.Fatal(err)
+		} else if sum, err := clone.Get(ctx, "sum"); err != nil {
+			t.Fatal(err)
+		} else if n, err := sum.Int64(ctx); err != nil {
+			t.Error(err)
+		} else if n != 3 {
+			t.Errorf("invalid sum: %d", n)
+		}
+	}
+
+	ReleaseSerialized(data)
+	if _, err := c.Deserialize(ctx, data); err == nil {
+		t.Error("expected released data not to deserialize")
+	}
+}
+
+func TestWorkerThreads(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := fstest.MapFS{
+		"app/index.js": {Data: []byte(`
+			const { Worker, isMainThread } = require('worker_threads');
+			const worker = new Worker('./worker.js', { workerData: { prefix: 'echo' } });
+			worker.on('message', (message) => {
+				result.messages.push(message);
+				if (message.done) {
+					worker.terminate().then((code) => { result.code = code; });
+				}
+			});
+			worker.postMessage({ text: 'hello', date: new Date(0) });
+			worker.postMessage({ text: 'world', done: true });
+			result.isMainThread = isMainThread;
+
+			try {
+				new Worker('./worker.js');
+			} catch (err) {
+				result.limited = true;
+			}
+		`)},
+		"app/worker.js": {Data: []byte(`
+			const { parentPort, workerData, isMainThread } = require('worker_threads');
+			parentPort.on('message', (message) => {
+				parentPort.postMessage({
+					text: workerData.prefix + ' ' + message.text,
+					time: message.date ? message.date.getTime() : null,
+					isMainThread,
+					done: message.done,
+				});
+			});
+		`)},
+	}
+
+	if global, err := c.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Run(ctx, `var result = { messages: [] }`, "setup.js", nil); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.RunWithRuntime(ctx, fs, "/app/index.js", func(RuntimeFunctionArgs) error { return nil }, nil, RuntimeOptions{MaxWorkers: 1}); err != nil {
+		t.Fatal(err)
+	} else if err := i.Wait(ctx); err != nil {
+		t.Fatal(err)
+	} else if result, err := global.Get(ctx, "result"); err != nil {
+		t.Fatal(err)
+	} else if json, err := result.MarshalJSON(ctx); err != nil {
+		t.Fatal(err)
+	} else if string(json) != `{"messages":[{"text":"echo hello","time":0,"isMainThread":false},{"text":"echo world","time":null,"isMainThread":false,"done":true}],"isMainThread":true,"limited":true,"code":1}` {
+		t.Errorf("invalid result: %s", json)
+	}
+}
+
+func TestWorkerThreadsUndeliveredMessages(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// WebAssembly modules are serialized by reference, which must be released
+	// for messages the worker never receives, both those queued when it is
+	// terminated and those posted once it has exited
+	fs := fstest.MapFS{
+		"app/index.js": {Data: []byte(`
+			const { Worker } = require('worker_threads');
+			const wasm = new WebAssembly.Module(new Uint8Array([0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00]));
+			const worker = new Worker('./worker.js');
+			worker.postMessage(wasm);
+			worker.on('exit', () => setTimeout(() => worker.postMessage(wasm), 1));
+			setTimeout(() => worker.terminate(), 10);
+		`)},
+		"app/worker.js": {Data: []byte(`while (true) {}`)},
+	}
+
+	serializations.Lock()
+	held := len(serializations.entries)
+	serializations.Unlock()
+
+	if _, err := c.RunWithRuntime(ctx, fs, "/app/index.js", func(RuntimeFunctionArgs) error { return nil }, nil, RuntimeOptions{MaxWorkers: 1}); err != nil {
+		t.Fatal(err)
+	} else if err := i.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	serializations.Lock()
+	defer serializations.Unlock()
+
+	if n := len(serializations.entries); n != held {
+		t.Errorf("expected %d serializations to be held, got %d", held, n)
+	}
+}
+
+func TestWorkerThreadsDisabled(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := fstest.MapFS{
+		"app/index.js": {Data: []byte(`require('worker_threads');`)},
+	}
+
+	if _, err := c.RunWithRuntime(ctx, fs, "/app/index.js", func(RuntimeFunctionArgs) error { return nil }, nil); err == nil {
+		t.Error("expected worker_threads to require RuntimeOptions.MaxWorkers")
+	}
+}
+
+func TestRunWithRuntimeFS(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := fstest.MapFS{
+		"app/index.js": {Data: []byte(`
+			const { greet } = require('greet');
+			const config = require('./config.json');
+			module.exports = greet(config.name) + module.fs.readFileSync('/app/suffix.txt', 'utf8');
+		`)},
+		"app/config.json":                     {Data: []byte(`{ "name": "disk" }`)},
+		"app/suffix.txt":                      {Data: []byte("!")},
+		"app/node_modules/greet/package.json": {Data: []byte(`{ "exports": { ".": { "require": "./lib/index.js" } } }`)},
+		"app/node_modules/greet/lib/index.js": {Data: []byte(`exports.greet = (name) => 'hello ' + name;`)},
+	}
+	generated := fstest.MapFS{
+		"app/config.json": {Data: []byte(`{ "name": "overlay" }`)},
+	}
+	fs := NewOverlayFS(generated, sources)
+
+	if err := fstest.TestFS(fs, "app/index.js", "app/config.json", "app/node_modules/greet/lib/index.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := c.RunWithRuntime(ctx, fs, "/app/index.js", func(RuntimeFunctionArgs) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	} else if value.String() != "hello overlay!" {
+		t.Errorf("invalid result: %s", value.String())
+	}
+}
+
+// testFS is the subset of Node's fs module used by RunWithRuntime, serving
+// files from memory and counting the calls made to it.
+type testFS struct {
+	files map[string]string
+	calls map[string]int
+}
+
+type testStats struct {
+	file bool
+}
+
+func (s *testStats) V8FuncIsFile(in FunctionArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, s.file)
+}
+
+func (s *testStats) V8FuncIsDirectory(in FunctionArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, !s.file)
+}
+
+type testBuffer struct {
+	data string
+}
+
+func (b *testBuffer) V8FuncToString(in FunctionArgs) (*Value, error) {
+	return in.Context.Create(in.ExecutionContext, b.data)
+}
+
+func (fs *testFS) V8FuncStatSync(in FunctionArgs) (*Value, error) {
+	fs.calls["statSync"]++
+	path := in.Arg(in.ExecutionContext, 0).String()
+	if _, ok := fs.files[path]; ok {
+		return in.Context.Create(in.ExecutionContext, &testStats{file: true})
+	}
+	for name := range fs.files {
+		if strings.HasPrefix(name, path+"/") {
+			return in.Context.Create(in.ExecutionContext, &testStats{file: false})
+		}
+	}
+	return nil, fmt.Errorf("ENOENT: no such file or directory, stat '%s'", path)
+}
+
+func (fs *testFS) V8FuncReadFileSync(in FunctionArgs) (*Value, error) {
+	fs.calls["readFileSync"]++
+	path := in.Arg(in.ExecutionContext, 0).String()
+	if data, ok := fs.files[path]; !ok {
+		return nil, fmt.Errorf("ENOENT: no such file or directory, open '%s'", path)
+	} else {
+		return in.Context.Create(in.ExecutionContext, &testBuffer{data})
+	}
+}
+
+func (fs *testFS) V8FuncRealpathSync(in FunctionArgs) (*Value, error) {
+	fs.calls["realpathSync"]++
+	return in.Arg(in.ExecutionContext, 0), nil
+}
+
+func TestRunWithRuntimeJSFS(t *testing.T) {
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &testFS{
+		files: map[string]string{
+			"/app/index.js": `
+				const { greet } = require('./lib');
+				module.exports = greet(require('./config.json').name);
+			`,
+			"/app/lib/index.js": `exports.greet = (name) => 'hello ' + name;`,
+			"/app/config.json":  `{ "name": "js" }`,
+		},
+		calls: map[string]int{},
+	}
+
+	if value, err := c.RunWithRuntime(ctx, fs, "/app/index.js", func(RuntimeFunctionArgs) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	} else if value.String() != "hello js" {
+		t.Errorf("invalid result: %s", value.String())
+	}
+
+	for _, method := range []string{"statSync", "readFileSync", "realpathSync"} {
+		if fs.calls[method] == 0 {
+			t.Errorf("expected %s to be called", method)
+		}
+	}
+}
+
+// runModules runs path with RunWithRuntime and returns the JSON of the value
+// its promise settles with.
+func runModules(t *testing.T, fs fstest.MapFS, path string) string {
+	t.Helper()
+
+	ctx := WithContext(context.Background())
+	i := NewIsolate()
+	defer i.Terminate()
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Fatal(err)
+	} else if value, err := c.RunWithRuntime(ctx, fs, path, func(RuntimeFunctionArgs) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	} else if result, err := value.Await(ctx); err != nil {
+		t.Fatal(err)
+	} else if json, err := result.MarshalJSON(ctx); err != nil {
+		t.Fatal(err)
+	} else {
+		return string(json)
+	}
+	return ""
+}
+
+func TestRunWithRuntimeESModule(t *testing.T) {
+	fs := fstest.MapFS{
+		"app/main.mjs": {Data: []byte(`
+			import { add, PI as pi } from './lib/math.mjs';
+			import greeting from './greeting.mjs';
+
+			const { late } = await import('./greeting.mjs');
+
+			export const sum = add(1, 2);
+			export const value = greeting + pi + late;
+		`)},
+		"app/lib/math.mjs": {Data: []byte(`
+			export const add = (a, b) => a + b;
+			export const PI = 3;
+		`)},
+		"app/greeting.mjs": {Data: []byte(`
+			export default 'hi';
+			export const late = await new Promise((resolve) => resolve('late'));
+		`)},
+	}
+
+	if json := runModules(t, fs, "/app/main.mjs"); json != `{"sum":3,"value":"hi3late"}` {
+		t.Errorf("invalid result: %s", json)
+	}
+}
+
+func TestRunWithRuntimePackageType(t *testing.T) {
+	fs := fstest.MapFS{
+		"app/package.json": {Data: []byte(`{ "type": "module" }`)},
+		"app/index.js": {Data: []byte(`
+			import { kind } from 'pkg';
+			import required from './bridge.cjs';
+
+			export const result = kind + ' ' + required;
+		`)},
+		"app/bridge.cjs":                    {Data: []byte(`module.exports = require('pkg').kind;`)},
+		"app/node_modules/pkg/package.json": {Data: []byte(`{ "exports": { ".": { "import": "./index.mjs", "require": "./index.cjs" } } }`)},
+		"app/node_modules/pkg/index.mjs":    {Data: []byte(`export const kind = 'import';`)},
+		"app/node_modules/pkg/index.cjs":    {Data: []byte(`exports.kind = 'require';`)},
+	}
+
+	if json := runModules(t, fs, "/app/index.js"); json != `{"result":"import require"}` {
+		t.Errorf("invalid result: %s", json)
+	}
+}
+
+// esModuleInteropFS imports CommonJS modules from ES modules and the other way
+// around.
+var esModuleInteropFS = fstest.MapFS{
+	"app/index.cjs": {Data: []byte(`
+		const esm = require('./esm.mjs');
+		const counter = require('./counter.cjs');
+
+		module.exports = import('./main.mjs').then((main) => [
+			esm.value,
+			main.esm === esm,
+			main.counter === counter,
+			main.named,
+			counter.count,
+		].join(' '));
+	`)},
+	"app/counter.cjs": {Data: []byte(`
+		exports.count = 0;
+		exports.named = 'cjs';
+		exports.increment = () => ++exports.count;
+	`)},
+	"app/esm.mjs": {Data: []byte(`
+		import { increment } from './counter.cjs';
+		export const value = increment();
+	`)},
+	"app/main.mjs": {Data: []byte(`
+		import * as esm from './esm.mjs';
+		import counter, { named } from './counter.cjs';
+		export { esm, counter, named };
+	`)},
+}
+
+func TestRunWithRuntimeESModuleInterop(t *testing.T) {
+	if json := runModules(t, esModuleInteropFS, "/app/index.cjs"); json != `"1 true true cjs 1"` {
+		t.Errorf("invalid result: %s", json)
+	}
+}
+
+func TestRunWithRuntimeESModuleInteropIsolates(t *testing.T) {
+	// the exports of CommonJS modules imported from ES modules are held by the
+	// isolate importing them
+	for n := 0; n < 4; n++ {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			t.Parallel()
+
+			if json := runModules(t, esModuleInteropFS, "/app/index.cjs"); json != `"1 true true cjs 1"` {
+				t.Errorf("invalid result: %s", json)
+			}
+		})
+	}
+}
+
+func TestRunWithRuntimeESModuleInteropLinkError(t *testing.T) {
+	// counter.cjs is wrapped for importing, but never evaluated as main.mjs
+	// fails to link, leaving its exports to be released with the isolate
+	fs := fstest.MapFS{
+		"app/index.cjs": {Data: []byte(`
+			module.exports = import('./main.mjs').then(
+				() => 'linked',
+				(err) => err.name,
+			);
+		`)},
+		"app/counter.cjs": {Data: []byte(`exports.count = 0;`)},
+		"app/main.mjs": {Data: []byte(`
+			import counter from './counter.cjs';
+			import { missing } from './lib.mjs';
+			export { counter, missing };
+		`)},
+		"app/lib.mjs": {Data: []byte(`export const present = true;`)},
+	}
+
+	if json := runModules(t, fs, "/app/index.cjs"); json != `"SyntaxError"` {
+		t.Errorf("invalid result: %s", json)
+	}
+}
+
+// testWasm exports run(x), which returns add(x, 2) using the imported
+// env.add.
+var testWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x0c, 0x02, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x02, 0x0b, 0x01, 0x03, 0x65, 0x6e, 0x76, 0x03, 0x61, 0x64, 0x64, 0x00, 0x00,
+	0x03, 0x02, 0x01, 0x01,
+	0x07, 0x07, 0x01, 0x03, 0x72, 0x75, 0x6e, 0x00, 0x01,
+	0x0a, 0x0a, 0x01, 0x08, 0x00, 0x20, 0x00, 0x41, 0x02, 0x10, 0x00, 0x0b,
+}
+
+func TestWasmModule(t *testing.T) {
+	ctx := WithContext(context.Background())
+
+	i1 := NewIsolate()
+	defer i1.Terminate()
+	i2 := NewIsolate()
+	defer i2.Terminate()
+
+	c1, err := i1.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := i2.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(in FunctionArgs) (*Value, error) {
+		if a, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if b, err := in.Arg(in.ExecutionContext, 1).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else {
+			return in.Context.Create(in.ExecutionContext, a+b)
+		}
+	}
+	imports := map[string]map[string]any{"env": {"add": add}}
+
+	run := func(m *WasmModule) int64 {
+		if instance, err := m.Instantiate(ctx, imports); err != nil {
+			t.Fatal(err)
+		} else if exports, err := instance.Get(ctx, "exports"); err != nil {
+			t.Fatal(err)
+		} else if run, err := exports.Get(ctx, "run"); err != nil {
+			t.Fatal(err)
+		} else if result, err := run.Call(ctx, nil, 40); err != nil {
+			t.Fatal(err)
+		} else if n, err := result.Int64(ctx); err != nil {
+			t.Fatal(err)
+		} else {
+			return n
+		}
+		return 0
+	}
+
+	m1, err := c1.CompileWasm(ctx, testWasm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := run(m1); n != 42 {
+		t.Errorf("invalid result: %d", n)
+	}
+
+	if compiled, err := m1.Compiled(ctx); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(compiled.WireBytes(), testWasm) {
+		t.Error("invalid wire bytes")
+	} else if m2, err := c2.NewWasmModule(ctx, compiled); err != nil {
+		t.Fatal(err)
+	} else if n := run(m2); n != 42 {
+		t.Errorf("invalid result: %d", n)
+	}
+
+	data, err := m1.Value().Serialize(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the compiled code is shared until the data is released
+	for j := 0; j < 2; j++ {
+		if v, err := c2.Deserialize(ctx, data); err != nil {
+			t.Fatal(err)
+		} else if m2, err := v.WasmModule(ctx); err != nil {
+			t.Fatal(err)
+		} else if n := run(m2); n != 42 {
+			t.Errorf("invalid result: %d", n)
+		}
+	}
+
+	ReleaseSerialized(data)
+	if _, err := c2.Deserialize(ctx, data); err == nil {
+		t.Error("expected released data not to deserialize")
+	}
+
+	if _, err := c1.CompileWasm(ctx, []byte{0, 1, 2, 3}); err == nil {
+		t.Error("expected invalid wasm not to compile")
+	}
+}
@@ -62,6 +62,9 @@ const (
 	KindSharedArrayBuffer
 	KindProxy
 	KindWebAssemblyCompiledModule
+	KindBigInt
+	KindBigInt64Array
+	KindBigUint64Array
 
 	kNumKinds
 )
@@ -114,6 +117,9 @@ var kindStrings = [kNumKinds]string{
 	"SharedArrayBuffer",
 	"Proxy",
 	"WebAssemblyCompiledModule",
+	"BigInt",
+	"BigInt64Array",
+	"BigUint64Array",
 }
 
 func (k Kind) String() string {
@@ -5,13 +5,371 @@ package isolates
 import "C"
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	_path "path"
+	"runtime"
 	"strconv"
 	"strings"
+	"unsafe"
 
 	refutils "github.com/grexie/refutils"
 )
 
+// esModule is a compiled v8::Module. Synthetic modules wrap the exports of
+// CommonJS modules and runtimes so that they can be imported.
+type esModule struct {
+	context   *Context
+	pointer   C.ModulePtr
+	id        int
+	synthetic bool
+	exports   *Value
+}
+
+func (c *Context) newESModule(ctx context.Context, r C.ModuleResult, synthetic bool) (*esModule, error) {
+	if r.module == nil {
+		_, err := c.newValueFromTuple(ctx, r.result)
+		if err == nil {
+			err = fmt.Errorf("unable to compile module")
+		}
+		return nil, err
+	}
+
+	m := &esModule{
+		context:   c,
+		pointer:   r.module,
+		id:        int(r.id),
+		synthetic: synthetic,
+	}
+	runtime.SetFinalizer(m, (*esModule).finalize)
+	c.trackSnapshotHandle(m)
+	return m, nil
+}
+
+func (m *esModule) finalize() {
+	m.context.isolate.finalize(m.release)
+}
+
+func (m *esModule) release() {
+	ctx := m.context.isolate.GetExecutionContext()
+
+	m.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		runtime.SetFinalizer(m, nil)
+
+		if m.context.pointer != nil {
+			C.v8_Module_Release(m.context.pointer, m.pointer)
+		}
+
+		m.context = nil
+		m.pointer = nil
+
+		return nil, nil
+	})
+}
+
+// compileModule compiles code as the ES module source of m.
+func (m *Module) compileModule(ctx context.Context, code string) error {
+	c := m.Context
+
+	_, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		pcode := C.CString(stripBOM(code))
+		defer C.free(unsafe.Pointer(pcode))
+
+		pfilename := C.CString(m.Filename)
+		defer C.free(unsafe.Pointer(pfilename))
+
+		iid := c.isolate.ref()
+		defer c.isolate.unref()
+
+		mid := c.isolate.modules.Ref(m)
+		pid := C.CString(fmt.Sprintf("%d:%d", iid, mid))
+		defer C.free(unsafe.Pointer(pid))
+
+		if esm, err := c.newESModule(ctx, C.v8_Module_Compile(c.pointer, pcode, pfilename, pid), false); err != nil {
+			return nil, err
+		} else {
+			m.esModule = esm
+			c.esModules[esm.id] = m
+			return nil, nil
+		}
+	})
+
+	return err
+}
+
+// wrapExports makes the exports of a CommonJS module or runtime importable
+// through a synthetic module.
+func (m *Module) wrapExports(ctx context.Context, exports *Value) error {
+	if m.esModule != nil {
+		return nil
+	}
+
+	c := m.Context
+
+	_, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		pname := C.CString(m.Filename)
+		defer C.free(unsafe.Pointer(pname))
+
+		if esm, err := c.newESModule(ctx, C.v8_Module_NewSynthetic(c.pointer, pname, exports.pointer), true); err != nil {
+			return nil, err
+		} else {
+			esm.exports = exports
+			m.esModule = esm
+			return nil, nil
+		}
+	})
+
+	return err
+}
+
+// evaluate links and evaluates the ES module of m, returning the promise V8
+// settles once any top-level await has completed.
+func (m *Module) evaluate(ctx context.Context) (*Value, error) {
+	c := m.Context
+
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if _, err := c.newValueFromTuple(ctx, C.v8_Module_Instantiate(c.pointer, m.esModule.pointer)); err != nil {
+			return nil, err
+		} else {
+			return c.newValueFromTuple(ctx, C.v8_Module_Evaluate(c.pointer, m.esModule.pointer))
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
+
+func (m *Module) namespace(ctx context.Context) (*Value, error) {
+	c := m.Context
+
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		return c.newValueFromTuple(ctx, C.v8_Module_GetNamespace(c.pointer, m.esModule.pointer))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
+
+// requireESModule evaluates the ES module of m for require, which can't wait
+// for a top-level await to settle.
+func (m *Module) requireESModule(ctx context.Context) (*Value, error) {
+	if promise, err := m.evaluate(ctx); err != nil {
+		return nil, err
+	} else if state, result, err := promise.PromiseInfo(ctx); err != nil {
+		return nil, err
+	} else if state == PromiseStateRejected {
+		return nil, result
+	} else if state == PromiseStatePending {
+		return nil, fmt.Errorf("require() of ES module %s which uses top-level await, use import() instead", m.Filename)
+	} else {
+		return m.namespace(ctx)
+	}
+}
+
+// Import imports specifier from m as an ES module, returning a promise for
+// its namespace. CommonJS modules and runtimes are wrapped so that their
+// exports are the default export alongside their named exports.
+func (m *Module) Import(ctx context.Context, specifier string) (*Value, error) {
+	if module, err := m.importModule(ctx, specifier); err != nil {
+		return nil, err
+	} else {
+		return module.importNamespace(ctx)
+	}
+}
+
+func (m *Module) importNamespace(ctx context.Context) (*Value, error) {
+	if promise, err := m.evaluate(ctx); err != nil {
+		return nil, err
+	} else if namespace, err := m.Context.Create(ctx, func(in FunctionArgs) (*Value, error) {
+		return m.namespace(in.ExecutionContext)
+	}); err != nil {
+		return nil, err
+	} else {
+		return promise.CallMethod(ctx, "then", namespace)
+	}
+}
+
+// importModule resolves specifier from m for an import and compiles the ES
+// module it refers to without evaluating it. Anything else is loaded through
+// require and wrapped in a synthetic module.
+func (m *Module) importModule(ctx context.Context, specifier string) (*Module, error) {
+	c := m.Context
+	l := m.loader
+
+	if l == nil {
+		return nil, fmt.Errorf("unable to resolve: %s in %s", specifier, m.Dirname)
+	}
+
+	if strings.HasPrefix(specifier, "file://") {
+		specifier = specifier[7:]
+	}
+
+	resolved, id, filename, err := l.resolveModule(ctx, c, m.Filename, specifier, importConditions)
+	if err != nil {
+		return nil, err
+	}
+
+	if module, ok := l.modules[id]; ok && module.esModule != nil {
+		return module, nil
+	} else if !ok && resolved[0].factory == nil {
+		if fs, err := c.newModuleFS(ctx, resolved[0].fs); err != nil {
+			return nil, err
+		} else if esm, err := isESModule(ctx, fs, filename); err != nil {
+			return nil, err
+		} else if esm {
+			if code, err := fs.readFile(ctx, filename); err != nil {
+				return nil, err
+			} else if require, err := c.createRequire(ctx, l, filename); err != nil {
+				return nil, err
+			} else {
+				module := &Module{
+					Context:  c,
+					ID:       id,
+					FS:       resolved[0].fs,
+					Filename: filename,
+					Dirname:  _path.Dir(filename),
+					Require:  require,
+					loader:   l,
+				}
+
+				l.modules[id] = module
+
+				if err := module.compileModule(ctx, string(code)); err != nil {
+					module.Error = err
+					return nil, err
+				}
+
+				return module, nil
+			}
+		}
+	}
+
+	// runtimes resolve by name, everything else by the resolved filename
+	target := filename
+	if resolved[0].factory != nil {
+		target = specifier
+	}
+
+	if exports, err := m.Require.Call(ctx, nil, target); err != nil {
+		return nil, err
+	} else if module, ok := l.modules[id]; !ok {
+		return nil, fmt.Errorf("unable to resolve: %s in %s", specifier, m.Dirname)
+	} else if err := module.wrapExports(ctx, exports); err != nil {
+		return nil, err
+	} else {
+		return module, nil
+	}
+}
+
+func (m *Module) V8Func_compileModule(in FunctionArgs) (*Value, error) {
+	if content, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if err := m.compileModule(in.ExecutionContext, content); err != nil {
+		return nil, err
+	} else if namespace, err := m.requireESModule(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if err := in.This.Set(in.ExecutionContext, "exports", namespace); err != nil {
+		return nil, err
+	} else {
+		return nil, nil
+	}
+}
+
+// isESModule reports whether filename is an ES module, either by its
+// extension or by the type field of the nearest package.json.
+func isESModule(ctx context.Context, fs *moduleFS, filename string) (bool, error) {
+	switch _path.Ext(filename) {
+	case ".mjs":
+		return true, nil
+	case ".cjs", ".json":
+		return false, nil
+	}
+
+	for dir := _path.Dir(filename); ; dir = _path.Dir(dir) {
+		descriptionFile := _path.Join(dir, "package.json")
+
+		if fs.isFile(ctx, descriptionFile) {
+			var descriptionFileData struct {
+				Type string `json:"type"`
+			}
+
+			if buffer, err := fs.readFile(ctx, descriptionFile); err != nil {
+				return false, err
+			} else if err := json.Unmarshal(buffer, &descriptionFileData); err != nil {
+				return false, nil
+			} else {
+				return descriptionFileData.Type == "module", nil
+			}
+		}
+
+		if dir == "/" || dir == "." {
+			return false, nil
+		}
+	}
+}
+
+//export resolveModuleCallbackHandler
+func resolveModuleCallbackHandler(info *C.ResolveModuleCallbackInfo) (r C.ModuleResult) {
+	isolate := (*Isolate)(info.isolate)
+
+	contextRef := isolate.contexts.Get(refutils.ID(info.contextId))
+	if contextRef == nil {
+		panic(fmt.Errorf("missing context pointer during module resolution for context #%d", info.contextId))
+	}
+	v8Context := contextRef.(*Context)
+
+	ctx := isolate.GetExecutionContext()
+	For(ctx).SetContext(v8Context)
+
+	specifier := C.GoStringN(info.specifier.data, info.specifier.length)
+
+	result, err := isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if referrer, ok := v8Context.esModules[int(info.referrer)]; !ok {
+			return nil, fmt.Errorf("unable to resolve: %s from unknown module", specifier)
+		} else if module, err := referrer.importModule(ctx, specifier); err != nil {
+			return nil, err
+		} else {
+			return module.esModule.pointer, nil
+		}
+	})
+
+	if err != nil {
+		if m, err := v8Context.Create(ctx, err); err != nil {
+			m := err.Error()
+			r.result.error = C.Error{data: C.CString(m), length: C.int(len(m))}
+			return r
+		} else {
+			C.v8_Value_ValueTuple_Retain(m.info)
+			r.result.result = m.info
+			r.result.isError = C.bool(true)
+			return r
+		}
+	}
+
+	r.module = result.(C.ModulePtr)
+	return r
+}
+
+//export importMetaCallbackHandler
+func importMetaCallbackHandler(pIsolate C.Pointer, contextId C.int, moduleId C.int) C.String {
+	isolate := (*Isolate)(pIsolate)
+
+	if contextRef := isolate.contexts.Get(refutils.ID(contextId)); contextRef == nil {
+		return C.String{data: nil, length: 0}
+	} else if module, ok := contextRef.(*Context).esModules[int(moduleId)]; !ok {
+		return C.String{data: nil, length: 0}
+	} else {
+		url := "file://" + module.Filename
+		return C.String{data: C.CString(url), length: C.int(len(url))}
+	}
+}
+
 //export importModuleDynamicallyCallbackHandler
 func importModuleDynamicallyCallbackHandler(info *C.ImportModuleDynamicallyCallbackInfo) (r C.CallResult) {
 	ids := C.GoStringN(info.id.data, info.id.length)
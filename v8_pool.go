@@ -0,0 +1,302 @@
+package isolates
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrIsolatePoolClosed = errors.New("isolates: isolate pool closed")
+
+// IsolatePoolOptions configures an IsolatePool. Zero values for MaxUses and
+// MaxUsedHeapSize disable recycling on that condition.
+type IsolatePoolOptions struct {
+	// MinSize isolates are created when the pool is created, and the pool is
+	// topped up to MinSize as isolates are recycled.
+	MinSize int
+
+	// MaxSize is the most isolates the pool holds at once, including those
+	// checked out. Get waits for an isolate to be returned beyond this.
+	MaxSize int
+
+	IsolateOptions IsolateOptions
+
+	// Setup runs once on the context of each new isolate, before it is first
+	// checked out, to install globals or bootstrap RunWithRuntime.
+	Setup func(ctx context.Context, c *Context) error
+
+	// MaxUses recycles an isolate once it has been checked out MaxUses times.
+	MaxUses int
+
+	// MaxUsedHeapSize recycles an isolate once its UsedHeapSize grows beyond
+	// MaxUsedHeapSize bytes.
+	MaxUsedHeapSize uint64
+}
+
+// IsolatePoolMetrics is a snapshot of the state of an IsolatePool.
+type IsolatePoolMetrics struct {
+	Size    int
+	Idle    int
+	InUse   int
+	Waiting int
+
+	Created   uint64
+	Recycled  uint64
+	Checkouts uint64
+	Timeouts  uint64
+}
+
+// IsolatePool keeps a set of isolates, each with a context already set up,
+// ready to be checked out with Get and returned with PooledIsolate.Release.
+type IsolatePool struct {
+	options IsolatePoolOptions
+
+	// slots holds a token for each isolate in the pool, checked out or not,
+	// and idle the isolates ready to be checked out.
+	slots chan bool
+	idle  chan *PooledIsolate
+
+	mutex   sync.Mutex
+	closed  bool
+	done    chan bool
+	metrics IsolatePoolMetrics
+}
+
+// PooledIsolate is an isolate checked out of an IsolatePool, together with the
+// context set up for it. It is returned to the pool with Release.
+type PooledIsolate struct {
+	Isolate *Isolate
+	Context *Context
+
+	pool *IsolatePool
+	uses int
+}
+
+// NewIsolatePool creates a pool and warms it with MinSize isolates.
+func NewIsolatePool(ctx context.Context, options IsolatePoolOptions) (*IsolatePool, error) {
+	if options.MaxSize <= 0 {
+		options.MaxSize = 1
+	}
+	if options.MinSize > options.MaxSize {
+		options.MinSize = options.MaxSize
+	}
+
+	p := &IsolatePool{
+		options: options,
+		slots:   make(chan bool, options.MaxSize),
+		idle:    make(chan *PooledIsolate, options.MaxSize),
+		done:    make(chan bool),
+	}
+
+	for j := 0; j < options.MinSize; j++ {
+		p.slots <- true
+		if pi, err := p.create(ctx); err != nil {
+			<-p.slots
+			p.Close()
+			return nil, err
+		} else {
+			p.idle <- pi
+		}
+	}
+
+	return p, nil
+}
+
+// Get checks out an isolate, creating one if the pool has fewer than MaxSize
+// or waiting for one to be released otherwise. It returns ctx.Err() if ctx is
+// done first.
+func (p *IsolatePool) Get(ctx context.Context) (*PooledIsolate, error) {
+	select {
+	case pi := <-p.idle:
+		return p.checkout(pi)
+	default:
+	}
+
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, ErrIsolatePoolClosed
+	}
+	p.metrics.Waiting++
+	p.mutex.Unlock()
+
+	defer func() {
+		p.mutex.Lock()
+		p.metrics.Waiting--
+		p.mutex.Unlock()
+	}()
+
+	select {
+	case pi := <-p.idle:
+		return p.checkout(pi)
+	case p.slots <- true:
+		if pi, err := p.create(ctx); err != nil {
+			<-p.slots
+			return nil, err
+		} else {
+			return p.checkout(pi)
+		}
+	case <-p.done:
+		return nil, ErrIsolatePoolClosed
+	case <-ctx.Done():
+		p.mutex.Lock()
+		p.metrics.Timeouts++
+		p.mutex.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Metrics returns the current size of the pool and its counters.
+func (p *IsolatePool) Metrics() IsolatePoolMetrics {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	metrics := p.metrics
+	metrics.Size = len(p.slots)
+	metrics.Idle = len(p.idle)
+	metrics.InUse = metrics.Size - metrics.Idle
+	return metrics
+}
+
+// Close terminates the idle isolates in the pool. Isolates checked out are
+// terminated when they are released.
+func (p *IsolatePool) Close() {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+	}
+	p.mutex.Unlock()
+
+	for {
+		select {
+		case pi := <-p.idle:
+			p.terminate(pi)
+		default:
+			return
+		}
+	}
+}
+
+func (p *IsolatePool) create(ctx context.Context) (*PooledIsolate, error) {
+	i := NewIsolateWithOptions(p.options.IsolateOptions)
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		i.Terminate()
+		return nil, err
+	}
+
+	if p.options.Setup != nil {
+		if err := p.options.Setup(ctx, c); err != nil {
+			i.Terminate()
+			return nil, err
+		}
+	}
+
+	p.mutex.Lock()
+	p.metrics.Created++
+	p.mutex.Unlock()
+
+	return &PooledIsolate{Isolate: i, Context: c, pool: p}, nil
+}
+
+func (p *IsolatePool) checkout(pi *PooledIsolate) (*PooledIsolate, error) {
+	pi.uses++
+
+	p.mutex.Lock()
+	p.metrics.Checkouts++
+	p.mutex.Unlock()
+
+	return pi, nil
+}
+
+func (p *IsolatePool) healthy(ctx context.Context, pi *PooledIsolate) bool {
+	if running, _ := pi.Isolate.IsRunning(ctx); !running {
+		return false
+	} else if pi.Isolate.HeapLimitExceeded() {
+		return false
+	} else if p.options.MaxUses > 0 && pi.uses >= p.options.MaxUses {
+		return false
+	} else if p.options.MaxUsedHeapSize > 0 {
+		if hs, err := pi.Isolate.GetHeapStatistics(ctx); err != nil || hs.UsedHeapSize > p.options.MaxUsedHeapSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *IsolatePool) terminate(pi *PooledIsolate) {
+	pi.Isolate.Terminate()
+	<-p.slots
+}
+
+// Release returns the isolate to its pool, or terminates it if it has been
+// used MaxUses times, has grown beyond MaxUsedHeapSize or the pool is closed.
+// Recycled isolates are replaced in the background to keep the pool at
+// MinSize.
+func (pi *PooledIsolate) Release() {
+	p := pi.pool
+	ctx := pi.Isolate.GetExecutionContext()
+
+	if p.healthy(ctx, pi) {
+		// idle has room for every isolate in the pool, so this never blocks
+		// while the mutex is held.
+		p.mutex.Lock()
+		if !p.closed {
+			p.idle <- pi
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Unlock()
+	}
+
+	p.terminate(pi)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.closed {
+		p.metrics.Recycled++
+		go p.replenish()
+	}
+}
+
+// replenish creates isolates in the background until the pool has MinSize.
+func (p *IsolatePool) replenish() {
+	ctx := WithContext(context.Background())
+
+	for {
+		p.mutex.Lock()
+		if p.closed || len(p.slots) >= p.options.MinSize {
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Unlock()
+
+		select {
+		case p.slots <- true:
+		default:
+			return
+		}
+
+		pi, err := p.create(ctx)
+		if err != nil {
+			<-p.slots
+			return
+		}
+
+		p.mutex.Lock()
+		closed := p.closed
+		if !closed {
+			p.idle <- pi
+		}
+		p.mutex.Unlock()
+
+		if closed {
+			p.terminate(pi)
+			return
+		}
+	}
+}
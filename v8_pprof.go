@@ -0,0 +1,216 @@
+package isolates
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// pprofProfile builds a profile in the gzipped protobuf format read by
+// go tool pprof. Only the parts of profile.proto the V8 profilers map onto are
+// implemented.
+type pprofProfile struct {
+	sampleTypes   []pprofValueType
+	samples       []pprofSample
+	locations     []pprofLocation
+	functions     []pprofFunction
+	strings       []string
+	timeNanos     int64
+	durationNanos int64
+	periodType    *pprofValueType
+	period        int64
+
+	stringIndex   map[string]int64
+	functionIndex map[pprofFunction]uint64
+	locationIndex map[pprofLocation]uint64
+}
+
+type pprofValueType struct {
+	Type string
+	Unit string
+}
+
+type pprofSample struct {
+	locations []uint64
+	values    []int64
+}
+
+type pprofLocation struct {
+	id         uint64
+	functionID uint64
+	line       int64
+}
+
+type pprofFunction struct {
+	id        uint64
+	name      string
+	filename  string
+	startLine int64
+}
+
+func newPprofProfile(sampleTypes ...pprofValueType) *pprofProfile {
+	return &pprofProfile{
+		sampleTypes:   sampleTypes,
+		strings:       []string{""},
+		stringIndex:   map[string]int64{"": 0},
+		functionIndex: map[pprofFunction]uint64{},
+		locationIndex: map[pprofLocation]uint64{},
+	}
+}
+
+func (p *pprofProfile) string(s string) int64 {
+	if i, ok := p.stringIndex[s]; ok {
+		return i
+	}
+	i := int64(len(p.strings))
+	p.strings = append(p.strings, s)
+	p.stringIndex[s] = i
+	return i
+}
+
+// location returns the ID of the location of a JavaScript frame, adding it
+// and its function to the profile if needed.
+func (p *pprofProfile) location(name string, filename string, line int64) uint64 {
+	if name == "" {
+		name = "(anonymous)"
+	}
+
+	fkey := pprofFunction{name: name, filename: filename}
+	fid, ok := p.functionIndex[fkey]
+	if !ok {
+		fid = uint64(len(p.functions) + 1)
+		p.functionIndex[fkey] = fid
+		p.functions = append(p.functions, pprofFunction{id: fid, name: name, filename: filename})
+	}
+
+	lkey := pprofLocation{functionID: fid, line: line}
+	lid, ok := p.locationIndex[lkey]
+	if !ok {
+		lid = uint64(len(p.locations) + 1)
+		p.locationIndex[lkey] = lid
+		p.locations = append(p.locations, pprofLocation{id: lid, functionID: fid, line: line})
+	}
+
+	return lid
+}
+
+func (p *pprofProfile) addSample(locations []uint64, values ...int64) {
+	p.samples = append(p.samples, pprofSample{locations, values})
+}
+
+func (p *pprofProfile) write(w io.Writer) error {
+	var b protoBuffer
+
+	for _, t := range p.sampleTypes {
+		b.message(1, p.valueType(t))
+	}
+
+	for _, s := range p.samples {
+		var sb protoBuffer
+		sb.packedUint64(1, s.locations)
+		sb.packedInt64(2, s.values)
+		b.message(2, sb)
+	}
+
+	for _, l := range p.locations {
+		var lb, line protoBuffer
+		line.uint64(1, l.functionID)
+		line.int64(2, l.line)
+		lb.uint64(1, l.id)
+		lb.message(4, line)
+		b.message(4, lb)
+	}
+
+	for _, f := range p.functions {
+		var fb protoBuffer
+		fb.uint64(1, f.id)
+		fb.int64(2, p.string(f.name))
+		fb.int64(3, p.string(f.name))
+		fb.int64(4, p.string(f.filename))
+		fb.int64(5, f.startLine)
+		b.message(5, fb)
+	}
+
+	b.int64(9, p.timeNanos)
+	b.int64(10, p.durationNanos)
+	if p.periodType != nil {
+		b.message(11, p.valueType(*p.periodType))
+		b.int64(12, p.period)
+	}
+
+	// The string table is written last as the fields above add to it.
+	for _, s := range p.strings {
+		b.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (p *pprofProfile) valueType(t pprofValueType) protoBuffer {
+	var b protoBuffer
+	b.int64(1, p.string(t.Type))
+	b.int64(2, p.string(t.Unit))
+	return b
+}
+
+// protoBuffer encodes protobuf wire format.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.data = append(b.data, byte(v)|0x80)
+		v >>= 7
+	}
+	b.data = append(b.data, byte(v))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(uint64(v))
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *protoBuffer) message(field int, m protoBuffer) {
+	b.bytes(field, m.data)
+}
+
+func (b *protoBuffer) packedUint64(field int, vs []uint64) {
+	var pb protoBuffer
+	for _, v := range vs {
+		pb.varint(v)
+	}
+	b.bytes(field, pb.data)
+}
+
+func (b *protoBuffer) packedInt64(field int, vs []int64) {
+	var pb protoBuffer
+	for _, v := range vs {
+		pb.varint(uint64(v))
+	}
+	b.bytes(field, pb.data)
+}
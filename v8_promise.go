@@ -18,6 +18,10 @@ type Resolver struct {
 
 	context *Context
 	pointer C.ResolverPtr
+
+	// settled releases the event loop once the promise is resolved or
+	// rejected.
+	settled func()
 }
 
 func (c *Context) NewResolver(ctx context.Context) (*Resolver, error) {
@@ -29,8 +33,10 @@ func (c *Context) NewResolver(ctx context.Context) (*Resolver, error) {
 		r := &Resolver{
 			context: c,
 			pointer: pr,
+			settled: c.isolate.KeepAlive(),
 		}
-		runtime.SetFinalizer(r, (*Resolver).release)
+		runtime.SetFinalizer(r, (*Resolver).finalize)
+		c.trackSnapshotHandle(r)
 		return r, nil
 	})
 
@@ -44,6 +50,7 @@ func (c *Context) NewResolver(ctx context.Context) (*Resolver, error) {
 func (r *Resolver) ResolveWithValue(ctx context.Context, v *Value) error {
 	_, err := r.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		err := C.v8_Resolver_Resolve(r.context.pointer, r.pointer, v.pointer)
+		r.settled()
 		return nil, r.context.isolate.newError(err)
 	})
 
@@ -56,6 +63,7 @@ func (r *Resolver) Resolve(ctx context.Context, value interface{}) error {
 			return nil, err
 		} else {
 			err := C.v8_Resolver_Resolve(r.context.pointer, r.pointer, v.pointer)
+			r.settled()
 			return nil, r.context.isolate.newError(err)
 		}
 	})
@@ -66,6 +74,7 @@ func (r *Resolver) Resolve(ctx context.Context, value interface{}) error {
 func (r *Resolver) RejectWithValue(ctx context.Context, v *Value) error {
 	_, err := r.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		err := C.v8_Resolver_Reject(r.context.pointer, r.pointer, v.pointer)
+		r.settled()
 		return nil, r.context.isolate.newError(err)
 	})
 
@@ -78,6 +87,7 @@ func (r *Resolver) Reject(ctx context.Context, value interface{}) error {
 			return nil, err
 		} else {
 			err := C.v8_Resolver_Reject(r.context.pointer, r.pointer, v.pointer)
+			r.settled()
 			return nil, r.context.isolate.newError(err)
 		}
 	})
@@ -120,11 +130,16 @@ func (r *Resolver) ToCallback(ctx context.Context, callback *Value) error {
 	return nil
 }
 
+func (r *Resolver) finalize() {
+	r.context.isolate.finalize(r.release)
+}
+
 func (r *Resolver) release() {
 	ctx := r.context.isolate.GetExecutionContext()
 
 	r.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		runtime.SetFinalizer(r, nil)
+		r.settled()
 
 		if r.context.pointer != nil {
 			C.v8_Resolver_Release(r.context.pointer, r.pointer)
@@ -13,6 +13,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync/atomic"
 
 	refutils "github.com/grexie/refutils"
 )
@@ -31,6 +32,41 @@ type Module struct {
 
 	Require *Value
 	Error   error
+
+	loader   *moduleLoader
+	esModule *esModule
+}
+
+// moduleLoader holds the state shared by the require functions and ES
+// modules of a runtime.
+type moduleLoader struct {
+	fs         *moduleFS
+	extensions *Value
+	modules    map[string]*Module
+	runtimes   map[string]bool
+
+	// source, env and options are the arguments to RunWithRuntime, kept so
+	// that workers can run with the same file system and environment. root is
+	// the directory of the main module.
+	source  any
+	env     func(RuntimeFunctionArgs) error
+	options RuntimeOptions
+	root    string
+}
+
+// RuntimeOptions configures Context.RunWithRuntime.
+type RuntimeOptions struct {
+	// CodeCacheStore, if set, is where modules read code caches from and
+	// write them to. A store can be shared by runtimes in several isolates.
+	CodeCacheStore CodeCacheStore
+
+	// MaxWorkers is the number of worker_threads Workers, each with its own
+	// isolate, that can run at once, including those started by workers.
+	// worker_threads can only be required if it is set.
+	MaxWorkers int
+
+	// workers counts the running workers, shared with the runtimes of workers.
+	workers *atomic.Int32
 }
 
 type RuntimeFunctionArgs struct {
@@ -85,6 +121,8 @@ var _ = RegisterRuntime("vm", "vm", func(in FunctionArgs) (*Value, error) {
 	return nil, nil
 })
 
+// RegisterRuntimeLibrary makes the module at path in fs available to require
+// as name. fs is an fs.FS or an object like the fs passed to RunWithRuntime.
 func RegisterRuntimeLibrary(name string, fs any, path string) *ResolveResult {
 	m := &ResolveResult{
 		fs:   fs,
@@ -112,8 +150,9 @@ func stripBOM(content string) string {
 
 var extensions = []string{".js", ".cjs"}
 var conditions = []string{"solid", "node", "require", "default"}
+var importConditions = []string{"solid", "node", "import", "default"}
 
-func resolve(ctx context.Context, fs *Value, context string, id string, conditions []string, extensions *Value) ([]*ResolveResult, error) {
+func resolve(ctx context.Context, fs *moduleFS, context string, id string, conditions []string, extensions *Value) ([]*ResolveResult, error) {
 	if runtime, ok := registeredRuntimes[id]; ok {
 		return runtime, nil
 	}
@@ -136,17 +175,11 @@ func resolve(ctx context.Context, fs *Value, context string, id string, conditio
 		var descriptionFileDataMap map[string]any
 		var ok bool
 
-		if stats, err := fs.CallMethod(ctx, "statSync", descriptionFile); err != nil {
-			return nil, ErrNotResolved
-		} else if isFile, err := stats.CallMethod(ctx, "isFile"); err != nil {
-			return nil, err
-		} else if isFile, err := isFile.Bool(ctx); err != nil {
-			return nil, err
-		} else if isFile {
+		if fs.isFile(ctx, descriptionFile) {
 			var extension func(p string, try bool) (string, bool)
 			extension = func(p string, try bool) (string, bool) {
 				p2 := _path.Join(_path.Dir(descriptionFile), p)
-				if stats, err := fs.CallMethod(ctx, "statSync", p2); err != nil {
+				if isFile, isDirectory, err := fs.stat(ctx, p2); err != nil {
 					if try {
 						for _, ext := range extensionsList {
 							if m, ok := extension(p+ext, false); ok {
@@ -154,16 +187,8 @@ func resolve(ctx context.Context, fs *Value, context string, id string, conditio
 							}
 						}
 					}
-				} else if isFile, err := stats.CallMethod(ctx, "isFile"); err != nil {
-					return "", false
-				} else if isFile, err := isFile.Bool(ctx); err != nil {
-					return "", false
 				} else if isFile {
 					return p2, true
-				} else if isDirectory, err := stats.CallMethod(ctx, "isDirectory"); err != nil {
-					return "", false
-				} else if isDirectory, err := isDirectory.Bool(ctx); err != nil {
-					return "", false
 				} else if isDirectory {
 					return extension(_path.Join(p, "index"), true)
 				}
@@ -171,13 +196,9 @@ func resolve(ctx context.Context, fs *Value, context string, id string, conditio
 				return "", false
 			}
 
-			if buffer, err := fs.CallMethod(ctx, "readFileSync", descriptionFile); err != nil {
-				return nil, err
-			} else if buffer, err := buffer.Get(ctx, "buffer"); err != nil {
+			if buffer, err := fs.readFile(ctx, descriptionFile); err != nil {
 				return nil, err
-			} else if buffer, err := buffer.Unmarshal(ctx, reflect.TypeOf([]byte{})); err != nil {
-				return nil, err
-			} else if err := json.Unmarshal(buffer.Interface().([]byte), &descriptionFileData); err != nil {
+			} else if err := json.Unmarshal(buffer, &descriptionFileData); err != nil {
 				// NOOP
 			} else if descriptionFileDataMap, ok = descriptionFileData.(map[string]any); !ok {
 				// NOOP
@@ -217,7 +238,7 @@ func resolve(ctx context.Context, fs *Value, context string, id string, conditio
 					p = strings.TrimSuffix(p, "/")
 					if p == packagePath {
 						if main, ok = condition(c); ok {
-							return []*ResolveResult{{fs: fs, path: main}}, nil
+							return []*ResolveResult{{fs: fs.source(), path: main}}, nil
 						}
 					}
 				}
@@ -226,16 +247,16 @@ func resolve(ctx context.Context, fs *Value, context string, id string, conditio
 			if packagePath == "." {
 				if m, ok := descriptionFileDataMap["main"]; !ok {
 					if main, ok := extension(packagePath, true); ok {
-						return []*ResolveResult{{fs: fs, path: main}}, nil
+						return []*ResolveResult{{fs: fs.source(), path: main}}, nil
 					}
 				} else if main, ok := m.(string); ok {
 					if main, ok := extension(main, true); ok {
-						return []*ResolveResult{{fs: fs, path: main}}, nil
+						return []*ResolveResult{{fs: fs.source(), path: main}}, nil
 					}
 				}
 			} else {
 				if main, ok := extension(packagePath, true); ok {
-					return []*ResolveResult{{fs: fs, path: main}}, nil
+					return []*ResolveResult{{fs: fs.source(), path: main}}, nil
 				}
 			}
 		}
@@ -245,30 +266,20 @@ func resolve(ctx context.Context, fs *Value, context string, id string, conditio
 
 	if _path.IsAbs(id) {
 		for _, extension := range extensionsList {
-			if stats, err := fs.CallMethod(ctx, "statSync", id+extension); err == nil {
-				if isFile, err := stats.CallMethod(ctx, "isFile"); err != nil {
-					return nil, err
-				} else if isFile, err := isFile.Bool(ctx); err != nil {
-					return nil, err
-				} else if isFile {
-					return []*ResolveResult{{fs: fs, path: id + extension}}, nil
-				}
+			if fs.isFile(ctx, id+extension) {
+				return []*ResolveResult{{fs: fs.source(), path: id + extension}}, nil
 			}
 		}
 
-		if stats, err := fs.CallMethod(ctx, "statSync", id); err == nil {
-			if isDirectory, err := stats.CallMethod(ctx, "isDirectory"); err != nil {
-				return nil, err
-			} else if isDirectory, err := isDirectory.Bool(ctx); err != nil {
-				return nil, err
-			} else if isDirectory {
+		if _, isDirectory, err := fs.stat(ctx, id); err == nil {
+			if isDirectory {
 				if result, err := resolveFromDescriptionFile(id, "."); err != nil {
 					return resolve(ctx, fs, context, _path.Join(id, "index"), conditions, extensions)
 				} else {
 					return result, nil
 				}
 			} else {
-				return []*ResolveResult{{fs: fs, path: id}}, nil
+				return []*ResolveResult{{fs: fs.source(), path: id}}, nil
 			}
 		}
 	} else {
@@ -299,45 +310,57 @@ func resolve(ctx context.Context, fs *Value, context string, id string, conditio
 }
 
 func (c *Context) CreateRequire(ctx context.Context, fs any, path string, extensions *Value, modules map[string]*Module, runtimes map[string]bool) (*Value, error) {
-	if fs, err := c.Create(ctx, fs); err != nil {
+	if fsys, err := c.newModuleFS(ctx, fs); err != nil {
 		return nil, err
-	} else if require, err := c.Create(ctx, func(in FunctionArgs) (*Value, error) {
-		if id, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
-			return nil, err
-		} else if runtimeAllowed, ok := runtimes[id]; ok && runtimeAllowed != false {
-			return nil, fmt.Errorf("unable to resolve: %s in %s", id, _path.Dir(path))
-		} else if resolved, err := resolve(in.ExecutionContext, fs, _path.Dir(path), id, conditions, extensions); err != nil {
-			return nil, err
-		} else {
-			realpath := resolved[0].path
-
-			if resolved[0].fs != nil {
-				if fs, err := c.Create(in.ExecutionContext, resolved[0].fs); err != nil {
-					return nil, err
-				} else if rp, err := fs.CallMethod(in.ExecutionContext, "realpathSync", resolved[0].path); err != nil {
-					return nil, err
-				} else if rp, err := rp.StringValue(in.ExecutionContext); err != nil {
-					return nil, err
-				} else {
-					realpath = rp
-				}
-			}
+	} else {
+		return c.createRequire(ctx, &moduleLoader{fs: fsys, extensions: extensions, modules: modules, runtimes: runtimes, source: fs, root: _path.Dir(path)}, path)
+	}
+}
 
-			var filename string
-			var dirname string
+// resolveModule resolves id from the module at path, returning the resolution
+// along with the ID and filename the module is cached under.
+func (l *moduleLoader) resolveModule(ctx context.Context, c *Context, path string, id string, conditions []string) ([]*ResolveResult, string, string, error) {
+	if runtimeAllowed, ok := l.runtimes[id]; ok && runtimeAllowed != false {
+		return nil, "", "", fmt.Errorf("unable to resolve: %s in %s", id, _path.Dir(path))
+	} else if resolved, err := resolve(ctx, l.fs, _path.Dir(path), id, conditions, l.extensions); err != nil {
+		return nil, "", "", err
+	} else {
+		filename := resolved[0].path
 
-			if resolved[0].factory != nil {
-				filename = realpath
-				dirname = _path.Dir(filename)
+		if resolved[0].fs != nil {
+			if fs, err := c.newModuleFS(ctx, resolved[0].fs); err != nil {
+				return nil, "", "", err
+			} else if rp, err := fs.realpath(ctx, resolved[0].path); err != nil {
+				return nil, "", "", err
 			} else {
-				filename = realpath
-				id = filename
-				dirname = _path.Dir(filename)
+				filename = rp
 			}
+		}
+
+		if resolved[0].factory == nil {
+			id = filename
+		}
+
+		return resolved, id, filename, nil
+	}
+}
+
+func (c *Context) createRequire(ctx context.Context, loader *moduleLoader, path string) (*Value, error) {
+	fs, extensions, modules := loader.fs, loader.extensions, loader.modules
+
+	if require, err := c.Create(ctx, func(in FunctionArgs) (*Value, error) {
+		if id, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if resolved, id, filename, err := loader.resolveModule(in.ExecutionContext, in.Context, path, id, conditions); err != nil {
+			return nil, err
+		} else {
+			dirname := _path.Dir(filename)
 
 			if module, ok := modules[id]; ok {
 				if module.Error != nil {
 					return nil, module.Error
+				} else if module.esModule != nil && !module.esModule.synthetic {
+					return module.requireESModule(in.ExecutionContext)
 				} else if moduleValue, err := in.Context.Create(in.ExecutionContext, module); err != nil {
 					return nil, err
 				} else if exports, err := moduleValue.Get(in.ExecutionContext, "exports"); err != nil {
@@ -345,7 +368,7 @@ func (c *Context) CreateRequire(ctx context.Context, fs any, path string, extens
 				} else {
 					return exports, nil
 				}
-			} else if require, err := c.CreateRequire(in.ExecutionContext, fs, filename, extensions, modules, runtimes); err != nil {
+			} else if require, err := c.createRequire(in.ExecutionContext, loader, filename); err != nil {
 				return nil, err
 			} else if exports, err := in.Context.NewObject(in.ExecutionContext); err != nil {
 				return nil, err
@@ -357,6 +380,7 @@ func (c *Context) CreateRequire(ctx context.Context, fs any, path string, extens
 					Filename: filename,
 					Dirname:  dirname,
 					Require:  require,
+					loader:   loader,
 				}
 
 				modules[id] = module
@@ -451,24 +475,58 @@ func (c *Context) CreateRequire(ctx context.Context, fs any, path string, extens
 	}
 }
 
-func (c *Context) RunWithRuntime(ctx context.Context, fs any, path string, env func(RuntimeFunctionArgs) error, security map[string]bool) (*Value, error) {
-	modules := map[string]*Module{}
+// moduleFileSystem returns the file system a require.extensions handler reads
+// module from, falling back to module.fs for objects that aren't a *Module.
+func moduleFileSystem(in FunctionArgs, module *Value) (*moduleFS, error) {
+	if r, err := in.Context.Receiver(in.ExecutionContext, module, reflect.TypeOf(&Module{})); err == nil && r.IsValid() {
+		if m, ok := r.Interface().(*Module); ok && m.FS != nil {
+			return in.Context.newModuleFS(in.ExecutionContext, m.FS)
+		}
+	}
 
-	if extensions, err := c.NewObject(ctx); err != nil {
+	if fs, err := module.Get(in.ExecutionContext, "fs"); err != nil {
+		return nil, err
+	} else {
+		return in.Context.newModuleFS(in.ExecutionContext, fs)
+	}
+}
+
+// RunWithRuntime runs the module at path with require and import. fs is the
+// file system modules are loaded from: an fs.FS such as an embed.FS or
+// NewOverlayFS, which is read from Go, or an object with the statSync,
+// readFileSync and realpathSync methods of Node's fs module. At most one
+// RuntimeOptions may be given.
+func (c *Context) RunWithRuntime(ctx context.Context, fs any, path string, env func(RuntimeFunctionArgs) error, security map[string]bool, options ...RuntimeOptions) (*Value, error) {
+	loader := &moduleLoader{modules: map[string]*Module{}, runtimes: security, source: fs, env: env, root: _path.Dir(path)}
+	if len(options) > 0 {
+		loader.options = options[0]
+	}
+	if loader.options.workers == nil {
+		loader.options.workers = new(atomic.Int32)
+	}
+
+	var err error
+	if loader.extensions, err = c.NewObject(ctx); err != nil {
 		return nil, err
 	} else if js, err := c.Create(ctx, func(in FunctionArgs) (*Value, error) {
 		module := in.Arg(in.ExecutionContext, 0)
 
-		if fs, err := module.Get(in.ExecutionContext, "fs"); err != nil {
+		if fs, err := moduleFileSystem(in, module); err != nil {
 			return nil, err
 		} else if filename, err := in.Arg(in.ExecutionContext, 1).StringValue(in.ExecutionContext); err != nil {
 			return nil, err
-		} else if buffer, err := fs.CallMethod(in.ExecutionContext, "readFileSync", filename); err != nil {
+		} else if code, err := fs.readFile(in.ExecutionContext, filename); err != nil {
 			return nil, err
-		} else if string, err := buffer.CallMethod(in.ExecutionContext, "toString", "utf8"); err != nil {
+		} else if esm, err := isESModule(in.ExecutionContext, fs, filename); err != nil {
 			return nil, err
+		} else if esm {
+			if _, err := module.CallMethod(in.ExecutionContext, "_compileModule", string(code), filename); err != nil {
+				return nil, err
+			} else {
+				return nil, nil
+			}
 		} else {
-			if _, err := module.CallMethod(in.ExecutionContext, "_compile", string, filename); err != nil {
+			if _, err := module.CallMethod(in.ExecutionContext, "_compile", string(code), filename); err != nil {
 				return nil, err
 			} else {
 				return nil, nil
@@ -479,15 +537,13 @@ func (c *Context) RunWithRuntime(ctx context.Context, fs any, path string, env f
 	} else if json, err := c.Create(ctx, func(in FunctionArgs) (*Value, error) {
 		module := in.Arg(in.ExecutionContext, 0)
 
-		if fs, err := module.Get(in.ExecutionContext, "fs"); err != nil {
+		if fs, err := moduleFileSystem(in, module); err != nil {
 			return nil, err
 		} else if filename, err := in.Arg(in.ExecutionContext, 1).StringValue(in.ExecutionContext); err != nil {
 			return nil, err
-		} else if buffer, err := fs.CallMethod(in.ExecutionContext, "readFileSync", filename); err != nil {
-			return nil, err
-		} else if string, err := buffer.CallMethod(in.ExecutionContext, "toString", "utf8"); err != nil {
+		} else if data, err := fs.readFile(in.ExecutionContext, filename); err != nil {
 			return nil, err
-		} else if json, err := in.Context.ParseJSON(in.ExecutionContext, string.String()); err != nil {
+		} else if json, err := in.Context.ParseJSON(in.ExecutionContext, string(data)); err != nil {
 			return nil, err
 		} else if err := module.Set(in.ExecutionContext, "exports", json); err != nil {
 			return nil, err
@@ -496,15 +552,19 @@ func (c *Context) RunWithRuntime(ctx context.Context, fs any, path string, env f
 		}
 	}); err != nil {
 		return nil, err
-	} else if err := extensions.Set(ctx, ".js", js); err != nil {
+	} else if err := loader.extensions.Set(ctx, ".js", js); err != nil {
 		return nil, err
-	} else if err := extensions.Set(ctx, ".cjs", js); err != nil {
+	} else if err := loader.extensions.Set(ctx, ".cjs", js); err != nil {
 		return nil, err
-	} else if err := extensions.Set(ctx, ".json", json); err != nil {
+	} else if err := loader.extensions.Set(ctx, ".mjs", js); err != nil {
+		return nil, err
+	} else if err := loader.extensions.Set(ctx, ".json", json); err != nil {
 		return nil, err
 	} else if global, err := c.Global(ctx); err != nil {
 		return nil, err
-	} else if require, err := c.CreateRequire(ctx, fs, path, extensions, modules, security); err != nil {
+	} else if loader.fs, err = c.newModuleFS(ctx, fs); err != nil {
+		return nil, err
+	} else if require, err := c.createRequire(ctx, loader, path); err != nil {
 		return nil, err
 	} else {
 		in := RuntimeFunctionArgs{
@@ -523,6 +583,24 @@ func (c *Context) RunWithRuntime(ctx context.Context, fs any, path string, env f
 			return nil, err
 		}
 
+		// ES modules are imported rather than required so that top-level
+		// await works, and RunWithRuntime returns a promise for their namespace
+		if esm, err := isESModule(ctx, loader.fs, path); err != nil {
+			return nil, err
+		} else if esm {
+			main := &Module{
+				Context:  c,
+				ID:       path,
+				FS:       fs,
+				Filename: path,
+				Dirname:  _path.Dir(path),
+				Require:  require,
+				Main:     true,
+				loader:   loader,
+			}
+			return main.Import(ctx, path)
+		}
+
 		return require.Call(ctx, nil, path)
 	}
 }
@@ -532,7 +610,11 @@ func (m *Module) V8GetId(in GetterArgs) (*Value, error) {
 }
 
 func (m *Module) V8GetFs(in GetterArgs) (*Value, error) {
-	return in.Context.Create(in.ExecutionContext, m.FS)
+	if fs, err := in.Context.newModuleFS(in.ExecutionContext, m.FS); err != nil {
+		return nil, err
+	} else {
+		return fs.binding(in.ExecutionContext, in.Context, m)
+	}
 }
 
 func (m *Module) V8GetFilename(in GetterArgs) (*Value, error) {
@@ -547,6 +629,14 @@ func (m *Module) V8GetRequire(in GetterArgs) (*Value, error) {
 	return m.Require, nil
 }
 
+// codeCacheStore returns the code cache store of the module's runtime, if any.
+func (m *Module) codeCacheStore() CodeCacheStore {
+	if m.loader == nil {
+		return nil
+	}
+	return m.loader.options.CodeCacheStore
+}
+
 func (m *Module) V8Func_compile(in FunctionArgs) (*Value, error) {
 	if global, err := in.Context.Global(in.ExecutionContext); err != nil {
 		return nil, err
@@ -554,7 +644,7 @@ func (m *Module) V8Func_compile(in FunctionArgs) (*Value, error) {
 		return nil, err
 	} else if filename, err := in.Arg(in.ExecutionContext, 1).StringValue(in.ExecutionContext); err != nil {
 		return nil, err
-	} else if value, err := in.Context.Run(in.ExecutionContext, wrapScript([]byte(stripBOM(content))), filename, m); err != nil {
+	} else if value, err := in.Context.runCached(in.ExecutionContext, m.codeCacheStore(), wrapScript([]byte(stripBOM(content))), filename, m); err != nil {
 		return nil, err
 	} else if exports, err := in.This.Get(in.ExecutionContext, "exports"); err != nil {
 		return nil, err
@@ -565,9 +655,8 @@ func (m *Module) V8Func_compile(in FunctionArgs) (*Value, error) {
 	}
 }
 
+// ImportModuleDynamically imports specifier for an import() in m, returning a
+// promise for the module namespace.
 func (m *Module) ImportModuleDynamically(ctx context.Context, specifier string, resourceName string, importAssertions []*Value) (*Value, error) {
-	if strings.HasPrefix(specifier, "file://") {
-		specifier = specifier[7:]
-	}
-	return m.Require.Call(ctx, nil, specifier)
+	return m.Import(ctx, specifier)
 }
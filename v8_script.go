@@ -0,0 +1,225 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	refutils "github.com/grexie/refutils"
+)
+
+// Script is a compiled script that is not bound to a context and can be run
+// repeatedly without being recompiled.
+type Script struct {
+	refutils.RefHolder
+
+	context       *Context
+	pointer       C.ScriptPtr
+	cacheRejected bool
+}
+
+// CompileOptions configures Context.CompileWithOptions.
+type CompileOptions struct {
+	// Module is the module that dynamic imports from the script resolve
+	// against.
+	Module *Module
+
+	// CodeCache is a code cache previously returned by Script.CreateCodeCache.
+	// V8 checks that it matches the source and the V8 build and compiles from
+	// scratch if it doesn't, which is reported by Script.CacheRejected.
+	CodeCache []byte
+}
+
+// CodeCacheStore persists code caches so that module loads in
+// Context.RunWithRuntime can skip compilation, including across isolates. It
+// is passed to RunWithRuntime in RuntimeOptions.
+// Keys are derived from the filename and a hash of the source.
+type CodeCacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+}
+
+// MemoryCodeCacheStore is a CodeCacheStore held in memory.
+type MemoryCodeCacheStore struct {
+	caches sync.Map
+}
+
+func (s *MemoryCodeCacheStore) Get(key string) ([]byte, bool) {
+	if data, ok := s.caches.Load(key); ok {
+		return data.([]byte), true
+	}
+	return nil, false
+}
+
+func (s *MemoryCodeCacheStore) Set(key string, data []byte) {
+	s.caches.Store(key, data)
+}
+
+func (c *Context) Compile(ctx context.Context, code string, filename string) (*Script, error) {
+	return c.CompileWithOptions(ctx, code, filename, CompileOptions{})
+}
+
+func (c *Context) CompileWithOptions(ctx context.Context, code string, filename string, options CompileOptions) (*Script, error) {
+	s, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		pcode := C.CString(code)
+		defer C.free(unsafe.Pointer(pcode))
+
+		pfilename := C.CString(filename)
+		defer C.free(unsafe.Pointer(pfilename))
+
+		iid := c.isolate.ref()
+		defer c.isolate.unref()
+
+		var mid refutils.ID
+		if options.Module != nil {
+			mid = c.isolate.modules.Ref(options.Module)
+		}
+		pid := C.CString(fmt.Sprintf("%d:%d", iid, mid))
+		defer C.free(unsafe.Pointer(pid))
+
+		cache := C.String{data: nil, length: 0}
+		if len(options.CodeCache) > 0 {
+			cache.data = (*C.char)(C.CBytes(options.CodeCache))
+			cache.length = C.int(len(options.CodeCache))
+			defer C.free(unsafe.Pointer(cache.data))
+		}
+
+		c.ref()
+		r := C.v8_Context_Compile(c.pointer, pcode, pfilename, pid, cache)
+		c.unref()
+
+		if r.script == nil {
+			if options.Module != nil {
+				c.isolate.modules.Unref(options.Module)
+			}
+			_, err := c.newValueFromTuple(ctx, r.result)
+			return nil, err
+		}
+
+		// functions created by the script import dynamically through the
+		// module, so, as with Run, it stays referenced once the script has
+		// been compiled
+		s := &Script{
+			context:       c,
+			pointer:       r.script,
+			cacheRejected: bool(r.cacheRejected),
+		}
+		runtime.SetFinalizer(s, (*Script).finalize)
+		c.trackSnapshotHandle(s)
+		return s, nil
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return s.(*Script), nil
+	}
+}
+
+// CacheRejected reports whether V8 rejected the code cache the script was
+// compiled with.
+func (s *Script) CacheRejected() bool {
+	return s.cacheRejected
+}
+
+func (s *Script) Run(ctx context.Context) (*Value, error) {
+	pv, err := s.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		s.context.ref()
+		vt := C.v8_Script_Run(s.context.pointer, s.pointer)
+		s.context.unref()
+
+		return s.context.newValueFromTuple(ctx, vt)
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
+
+// CreateCodeCache serializes the compiled code of the script. Functions that
+// have been run by then are included, so creating the cache after running the
+// script gives a more complete cache.
+func (s *Script) CreateCodeCache(ctx context.Context) ([]byte, error) {
+	data, err := s.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		cache := C.v8_Script_CreateCodeCache(s.context.pointer, s.pointer)
+		if cache.data == nil {
+			return nil, fmt.Errorf("unable to create code cache")
+		}
+		defer C.free(unsafe.Pointer(cache.data))
+
+		return C.GoBytes(unsafe.Pointer(cache.data), cache.length), nil
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return data.([]byte), nil
+	}
+}
+
+func (s *Script) finalize() {
+	s.context.isolate.finalize(s.release)
+}
+
+func (s *Script) release() {
+	if s.context == nil {
+		return
+	}
+
+	ctx := s.context.isolate.GetExecutionContext()
+
+	s.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		runtime.SetFinalizer(s, nil)
+
+		if s.context.pointer != nil {
+			C.v8_Script_Release(s.context.pointer, s.pointer)
+		}
+
+		s.context = nil
+		s.pointer = nil
+
+		return nil, nil
+	})
+}
+
+func codeCacheKey(filename string, code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return filename + "#" + hex.EncodeToString(hash[:])
+}
+
+// runCached runs code through store, if it isn't nil.
+func (c *Context) runCached(ctx context.Context, store CodeCacheStore, code string, filename string, module *Module) (*Value, error) {
+	if store == nil {
+		return c.Run(ctx, code, filename, module)
+	}
+
+	key := codeCacheKey(filename, code)
+	cache, cached := store.Get(key)
+
+	script, err := c.CompileWithOptions(ctx, code, filename, CompileOptions{Module: module, CodeCache: cache})
+	if err != nil {
+		return nil, err
+	}
+	defer script.release()
+
+	if value, err := script.Run(ctx); err != nil {
+		return nil, err
+	} else {
+		if !cached || script.CacheRejected() {
+			if data, err := script.CreateCodeCache(ctx); err == nil {
+				store.Set(key, data)
+			}
+		}
+		return value, nil
+	}
+}
@@ -0,0 +1,279 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	refutils "github.com/grexie/refutils"
+)
+
+// HostObjectDelegate transfers host objects, the objects created from Go
+// values, through Value.Serialize and Context.Deserialize. WriteHostObject
+// returns the Go value an object is written as, and ReadHostObject creates the
+// object for that value in the context data is deserialized into. Both are
+// called on the isolate's thread.
+type HostObjectDelegate interface {
+	WriteHostObject(ctx context.Context, object *Value) (any, error)
+	ReadHostObject(ctx context.Context, c *Context, value any) (*Value, error)
+}
+
+// receiverDelegate is the HostObjectDelegate of contexts that haven't set
+// one. It transfers the Go receiver of an object, which is created again in
+// the deserializing context.
+type receiverDelegate struct{}
+
+func (receiverDelegate) WriteHostObject(ctx context.Context, object *Value) (any, error) {
+	if receiver := object.Receiver(ctx); isZero(receiver) {
+		return nil, fmt.Errorf("host object has no receiver")
+	} else {
+		return receiver.Interface(), nil
+	}
+}
+
+func (receiverDelegate) ReadHostObject(ctx context.Context, c *Context, value any) (*Value, error) {
+	return c.Create(ctx, value)
+}
+
+// SetHostObjectDelegate sets the delegate that host objects are written and
+// read with when values in the context are serialized, or data is
+// deserialized into it. A nil delegate restores the default, which transfers
+// Go receivers.
+func (c *Context) SetHostObjectDelegate(delegate HostObjectDelegate) {
+	c.hostObjectDelegate = delegate
+}
+
+func (c *Context) getHostObjectDelegate() HostObjectDelegate {
+	if c.hostObjectDelegate == nil {
+		return receiverDelegate{}
+	}
+	return c.hostObjectDelegate
+}
+
+// serializations holds what the data returned by Value.Serialize refers to
+// rather than copies, by the ID written at the end of the data, until the data
+// is released with ReleaseSerialized.
+var serializations = struct {
+	sync.Mutex
+	nextID  uint32
+	entries map[uint32]*serialization
+}{entries: map[uint32]*serialization{}}
+
+type serialization struct {
+	hostObjects []any
+	wasmModules []C.CompiledWasmModulePtr
+}
+
+func newSerialization() uint32 {
+	serializations.Lock()
+	defer serializations.Unlock()
+
+	serializations.nextID++
+	if serializations.nextID == 0 {
+		serializations.nextID++
+	}
+	serializations.entries[serializations.nextID] = &serialization{}
+	return serializations.nextID
+}
+
+func getSerialization(id uint32) (*serialization, bool) {
+	serializations.Lock()
+	defer serializations.Unlock()
+
+	s, ok := serializations.entries[id]
+	return s, ok
+}
+
+func (s *serialization) empty() bool {
+	return len(s.hostObjects) == 0 && len(s.wasmModules) == 0
+}
+
+func releaseSerialization(id uint32) {
+	serializations.Lock()
+	s, ok := serializations.entries[id]
+	delete(serializations.entries, id)
+	serializations.Unlock()
+
+	if ok {
+		for _, compiled := range s.wasmModules {
+			C.v8_CompiledWasmModule_Release(compiled)
+		}
+	}
+}
+
+// splitSerialized returns the data written by V8 and the serialization ID at
+// the end of data returned by Value.Serialize.
+func splitSerialized(data []byte) ([]byte, uint32, error) {
+	if len(data) < 4 {
+		return nil, 0, fmt.Errorf("invalid serialized data")
+	}
+	return data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:]), nil
+}
+
+// Serialize writes the value with the structured clone algorithm, as
+// postMessage does. Unlike MarshalJSON it keeps Dates, Maps, Sets, typed
+// arrays, BigInts, undefined and cycles. Host objects, written with the
+// context's HostObjectDelegate, and WebAssembly modules are written by
+// reference, so the data is only valid within this process and must be
+// released with ReleaseSerialized.
+func (v *Value) Serialize(ctx context.Context) ([]byte, error) {
+	pb, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		id := newSerialization()
+
+		r := C.v8_Value_Serialize(v.context.pointer, v.pointer, C.uint32_t(id))
+		if err := v.context.isolate.newError(r.error); err != nil {
+			releaseSerialization(id)
+			return nil, err
+		}
+
+		b := C.GoBytes(unsafe.Pointer(r.data.data), r.data.length)
+		C.free(unsafe.Pointer(r.data.data))
+
+		// data without references needs no releasing
+		if s, _ := getSerialization(id); s.empty() {
+			releaseSerialization(id)
+			id = 0
+		}
+
+		return binary.LittleEndian.AppendUint32(b, id), nil
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pb.([]byte), nil
+	}
+}
+
+// Deserialize reads a value written by Value.Serialize, possibly in another
+// isolate, into the context. The same data can be deserialized any number of
+// times until it is released.
+func (c *Context) Deserialize(ctx context.Context, data []byte) (*Value, error) {
+	data, id, err := splitSerialized(data)
+	if err != nil {
+		return nil, err
+	} else if _, ok := getSerialization(id); id != 0 && !ok {
+		return nil, fmt.Errorf("serialized data has been released")
+	}
+
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		var pd *C.char
+		if len(data) > 0 {
+			pd = (*C.char)(unsafe.Pointer(&data[0]))
+		}
+
+		return c.newValueFromTuple(ctx, C.v8_Context_Deserialize(c.pointer, C.ByteArray{data: pd, length: C.int(len(data))}, C.uint32_t(id)))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
+
+// ReleaseSerialized drops the references held for data returned by
+// Value.Serialize, freeing the compiled code of WebAssembly modules that isn't
+// used elsewhere. Data that refers to host objects or WebAssembly modules
+// can't be deserialized once released, so it must not be released while it
+// is being deserialized.
+func ReleaseSerialized(data []byte) {
+	if _, id, err := splitSerialized(data); err == nil && id != 0 {
+		releaseSerialization(id)
+	}
+}
+
+// InstallStructuredClone defines structuredClone on the global object of the
+// context. NewContext calls it for every context except those created for a
+// snapshot, where it is left to the setup function.
+func (c *Context) InstallStructuredClone(ctx context.Context) error {
+	structuredClone := func(in FunctionArgs) (*Value, error) {
+		if data, err := in.Arg(in.ExecutionContext, 0).Serialize(in.ExecutionContext); err != nil {
+			return nil, err
+		} else {
+			defer ReleaseSerialized(data)
+			return in.Context.Deserialize(in.ExecutionContext, data)
+		}
+	}
+
+	if global, err := c.Global(ctx); err != nil {
+		return err
+	} else if fn, err := c.CreateWithName(ctx, "structuredClone", Function(structuredClone)); err != nil {
+		return err
+	} else {
+		return global.SetValue(ctx, "structuredClone", fn)
+	}
+}
+
+//export valueSerializerWriteHostObject
+func valueSerializerWriteHostObject(pIsolate C.Pointer, contextId C.int, serializationId C.uint32_t, object C.CallResult) C.uint32_t {
+	isolate := (*Isolate)(pIsolate)
+
+	contextRef := isolate.contexts.Get(refutils.ID(contextId))
+	s, ok := getSerialization(uint32(serializationId))
+	if contextRef == nil || !ok {
+		return 0
+	}
+	c := contextRef.(*Context)
+
+	ctx := isolate.GetExecutionContext()
+
+	index, _ := isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if value, err := c.newValueFromTuple(ctx, object); err != nil {
+			return uint32(0), nil
+		} else if hostObject, err := c.getHostObjectDelegate().WriteHostObject(ctx, value); err != nil {
+			return uint32(0), nil
+		} else {
+			serializations.Lock()
+			defer serializations.Unlock()
+
+			s.hostObjects = append(s.hostObjects, hostObject)
+			return uint32(len(s.hostObjects)), nil
+		}
+	})
+
+	return C.uint32_t(index.(uint32))
+}
+
+//export valueDeserializerReadHostObject
+func valueDeserializerReadHostObject(pIsolate C.Pointer, contextId C.int, serializationId C.uint32_t, index C.uint32_t) C.CallResult {
+	isolate := (*Isolate)(pIsolate)
+
+	var hostObject any
+	s, ok := getSerialization(uint32(serializationId))
+	if ok {
+		serializations.Lock()
+		if ok = index > 0 && int(index) <= len(s.hostObjects); ok {
+			hostObject = s.hostObjects[index-1]
+		}
+		serializations.Unlock()
+	}
+
+	contextRef := isolate.contexts.Get(refutils.ID(contextId))
+	if !ok || contextRef == nil {
+		return C.v8_CallResult()
+	}
+	c := contextRef.(*Context)
+
+	ctx := isolate.GetExecutionContext()
+
+	r, _ := isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if value, err := c.getHostObjectDelegate().ReadHostObject(ctx, c, hostObject); err != nil || value == nil {
+			return C.v8_CallResult(), nil
+		} else {
+			C.v8_Value_ValueTuple_Retain(value.info)
+
+			result := C.v8_CallResult()
+			result.result = value.info
+			return result, nil
+		}
+	})
+
+	return r.(C.CallResult)
+}
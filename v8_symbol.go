@@ -0,0 +1,61 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"unsafe"
+)
+
+// WellKnownSymbol names one of the symbols V8 exposes as properties of
+// Symbol, for example Symbol.iterator.
+type WellKnownSymbol string
+
+const (
+	SymbolAsyncIterator      WellKnownSymbol = "asyncIterator"
+	SymbolHasInstance        WellKnownSymbol = "hasInstance"
+	SymbolIsConcatSpreadable WellKnownSymbol = "isConcatSpreadable"
+	SymbolIterator           WellKnownSymbol = "iterator"
+	SymbolMatch              WellKnownSymbol = "match"
+	SymbolReplace            WellKnownSymbol = "replace"
+	SymbolSearch             WellKnownSymbol = "search"
+	SymbolSplit              WellKnownSymbol = "split"
+	SymbolToPrimitive        WellKnownSymbol = "toPrimitive"
+	SymbolToStringTag        WellKnownSymbol = "toStringTag"
+	SymbolUnscopables        WellKnownSymbol = "unscopables"
+)
+
+func (c *Context) createSymbol(ctx context.Context, description string, registry bool) (*Value, error) {
+	pd := C.ByteArray{data: C.CString(description), length: C.int(len(description))}
+	defer C.free(unsafe.Pointer(pd.data))
+	return c.createImmediateValue(ctx, C.ImmediateValue{_type: C.tSYMBOL, _data: pd, _bool: C.bool(registry)})
+}
+
+// NewSymbol creates a new unique symbol, as Symbol(description) does.
+func (c *Context) NewSymbol(ctx context.Context, description string) (*Value, error) {
+	return c.createSymbol(ctx, description, false)
+}
+
+// SymbolFor looks up the symbol for key in the global symbol registry,
+// creating it if needed, as Symbol.for(key) does.
+func (c *Context) SymbolFor(ctx context.Context, key string) (*Value, error) {
+	return c.createSymbol(ctx, key, true)
+}
+
+// WellKnownSymbol returns one of the well-known symbols, such as
+// Symbol.iterator. It isn't affected by scripts replacing the global Symbol.
+func (c *Context) WellKnownSymbol(ctx context.Context, name WellKnownSymbol) (*Value, error) {
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		pn := C.CString(string(name))
+		defer C.free(unsafe.Pointer(pn))
+		return c.newValueFromTuple(ctx, C.v8_Context_WellKnownSymbol(c.pointer, pn))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
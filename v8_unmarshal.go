@@ -8,7 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"math/big"
 	"reflect"
 	"time"
 	"unsafe"
@@ -19,6 +19,9 @@ func (v *Value) IsError(ctx context.Context, err error) bool {
 		return false
 	} else {
 		goerr := goerrrv.Interface().(error)
+		if jsErr, ok := goerr.(*JSError); ok && jsErr.cause != nil {
+			return errors.Is(err, jsErr.cause)
+		}
 		return errors.Is(err, goerr)
 	}
 }
@@ -42,21 +45,8 @@ func (v *Value) Unmarshal(ctx context.Context, t reflect.Type) (*reflect.Value,
 			if v.IsNil() {
 				rv := reflect.ValueOf((error)(nil))
 				return &rv, nil
-			} else if v.Receiver(ctx).IsValid() && v.Receiver(ctx).CanConvert(errorType) {
-				rv := v.Receiver(ctx)
-				log.Println(rv)
-				return &rv, nil
-			} else if message, err := v.Get(ctx, "message"); err != nil {
-				if s, err := message.StringValue(ctx); err != nil {
-					return nil, err
-				} else {
-					rv := reflect.ValueOf(errors.New(s))
-					return &rv, nil
-				}
-			} else if s, err := v.StringValue(ctx); err != nil {
-				return nil, err
 			} else {
-				rv := reflect.ValueOf(errors.New(s))
+				rv := reflect.ValueOf(v.newJSError(ctx))
 				return &rv, nil
 			}
 		}
@@ -79,6 +69,35 @@ func (v *Value) Unmarshal(ctx context.Context, t reflect.Type) (*reflect.Value,
 			}
 		}
 
+		if t == sharedArrayBufferType {
+			if b, err := v.SharedArrayBuffer(ctx); err != nil {
+				return nil, err
+			} else {
+				rv := reflect.ValueOf(b)
+				return &rv, nil
+			}
+		}
+
+		if t == bigIntType || t == reflect.PointerTo(bigIntType) {
+			b := new(big.Int)
+			if v.IsKind(KindBigInt) {
+				var err error
+				if b, err = v.BigInt(ctx); err != nil {
+					return nil, err
+				}
+			} else if i, err := v.Int64(ctx); err != nil {
+				return nil, err
+			} else {
+				b.SetInt64(i)
+			}
+
+			rv := reflect.ValueOf(b)
+			if t == bigIntType {
+				rv = rv.Elem()
+			}
+			return &rv, nil
+		}
+
 		switch t.Kind() {
 		case reflect.Bool:
 			if value, err := v.Bool(ctx); err != nil {
@@ -87,7 +106,36 @@ func (v *Value) Unmarshal(ctx context.Context, t reflect.Type) (*reflect.Value,
 				v := reflect.ValueOf(value).Convert(t)
 				return &v, nil
 			}
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.IsKind(KindBigInt) {
+				if value, err := v.bigIntInt64(ctx); err != nil {
+					return nil, err
+				} else if rv := reflect.New(t).Elem(); rv.OverflowInt(value) {
+					return nil, fmt.Errorf("bigint %d overflows %s", value, t)
+				} else {
+					rv.SetInt(value)
+					return &rv, nil
+				}
+			}
+
+			if value, err := v.Int64(ctx); err != nil {
+				return nil, err
+			} else {
+				v := reflect.ValueOf(value).Convert(t)
+				return &v, nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v.IsKind(KindBigInt) {
+				if value, err := v.bigIntUint64(ctx); err != nil {
+					return nil, err
+				} else if rv := reflect.New(t).Elem(); rv.OverflowUint(value) {
+					return nil, fmt.Errorf("bigint %d overflows %s", value, t)
+				} else {
+					rv.SetUint(value)
+					return &rv, nil
+				}
+			}
+
 			if value, err := v.Int64(ctx); err != nil {
 				return nil, err
 			} else {
@@ -95,6 +143,16 @@ func (v *Value) Unmarshal(ctx context.Context, t reflect.Type) (*reflect.Value,
 				return &v, nil
 			}
 		case reflect.Float32, reflect.Float64:
+			if v.IsKind(KindBigInt) {
+				if b, err := v.BigInt(ctx); err != nil {
+					return nil, err
+				} else {
+					f, _ := new(big.Float).SetInt(b).Float64()
+					v := reflect.ValueOf(f).Convert(t)
+					return &v, nil
+				}
+			}
+
 			if value, err := v.Float64(ctx); err != nil {
 				return nil, err
 			} else {
@@ -111,14 +169,26 @@ func (v *Value) Unmarshal(ctx context.Context, t reflect.Type) (*reflect.Value,
 				}
 			}
 
-			if lengthV, err := v.Get(ctx, "length"); err != nil {
+			if kind, ok := typedArrayKinds[t.Elem().Kind()]; ok && t.Kind() == reflect.Slice && v.IsKind(kind) {
+				return v.unmarshalTypedArray(ctx, t)
+			}
+
+			array := v
+			if v.IsKind(KindSet) {
+				var err error
+				if array, err = v.asArray(ctx); err != nil {
+					return nil, err
+				}
+			}
+
+			if lengthV, err := array.Get(ctx, "length"); err != nil {
 				return nil, err
 			} else if length, err := lengthV.Int64(ctx); err != nil {
 				return nil, err
 			} else {
 				rv := reflect.MakeSlice(t, int(length), int(length))
 				for i := 0; int64(i) < length; i++ {
-					if itemV, err := v.GetIndex(ctx, i); err != nil {
+					if itemV, err := array.GetIndex(ctx, i); err != nil {
 						return nil, err
 					} else if itemR, err := itemV.Unmarshal(ctx, t.Elem()); err != nil {
 						return nil, err
@@ -162,6 +232,10 @@ func (v *Value) Unmarshal(ctx context.Context, t reflect.Type) (*reflect.Value,
 				}
 			}
 		case reflect.Map:
+			if v.IsKind(KindMap) || v.IsKind(KindSet) {
+				return v.unmarshalMapOrSet(ctx, t)
+			}
+
 			if keys, err := v.Keys(ctx); err != nil {
 				return nil, err
 			} else {
@@ -266,3 +340,41 @@ func (v *Value) Unmarshal(ctx context.Context, t reflect.Type) (*reflect.Value,
 		return rv.(*reflect.Value), nil
 	}
 }
+
+// unmarshalMapOrSet unmarshals the entries of a JavaScript Map, or the values
+// of a Set as the keys of a map[T]struct{}.
+func (v *Value) unmarshalMapOrSet(ctx context.Context, t reflect.Type) (*reflect.Value, error) {
+	isSet := v.IsKind(KindSet)
+	if isSet && t.Elem() != emptyStructType {
+		return nil, fmt.Errorf("set must be unmarshalled to map[T]struct{}, not %s", t)
+	}
+
+	stride := 2
+	if isSet {
+		stride = 1
+	}
+
+	if array, err := v.asArray(ctx); err != nil {
+		return nil, err
+	} else if length, err := array.GetLength(ctx); err != nil {
+		return nil, err
+	} else {
+		rv := reflect.MakeMapWithSize(t, int(length)/stride)
+		for i := 0; int64(i) < length; i += stride {
+			if keyV, err := array.GetIndex(ctx, i); err != nil {
+				return nil, err
+			} else if keyR, err := keyV.Unmarshal(ctx, t.Key()); err != nil {
+				return nil, err
+			} else if isSet {
+				rv.SetMapIndex(*keyR, reflect.Zero(emptyStructType))
+			} else if itemV, err := array.GetIndex(ctx, i+1); err != nil {
+				return nil, err
+			} else if itemR, err := itemV.Unmarshal(ctx, t.Elem()); err != nil {
+				return nil, err
+			} else {
+				rv.SetMapIndex(*keyR, *itemR)
+			}
+		}
+		return &rv, nil
+	}
+}
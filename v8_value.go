@@ -85,6 +85,10 @@ func (c *Context) newValuesFromTuples(ctx context.Context, r *C.CallResult, n C.
 
 func (c *Context) newValueFromTuple(ctx context.Context, r C.CallResult) (*Value, error) {
 	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if r.isTerminated {
+			return nil, c.isolate.terminationError()
+		}
+
 		if value, err := c.newValue(ctx, r.result), c.isolate.newError(r.error); err != nil {
 			if r.result != nil {
 				C.v8_Value_ValueTuple_Release(c.pointer, r.result)
@@ -92,7 +96,7 @@ func (c *Context) newValueFromTuple(ctx context.Context, r C.CallResult) (*Value
 			return nil, err
 		} else {
 			if r.isError {
-				return nil, value
+				return nil, value.newJSError(ctx)
 			} else {
 				return value, nil
 			}
@@ -134,7 +138,8 @@ func (c *Context) newValue(ctx context.Context, vt C.ValueTuplePtr) *Value {
 			v.context.values++
 			v.refCount++
 
-			runtime.SetFinalizer(v, (*Value).release)
+			runtime.SetFinalizer(v, (*Value).finalize)
+			c.trackSnapshotHandle(valueHandle{v})
 		}
 
 		return v, nil
@@ -270,6 +275,36 @@ func (v *Value) SetIndex(ctx context.Context, i int, value *Value) error {
 	return err
 }
 
+func (v *Value) mapSet(ctx context.Context, key *Value, value *Value) error {
+	_, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, v.context.isolate.newError(C.v8_Map_Set(v.context.pointer, v.pointer, key.pointer, value.pointer))
+	})
+
+	return err
+}
+
+func (v *Value) setAdd(ctx context.Context, value *Value) error {
+	_, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, v.context.isolate.newError(C.v8_Set_Add(v.context.pointer, v.pointer, value.pointer))
+	})
+
+	return err
+}
+
+// asArray returns the entries of a Map flattened to [key, value, ...], or the
+// values of a Set.
+func (v *Value) asArray(ctx context.Context) (*Value, error) {
+	pv, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		return v.context.newValueFromTuple(ctx, C.v8_Value_AsArray(v.context.pointer, v.pointer))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pv.(*Value), nil
+	}
+}
+
 func (v *Value) SetInternalField(ctx context.Context, i int, value uint32) error {
 	_, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		v.context.ref()
@@ -653,6 +688,22 @@ func (v *Value) SetBytes(ctx context.Context, bytes []byte) error {
 	return err
 }
 
+// WithBytes calls fn with the memory of an ArrayBuffer or typed array rather
+// than a copy of it, so that large buffers such as WebAssembly memory can be
+// read and written in place. The slice must not be used after fn returns.
+func (v *Value) WithBytes(ctx context.Context, fn func([]byte) error) error {
+	_, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		b := C.v8_Value_Bytes(v.context.pointer, v.pointer)
+		if b.data == nil {
+			return nil, fn(nil)
+		}
+
+		return nil, fn(unsafe.Slice((*byte)(unsafe.Pointer(b.data)), int(b.length)))
+	})
+
+	return err
+}
+
 func (v *Value) GetByteLength(ctx context.Context) (int, error) {
 	pi, err := v.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
 		bytes := C.v8_Value_ByteLength(v.context.pointer, v.pointer)
@@ -788,7 +839,7 @@ func (v *Value) Await(ctx context.Context) (*Value, error) {
 			return v, nil
 		}
 
-		resolved := make(chan func() (*Value, error))
+		resolved := make(chan func() (*Value, error), 1)
 
 		if then, err := v.Get(ctx, "then"); err != nil {
 			return nil, err
@@ -802,18 +853,7 @@ func (v *Value) Await(ctx context.Context) (*Value, error) {
 			return nil, err
 		} else if reject, err := v.context.Create(ctx, func(in FunctionArgs) (*Value, error) {
 			resolved <- func() (*Value, error) {
-				errValue := in.Arg(in.ExecutionContext, 0)
-				if stackValue, err := errValue.Get(in.ExecutionContext, "stack"); err == nil {
-					if stack, err := stackValue.StringValue(in.ExecutionContext); err != nil {
-						return nil, err
-					} else {
-						return nil, fmt.Errorf(stack)
-					}
-				} else if message, err := errValue.StringValue(in.ExecutionContext); err != nil {
-					return nil, err
-				} else {
-					return nil, fmt.Errorf(message)
-				}
+				return nil, in.Arg(in.ExecutionContext, 0).newJSError(in.ExecutionContext)
 			}
 			close(resolved)
 			return nil, nil
@@ -825,7 +865,12 @@ func (v *Value) Await(ctx context.Context) (*Value, error) {
 					For(ctx).Error(err)
 				}
 			})
-			return (<-resolved)()
+			select {
+			case fn := <-resolved:
+				return fn()
+			case <-ctx.Done():
+				return nil, &ExecutionTerminatedError{ctx.Err()}
+			}
 		}
 	})
 
@@ -989,6 +1034,10 @@ func valueWeakCallbackHandler(pid C.String) {
 	// 	return nil
 }
 
+func (v *Value) finalize() {
+	v.context.isolate.finalize(v.release)
+}
+
 func (v *Value) release() {
 	ctx := v.context.isolate.GetExecutionContext()
 
@@ -996,30 +1045,59 @@ func (v *Value) release() {
 		v.refCount--
 
 		if v.refCount > 0 {
-			runtime.SetFinalizer(v, (*Value).release)
+			// the tuple was retained each time V8 returned the value
+			if v.context.pointer != nil {
+				C.v8_Value_ValueTuple_Release(v.context.pointer, v.info)
+			}
+			runtime.SetFinalizer(v, (*Value).finalize)
 			return nil, nil
-		} else {
-			runtime.SetFinalizer(v, nil)
 		}
 
 		if v.info == nil {
 			panic(fmt.Errorf("overrelease on instance: %s (%s)", v, v.kinds))
 		}
 
-		// tracer.Release(v)
-		v.info.internal = nil
-		C.v8_Value_ValueTuple_Release(v.context.pointer, v.info)
-		v.context.values--
-
-		v.context = nil
-		v.info = nil
-		v.pointer = nil
-		v.kinds = kinds(KindUndefined)
-
+		v.dispose()
 		return nil, nil
 	})
 }
 
+// dispose resets the handle of the value whatever its reference count. It
+// must be called on the isolate's thread.
+func (v *Value) dispose() {
+	runtime.SetFinalizer(v, nil)
+
+	if v.info == nil {
+		return
+	}
+
+	// tracer.Release(v)
+	v.info.internal = nil
+	if v.context.pointer != nil {
+		// release the tuple once for every reference that is still held
+		for n := max(v.refCount, 1); n > 0; n-- {
+			C.v8_Value_ValueTuple_Release(v.context.pointer, v.info)
+		}
+	}
+	v.refCount = 0
+	v.context.values--
+
+	v.context = nil
+	v.info = nil
+	v.pointer = nil
+	v.kinds = kinds(KindUndefined)
+}
+
+// valueHandle disposes of a value that is held by a context being
+// snapshotted.
+type valueHandle struct {
+	value *Value
+}
+
+func (h valueHandle) release() {
+	h.value.dispose()
+}
+
 func (d *PropertyDescriptor) V8Construct(in FunctionArgs) error {
 	return nil
 }
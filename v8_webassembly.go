@@ -0,0 +1,194 @@
+package isolates
+
+//#include "v8_c_bridge.h"
+//#cgo CXXFLAGS: -I/usr/local/include/v8 -std=c++17
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// WasmModule is a compiled WebAssembly module in a context.
+type WasmModule struct {
+	value *Value
+}
+
+// CompiledWasmModule is the compiled code of a WebAssembly module, held by Go
+// so that the module can be created in contexts in any isolate without being
+// compiled again.
+type CompiledWasmModule struct {
+	mutex   sync.Mutex
+	pointer C.CompiledWasmModulePtr
+}
+
+// CompileWasm compiles the WebAssembly binary b, as new WebAssembly.Module
+// does. It fails if the context was created with DisallowWasmCodeGeneration.
+func (c *Context) CompileWasm(ctx context.Context, b []byte) (*WasmModule, error) {
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		var pb *C.char
+		if len(b) > 0 {
+			pb = (*C.char)(unsafe.Pointer(&b[0]))
+		}
+
+		return c.newValueFromTuple(ctx, C.v8_Context_CompileWasm(c.pointer, C.ByteArray{data: pb, length: C.int(len(b))}))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return &WasmModule{pv.(*Value)}, nil
+	}
+}
+
+// NewWasmModule creates a WebAssembly module in the context from code
+// compiled in this or another isolate.
+func (c *Context) NewWasmModule(ctx context.Context, compiled *CompiledWasmModule) (*WasmModule, error) {
+	pv, err := c.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		compiled.mutex.Lock()
+		defer compiled.mutex.Unlock()
+
+		if compiled.pointer == nil {
+			return nil, fmt.Errorf("compiled wasm module released")
+		}
+
+		return c.newValueFromTuple(ctx, C.v8_Context_NewWasmModule(c.pointer, compiled.pointer))
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return &WasmModule{pv.(*Value)}, nil
+	}
+}
+
+// WasmModule returns the WebAssembly.Module the value holds.
+func (v *Value) WasmModule(ctx context.Context) (*WasmModule, error) {
+	if !v.IsKind(KindWebAssemblyCompiledModule) {
+		return nil, fmt.Errorf("value is not a wasm module: %s", v.kinds)
+	}
+
+	return &WasmModule{v}, nil
+}
+
+// Value returns the WebAssembly.Module object, so that it can be passed to
+// JavaScript.
+func (m *WasmModule) Value() *Value {
+	return m.value
+}
+
+// Instantiate creates an instance of the module, as new WebAssembly.Instance
+// does. imports is created in the context with Create, so Go functions can be
+// given as imports, for example map[string]map[string]any{"env": {"log":
+// Function(log)}}. The exported functions of the instance are in its exports
+// property and can be called with Value.Call.
+func (m *WasmModule) Instantiate(ctx context.Context, imports any) (*Value, error) {
+	c := m.value.context
+
+	args := []any{m.value}
+	if imports != nil {
+		if importObject, err := c.Create(ctx, imports); err != nil {
+			return nil, err
+		} else {
+			args = append(args, importObject)
+		}
+	}
+
+	if global, err := c.Global(ctx); err != nil {
+		return nil, err
+	} else if webAssembly, err := global.Get(ctx, "WebAssembly"); err != nil {
+		return nil, err
+	} else if instance, err := webAssembly.Get(ctx, "Instance"); err != nil {
+		return nil, err
+	} else {
+		return instance.New(ctx, args...)
+	}
+}
+
+// Compiled returns the compiled code of the module, which can be cached and
+// used to create the module in other isolates with Context.NewWasmModule.
+func (m *WasmModule) Compiled(ctx context.Context) (*CompiledWasmModule, error) {
+	pc, err := m.value.context.isolate.Sync(ctx, func(ctx context.Context) (interface{}, error) {
+		if pointer := C.v8_Value_CompiledWasmModule(m.value.context.pointer, m.value.pointer); pointer == nil {
+			return nil, fmt.Errorf("value is not a wasm module: %s", m.value.kinds)
+		} else {
+			return newCompiledWasmModule(pointer), nil
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	} else {
+		return pc.(*CompiledWasmModule), nil
+	}
+}
+
+func newCompiledWasmModule(pointer C.CompiledWasmModulePtr) *CompiledWasmModule {
+	m := &CompiledWasmModule{pointer: pointer}
+	runtime.SetFinalizer(m, (*CompiledWasmModule).Release)
+	return m
+}
+
+// WireBytes returns a copy of the WebAssembly binary the module was compiled
+// from.
+func (m *CompiledWasmModule) WireBytes() []byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.pointer == nil {
+		return nil
+	}
+
+	b := C.v8_CompiledWasmModule_WireBytes(m.pointer)
+	return C.GoBytes(unsafe.Pointer(b.data), b.length)
+}
+
+// Release drops Go's reference to the compiled code. It is freed once every
+// module created from it has also been garbage collected.
+func (m *CompiledWasmModule) Release() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.pointer != nil {
+		C.v8_CompiledWasmModule_Release(m.pointer)
+		m.pointer = nil
+		runtime.SetFinalizer(m, nil)
+	}
+}
+
+//export valueSerializerWriteWasmModule
+func valueSerializerWriteWasmModule(serializationId C.uint32_t, compiled C.CompiledWasmModulePtr) C.uint32_t {
+	s, ok := getSerialization(uint32(serializationId))
+	if !ok {
+		C.v8_CompiledWasmModule_Release(compiled)
+		return 0
+	}
+
+	serializations.Lock()
+	defer serializations.Unlock()
+
+	s.wasmModules = append(s.wasmModules, compiled)
+	return C.uint32_t(len(s.wasmModules))
+}
+
+// valueDeserializerReadWasmModule returns the compiled code of a module
+// written by Serialize, which stays owned by the serialization.
+//
+//export valueDeserializerReadWasmModule
+func valueDeserializerReadWasmModule(serializationId C.uint32_t, index C.uint32_t) C.CompiledWasmModulePtr {
+	s, ok := getSerialization(uint32(serializationId))
+	if !ok {
+		return nil
+	}
+
+	serializations.Lock()
+	defer serializations.Unlock()
+
+	if index == 0 || int(index) > len(s.wasmModules) {
+		return nil
+	}
+	return s.wasmModules[index-1]
+}
@@ -0,0 +1,616 @@
+package isolates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	_path "path"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var ErrWorkerFileSystem = errors.New("isolates: workers need a Go file system to be passed to RunWithRuntime")
+var ErrWorkerLimit = errors.New("isolates: too many workers running")
+
+const workerThreadsBootstrap = `(function (spawn, postMessage, terminate, setRef, port) {
+	class EventEmitter {
+		#listeners = {};
+
+		on(type, listener) {
+			(this.#listeners[type] ??= []).push(listener);
+			return this;
+		}
+
+		addListener(type, listener) {
+			return this.on(type, listener);
+		}
+
+		once(type, listener) {
+			const once = (...args) => {
+				this.off(type, once);
+				listener.apply(this, args);
+			};
+			return this.on(type, once);
+		}
+
+		off(type, listener) {
+			const listeners = this.#listeners[type] ?? [];
+			const index = listeners.indexOf(listener);
+			if (index !== -1) {
+				listeners.splice(index, 1);
+			}
+			return this;
+		}
+
+		removeListener(type, listener) {
+			return this.off(type, listener);
+		}
+
+		listenerCount(type) {
+			return (this.#listeners[type] ?? []).length;
+		}
+
+		emit(type, ...args) {
+			const listeners = [...(this.#listeners[type] ?? [])];
+			for (const listener of listeners) {
+				listener.apply(this, args);
+			}
+			return listeners.length > 0;
+		}
+	}
+
+	class Worker extends EventEmitter {
+		#id;
+		#exitCode;
+
+		constructor(filename, options = {}) {
+			super();
+			this.#id = spawn(String(filename), options.workerData, (type, value) => {
+				if (type === 'exit') {
+					this.#exitCode = value;
+				}
+				if (type === 'message' && typeof this.onmessage === 'function') {
+					this.onmessage({ data: value });
+				}
+				if (type === 'error' && typeof this.onerror === 'function') {
+					this.onerror(value);
+				}
+				this.emit(type, value);
+			});
+		}
+
+		get threadId() {
+			return this.#id;
+		}
+
+		postMessage(value) {
+			postMessage(this.#id, value);
+		}
+
+		terminate() {
+			return new Promise((resolve) => {
+				if (this.#exitCode !== undefined) {
+					resolve(this.#exitCode);
+				} else {
+					this.once('exit', resolve);
+					terminate(this.#id);
+				}
+			});
+		}
+
+		ref() {
+			setRef(this.#id, true);
+		}
+
+		unref() {
+			setRef(this.#id, false);
+		}
+	}
+
+	// MessagePort is the worker's end of the channel to its parent. It keeps
+	// the worker alive while it has message listeners, until it is closed.
+	class MessagePort extends EventEmitter {
+		#onmessage = null;
+		#closed = false;
+
+		#update() {
+			port.setRef(!this.#closed && (this.#onmessage !== null || this.listenerCount('message') > 0));
+		}
+
+		on(type, listener) {
+			super.on(type, listener);
+			this.#update();
+			return this;
+		}
+
+		off(type, listener) {
+			super.off(type, listener);
+			this.#update();
+			return this;
+		}
+
+		get onmessage() {
+			return this.#onmessage;
+		}
+
+		set onmessage(listener) {
+			this.#onmessage = typeof listener === 'function' ? listener : null;
+			this.#update();
+		}
+
+		postMessage(value) {
+			port.postMessage(value);
+		}
+
+		close() {
+			this.#closed = true;
+			this.#update();
+		}
+
+		ref() {
+			this.#closed = false;
+			this.#update();
+		}
+
+		unref() {
+			this.close();
+		}
+	}
+
+	const parentPort = port ? new MessagePort() : null;
+
+	return {
+		Worker,
+		parentPort,
+		dispatch(value) {
+			if (parentPort.onmessage) {
+				parentPort.onmessage({ data: value });
+			}
+			parentPort.emit('message', value);
+		},
+	};
+})`
+
+// workerMessage is an event sent between a worker and its parent: a
+// serialized message, the error that stopped the worker or its exit code.
+type workerMessage struct {
+	kind string
+	data []byte
+	err  string
+	code int
+}
+
+// workerQueue delivers messages in order without blocking the sender.
+type workerQueue struct {
+	mutex    sync.Mutex
+	messages []workerMessage
+	signal   chan bool
+	closed   bool
+}
+
+func newWorkerQueue() *workerQueue {
+	return &workerQueue{signal: make(chan bool, 1)}
+}
+
+func (q *workerQueue) push(m workerMessage) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		ReleaseSerialized(m.data)
+		return
+	}
+
+	q.messages = append(q.messages, m)
+	select {
+	case q.signal <- true:
+	default:
+	}
+}
+
+func (q *workerQueue) pop(ctx context.Context) (workerMessage, bool) {
+	for {
+		q.mutex.Lock()
+		if len(q.messages) > 0 {
+			m := q.messages[0]
+			q.messages = q.messages[1:]
+			q.mutex.Unlock()
+			return m, true
+		}
+		q.mutex.Unlock()
+
+		select {
+		case <-q.signal:
+		case <-ctx.Done():
+			return workerMessage{}, false
+		}
+	}
+}
+
+// close releases the messages that haven't been delivered, and any pushed
+// from then on, once their receiver has gone.
+func (q *workerQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, m := range q.messages {
+		ReleaseSerialized(m.data)
+	}
+	q.messages = nil
+	q.closed = true
+}
+
+// worker is a script running in its own isolate on its own goroutine, started
+// with new Worker() from the worker_threads runtime.
+type worker struct {
+	id         int
+	loader     *moduleLoader
+	workerData []byte
+
+	// parent is the context that created the worker and dispatch the
+	// function in it that emits the worker's events.
+	parent   *Context
+	dispatch *Value
+	release  func()
+
+	isolate *Isolate
+	context *Context
+
+	// portDispatch emits messages on parentPort in the worker's context, and
+	// portRelease stops parentPort keeping the worker alive.
+	portDispatch *Value
+	portRelease  func()
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	toWorker *workerQueue
+	toParent *workerQueue
+
+	mutex   sync.Mutex
+	exited  bool
+	failure error
+}
+
+type workerContextKey struct{}
+
+var workers = struct {
+	sync.Mutex
+	nextID int
+	byID   map[int]*worker
+}{byID: map[int]*worker{}}
+
+func getWorker(id int) (*worker, error) {
+	workers.Lock()
+	defer workers.Unlock()
+
+	if w, ok := workers.byID[id]; !ok {
+		return nil, fmt.Errorf("worker %d not found", id)
+	} else {
+		return w, nil
+	}
+}
+
+var _ = RegisterRuntime("worker_threads", "worker_threads", func(in FunctionArgs) (*Value, error) {
+	ctx := in.ExecutionContext
+	c := in.Context
+
+	var module *Module
+	if r, err := c.Receiver(ctx, in.Args[0], reflect.TypeOf(module)); err != nil {
+		return nil, err
+	} else if module, _ = r.Interface().(*Module); module == nil || module.loader == nil {
+		return nil, fmt.Errorf("worker_threads must be required from RunWithRuntime")
+	} else if module.loader.options.MaxWorkers <= 0 {
+		return nil, fmt.Errorf("worker_threads is disabled, set RuntimeOptions.MaxWorkers to enable it")
+	}
+
+	spawn := func(in FunctionArgs) (*Value, error) {
+		if filename, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if workerData, err := in.Arg(in.ExecutionContext, 1).Serialize(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if w, err := c.spawnWorker(in.ExecutionContext, module.loader, filename, workerData, in.Arg(in.ExecutionContext, 2)); err != nil {
+			ReleaseSerialized(workerData)
+			return nil, err
+		} else {
+			return in.Context.Create(in.ExecutionContext, w.id)
+		}
+	}
+
+	postMessage := func(in FunctionArgs) (*Value, error) {
+		if id, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if data, err := in.Arg(in.ExecutionContext, 1).Serialize(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if w, err := getWorker(int(id)); err != nil {
+			ReleaseSerialized(data)
+		} else {
+			w.toWorker.push(workerMessage{kind: "message", data: data})
+		}
+		return nil, nil
+	}
+
+	terminate := func(in FunctionArgs) (*Value, error) {
+		if id, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if w, err := getWorker(int(id)); err == nil {
+			w.cancel()
+		}
+		return nil, nil
+	}
+
+	setRef := func(in FunctionArgs) (*Value, error) {
+		if id, err := in.Arg(in.ExecutionContext, 0).Int64(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if ref, err := in.Arg(in.ExecutionContext, 1).Bool(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if w, err := getWorker(int(id)); err == nil {
+			w.setRef(ref)
+		}
+		return nil, nil
+	}
+
+	var port any
+	w, isWorker := c.data.Load(workerContextKey{})
+	if isWorker {
+		port = w.(*worker).port()
+	}
+
+	if bootstrap, err := c.Run(ctx, workerThreadsBootstrap, "isolates:worker_threads.js", nil); err != nil {
+		return nil, err
+	} else if workerThreads, err := bootstrap.Call(ctx, nil, spawn, postMessage, terminate, setRef, port); err != nil {
+		return nil, err
+	} else if Worker, err := workerThreads.Get(ctx, "Worker"); err != nil {
+		return nil, err
+	} else if parentPort, err := workerThreads.Get(ctx, "parentPort"); err != nil {
+		return nil, err
+	} else if err := in.Args[1].SetValue(ctx, "Worker", Worker); err != nil {
+		return nil, err
+	} else if err := in.Args[1].SetValue(ctx, "parentPort", parentPort); err != nil {
+		return nil, err
+	} else if err := in.Args[1].Set(ctx, "isMainThread", !isWorker); err != nil {
+		return nil, err
+	} else if !isWorker {
+		if err := in.Args[1].Set(ctx, "threadId", 0); err != nil {
+			return nil, err
+		} else if err := in.Args[1].Set(ctx, "workerData", nil); err != nil {
+			return nil, err
+		}
+	} else {
+		w := w.(*worker)
+		if w.portDispatch, err = workerThreads.Get(ctx, "dispatch"); err != nil {
+			return nil, err
+		} else if err := in.Args[1].Set(ctx, "threadId", w.id); err != nil {
+			return nil, err
+		} else if workerData, err := c.Deserialize(ctx, w.workerData); err != nil {
+			return nil, err
+		} else if err := in.Args[1].SetValue(ctx, "workerData", workerData); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+})
+
+func (c *Context) spawnWorker(ctx context.Context, loader *moduleLoader, filename string, workerData []byte, dispatch *Value) (*worker, error) {
+	if _, ok := loader.source.(*Value); ok || loader.source == nil {
+		return nil, ErrWorkerFileSystem
+	}
+
+	if int(loader.options.workers.Add(1)) > loader.options.MaxWorkers {
+		loader.options.workers.Add(-1)
+		return nil, ErrWorkerLimit
+	}
+
+	filename = strings.TrimPrefix(filename, "file://")
+	if !_path.IsAbs(filename) {
+		filename = _path.Join(loader.root, filename)
+	}
+
+	w := &worker{
+		loader:     loader,
+		workerData: workerData,
+		parent:     c,
+		dispatch:   dispatch,
+		release:    c.isolate.KeepAlive(),
+		toWorker:   newWorkerQueue(),
+		toParent:   newWorkerQueue(),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	workers.Lock()
+	workers.nextID++
+	w.id = workers.nextID
+	workers.byID[w.id] = w
+	workers.Unlock()
+
+	go w.run(filename)
+	go w.deliverToParent()
+
+	return w, nil
+}
+
+// run runs the worker's script and event loop, then reports how it exited.
+// Workers that are terminated exit with code 1, as in Node.js.
+func (w *worker) run(filename string) {
+	err := w.start(filename)
+	ReleaseSerialized(w.workerData)
+
+	w.mutex.Lock()
+	if w.failure != nil {
+		err = w.failure
+	} else if w.ctx.Err() != nil {
+		err = nil
+	}
+	w.mutex.Unlock()
+
+	code := 0
+	if err != nil {
+		w.toParent.push(workerMessage{kind: "error", err: err.Error()})
+		code = 1
+	} else if w.ctx.Err() != nil {
+		code = 1
+	}
+
+	w.cancel()
+	if w.isolate != nil {
+		w.isolate.Terminate()
+	}
+	w.toWorker.close()
+	w.loader.options.workers.Add(-1)
+
+	w.toParent.push(workerMessage{kind: "exit", code: code})
+}
+
+func (w *worker) start(filename string) error {
+	w.isolate = NewIsolate()
+	ctx := WithContext(w.ctx)
+
+	env := w.loader.env
+	if env == nil {
+		env = func(RuntimeFunctionArgs) error {
+			return nil
+		}
+	}
+
+	if c, err := w.isolate.NewContext(ctx); err != nil {
+		return err
+	} else {
+		w.context = c
+		c.data.Store(workerContextKey{}, w)
+		c.SetHostObjectDelegate(w.parent.hostObjectDelegate)
+		w.toParent.push(workerMessage{kind: "online"})
+
+		if _, err := c.RunWithRuntime(ctx, w.loader.source, filename, env, w.loader.runtimes, w.loader.options); err != nil {
+			return err
+		}
+
+		go w.deliverToWorker()
+		return w.isolate.Wait(ctx)
+	}
+}
+
+// fail stops the worker with an error thrown by one of its message
+// listeners.
+func (w *worker) fail(err error) {
+	w.mutex.Lock()
+	if w.failure == nil {
+		w.failure = err
+	}
+	w.mutex.Unlock()
+
+	w.cancel()
+}
+
+func (w *worker) deliverToWorker() {
+	for {
+		m, ok := w.toWorker.pop(w.ctx)
+		if !ok {
+			return
+		} else if w.portDispatch == nil {
+			ReleaseSerialized(m.data)
+			continue
+		}
+
+		ctx := withIsolateContext(w.ctx, w.isolate)
+		For(ctx).SetContext(w.context)
+
+		value, err := w.context.Deserialize(ctx, m.data)
+		ReleaseSerialized(m.data)
+
+		if err != nil {
+			w.fail(err)
+		} else if _, err := w.portDispatch.Call(ctx, nil, value); err != nil {
+			w.fail(err)
+		}
+	}
+}
+
+func (w *worker) deliverToParent() {
+	for {
+		m, _ := w.toParent.pop(context.Background())
+
+		ctx := withIsolateContext(context.Background(), w.parent.isolate)
+		For(ctx).SetContext(w.parent)
+
+		var value any
+		switch m.kind {
+		case "message":
+			v, err := w.parent.Deserialize(ctx, m.data)
+			ReleaseSerialized(m.data)
+
+			if err != nil {
+				w.parent.isolate.loop.fail(err)
+				continue
+			} else {
+				value = v
+			}
+		case "error":
+			value = errors.New(m.err)
+		case "exit":
+			value = m.code
+		}
+
+		if _, err := w.dispatch.Call(ctx, nil, m.kind, value); err != nil {
+			w.parent.isolate.loop.fail(err)
+		}
+
+		if m.kind == "exit" {
+			workers.Lock()
+			delete(workers.byID, w.id)
+			workers.Unlock()
+
+			w.toParent.close()
+
+			w.mutex.Lock()
+			w.exited = true
+			w.mutex.Unlock()
+			w.setRef(false)
+			return
+		}
+	}
+}
+
+// setRef sets whether the worker keeps the parent's event loop alive.
+func (w *worker) setRef(ref bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if ref && w.release == nil && !w.exited {
+		w.release = w.parent.isolate.KeepAlive()
+	} else if !ref && w.release != nil {
+		w.release()
+		w.release = nil
+	}
+}
+
+// port returns the functions backing parentPort in the worker's context.
+func (w *worker) port() map[string]any {
+	return map[string]any{
+		"postMessage": func(in FunctionArgs) (*Value, error) {
+			if data, err := in.Arg(in.ExecutionContext, 0).Serialize(in.ExecutionContext); err != nil {
+				return nil, err
+			} else {
+				w.toParent.push(workerMessage{kind: "message", data: data})
+				return nil, nil
+			}
+		},
+		"setRef": func(in FunctionArgs) (*Value, error) {
+			if ref, err := in.Arg(in.ExecutionContext, 0).Bool(in.ExecutionContext); err != nil {
+				return nil, err
+			} else {
+				w.mutex.Lock()
+				defer w.mutex.Unlock()
+
+				if ref && w.portRelease == nil {
+					w.portRelease = w.isolate.KeepAlive()
+				} else if !ref && w.portRelease != nil {
+					w.portRelease()
+					w.portRelease = nil
+				}
+				return nil, nil
+			}
+		},
+	}
+}
@@ -0,0 +1,432 @@
+package wasi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	errIsDir        = errors.New("is a directory")
+	errNotDir       = errors.New("not a directory")
+	errNotEmpty     = errors.New("directory not empty")
+	errNotSupported = errors.New("operation not supported")
+)
+
+// Overlay is a writable file system layered over a read-only fs.FS. Files
+// created or written are kept in memory, and everything else is read from the
+// base file system, which is never modified. Overlay is itself an fs.FS, so
+// the files a module wrote can be read back from Go. Unlike
+// isolates.NewOverlayFS, which layers several read-only file systems, it has a
+// single base and is writable.
+type Overlay struct {
+	base fs.FS
+
+	mutex   sync.Mutex
+	files   map[string]*overlayFile
+	dirs    map[string]time.Time
+	removed map[string]bool
+}
+
+type overlayFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewOverlay returns an Overlay over base, which may be nil for an empty file
+// system.
+func NewOverlay(base fs.FS) *Overlay {
+	return &Overlay{
+		base:    base,
+		files:   map[string]*overlayFile{},
+		dirs:    map[string]time.Time{},
+		removed: map[string]bool{},
+	}
+}
+
+func (o *Overlay) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if info, err := o.statLocked(name); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	} else if info.IsDir() {
+		if entries, err := o.readDirLocked(name); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		} else {
+			return &overlayDir{info: info, entries: entries}, nil
+		}
+	} else if f, ok := o.files[name]; ok {
+		return &overlayReader{info: info, Reader: bytes.NewReader(bytes.Clone(f.data))}, nil
+	} else {
+		return o.base.Open(name)
+	}
+}
+
+func (o *Overlay) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if info, err := o.statLocked(name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	} else {
+		return info, nil
+	}
+}
+
+func (o *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if entries, err := o.readDirLocked(name); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	} else {
+		return entries, nil
+	}
+}
+
+// WriteFile creates or replaces the file name with data. Its directory must
+// exist.
+func (o *Overlay) WriteFile(name string, data []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if f, err := o.openLocked("writefile", name, true, true); err != nil {
+		return err
+	} else {
+		f.data = bytes.Clone(data)
+		return nil
+	}
+}
+
+// Mkdir creates the directory name. Its parent must exist.
+func (o *Overlay) Mkdir(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, err := o.statLocked(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	} else if err := o.checkParentLocked(name); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	o.dirs[name] = time.Now()
+	delete(o.removed, name)
+	return nil
+}
+
+// Remove removes the file or empty directory name.
+func (o *Overlay) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if info, err := o.statLocked(name); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	} else if info.IsDir() {
+		if entries, err := o.readDirLocked(name); err != nil {
+			return &fs.PathError{Op: "remove", Path: name, Err: err}
+		} else if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+		}
+	}
+
+	o.removeLocked(name)
+	return nil
+}
+
+// Rename moves the file oldname to newname, replacing any file there.
+// Directories can't be renamed.
+func (o *Overlay) Rename(oldname, newname string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if info, err := o.statLocked(oldname); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: err}
+	} else if info.IsDir() {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: errNotSupported}
+	} else if f, err := o.openLocked("rename", oldname, false, false); err != nil {
+		return err
+	} else if g, err := o.openLocked("rename", newname, true, true); err != nil {
+		return err
+	} else if oldname != newname {
+		*g = *f
+		o.removeLocked(oldname)
+	}
+
+	return nil
+}
+
+// openFile returns the file name for writing, copying it from the base file
+// system into memory the first time it is written.
+func (o *Overlay) openFile(name string, create, exclusive, truncate bool) (*overlayFile, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if create && exclusive {
+		if _, err := o.statLocked(name); err == nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+	}
+
+	return o.openLocked("open", name, create, truncate)
+}
+
+func (o *Overlay) openLocked(op string, name string, create, truncate bool) (*overlayFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	if f, ok := o.files[name]; ok {
+		if truncate {
+			f.data = nil
+			f.modTime = time.Now()
+		}
+		return f, nil
+	}
+
+	f := &overlayFile{modTime: time.Now()}
+
+	if info, err := o.statLocked(name); err == nil {
+		if info.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errIsDir}
+		} else if !truncate {
+			if f.data, err = fs.ReadFile(o.base, name); err != nil {
+				return nil, err
+			}
+		}
+	} else if !create {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	} else if err := o.checkParentLocked(name); err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	o.files[name] = f
+	delete(o.removed, name)
+	return f, nil
+}
+
+func (o *Overlay) readAt(f *overlayFile, p []byte, offset int64) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, f.data[offset:]), nil
+}
+
+func (o *Overlay) writeAt(f *overlayFile, p []byte, offset int64) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if end := offset + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	f.modTime = time.Now()
+	return copy(f.data[offset:], p), nil
+}
+
+func (o *Overlay) truncate(f *overlayFile, size int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if size < int64(len(f.data)) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.modTime = time.Now()
+}
+
+func (o *Overlay) stat(f *overlayFile) (int64, time.Time) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return int64(len(f.data)), f.modTime
+}
+
+func (o *Overlay) removeLocked(name string) {
+	delete(o.files, name)
+	delete(o.dirs, name)
+	if o.base != nil {
+		if _, err := fs.Stat(o.base, name); err == nil {
+			o.removed[name] = true
+		}
+	}
+}
+
+func (o *Overlay) checkParentLocked(name string) error {
+	if info, err := o.statLocked(path.Dir(name)); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return errNotDir
+	}
+	return nil
+}
+
+func (o *Overlay) statLocked(name string) (fs.FileInfo, error) {
+	if name == "." {
+		return overlayInfo{name: ".", dir: true}, nil
+	} else if o.removed[name] {
+		return nil, fs.ErrNotExist
+	} else if f, ok := o.files[name]; ok {
+		return overlayInfo{name: path.Base(name), size: int64(len(f.data)), modTime: f.modTime}, nil
+	} else if modTime, ok := o.dirs[name]; ok {
+		return overlayInfo{name: path.Base(name), dir: true, modTime: modTime}, nil
+	} else if o.base == nil {
+		return nil, fs.ErrNotExist
+	} else if info, err := fs.Stat(o.base, name); err != nil {
+		return nil, fs.ErrNotExist
+	} else {
+		return info, nil
+	}
+}
+
+func (o *Overlay) readDirLocked(name string) ([]fs.DirEntry, error) {
+	if info, err := o.statLocked(name); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, errNotDir
+	}
+
+	entries := map[string]fs.DirEntry{}
+
+	if _, created := o.dirs[name]; !created && o.base != nil {
+		if base, err := fs.ReadDir(o.base, name); err == nil {
+			for _, entry := range base {
+				if !o.removed[path.Join(name, entry.Name())] {
+					entries[entry.Name()] = entry
+				}
+			}
+		}
+	}
+
+	for p := range o.files {
+		if path.Dir(p) == name {
+			info, _ := o.statLocked(p)
+			entries[path.Base(p)] = fs.FileInfoToDirEntry(info)
+		}
+	}
+	for p := range o.dirs {
+		if path.Dir(p) == name {
+			info, _ := o.statLocked(p)
+			entries[path.Base(p)] = fs.FileInfoToDirEntry(info)
+		}
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		result[i] = entries[name]
+	}
+	return result, nil
+}
+
+type overlayInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (i overlayInfo) Name() string {
+	return i.name
+}
+
+func (i overlayInfo) Size() int64 {
+	return i.size
+}
+
+func (i overlayInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i overlayInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i overlayInfo) IsDir() bool {
+	return i.dir
+}
+
+func (i overlayInfo) Sys() any {
+	return nil
+}
+
+type overlayReader struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (r *overlayReader) Stat() (fs.FileInfo, error) {
+	return r.info, nil
+}
+
+func (r *overlayReader) Close() error {
+	return nil
+}
+
+type overlayDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *overlayDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *overlayDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errIsDir}
+}
+
+func (d *overlayDir) Close() error {
+	return nil
+}
+
+func (d *overlayDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	} else if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,928 @@
+package wasi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type errno uint16
+
+// The subset of WASI errno values the host returns.
+const (
+	errnoSuccess    errno = 0
+	errnoAcces      errno = 2
+	errnoBadf       errno = 8
+	errnoExist      errno = 20
+	errnoFault      errno = 21
+	errnoInval      errno = 28
+	errnoIO         errno = 29
+	errnoIsDir      errno = 31
+	errnoNoent      errno = 44
+	errnoNosys      errno = 52
+	errnoNotDir     errno = 54
+	errnoNotEmpty   errno = 55
+	errnoNotSup     errno = 58
+	errnoROFS       errno = 69
+	errnoSpipe      errno = 70
+	errnoNotCapable errno = 76
+)
+
+const (
+	filetypeCharacterDevice = 2
+	filetypeDirectory       = 3
+	filetypeRegularFile     = 4
+)
+
+const (
+	oflagCreat     = 1 << 0
+	oflagDirectory = 1 << 1
+	oflagExcl      = 1 << 2
+	oflagTrunc     = 1 << 3
+
+	fdflagAppend = 1 << 0
+
+	rightFdSeek  = 1 << 2
+	rightFdTell  = 1 << 5
+	rightFdWrite = 1 << 6
+	rightsAll    = 1<<29 - 1
+
+	whenceSet = 0
+	whenceCur = 1
+	whenceEnd = 2
+
+	clockRealtime  = 0
+	clockMonotonic = 1
+	clockProcess   = 2
+	clockThread    = 3
+
+	eventtypeClock       = 0
+	subclockflagAbstime  = 1 << 0
+	subscriptionSize     = 48
+	eventSize            = 32
+	direntSize           = 24
+	filestatSize         = 64
+	preopenTypeDirectory = 0
+)
+
+func errnoFor(err error) errno {
+	switch {
+	case err == nil:
+		return errnoSuccess
+	case errors.Is(err, fs.ErrNotExist):
+		return errnoNoent
+	case errors.Is(err, fs.ErrExist):
+		return errnoExist
+	case errors.Is(err, fs.ErrPermission):
+		return errnoAcces
+	case errors.Is(err, fs.ErrInvalid):
+		return errnoInval
+	case errors.Is(err, errIsDir):
+		return errnoIsDir
+	case errors.Is(err, errNotDir):
+		return errnoNotDir
+	case errors.Is(err, errNotEmpty):
+		return errnoNotEmpty
+	case errors.Is(err, errNotSupported):
+		return errnoNotSup
+	default:
+		return errnoIO
+	}
+}
+
+// memory is the linear memory of a module. Its accessors report whether the
+// range is in bounds, so that syscalls can return EFAULT.
+type memory []byte
+
+func (m memory) bytes(offset, length uint64) ([]byte, bool) {
+	if offset+length > uint64(len(m)) {
+		return nil, false
+	}
+	return m[offset : offset+length], true
+}
+
+func (m memory) uint32(offset uint64) (uint32, bool) {
+	if b, ok := m.bytes(offset, 4); !ok {
+		return 0, false
+	} else {
+		return binary.LittleEndian.Uint32(b), true
+	}
+}
+
+func (m memory) putUint32(offset uint64, v uint32) bool {
+	if b, ok := m.bytes(offset, 4); !ok {
+		return false
+	} else {
+		binary.LittleEndian.PutUint32(b, v)
+		return true
+	}
+}
+
+func (m memory) putUint64(offset uint64, v uint64) bool {
+	if b, ok := m.bytes(offset, 8); !ok {
+		return false
+	} else {
+		binary.LittleEndian.PutUint64(b, v)
+		return true
+	}
+}
+
+func (m memory) string(offset, length uint64) (string, bool) {
+	if b, ok := m.bytes(offset, length); !ok {
+		return "", false
+	} else {
+		return string(b), true
+	}
+}
+
+// iovecs returns the buffers of an array of iovec structs.
+func (m memory) iovecs(offset, count uint64) ([][]byte, bool) {
+	// count comes from the module, so the array must be in bounds before it
+	// sizes an allocation.
+	if count > uint64(len(m))/8 || offset+count*8 > uint64(len(m)) {
+		return nil, false
+	}
+
+	iovecs := make([][]byte, count)
+	for i := range iovecs {
+		if buf, ok := m.uint32(offset + uint64(i)*8); !ok {
+			return nil, false
+		} else if length, ok := m.uint32(offset + uint64(i)*8 + 4); !ok {
+			return nil, false
+		} else if iovecs[i], ok = m.bytes(uint64(buf), uint64(length)); !ok {
+			return nil, false
+		}
+	}
+	return iovecs, true
+}
+
+// file is an open file descriptor: standard input or output, a directory, a
+// file read from the file system or a file written in the overlay.
+type file struct {
+	path    string
+	dir     bool
+	preopen string
+	entries []fs.DirEntry
+
+	reader io.Reader
+	writer io.Writer
+
+	base    fs.File
+	overlay *Overlay
+	node    *overlayFile
+
+	offset int64
+	append bool
+}
+
+func (f *file) readAt(p []byte, offset int64) (int, error) {
+	if f.reader != nil {
+		return f.reader.Read(p)
+	} else if f.node != nil {
+		return f.overlay.readAt(f.node, p, offset)
+	} else if f.base == nil {
+		return 0, errIsDir
+	} else if r, ok := f.base.(io.ReaderAt); ok {
+		return r.ReadAt(p, offset)
+	} else {
+		return f.base.Read(p)
+	}
+}
+
+func (f *file) writeAt(p []byte, offset int64) (int, error) {
+	if f.writer != nil {
+		return f.writer.Write(p)
+	} else if f.node != nil {
+		return f.overlay.writeAt(f.node, p, offset)
+	} else {
+		return 0, fs.ErrPermission
+	}
+}
+
+func (f *file) size() (int64, error) {
+	if f.node != nil {
+		size, _ := f.overlay.stat(f.node)
+		return size, nil
+	} else if f.base != nil {
+		if info, err := f.base.Stat(); err != nil {
+			return 0, err
+		} else {
+			return info.Size(), nil
+		}
+	}
+	return 0, nil
+}
+
+func (f *file) filetype() uint8 {
+	if f.dir {
+		return filetypeDirectory
+	} else if f.reader != nil || f.writer != nil {
+		return filetypeCharacterDevice
+	}
+	return filetypeRegularFile
+}
+
+type syscall func(w *WASI, ctx context.Context, m memory, args []uint64) errno
+
+// syscalls are the functions of wasi_snapshot_preview1. Those a sandbox has no
+// use for, such as sockets and links, return ENOSYS.
+var syscalls = map[string]syscall{
+	"args_get":                (*WASI).argsGet,
+	"args_sizes_get":          (*WASI).argsSizesGet,
+	"environ_get":             (*WASI).environGet,
+	"environ_sizes_get":       (*WASI).environSizesGet,
+	"clock_res_get":           (*WASI).clockResGet,
+	"clock_time_get":          (*WASI).clockTimeGet,
+	"fd_advise":               (*WASI).nosys,
+	"fd_allocate":             (*WASI).nosys,
+	"fd_close":                (*WASI).fdClose,
+	"fd_datasync":             (*WASI).fdSync,
+	"fd_fdstat_get":           (*WASI).fdFdstatGet,
+	"fd_fdstat_set_flags":     (*WASI).fdFdstatSetFlags,
+	"fd_fdstat_set_rights":    (*WASI).nosys,
+	"fd_filestat_get":         (*WASI).fdFilestatGet,
+	"fd_filestat_set_size":    (*WASI).fdFilestatSetSize,
+	"fd_filestat_set_times":   (*WASI).nosys,
+	"fd_pread":                (*WASI).fdPread,
+	"fd_prestat_get":          (*WASI).fdPrestatGet,
+	"fd_prestat_dir_name":     (*WASI).fdPrestatDirName,
+	"fd_pwrite":               (*WASI).fdPwrite,
+	"fd_read":                 (*WASI).fdRead,
+	"fd_readdir":              (*WASI).fdReaddir,
+	"fd_renumber":             (*WASI).nosys,
+	"fd_seek":                 (*WASI).fdSeek,
+	"fd_sync":                 (*WASI).fdSync,
+	"fd_tell":                 (*WASI).fdTell,
+	"fd_write":                (*WASI).fdWrite,
+	"path_create_directory":   (*WASI).pathCreateDirectory,
+	"path_filestat_get":       (*WASI).pathFilestatGet,
+	"path_filestat_set_times": (*WASI).nosys,
+	"path_link":               (*WASI).nosys,
+	"path_open":               (*WASI).pathOpen,
+	"path_readlink":           (*WASI).nosys,
+	"path_remove_directory":   (*WASI).pathRemoveDirectory,
+	"path_rename":             (*WASI).pathRename,
+	"path_symlink":            (*WASI).nosys,
+	"path_unlink_file":        (*WASI).pathUnlinkFile,
+	"poll_oneoff":             (*WASI).pollOneoff,
+	"proc_exit":               (*WASI).procExit,
+	"proc_raise":              (*WASI).nosys,
+	"random_get":              (*WASI).randomGet,
+	"sched_yield":             (*WASI).schedYield,
+	"sock_accept":             (*WASI).nosys,
+	"sock_recv":               (*WASI).nosys,
+	"sock_send":               (*WASI).nosys,
+	"sock_shutdown":           (*WASI).nosys,
+}
+
+func (w *WASI) nosys(ctx context.Context, m memory, args []uint64) errno {
+	return errnoNosys
+}
+
+// putStrings writes strings as an array of pointers at ptrs to NUL terminated
+// strings at buf, as args_get and environ_get do.
+func putStrings(m memory, values []string, ptrs, buf uint64) errno {
+	for i, s := range values {
+		if !m.putUint32(ptrs+uint64(i)*4, uint32(buf)) {
+			return errnoFault
+		} else if b, ok := m.bytes(buf, uint64(len(s))+1); !ok {
+			return errnoFault
+		} else {
+			copy(b, s)
+			b[len(s)] = 0
+			buf += uint64(len(s)) + 1
+		}
+	}
+	return errnoSuccess
+}
+
+func putStringSizes(m memory, values []string, count, size uint64) errno {
+	n := 0
+	for _, s := range values {
+		n += len(s) + 1
+	}
+
+	if !m.putUint32(count, uint32(len(values))) || !m.putUint32(size, uint32(n)) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) argsGet(ctx context.Context, m memory, args []uint64) errno {
+	return putStrings(m, w.config.Args, args[0], args[1])
+}
+
+func (w *WASI) argsSizesGet(ctx context.Context, m memory, args []uint64) errno {
+	return putStringSizes(m, w.config.Args, args[0], args[1])
+}
+
+func (w *WASI) environGet(ctx context.Context, m memory, args []uint64) errno {
+	return putStrings(m, w.config.Env, args[0], args[1])
+}
+
+func (w *WASI) environSizesGet(ctx context.Context, m memory, args []uint64) errno {
+	return putStringSizes(m, w.config.Env, args[0], args[1])
+}
+
+func (w *WASI) clockResGet(ctx context.Context, m memory, args []uint64) errno {
+	if args[0] > clockThread {
+		return errnoInval
+	} else if !m.putUint64(args[1], uint64(time.Microsecond)) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) now(clock uint64) (uint64, errno) {
+	switch clock {
+	case clockRealtime:
+		return uint64(w.config.Now().UnixNano()), errnoSuccess
+	case clockMonotonic, clockProcess, clockThread:
+		return uint64(w.config.Now().Sub(w.epoch)), errnoSuccess
+	default:
+		return 0, errnoInval
+	}
+}
+
+func (w *WASI) clockTimeGet(ctx context.Context, m memory, args []uint64) errno {
+	if now, errno := w.now(args[0]); errno != errnoSuccess {
+		return errno
+	} else if !m.putUint64(args[2], now) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) fdClose(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	} else {
+		delete(w.files, uint32(args[0]))
+		if f.base != nil {
+			f.base.Close()
+		}
+		return errnoSuccess
+	}
+}
+
+func (w *WASI) fdSync(ctx context.Context, m memory, args []uint64) errno {
+	if _, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) fdFdstatGet(ctx context.Context, m memory, args []uint64) errno {
+	f, ok := w.files[uint32(args[0])]
+	if !ok {
+		return errnoBadf
+	}
+
+	b, ok := m.bytes(args[1], 24)
+	if !ok {
+		return errnoFault
+	}
+
+	// Standard input and output aren't seekable, which is how wasi-libc's
+	// isatty recognizes a terminal.
+	rights := uint64(rightsAll)
+	if f.filetype() == filetypeCharacterDevice {
+		rights &^= rightFdSeek | rightFdTell
+	}
+
+	var flags uint16
+	if f.append {
+		flags |= fdflagAppend
+	}
+
+	clear(b)
+	b[0] = f.filetype()
+	binary.LittleEndian.PutUint16(b[2:], flags)
+	binary.LittleEndian.PutUint64(b[8:], rights)
+	binary.LittleEndian.PutUint64(b[16:], rightsAll)
+	return errnoSuccess
+}
+
+func (w *WASI) fdFdstatSetFlags(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	} else {
+		f.append = args[1]&fdflagAppend != 0
+		return errnoSuccess
+	}
+}
+
+func putFilestat(m memory, offset uint64, filetype uint8, size int64, modTime time.Time) errno {
+	b, ok := m.bytes(offset, filestatSize)
+	if !ok {
+		return errnoFault
+	}
+
+	var mtim uint64
+	if !modTime.IsZero() {
+		mtim = uint64(modTime.UnixNano())
+	}
+
+	clear(b)
+	b[16] = filetype
+	binary.LittleEndian.PutUint64(b[24:], 1)
+	binary.LittleEndian.PutUint64(b[32:], uint64(size))
+	binary.LittleEndian.PutUint64(b[40:], mtim)
+	binary.LittleEndian.PutUint64(b[48:], mtim)
+	binary.LittleEndian.PutUint64(b[56:], mtim)
+	return errnoSuccess
+}
+
+func putFileInfo(m memory, offset uint64, info fs.FileInfo) errno {
+	filetype := uint8(filetypeRegularFile)
+	if info.IsDir() {
+		filetype = filetypeDirectory
+	}
+	return putFilestat(m, offset, filetype, info.Size(), info.ModTime())
+}
+
+func (w *WASI) fdFilestatGet(ctx context.Context, m memory, args []uint64) errno {
+	f, ok := w.files[uint32(args[0])]
+	if !ok {
+		return errnoBadf
+	} else if f.dir {
+		if fsys, errno := w.fileSystem(); errno != errnoSuccess {
+			return errno
+		} else if info, err := fs.Stat(fsys, f.path); err != nil {
+			return errnoFor(err)
+		} else {
+			return putFileInfo(m, args[1], info)
+		}
+	} else if f.filetype() == filetypeCharacterDevice {
+		return putFilestat(m, args[1], filetypeCharacterDevice, 0, time.Time{})
+	} else if f.node != nil {
+		size, modTime := f.overlay.stat(f.node)
+		return putFilestat(m, args[1], filetypeRegularFile, size, modTime)
+	} else if info, err := f.base.Stat(); err != nil {
+		return errnoFor(err)
+	} else {
+		return putFileInfo(m, args[1], info)
+	}
+}
+
+func (w *WASI) fdFilestatSetSize(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	} else if f.node == nil {
+		return errnoInval
+	} else {
+		f.overlay.truncate(f.node, int64(args[1]))
+		return errnoSuccess
+	}
+}
+
+func (w *WASI) fdPrestatGet(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok || f.preopen == "" {
+		return errnoBadf
+	} else if b, ok := m.bytes(args[1], 8); !ok {
+		return errnoFault
+	} else {
+		clear(b)
+		b[0] = preopenTypeDirectory
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(f.preopen)))
+		return errnoSuccess
+	}
+}
+
+func (w *WASI) fdPrestatDirName(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok || f.preopen == "" {
+		return errnoBadf
+	} else if b, ok := m.bytes(args[1], args[2]); !ok {
+		return errnoFault
+	} else {
+		copy(b, f.preopen)
+		return errnoSuccess
+	}
+}
+
+// read fills iovecs from f at offset, stopping at a short read.
+func read(f *file, iovecs [][]byte, offset int64) (int, errno) {
+	n := 0
+	for _, iovec := range iovecs {
+		m, err := f.readAt(iovec, offset+int64(n))
+		n += m
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return n, errnoFor(err)
+		} else if m < len(iovec) {
+			break
+		}
+	}
+	return n, errnoSuccess
+}
+
+func write(f *file, iovecs [][]byte, offset int64) (int, errno) {
+	n := 0
+	for _, iovec := range iovecs {
+		m, err := f.writeAt(iovec, offset+int64(n))
+		n += m
+		if err != nil {
+			return n, errnoFor(err)
+		}
+	}
+	return n, errnoSuccess
+}
+
+func (w *WASI) fdRead(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	} else if iovecs, ok := m.iovecs(args[1], args[2]); !ok {
+		return errnoFault
+	} else if n, errno := read(f, iovecs, f.offset); errno != errnoSuccess {
+		return errno
+	} else if !m.putUint32(args[3], uint32(n)) {
+		return errnoFault
+	} else {
+		f.offset += int64(n)
+		return errnoSuccess
+	}
+}
+
+func (w *WASI) fdPread(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	} else if f.reader != nil {
+		return errnoSpipe
+	} else if iovecs, ok := m.iovecs(args[1], args[2]); !ok {
+		return errnoFault
+	} else if n, errno := read(f, iovecs, int64(args[3])); errno != errnoSuccess {
+		return errno
+	} else if !m.putUint32(args[4], uint32(n)) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) fdWrite(ctx context.Context, m memory, args []uint64) errno {
+	f, ok := w.files[uint32(args[0])]
+	if !ok {
+		return errnoBadf
+	}
+
+	if f.append {
+		if size, err := f.size(); err != nil {
+			return errnoFor(err)
+		} else {
+			f.offset = size
+		}
+	}
+
+	if iovecs, ok := m.iovecs(args[1], args[2]); !ok {
+		return errnoFault
+	} else if n, errno := write(f, iovecs, f.offset); errno != errnoSuccess {
+		return errno
+	} else if !m.putUint32(args[3], uint32(n)) {
+		return errnoFault
+	} else {
+		f.offset += int64(n)
+		return errnoSuccess
+	}
+}
+
+func (w *WASI) fdPwrite(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	} else if f.writer != nil {
+		return errnoSpipe
+	} else if iovecs, ok := m.iovecs(args[1], args[2]); !ok {
+		return errnoFault
+	} else if n, errno := write(f, iovecs, int64(args[3])); errno != errnoSuccess {
+		return errno
+	} else if !m.putUint32(args[4], uint32(n)) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+// fdReaddir writes directory entries from the cookie onwards, truncating the
+// last one if the buffer is full. The cookie of an entry is its index.
+func (w *WASI) fdReaddir(ctx context.Context, m memory, args []uint64) errno {
+	f, ok := w.files[uint32(args[0])]
+	if !ok {
+		return errnoBadf
+	} else if !f.dir {
+		return errnoNotDir
+	}
+
+	if f.entries == nil || args[3] == 0 {
+		if fsys, errno := w.fileSystem(); errno != errnoSuccess {
+			return errno
+		} else if entries, err := fs.ReadDir(fsys, f.path); err != nil {
+			return errnoFor(err)
+		} else {
+			f.entries = entries
+		}
+	}
+
+	buf, ok := m.bytes(args[1], args[2])
+	if !ok {
+		return errnoFault
+	}
+
+	var b []byte
+	for i := args[3]; i < uint64(len(f.entries)) && len(b) < len(buf); i++ {
+		entry := f.entries[i]
+
+		dirent := make([]byte, direntSize)
+		binary.LittleEndian.PutUint64(dirent[0:], i+1)
+		binary.LittleEndian.PutUint32(dirent[16:], uint32(len(entry.Name())))
+		dirent[20] = filetypeRegularFile
+		if entry.IsDir() {
+			dirent[20] = filetypeDirectory
+		}
+
+		b = append(b, dirent...)
+		b = append(b, entry.Name()...)
+	}
+
+	n := copy(buf, b)
+	if !m.putUint32(args[4], uint32(n)) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) fdSeek(ctx context.Context, m memory, args []uint64) errno {
+	f, ok := w.files[uint32(args[0])]
+	if !ok {
+		return errnoBadf
+	} else if f.filetype() == filetypeCharacterDevice {
+		return errnoSpipe
+	} else if f.dir {
+		return errnoIsDir
+	}
+
+	offset := int64(args[1])
+	switch args[2] {
+	case whenceSet:
+	case whenceCur:
+		offset += f.offset
+	case whenceEnd:
+		if size, err := f.size(); err != nil {
+			return errnoFor(err)
+		} else {
+			offset += size
+		}
+	default:
+		return errnoInval
+	}
+
+	if offset < 0 {
+		return errnoInval
+	} else if !m.putUint64(args[3], uint64(offset)) {
+		return errnoFault
+	}
+
+	f.offset = offset
+	return errnoSuccess
+}
+
+func (w *WASI) fdTell(ctx context.Context, m memory, args []uint64) errno {
+	if f, ok := w.files[uint32(args[0])]; !ok {
+		return errnoBadf
+	} else if f.filetype() == filetypeCharacterDevice {
+		return errnoSpipe
+	} else if !m.putUint64(args[1], uint64(f.offset)) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+// resolve returns the path in the file system of a path relative to the
+// directory fd. Paths can't escape the preopened directory.
+func (w *WASI) resolve(m memory, fd, offset, length uint64) (string, errno) {
+	if f, ok := w.files[uint32(fd)]; !ok {
+		return "", errnoBadf
+	} else if !f.dir {
+		return "", errnoNotDir
+	} else if p, ok := m.string(offset, length); !ok {
+		return "", errnoFault
+	} else {
+		p = path.Join(f.path, strings.TrimPrefix(p, "/"))
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return "", errnoNotCapable
+		}
+		return p, errnoSuccess
+	}
+}
+
+func (w *WASI) pathCreateDirectory(ctx context.Context, m memory, args []uint64) errno {
+	if name, errno := w.resolve(m, args[0], args[1], args[2]); errno != errnoSuccess {
+		return errno
+	} else if o, errno := w.overlay(); errno != errnoSuccess {
+		return errno
+	} else {
+		return errnoFor(o.Mkdir(name))
+	}
+}
+
+func (w *WASI) pathFilestatGet(ctx context.Context, m memory, args []uint64) errno {
+	if name, errno := w.resolve(m, args[0], args[2], args[3]); errno != errnoSuccess {
+		return errno
+	} else if fsys, errno := w.fileSystem(); errno != errnoSuccess {
+		return errno
+	} else if info, err := fs.Stat(fsys, name); err != nil {
+		return errnoFor(err)
+	} else {
+		return putFileInfo(m, args[4], info)
+	}
+}
+
+// pathOpen opens files for reading from the file system, and for writing
+// from the overlay, which copies them from the file system on first write.
+func (w *WASI) pathOpen(ctx context.Context, m memory, args []uint64) errno {
+	oflags, rights, fdflags := args[4], args[5], args[7]
+
+	name, errno := w.resolve(m, args[0], args[2], args[3])
+	if errno != errnoSuccess {
+		return errno
+	}
+
+	fsys, errno := w.fileSystem()
+	if errno != errnoSuccess {
+		return errno
+	}
+
+	f := &file{path: name, append: fdflags&fdflagAppend != 0}
+
+	if rights&rightFdWrite != 0 || oflags&(oflagCreat|oflagTrunc) != 0 {
+		if oflags&oflagDirectory != 0 {
+			return errnoIsDir
+		} else if o, errno := w.overlay(); errno != errnoSuccess {
+			return errno
+		} else if node, err := o.openFile(name, oflags&oflagCreat != 0, oflags&oflagExcl != 0, oflags&oflagTrunc != 0); err != nil {
+			return errnoFor(err)
+		} else {
+			f.overlay, f.node = o, node
+		}
+	} else if info, err := fs.Stat(fsys, name); err != nil {
+		return errnoFor(err)
+	} else if info.IsDir() {
+		f.dir = true
+	} else if oflags&oflagDirectory != 0 {
+		return errnoNotDir
+	} else if base, err := fsys.Open(name); err != nil {
+		return errnoFor(err)
+	} else {
+		f.base = base
+	}
+
+	fd := w.nextFD
+	if !m.putUint32(args[8], fd) {
+		if f.base != nil {
+			f.base.Close()
+		}
+		return errnoFault
+	}
+
+	w.files[fd] = f
+	w.nextFD++
+	return errnoSuccess
+}
+
+func (w *WASI) pathRemoveDirectory(ctx context.Context, m memory, args []uint64) errno {
+	if name, errno := w.resolve(m, args[0], args[1], args[2]); errno != errnoSuccess {
+		return errno
+	} else if o, errno := w.overlay(); errno != errnoSuccess {
+		return errno
+	} else if info, err := o.Stat(name); err != nil {
+		return errnoFor(err)
+	} else if !info.IsDir() {
+		return errnoNotDir
+	} else {
+		return errnoFor(o.Remove(name))
+	}
+}
+
+func (w *WASI) pathUnlinkFile(ctx context.Context, m memory, args []uint64) errno {
+	if name, errno := w.resolve(m, args[0], args[1], args[2]); errno != errnoSuccess {
+		return errno
+	} else if o, errno := w.overlay(); errno != errnoSuccess {
+		return errno
+	} else if info, err := o.Stat(name); err != nil {
+		return errnoFor(err)
+	} else if info.IsDir() {
+		return errnoIsDir
+	} else {
+		return errnoFor(o.Remove(name))
+	}
+}
+
+func (w *WASI) pathRename(ctx context.Context, m memory, args []uint64) errno {
+	if oldname, errno := w.resolve(m, args[0], args[1], args[2]); errno != errnoSuccess {
+		return errno
+	} else if newname, errno := w.resolve(m, args[3], args[4], args[5]); errno != errnoSuccess {
+		return errno
+	} else if o, errno := w.overlay(); errno != errnoSuccess {
+		return errno
+	} else {
+		return errnoFor(o.Rename(oldname, newname))
+	}
+}
+
+// pollOneoff sleeps until the earliest clock subscription fires. Files are
+// always ready, so subscriptions to them complete immediately.
+func (w *WASI) pollOneoff(ctx context.Context, m memory, args []uint64) errno {
+	in, out, count := args[0], args[1], args[2]
+	if count == 0 {
+		return errnoInval
+	}
+
+	var events [][]byte
+	var timeout time.Duration = -1
+	var clocks [][]byte
+
+	for i := uint64(0); i < count; i++ {
+		subscription, ok := m.bytes(in+i*subscriptionSize, subscriptionSize)
+		if !ok {
+			return errnoFault
+		}
+
+		event := make([]byte, eventSize)
+		copy(event[0:8], subscription[0:8])
+		event[10] = subscription[8]
+
+		if subscription[8] != eventtypeClock {
+			if _, ok := w.files[binary.LittleEndian.Uint32(subscription[16:])]; !ok {
+				binary.LittleEndian.PutUint16(event[8:], uint16(errnoBadf))
+			}
+			events = append(events, event)
+			continue
+		}
+
+		d := time.Duration(binary.LittleEndian.Uint64(subscription[24:]))
+		if binary.LittleEndian.Uint16(subscription[40:])&subclockflagAbstime != 0 {
+			if now, errno := w.now(uint64(binary.LittleEndian.Uint32(subscription[16:]))); errno != errnoSuccess {
+				binary.LittleEndian.PutUint16(event[8:], uint16(errno))
+				events = append(events, event)
+				continue
+			} else {
+				d -= time.Duration(now)
+			}
+		}
+
+		if timeout < 0 || d < timeout {
+			timeout, clocks = d, nil
+		}
+		if d == timeout {
+			clocks = append(clocks, event)
+		}
+	}
+
+	if len(events) == 0 && timeout > 0 {
+		t := time.NewTimer(timeout)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+	if len(events) == 0 {
+		events = clocks
+	}
+
+	for i, event := range events {
+		if b, ok := m.bytes(out+uint64(i)*eventSize, eventSize); !ok {
+			return errnoFault
+		} else {
+			copy(b, event)
+		}
+	}
+
+	if !m.putUint32(args[3], uint32(len(events))) {
+		return errnoFault
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) procExit(ctx context.Context, m memory, args []uint64) errno {
+	w.exited = true
+	w.exitCode = uint32(args[0])
+	return errnoSuccess
+}
+
+func (w *WASI) randomGet(ctx context.Context, m memory, args []uint64) errno {
+	if b, ok := m.bytes(args[0], args[1]); !ok {
+		return errnoFault
+	} else if _, err := io.ReadFull(w.config.Rand, b); err != nil {
+		return errnoIO
+	}
+	return errnoSuccess
+}
+
+func (w *WASI) schedYield(ctx context.Context, m memory, args []uint64) errno {
+	runtime.Gosched()
+	return errnoSuccess
+}
@@ -0,0 +1,235 @@
+// Package wasi implements WASI preview1 (wasi_snapshot_preview1) for
+// WebAssembly modules instantiated in an isolates.Context. Files are served
+// from an fs.FS, which modules can also write to when it is an Overlay.
+//
+//	w := wasi.New(wasi.Config{
+//		Args:   []string{"tool", "-v"},
+//		FS:     wasi.NewOverlay(os.DirFS("data")),
+//		Stdout: os.Stdout,
+//	})
+//	module, _ := context.CompileWasm(ctx, binary)
+//	instance, _ := module.Instantiate(ctx, w.Imports())
+//	code, err := w.Start(ctx, instance)
+package wasi
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/grexie/isolates"
+)
+
+// Module is the name WASI preview1 functions are imported from.
+const Module = "wasi_snapshot_preview1"
+
+// Config is the environment a module runs in. The zero value runs a module
+// with no arguments, environment or files, discarding its output.
+type Config struct {
+	// Args are the command line arguments, starting with the program name.
+	Args []string
+
+	// Env is the environment, as KEY=value pairs.
+	Env []string
+
+	// FS is preopened as the directory "/". Modules can only create, write and
+	// remove files when it is an *Overlay.
+	FS fs.FS
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Now returns the time for the realtime and monotonic clocks. It defaults
+	// to time.Now.
+	Now func() time.Time
+
+	// Rand is the source of random_get. It defaults to crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// WASI holds the state of one module instance: its memory, open files and
+// exit code.
+type WASI struct {
+	config Config
+	epoch  time.Time
+	memory *isolates.Value
+
+	files  map[uint32]*file
+	nextFD uint32
+
+	exited   bool
+	exitCode uint32
+}
+
+// ExitError is thrown into the module by proc_exit to unwind it.
+type ExitError struct {
+	Code uint32
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("wasi: exit status %d", e.Code)
+}
+
+func New(config Config) *WASI {
+	if config.Stdin == nil {
+		config.Stdin = eofReader{}
+	}
+	if config.Stdout == nil {
+		config.Stdout = io.Discard
+	}
+	if config.Stderr == nil {
+		config.Stderr = io.Discard
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.Rand == nil {
+		config.Rand = rand.Reader
+	}
+
+	w := &WASI{
+		config: config,
+		epoch:  config.Now(),
+		files: map[uint32]*file{
+			0: {reader: config.Stdin},
+			1: {writer: config.Stdout},
+			2: {writer: config.Stderr},
+		},
+		nextFD: 3,
+	}
+
+	if config.FS != nil {
+		w.files[w.nextFD] = &file{path: ".", dir: true, preopen: "/"}
+		w.nextFD++
+	}
+
+	return w
+}
+
+// Imports returns the import object for WasmModule.Instantiate. Modules that
+// import their own host functions as well can add their namespaces to it.
+func (w *WASI) Imports() map[string]any {
+	functions := map[string]any{}
+	for name, fn := range syscalls {
+		functions[name] = w.function(fn)
+	}
+	return map[string]any{Module: functions}
+}
+
+// Start runs a command module instantiated with Imports by calling its _start
+// export. It returns the code the module passed to proc_exit, or 0 if _start
+// returned.
+func (w *WASI) Start(ctx context.Context, instance *isolates.Value) (int, error) {
+	if exports, err := w.bind(ctx, instance); err != nil {
+		return 0, err
+	} else if start, err := exports.Get(ctx, "_start"); err != nil {
+		return 0, err
+	} else if !start.IsKind(isolates.KindFunction) {
+		return 0, errors.New("wasi: module does not export _start")
+	} else if _, err := start.Call(ctx, nil); err != nil && !w.exited {
+		return 0, err
+	}
+
+	return int(w.exitCode), nil
+}
+
+// Initialize prepares a reactor module instantiated with Imports by calling
+// its _initialize export, if any, after which its other exports can be
+// called.
+func (w *WASI) Initialize(ctx context.Context, instance *isolates.Value) error {
+	if exports, err := w.bind(ctx, instance); err != nil {
+		return err
+	} else if initialize, err := exports.Get(ctx, "_initialize"); err != nil {
+		return err
+	} else if initialize.IsKind(isolates.KindFunction) {
+		if _, err := initialize.Call(ctx, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *WASI) bind(ctx context.Context, instance *isolates.Value) (*isolates.Value, error) {
+	if exports, err := instance.Get(ctx, "exports"); err != nil {
+		return nil, err
+	} else if memory, err := exports.Get(ctx, "memory"); err != nil {
+		return nil, err
+	} else if memory.IsNil() {
+		return nil, errors.New("wasi: module does not export memory")
+	} else {
+		w.memory = memory
+		return exports, nil
+	}
+}
+
+// function adapts a syscall to a JavaScript function. i32 arguments arrive as
+// numbers and i64 arguments as BigInts, and both are passed to the syscall as
+// their unsigned bits. The module's memory is read from its buffer on every
+// call, as growing memory replaces the buffer.
+func (w *WASI) function(fn syscall) isolates.Function {
+	return func(in isolates.FunctionArgs) (*isolates.Value, error) {
+		ctx := in.ExecutionContext
+
+		// Syscalls take at most 9 arguments. Missing ones are zero rather than
+		// out of range if a module imports a syscall with the wrong signature.
+		args := make([]uint64, max(len(in.Args), 9))
+		for i, arg := range in.Args {
+			if arg.IsKind(isolates.KindBigInt) {
+				if n, err := arg.BigInt(ctx); err != nil {
+					return nil, err
+				} else {
+					args[i] = uint64(n.Int64())
+				}
+			} else if n, err := arg.Int64(ctx); err != nil {
+				return nil, err
+			} else {
+				args[i] = uint64(uint32(n))
+			}
+		}
+
+		if w.memory == nil {
+			return nil, errors.New("wasi: Start or Initialize has not been called")
+		}
+
+		var result errno
+		if buffer, err := w.memory.Get(ctx, "buffer"); err != nil {
+			return nil, err
+		} else if err := buffer.WithBytes(ctx, func(b []byte) error {
+			result = fn(w, ctx, memory(b), args)
+			return nil
+		}); err != nil {
+			return nil, err
+		} else if w.exited {
+			return nil, &ExitError{w.exitCode}
+		} else {
+			return in.Context.Create(ctx, int32(result))
+		}
+	}
+}
+
+func (w *WASI) fileSystem() (fs.FS, errno) {
+	if w.config.FS == nil {
+		return nil, errnoNotCapable
+	}
+	return w.config.FS, errnoSuccess
+}
+
+func (w *WASI) overlay() (*Overlay, errno) {
+	if o, ok := w.config.FS.(*Overlay); !ok {
+		return nil, errnoROFS
+	} else {
+		return o, errnoSuccess
+	}
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
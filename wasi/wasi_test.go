@@ -0,0 +1,482 @@
+package wasi
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/fs"
+	"math/big"
+	"os"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/grexie/isolates"
+)
+
+func TestMain(m *testing.M) {
+	isolates.Initialize()
+	os.Exit(m.Run())
+}
+
+// testHello writes "hello\n" to stdout with fd_write and exits with status 7.
+var testHello = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32, i32, i32, i32) -> i32, (i32) -> (), () -> ()
+	0x01, 0x10, 0x03,
+	0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f,
+	0x60, 0x01, 0x7f, 0x00,
+	0x60, 0x00, 0x00,
+	// imports: fd_write, proc_exit
+	0x02, 0x46, 0x02,
+	0x16, 'w', 'a', 's', 'i', '_', 's', 'n', 'a', 'p', 's', 'h', 'o', 't', '_', 'p', 'r', 'e', 'v', 'i', 'e', 'w', '1',
+	0x08, 'f', 'd', '_', 'w', 'r', 'i', 't', 'e', 0x00, 0x00,
+	0x16, 'w', 'a', 's', 'i', '_', 's', 'n', 'a', 'p', 's', 'h', 'o', 't', '_', 'p', 'r', 'e', 'v', 'i', 'e', 'w', '1',
+	0x09, 'p', 'r', 'o', 'c', '_', 'e', 'x', 'i', 't', 0x00, 0x01,
+	// functions, memory and exports: memory, _start
+	0x03, 0x02, 0x01, 0x02,
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x13, 0x02,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x02,
+	// _start: fd_write(1, 0, 1, 16); proc_exit(7)
+	0x0a, 0x13, 0x01, 0x11, 0x00,
+	0x41, 0x01, 0x41, 0x00, 0x41, 0x01, 0x41, 0x10, 0x10, 0x00, 0x1a,
+	0x41, 0x07, 0x10, 0x01, 0x0b,
+	// data: an iovec at 0 for "hello\n" at 8
+	0x0b, 0x14, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x0e,
+	0x08, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00,
+	'h', 'e', 'l', 'l', 'o', '\n',
+}
+
+func TestStart(t *testing.T) {
+	ctx := isolates.WithContext(context.Background())
+	i := isolates.NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	w := New(Config{Stdout: &stdout})
+
+	if module, err := c.CompileWasm(ctx, testHello); err != nil {
+		t.Fatal(err)
+	} else if instance, err := module.Instantiate(ctx, w.Imports()); err != nil {
+		t.Fatal(err)
+	} else if code, err := w.Start(ctx, instance); err != nil {
+		t.Fatal(err)
+	} else if code != 7 {
+		t.Errorf("invalid exit code: %d", code)
+	} else if stdout.String() != "hello\n" {
+		t.Errorf("invalid stdout: %q", stdout.String())
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	o := NewOverlay(fstest.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"dir/b.txt": {Data: []byte("b")},
+	})
+
+	if err := o.WriteFile("dir/c.txt", []byte("c")); err != nil {
+		t.Fatal(err)
+	} else if err := o.Remove("a.txt"); err != nil {
+		t.Fatal(err)
+	} else if err := o.Mkdir("new"); err != nil {
+		t.Fatal(err)
+	} else if err := o.Rename("dir/b.txt", "new/b.txt"); err != nil {
+		t.Fatal(err)
+	} else if err := o.WriteFile("missing/d.txt", nil); err == nil {
+		t.Error("expected writing to a missing directory to fail")
+	} else if err := o.Remove("new"); err == nil {
+		t.Error("expected removing a non-empty directory to fail")
+	}
+
+	if err := fstest.TestFS(o, "dir/c.txt", "new/b.txt"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := fs.Stat(o, "a.txt"); err == nil {
+		t.Error("expected a.txt to be removed")
+	} else if b, err := fs.ReadFile(o, "new/b.txt"); err != nil {
+		t.Error(err)
+	} else if string(b) != "b" {
+		t.Errorf("invalid new/b.txt: %q", b)
+	}
+}
+
+// testSignatures are the parameters of the syscalls testModule exports, as
+// wasm value types. All of them return an i32 errno.
+var testSignatures = map[string][]byte{
+	"args_get":          {0x7f, 0x7f},
+	"args_sizes_get":    {0x7f, 0x7f},
+	"environ_get":       {0x7f, 0x7f},
+	"environ_sizes_get": {0x7f, 0x7f},
+	"clock_time_get":    {0x7f, 0x7e, 0x7f},
+	"random_get":        {0x7f, 0x7f},
+	"path_open":         {0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7e, 0x7e, 0x7f, 0x7f},
+	"fd_read":           {0x7f, 0x7f, 0x7f, 0x7f},
+	"fd_write":          {0x7f, 0x7f, 0x7f, 0x7f},
+	"fd_readdir":        {0x7f, 0x7f, 0x7f, 0x7e, 0x7f},
+	"fd_close":          {0x7f},
+}
+
+func uleb128(n uint64) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		if n >>= 7; n != 0 {
+			b = append(b, c|0x80)
+		} else {
+			return append(b, c)
+		}
+	}
+}
+
+func wasmName(name string) []byte {
+	return append(uleb128(uint64(len(name))), name...)
+}
+
+func wasmVector(items [][]byte) []byte {
+	b := uleb128(uint64(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func wasmSection(id byte, content []byte) []byte {
+	return append(append([]byte{id}, uleb128(uint64(len(content)))...), content...)
+}
+
+// testModule assembles a module exporting a page of memory and, for each of
+// names, a function that passes its arguments to the imported syscall, so
+// that tests can make syscalls as a module would.
+func testModule(names ...string) []byte {
+	var types, imports, functions, exports, code [][]byte
+
+	exports = append(exports, append(wasmName("memory"), 0x02, 0x00))
+	for i, name := range names {
+		params := testSignatures[name]
+		functype := append([]byte{0x60}, uleb128(uint64(len(params)))...)
+		types = append(types, append(append(functype, params...), 0x01, 0x7f))
+		imports = append(imports, append(append(wasmName(Module), wasmName(name)...), 0x00, byte(i)))
+		functions = append(functions, []byte{byte(i)})
+		exports = append(exports, append(wasmName(name), 0x00, byte(len(names)+i)))
+
+		body := []byte{0x00}
+		for j := range params {
+			body = append(body, 0x20, byte(j))
+		}
+		body = append(body, 0x10, byte(i), 0x0b)
+		code = append(code, append(uleb128(uint64(len(body))), body...))
+	}
+
+	b := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	b = append(b, wasmSection(0x01, wasmVector(types))...)
+	b = append(b, wasmSection(0x02, wasmVector(imports))...)
+	b = append(b, wasmSection(0x03, wasmVector(functions))...)
+	b = append(b, wasmSection(0x05, []byte{0x01, 0x00, 0x01})...)
+	b = append(b, wasmSection(0x07, wasmVector(exports))...)
+	b = append(b, wasmSection(0x0a, wasmVector(code))...)
+	return b
+}
+
+// testInstance is an instance of testModule initialized with a WASI.
+type testInstance struct {
+	t       *testing.T
+	ctx     context.Context
+	exports *isolates.Value
+}
+
+func newTestInstance(t *testing.T, w *WASI) *testInstance {
+	t.Helper()
+
+	ctx := isolates.WithContext(context.Background())
+	i := isolates.NewIsolate()
+	t.Cleanup(i.Terminate)
+
+	names := make([]string, 0, len(testSignatures))
+	for name := range testSignatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Fatal(err)
+	} else if module, err := c.CompileWasm(ctx, testModule(names...)); err != nil {
+		t.Fatal(err)
+	} else if instance, err := module.Instantiate(ctx, w.Imports()); err != nil {
+		t.Fatal(err)
+	} else if err := w.Initialize(ctx, instance); err != nil {
+		t.Fatal(err)
+	} else if exports, err := instance.Get(ctx, "exports"); err != nil {
+		t.Fatal(err)
+	} else {
+		return &testInstance{t, ctx, exports}
+	}
+	return nil
+}
+
+// call calls a syscall through the module. i64 arguments are *big.Int.
+func (ti *testInstance) call(name string, args ...any) errno {
+	ti.t.Helper()
+
+	if fn, err := ti.exports.Get(ti.ctx, name); err != nil {
+		ti.t.Fatal(err)
+	} else if result, err := fn.Call(ti.ctx, nil, args...); err != nil {
+		ti.t.Fatal(err)
+	} else if n, err := result.Int64(ti.ctx); err != nil {
+		ti.t.Fatal(err)
+	} else {
+		return errno(n)
+	}
+	return 0
+}
+
+// memory calls fn with the module's memory.
+func (ti *testInstance) memory(fn func(b []byte)) {
+	ti.t.Helper()
+
+	if memory, err := ti.exports.Get(ti.ctx, "memory"); err != nil {
+		ti.t.Fatal(err)
+	} else if buffer, err := memory.Get(ti.ctx, "buffer"); err != nil {
+		ti.t.Fatal(err)
+	} else if err := buffer.WithBytes(ti.ctx, func(b []byte) error {
+		fn(b)
+		return nil
+	}); err != nil {
+		ti.t.Fatal(err)
+	}
+}
+
+func (ti *testInstance) read(offset, length int) []byte {
+	var b []byte
+	ti.memory(func(m []byte) {
+		b = append(b, m[offset:offset+length]...)
+	})
+	return b
+}
+
+func (ti *testInstance) write(offset int, b []byte) {
+	ti.memory(func(m []byte) {
+		copy(m[offset:], b)
+	})
+}
+
+func (ti *testInstance) uint32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(ti.read(offset, 4))
+}
+
+func (ti *testInstance) uint64(offset int) uint64 {
+	return binary.LittleEndian.Uint64(ti.read(offset, 8))
+}
+
+// open opens name relative to the preopened directory with path_open and
+// returns its fd.
+func (ti *testInstance) open(name string, oflags int, rights int64) (uint32, errno) {
+	ti.t.Helper()
+
+	ti.write(1024, []byte(name))
+	errno := ti.call("path_open", 3, 0, 1024, len(name), oflags, big.NewInt(rights), big.NewInt(0), 0, 0)
+	return ti.uint32(0), errno
+}
+
+func TestArgsAndEnviron(t *testing.T) {
+	ti := newTestInstance(t, New(Config{
+		Args: []string{"tool", "-v"},
+		Env:  []string{"A=1", "B=two"},
+	}))
+
+	tests := []struct {
+		sizes, get string
+		count      uint32
+		data       string
+	}{
+		{"args_sizes_get", "args_get", 2, "tool\x00-v\x00"},
+		{"environ_sizes_get", "environ_get", 2, "A=1\x00B=two\x00"},
+	}
+
+	for _, test := range tests {
+		if errno := ti.call(test.sizes, 0, 4); errno != errnoSuccess {
+			t.Fatalf("%s: errno %d", test.sizes, errno)
+		} else if count, size := ti.uint32(0), ti.uint32(4); count != test.count || size != uint32(len(test.data)) {
+			t.Errorf("%s: invalid sizes %d, %d", test.sizes, count, size)
+		}
+
+		if errno := ti.call(test.get, 16, 64); errno != errnoSuccess {
+			t.Fatalf("%s: errno %d", test.get, errno)
+		} else if data := string(ti.read(64, len(test.data))); data != test.data {
+			t.Errorf("%s: invalid data %q", test.get, data)
+		} else if first, second := ti.uint32(16), ti.uint32(20); first != 64 || int(second) != 64+bytes.IndexByte([]byte(test.data), 0)+1 {
+			t.Errorf("%s: invalid pointers %d, %d", test.get, first, second)
+		}
+	}
+
+	if errno := ti.call("args_get", 65536, 0); errno != errnoFault {
+		t.Errorf("expected EFAULT for pointers out of bounds, got %d", errno)
+	}
+}
+
+func TestClockAndRandom(t *testing.T) {
+	now := time.Unix(1000, 5)
+	w := New(Config{
+		Now:  func() time.Time { return now },
+		Rand: bytes.NewReader([]byte{1, 2, 3, 4}),
+	})
+	now = now.Add(3 * time.Second)
+	ti := newTestInstance(t, w)
+
+	if errno := ti.call("clock_time_get", clockRealtime, big.NewInt(1), 0); errno != errnoSuccess {
+		t.Fatalf("realtime: errno %d", errno)
+	} else if realtime := ti.uint64(0); realtime != uint64(now.UnixNano()) {
+		t.Errorf("invalid realtime: %d", realtime)
+	}
+
+	if errno := ti.call("clock_time_get", clockMonotonic, big.NewInt(1), 0); errno != errnoSuccess {
+		t.Fatalf("monotonic: errno %d", errno)
+	} else if monotonic := ti.uint64(0); monotonic != uint64(3*time.Second) {
+		t.Errorf("invalid monotonic: %d", monotonic)
+	}
+
+	if errno := ti.call("clock_time_get", 9, big.NewInt(1), 0); errno != errnoInval {
+		t.Errorf("expected EINVAL for an invalid clock, got %d", errno)
+	}
+
+	if errno := ti.call("random_get", 32, 4); errno != errnoSuccess {
+		t.Fatalf("random_get: errno %d", errno)
+	} else if b := ti.read(32, 4); !bytes.Equal(b, []byte{1, 2, 3, 4}) {
+		t.Errorf("invalid random bytes: %v", b)
+	} else if errno := ti.call("random_get", 32, 4); errno != errnoIO {
+		t.Errorf("expected EIO once the source is exhausted, got %d", errno)
+	}
+}
+
+func TestPathOpen(t *testing.T) {
+	ti := newTestInstance(t, New(Config{
+		FS: fstest.MapFS{
+			"dir/a.txt": {Data: []byte("hello")},
+			"dir/b.txt": {Data: []byte("bee")},
+		},
+	}))
+
+	fd, errno := ti.open("dir/a.txt", 0, 0)
+	if errno != errnoSuccess {
+		t.Fatalf("path_open: errno %d", errno)
+	}
+
+	// an iovec at 64 for 16 bytes at 128
+	iovec := make([]byte, 8)
+	binary.LittleEndian.PutUint32(iovec[0:], 128)
+	binary.LittleEndian.PutUint32(iovec[4:], 16)
+	ti.write(64, iovec)
+
+	if errno := ti.call("fd_read", fd, 64, 1, 8); errno != errnoSuccess {
+		t.Fatalf("fd_read: errno %d", errno)
+	} else if n := ti.uint32(8); n != 5 {
+		t.Errorf("invalid read length: %d", n)
+	} else if data := string(ti.read(128, 5)); data != "hello" {
+		t.Errorf("invalid data: %q", data)
+	} else if errno := ti.call("fd_read", fd, 64, 1, 8); errno != errnoSuccess || ti.uint32(8) != 0 {
+		t.Errorf("expected EOF, got errno %d, length %d", errno, ti.uint32(8))
+	} else if errno := ti.call("fd_read", fd, 64, 1<<30, 8); errno != errnoFault {
+		t.Errorf("expected EFAULT for an iovec count out of bounds, got %d", errno)
+	} else if errno := ti.call("fd_close", fd); errno != errnoSuccess {
+		t.Errorf("fd_close: errno %d", errno)
+	}
+
+	for _, name := range []string{"../x", "dir/../../x", "/../x"} {
+		if _, errno := ti.open(name, 0, 0); errno != errnoNotCapable {
+			t.Errorf("%s: expected ENOTCAPABLE, got %d", name, errno)
+		}
+	}
+
+	if _, errno := ti.open("dir/missing.txt", 0, 0); errno != errnoNoent {
+		t.Errorf("expected ENOENT, got %d", errno)
+	} else if _, errno := ti.open("dir/a.txt", oflagDirectory, 0); errno != errnoNotDir {
+		t.Errorf("expected ENOTDIR, got %d", errno)
+	} else if _, errno := ti.open("dir/c.txt", oflagCreat, rightFdWrite); errno != errnoROFS {
+		t.Errorf("expected EROFS without an overlay, got %d", errno)
+	}
+}
+
+func TestReaddir(t *testing.T) {
+	ti := newTestInstance(t, New(Config{
+		FS: fstest.MapFS{
+			"dir/a.txt":     {Data: []byte("a")},
+			"dir/sub/b.txt": {Data: []byte("b")},
+		},
+	}))
+
+	fd, errno := ti.open("dir", oflagDirectory, 0)
+	if errno != errnoSuccess {
+		t.Fatalf("path_open: errno %d", errno)
+	} else if errno := ti.call("fd_readdir", fd, 128, 512, big.NewInt(0), 0); errno != errnoSuccess {
+		t.Fatalf("fd_readdir: errno %d", errno)
+	}
+
+	var entries []string
+	buf := ti.read(128, int(ti.uint32(0)))
+	for len(buf) >= direntSize {
+		length := int(binary.LittleEndian.Uint32(buf[16:]))
+		filetype := "f"
+		if buf[20] == filetypeDirectory {
+			filetype = "d"
+		}
+		entries = append(entries, filetype+":"+string(buf[direntSize:direntSize+length]))
+		buf = buf[direntSize+length:]
+	}
+
+	if len(entries) != 2 || entries[0] != "f:a.txt" || entries[1] != "d:sub" {
+		t.Errorf("invalid entries: %v", entries)
+	}
+
+	// resuming from the cookie of the first entry
+	if errno := ti.call("fd_readdir", fd, 128, 512, big.NewInt(1), 0); errno != errnoSuccess {
+		t.Fatalf("fd_readdir: errno %d", errno)
+	} else if n := ti.uint32(0); n != direntSize+3 {
+		t.Errorf("invalid length resuming from the cookie: %d", n)
+	}
+}
+
+func TestOverlayWrite(t *testing.T) {
+	base := fstest.MapFS{"dir/a.txt": {Data: []byte("a")}}
+	overlay := NewOverlay(base)
+	ti := newTestInstance(t, New(Config{FS: overlay}))
+
+	fd, errno := ti.open("dir/b.txt", oflagCreat, rightFdWrite)
+	if errno != errnoSuccess {
+		t.Fatalf("path_open: errno %d", errno)
+	}
+
+	// an iovec at 64 for "written" at 128
+	iovec := make([]byte, 8)
+	binary.LittleEndian.PutUint32(iovec[0:], 128)
+	binary.LittleEndian.PutUint32(iovec[4:], 7)
+	ti.write(64, iovec)
+	ti.write(128, []byte("written"))
+
+	if errno := ti.call("fd_write", fd, 64, 1, 8); errno != errnoSuccess {
+		t.Fatalf("fd_write: errno %d", errno)
+	} else if n := ti.uint32(8); n != 7 {
+		t.Errorf("invalid write length: %d", n)
+	} else if errno := ti.call("fd_close", fd); errno != errnoSuccess {
+		t.Errorf("fd_close: errno %d", errno)
+	}
+
+	if b, err := fs.ReadFile(overlay, "dir/b.txt"); err != nil {
+		t.Error(err)
+	} else if string(b) != "written" {
+		t.Errorf("invalid dir/b.txt: %q", b)
+	} else if _, ok := base["dir/b.txt"]; ok {
+		t.Error("expected the base file system to be unchanged")
+	}
+
+	if _, errno := ti.open("dir/a.txt", oflagCreat|oflagExcl, rightFdWrite); errno != errnoExist {
+		t.Errorf("expected EEXIST, got %d", errno)
+	}
+}
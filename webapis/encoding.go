@@ -0,0 +1,257 @@
+package webapis
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var errInvalidData = errors.New("The encoded data was not valid")
+
+// encodingLabels maps the labels TextDecoder accepts to the names of the
+// encodings they are for.
+var encodingLabels = map[string]string{
+	"unicode-1-1-utf-8": "utf-8",
+	"unicode11utf8":     "utf-8",
+	"unicode20utf8":     "utf-8",
+	"utf-8":             "utf-8",
+	"utf8":              "utf-8",
+	"x-unicode20utf8":   "utf-8",
+	"csunicode":         "utf-16le",
+	"iso-10646-ucs-2":   "utf-16le",
+	"ucs-2":             "utf-16le",
+	"unicode":           "utf-16le",
+	"unicodefeff":       "utf-16le",
+	"utf-16":            "utf-16le",
+	"utf-16le":          "utf-16le",
+	"unicodefffe":       "utf-16be",
+	"utf-16be":          "utf-16be",
+}
+
+// encodingForLabel returns the name of the encoding for a label, or "" if
+// the label is unknown or for an encoding that isn't supported.
+func encodingForLabel(label string) string {
+	return encodingLabels[strings.ToLower(strings.Trim(label, "\t\n\f\r "))]
+}
+
+// decode decodes data in an encoding returned by encodingForLabel. When
+// stream is true, the bytes of a character split at the end of data aren't
+// decoded, and their count is returned so they can be decoded with the next
+// chunk. Errors are replaced by U+FFFD unless fatal is true.
+func decode(data []byte, encoding string, fatal bool, stream bool) (string, int, error) {
+	switch encoding {
+	case "utf-16le":
+		return decodeUTF16(data, false, fatal, stream)
+	case "utf-16be":
+		return decodeUTF16(data, true, fatal, stream)
+	default:
+		return decodeUTF8(data, fatal, stream)
+	}
+}
+
+// decodeUTF8 decodes UTF-8 as the Encoding Standard does, replacing each
+// maximal subpart of an invalid sequence with a single U+FFFD.
+func decodeUTF8(data []byte, fatal bool, stream bool) (string, int, error) {
+	var b strings.Builder
+	b.Grow(len(data))
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		if c < 0x80 {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+
+		needed, lower, upper := 0, byte(0x80), byte(0xbf)
+		switch {
+		case c >= 0xc2 && c <= 0xdf:
+			needed = 1
+		case c >= 0xe0 && c <= 0xef:
+			needed = 2
+			if c == 0xe0 {
+				lower = 0xa0
+			} else if c == 0xed {
+				upper = 0x9f
+			}
+		case c >= 0xf0 && c <= 0xf4:
+			needed = 3
+			if c == 0xf0 {
+				lower = 0x90
+			} else if c == 0xf4 {
+				upper = 0x8f
+			}
+		default:
+			if fatal {
+				return "", 0, errInvalidData
+			}
+			b.WriteRune(utf8.RuneError)
+			i++
+			continue
+		}
+
+		j := i + 1
+		for ; j <= i+needed; j++ {
+			if j == len(data) {
+				if stream {
+					return b.String(), len(data) - i, nil
+				}
+				break
+			} else if data[j] < lower || data[j] > upper {
+				break
+			}
+			lower, upper = 0x80, 0xbf
+		}
+
+		if j == i+needed+1 {
+			b.Write(data[i:j])
+		} else if fatal {
+			return "", 0, errInvalidData
+		} else {
+			b.WriteRune(utf8.RuneError)
+		}
+		i = j
+	}
+
+	return b.String(), 0, nil
+}
+
+// decodeUTF8WithoutBOM decodes UTF-8, replacing errors with U+FFFD and
+// keeping a leading byte order mark.
+func decodeUTF8WithoutBOM(data []byte) string {
+	s, _, _ := decodeUTF8(data, false, false)
+	return s
+}
+
+// decodeUTF16 decodes UTF-16 as the Encoding Standard does, replacing
+// unpaired surrogates with U+FFFD.
+func decodeUTF16(data []byte, bigEndian bool, fatal bool, stream bool) (string, int, error) {
+	var b strings.Builder
+	b.Grow(len(data))
+
+	unit := func(i int) uint16 {
+		if bigEndian {
+			return uint16(data[i])<<8 | uint16(data[i+1])
+		}
+		return uint16(data[i+1])<<8 | uint16(data[i])
+	}
+
+	replace := func() error {
+		if fatal {
+			return errInvalidData
+		}
+		b.WriteRune(utf8.RuneError)
+		return nil
+	}
+
+	i := 0
+	for ; i+1 < len(data); i += 2 {
+		u := unit(i)
+		switch {
+		case utf16.IsSurrogate(rune(u)) && u < 0xdc00:
+			if i+3 < len(data) {
+				if next := unit(i + 2); next >= 0xdc00 && next <= 0xdfff {
+					b.WriteRune(utf16.DecodeRune(rune(u), rune(next)))
+					i += 2
+				} else if err := replace(); err != nil {
+					return "", 0, err
+				}
+			} else if stream {
+				return b.String(), len(data) - i, nil
+			} else {
+				// an unpaired lead surrogate and a trailing odd byte are a
+				// single error
+				if err := replace(); err != nil {
+					return "", 0, err
+				}
+				return b.String(), 0, nil
+			}
+		case utf16.IsSurrogate(rune(u)):
+			if err := replace(); err != nil {
+				return "", 0, err
+			}
+		default:
+			b.WriteRune(rune(u))
+		}
+	}
+
+	if i < len(data) {
+		if stream {
+			return b.String(), len(data) - i, nil
+		} else if err := replace(); err != nil {
+			return "", 0, err
+		}
+	}
+
+	return b.String(), 0, nil
+}
+
+// encodeInto writes as many whole characters of s as fit into dst as UTF-8,
+// returning the number of UTF-16 code units read from s and bytes written.
+func encodeInto(s string, dst []byte) (read int, written int) {
+	for _, r := range s {
+		n := utf8.RuneLen(r)
+		if written+n > len(dst) {
+			break
+		}
+		utf8.EncodeRune(dst[written:], r)
+		written += n
+		read += len(utf16.Encode([]rune{r}))
+	}
+	return read, written
+}
+
+// forgivingBase64Decode decodes base64 as atob does, ignoring ASCII
+// whitespace and optional padding.
+func forgivingBase64Decode(s string) ([]byte, bool) {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune("\t\n\f\r ", r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	if len(s)%4 == 0 {
+		if strings.HasSuffix(s, "==") {
+			s = s[:len(s)-2]
+		} else if strings.HasSuffix(s, "=") {
+			s = s[:len(s)-1]
+		}
+	}
+
+	if len(s)%4 == 1 {
+		return nil, false
+	}
+	for _, r := range s {
+		if !isASCIIAlphanumeric(r) && r != '+' && r != '/' {
+			return nil, false
+		}
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(s)
+	return data, err == nil
+}
+
+// latin1 returns the bytes of s if every character of it is at most U+00FF.
+func latin1(s string) ([]byte, bool) {
+	data := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, false
+		}
+		data = append(data, byte(r))
+	}
+	return data, true
+}
+
+// fromLatin1 returns the string of the characters U+0000 to U+00FF with the
+// code points of data.
+func fromLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
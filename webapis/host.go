@@ -0,0 +1,168 @@
+package webapis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// parseHost parses the host of a URL, as net/url has decoded it. Domains of
+// special URLs are mapped and encoded with the UTS #46 processing of the
+// idna.Lookup profile, and hosts of other URLs are left for net/url to
+// percent-encode.
+func parseHost(input string, isNotSpecial bool) (string, error) {
+	if isNotSpecial {
+		if strings.ContainsFunc(input, isForbiddenHostCodePoint) {
+			return "", errInvalidURL
+		}
+		return input, nil
+	} else if !utf8.ValidString(input) {
+		return "", errInvalidURL
+	}
+
+	domain, err := idna.Lookup.ToASCII(input)
+	if err != nil || domain == "" {
+		return "", errInvalidURL
+	} else if strings.ContainsFunc(domain, isForbiddenDomainCodePoint) {
+		return "", errInvalidURL
+	} else if endsInANumber(domain) {
+		return parseIPv4(domain)
+	}
+
+	return domain, nil
+}
+
+func isForbiddenHostCodePoint(c rune) bool {
+	return c == 0 || strings.ContainsRune("\t\n\r #/:<>?@[\\]^|", c)
+}
+
+func isForbiddenDomainCodePoint(c rune) bool {
+	return isForbiddenHostCodePoint(c) || c <= 0x1f || c == '%' || c == 0x7f
+}
+
+func endsInANumber(domain string) bool {
+	parts := strings.Split(domain, ".")
+	if parts[len(parts)-1] == "" {
+		if len(parts) == 1 {
+			return false
+		}
+		parts = parts[:len(parts)-1]
+	}
+
+	last := parts[len(parts)-1]
+	if last != "" && !strings.ContainsFunc(last, func(r rune) bool { return !isASCIIDigit(r) }) {
+		return true
+	}
+	_, err := parseIPv4Number(last)
+	return err == nil
+}
+
+func parseIPv4Number(s string) (uint64, error) {
+	if s == "" {
+		return 0, errInvalidURL
+	}
+
+	radix := 10
+	if len(s) >= 2 && (s[:2] == "0x" || s[:2] == "0X") {
+		s, radix = s[2:], 16
+	} else if len(s) >= 2 && s[0] == '0' {
+		s, radix = s[1:], 8
+	}
+
+	if s == "" {
+		return 0, nil
+	} else if n, err := strconv.ParseUint(s, radix, 64); errors.Is(err, strconv.ErrRange) {
+		return math.MaxUint64, nil
+	} else if err != nil {
+		return 0, errInvalidURL
+	} else {
+		return n, nil
+	}
+}
+
+func parseIPv4(s string) (string, error) {
+	parts := strings.Split(s, ".")
+	if parts[len(parts)-1] == "" && len(parts) > 1 {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > 4 {
+		return "", errInvalidURL
+	}
+
+	numbers := make([]uint64, len(parts))
+	for i, part := range parts {
+		if n, err := parseIPv4Number(part); err != nil {
+			return "", err
+		} else if n > 255 && i < len(parts)-1 {
+			return "", errInvalidURL
+		} else {
+			numbers[i] = n
+		}
+	}
+
+	ipv4 := numbers[len(numbers)-1]
+	if ipv4 >= 1<<(8*(5-len(numbers))) {
+		return "", errInvalidURL
+	}
+	for i, n := range numbers[:len(numbers)-1] {
+		ipv4 += n << (8 * (3 - i))
+	}
+
+	return fmt.Sprintf("%d.%d.%d.%d", ipv4>>24, ipv4>>16&0xff, ipv4>>8&0xff, ipv4&0xff), nil
+}
+
+// parseIPv6 parses an IPv6 address with net/netip, and serializes it with
+// the longest run of zero pieces compressed and no embedded IPv4 address.
+func parseIPv6(s string) (string, error) {
+	if strings.Contains(s, "%") {
+		return "", errInvalidURL
+	}
+
+	address, err := netip.ParseAddr(s)
+	if err != nil || !address.Is6() {
+		return "", errInvalidURL
+	}
+
+	bytes := address.As16()
+	var pieces [8]uint16
+	for i := range pieces {
+		pieces[i] = uint16(bytes[i*2])<<8 | uint16(bytes[i*2+1])
+	}
+
+	compress, longest := -1, 1
+	for i := 0; i < len(pieces); {
+		j := i
+		for j < len(pieces) && pieces[j] == 0 {
+			j++
+		}
+		if j-i > longest {
+			compress, longest = i, j-i
+		}
+		i = j + 1
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(pieces); i++ {
+		if i == compress {
+			if i == 0 {
+				b.WriteString("::")
+			} else {
+				b.WriteString(":")
+			}
+			i += longest - 1
+			continue
+		}
+		b.WriteString(strconv.FormatUint(uint64(pieces[i]), 16))
+		if i < len(pieces)-1 {
+			b.WriteString(":")
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,633 @@
+package webapis
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var errInvalidURL = errors.New("Invalid URL")
+
+var specialSchemes = map[string]string{
+	"ftp":   "21",
+	"file":  "",
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+func isSpecial(scheme string) bool {
+	_, ok := specialSchemes[scheme]
+	return ok
+}
+
+// parseURL parses input against an optional base URL with net/url. The input
+// is first brought to the form the WHATWG URL Standard reads it in: tabs and
+// newlines are removed, backslashes in special URLs are slashes, and the
+// characters browsers percent-encode are encoded. The hosts and ports of the
+// result are then normalized as browsers serialize them.
+func parseURL(input string, base *url.URL) (*url.URL, error) {
+	input = strings.TrimFunc(input, func(r rune) bool {
+		return r <= ' '
+	})
+	input = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, input)
+
+	scheme, rest, ok := cutScheme(input)
+	relative := !ok
+	if relative {
+		if base == nil {
+			return nil, errInvalidURL
+		} else if base.Opaque != "" {
+			// only a fragment can be resolved against a URL with an opaque
+			// path, as in "mailto:x"
+			if !strings.HasPrefix(input, "#") {
+				return nil, errInvalidURL
+			}
+			u := *base
+			u.Fragment, u.RawFragment = unescapeFragment(input[1:])
+			return &u, nil
+		}
+		scheme, rest = base.Scheme, input
+	}
+
+	special := isSpecial(scheme)
+	if special {
+		rest = slashBackslashes(rest)
+	}
+
+	if !relative && special && base != nil && base.Scheme == scheme && !strings.HasPrefix(rest, "//") {
+		// "http:x" is relative to an http base URL
+		relative = true
+	} else if relative && strings.HasPrefix(rest, "//") {
+		// only the scheme is taken from the base URL of "//host/x"
+		relative = false
+	}
+
+	if !relative && special && scheme != "file" {
+		// special URLs have a host, however many slashes precede it
+		rest = "//" + strings.TrimLeft(rest, "/")
+	} else if !relative && scheme == "file" && !strings.HasPrefix(rest, "//") {
+		rest = "///" + strings.TrimLeft(rest, "/")
+	} else if relative && rest != "" && !strings.ContainsRune("/?#", rune(rest[0])) {
+		// keeps a colon in the first segment from being read as a scheme
+		rest = "./" + rest
+	}
+
+	opaque := !relative && !special && !strings.HasPrefix(rest, "/")
+	rest = escapeURL(rest, special, opaque)
+
+	var u *url.URL
+	if relative {
+		ref, err := url.Parse(rest)
+		if err != nil {
+			return nil, errInvalidURL
+		}
+		u = base.ResolveReference(ref)
+		if ref.Fragment == "" {
+			u.Fragment, u.RawFragment = "", ""
+		}
+		// keeps "sc:/x" from being serialized with an empty host
+		u.OmitHost = base.OmitHost
+	} else if parsed, err := url.Parse(scheme + ":" + rest); err != nil {
+		return nil, errInvalidURL
+	} else {
+		// removes the dot segments of the path
+		u = parsed.ResolveReference(parsed)
+	}
+
+	if err := normalizeURL(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// cutScheme returns the scheme of input, lowercased, and the rest of it.
+func cutScheme(input string) (string, string, bool) {
+	for i, c := range input {
+		if c == ':' && i > 0 {
+			return strings.ToLower(input[:i]), input[i+1:], true
+		} else if !isASCIIAlpha(c) && (i == 0 || (!isASCIIDigit(c) && c != '+' && c != '-' && c != '.')) {
+			break
+		}
+	}
+	return "", input, false
+}
+
+// slashBackslashes replaces the backslashes before the query and fragment of
+// s with slashes.
+func slashBackslashes(s string) string {
+	end := strings.IndexAny(s, "?#")
+	if end == -1 {
+		end = len(s)
+	}
+	return strings.ReplaceAll(s[:end], `\`, "/") + s[end:]
+}
+
+// escapeURL percent-encodes the parts of a URL without its scheme as
+// browsers do, and the percent signs net/url would reject as invalid escapes.
+func escapeURL(s string, special bool, opaque bool) string {
+	s, fragment, hasFragment := strings.Cut(s, "#")
+	s, query, hasQuery := strings.Cut(s, "?")
+
+	var b strings.Builder
+	if strings.HasPrefix(s, "//") {
+		end := strings.IndexByte(s[2:], '/')
+		if end == -1 {
+			end = len(s) - 2
+		}
+		authority := s[2 : end+2]
+		s = s[end+2:]
+
+		b.WriteString("//")
+		if at := strings.LastIndexByte(authority, '@'); at != -1 {
+			username, password, hasPassword := strings.Cut(authority[:at], ":")
+			b.WriteString(escapePercents(percentEncodeString(username, inUserinfoSet)))
+			if hasPassword {
+				b.WriteString(":" + escapePercents(percentEncodeString(password, inUserinfoSet)))
+			}
+			b.WriteString("@")
+			authority = authority[at+1:]
+		}
+		b.WriteString(authority)
+	}
+
+	if opaque {
+		b.WriteString(percentEncodeString(s, inC0ControlSet))
+	} else {
+		segments := strings.Split(s, "/")
+		for i, segment := range segments {
+			// net/url only removes the dot segments that aren't encoded
+			switch strings.ToLower(segment) {
+			case "%2e":
+				segments[i] = "."
+			case ".%2e", "%2e.", "%2e%2e":
+				segments[i] = ".."
+			}
+		}
+		b.WriteString(escapePercents(percentEncodeString(strings.Join(segments, "/"), inPathSet)))
+	}
+
+	if hasQuery {
+		set := inQuerySet
+		if special {
+			set = inSpecialQuerySet
+		}
+		b.WriteString("?" + percentEncodeString(query, set))
+	}
+	if hasFragment {
+		b.WriteString("#" + escapePercents(percentEncodeString(fragment, inFragmentSet)))
+	}
+
+	return b.String()
+}
+
+// escapePercents encodes the percent signs of s that aren't followed by two
+// hex digits.
+func escapePercents(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && !(i+2 < len(s) && isASCIIHexDigit(rune(s[i+1])) && isASCIIHexDigit(rune(s[i+2]))) {
+			b.WriteString("%25")
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func unescapeFragment(s string) (string, string) {
+	escaped := escapePercents(percentEncodeString(s, inFragmentSet))
+	fragment, _ := url.PathUnescape(escaped)
+	return fragment, escaped
+}
+
+// normalizeURL checks the host and port of u and serializes them as browsers
+// do, and gives special URLs a path.
+func normalizeURL(u *url.URL) error {
+	special := isSpecial(u.Scheme)
+
+	if u.User != nil && u.Host == "" {
+		return errInvalidURL
+	} else if u.User != nil {
+		// credentials are only serialized when they aren't empty
+		username := u.User.Username()
+		if password, _ := u.User.Password(); password != "" {
+			u.User = url.UserPassword(username, password)
+		} else if username != "" {
+			u.User = url.User(username)
+		} else {
+			u.User = nil
+		}
+	}
+
+	if u.Host == "" {
+		if special && u.Scheme != "file" {
+			return errInvalidURL
+		}
+	} else {
+		hostname, port := u.Hostname(), u.Port()
+		if hostname == "" || (u.Scheme == "file" && (port != "" || strings.HasSuffix(u.Host, ":") || u.User != nil)) {
+			return errInvalidURL
+		}
+
+		var host string
+		var err error
+		if strings.HasPrefix(u.Host, "[") {
+			host, err = parseIPv6(hostname)
+			host = "[" + host + "]"
+		} else {
+			host, err = parseHost(hostname, !special)
+		}
+		if err != nil {
+			return err
+		} else if u.Scheme == "file" && host == "localhost" {
+			host = ""
+		}
+
+		if port != "" {
+			if n, err := strconv.Atoi(port); err != nil || n > 65535 {
+				return errInvalidURL
+			} else if port = strconv.Itoa(n); port == specialSchemes[u.Scheme] {
+				port = ""
+			}
+		}
+
+		u.Host = host
+		if port != "" {
+			u.Host += ":" + port
+		}
+	}
+
+	if special && u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+
+	return nil
+}
+
+func cannotHaveUsernamePasswordPort(u *url.URL) bool {
+	return u.Host == "" || u.Scheme == "file"
+}
+
+func userinfo(u *url.URL) (string, string) {
+	if u.User == nil {
+		return "", ""
+	}
+	username, password, _ := strings.Cut(u.User.String(), ":")
+	return username, password
+}
+
+func hostname(u *url.URL) string {
+	if strings.HasPrefix(u.Host, "[") {
+		return u.Host[:strings.IndexByte(u.Host, ']')+1]
+	}
+	hostname, _, _ := strings.Cut(u.Host, ":")
+	return hostname
+}
+
+func pathname(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.EscapedPath()
+}
+
+func origin(u *url.URL) string {
+	switch u.Scheme {
+	case "http", "https", "ws", "wss", "ftp":
+		return u.Scheme + "://" + u.Host
+	case "blob":
+		if inner, err := parseURL(pathname(u), nil); err == nil && (inner.Scheme == "http" || inner.Scheme == "https") {
+			return origin(inner)
+		}
+	}
+	return "null"
+}
+
+// getURL returns a component of u as the URL attribute of the same name
+// does.
+func getURL(u *url.URL, name string) string {
+	switch name {
+	case "href":
+		return u.String()
+	case "origin":
+		return origin(u)
+	case "protocol":
+		return u.Scheme + ":"
+	case "username":
+		username, _ := userinfo(u)
+		return username
+	case "password":
+		_, password := userinfo(u)
+		return password
+	case "host":
+		// net/url holds the hosts of non-special URLs decoded
+		return percentEncodeString(u.Host, inC0ControlSet)
+	case "hostname":
+		return percentEncodeString(hostname(u), inC0ControlSet)
+	case "port":
+		return u.Port()
+	case "pathname":
+		return pathname(u)
+	case "search":
+		if u.RawQuery == "" {
+			return ""
+		}
+		return "?" + u.RawQuery
+	case "hash":
+		if u.Fragment == "" {
+			return ""
+		}
+		return "#" + u.EscapedFragment()
+	default:
+		return ""
+	}
+}
+
+// setURL sets a component of u as the URL attribute setter of the same name
+// does, by parsing the URL with the component replaced. Invalid values are
+// ignored, except for href.
+func setURL(u *url.URL, name string, value string) error {
+	special := isSpecial(u.Scheme)
+	replaced := *u
+
+	if name != "username" && name != "password" {
+		value = strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return -1
+			}
+			return r
+		}, value)
+	}
+
+	switch name {
+	case "href":
+		if parsed, err := parseURL(value, nil); err != nil {
+			return err
+		} else {
+			*u = *parsed
+		}
+		return nil
+
+	case "protocol":
+		scheme, _, _ := strings.Cut(value, ":")
+		if s, _, ok := cutScheme(scheme + ":"); !ok || isSpecial(s) != special {
+			return nil
+		} else if s == "file" && (u.User != nil || u.Port() != "") {
+			return nil
+		} else if u.Scheme == "file" && u.Host == "" {
+			return nil
+		} else {
+			replaced.Scheme = s
+		}
+
+	case "username", "password":
+		if cannotHaveUsernamePasswordPort(u) {
+			return nil
+		}
+		username, password := "", ""
+		if u.User != nil {
+			username = u.User.Username()
+			password, _ = u.User.Password()
+		}
+		// net/url holds credentials decoded
+		value, _ = url.PathUnescape(escapePercents(value))
+		if name == "username" {
+			username = value
+		} else {
+			password = value
+		}
+		replaced.User = url.UserPassword(username, password)
+
+	case "host", "hostname":
+		if u.Opaque != "" {
+			return nil
+		}
+		if special {
+			value = slashBackslashes(value)
+		}
+		if end := strings.IndexAny(value, "/?#"); end != -1 {
+			value = value[:end]
+		}
+
+		host, port := value, ""
+		if end := strings.LastIndexByte(value, ':'); end != -1 && !strings.HasSuffix(value, "]") {
+			if name == "hostname" {
+				return nil
+			}
+			host, port = value[:end], value[end+1:]
+			if end := strings.IndexFunc(port, func(r rune) bool { return !isASCIIDigit(r) }); end != -1 {
+				port = port[:end]
+			}
+		}
+		if port == "" {
+			port = u.Port()
+		}
+
+		if host == "" && special && u.Scheme != "file" {
+			return nil
+		} else if decoded, err := url.PathUnescape(host); err == nil {
+			// net/url holds hosts decoded
+			host = decoded
+		}
+		replaced.Host = host
+		if port != "" {
+			replaced.Host += ":" + port
+		}
+
+	case "port":
+		if cannotHaveUsernamePasswordPort(u) {
+			return nil
+		}
+		end := strings.IndexFunc(value, func(r rune) bool { return !isASCIIDigit(r) })
+		if end == -1 {
+			end = len(value)
+		}
+		if end == 0 && value != "" {
+			return nil
+		}
+		replaced.Host = hostname(u)
+		if end > 0 {
+			replaced.Host += ":" + value[:end]
+		}
+
+	case "pathname":
+		if u.Opaque != "" {
+			return nil
+		}
+		if special {
+			value = strings.ReplaceAll(value, `\`, "/")
+		}
+		value = strings.NewReplacer("?", "%3F", "#", "%23").Replace(value)
+		if (value != "" || special || u.OmitHost) && !strings.HasPrefix(value, "/") {
+			value = "/" + value
+		}
+		replaced.RawPath = escapePercents(percentEncodeString(value, inPathSet))
+		replaced.Path, _ = url.PathUnescape(replaced.RawPath)
+
+	case "search":
+		query := strings.TrimPrefix(value, "?")
+		set := inQuerySet
+		if special {
+			set = inSpecialQuerySet
+		}
+		replaced.RawQuery = percentEncodeString(query, set)
+		replaced.ForceQuery = value != "" && query == ""
+		if value == "" {
+			stripTrailingSpacesFromOpaquePath(&replaced)
+		}
+
+	case "hash":
+		replaced.Fragment, replaced.RawFragment = unescapeFragment(strings.TrimPrefix(value, "#"))
+		if value == "" {
+			stripTrailingSpacesFromOpaquePath(&replaced)
+		}
+
+	default:
+		return nil
+	}
+
+	if parsed, err := parseURL(replaced.String(), nil); err == nil {
+		*u = *parsed
+	}
+	return nil
+}
+
+func stripTrailingSpacesFromOpaquePath(u *url.URL) {
+	if u.Opaque != "" && u.Fragment == "" && u.RawQuery == "" {
+		u.Opaque = strings.TrimRight(u.Opaque, " ")
+	}
+}
+
+func isASCIIAlpha(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isASCIIHexDigit(c rune) bool {
+	return isASCIIDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isASCIIAlphanumeric(c rune) bool {
+	return isASCIIAlpha(c) || isASCIIDigit(c)
+}
+
+func inC0ControlSet(c rune) bool {
+	return c < 0x20 || c > 0x7e
+}
+
+func inFragmentSet(c rune) bool {
+	return inC0ControlSet(c) || strings.ContainsRune(" \"<>`", c)
+}
+
+func inQuerySet(c rune) bool {
+	return inC0ControlSet(c) || strings.ContainsRune(" \"#<>", c)
+}
+
+func inSpecialQuerySet(c rune) bool {
+	return inQuerySet(c) || c == '\''
+}
+
+func inPathSet(c rune) bool {
+	return inQuerySet(c) || strings.ContainsRune("?`{}", c)
+}
+
+func inUserinfoSet(c rune) bool {
+	return inPathSet(c) || strings.ContainsRune("/:;=@[\\]^|", c)
+}
+
+// percentEncode returns c, or the percent-encoded bytes of its UTF-8 encoding
+// if it is in set.
+func percentEncode(c rune, set func(rune) bool) string {
+	if !set(c) {
+		return string(c)
+	}
+
+	var b strings.Builder
+	for _, octet := range []byte(string(c)) {
+		fmt.Fprintf(&b, "%%%02X", octet)
+	}
+	return b.String()
+}
+
+func percentEncodeString(s string, set func(rune) bool) string {
+	var b strings.Builder
+	for _, c := range s {
+		b.WriteString(percentEncode(c, set))
+	}
+	return b.String()
+}
+
+// percentDecode decodes the percent-encoded bytes of s, leaving "%" as is
+// where it isn't followed by two hex digits.
+func percentDecode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isASCIIHexDigit(rune(s[i+1])) && isASCIIHexDigit(rune(s[i+2])) {
+			n, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			b = append(b, byte(n))
+			i += 2
+		} else {
+			b = append(b, s[i])
+		}
+	}
+	return b
+}
+
+// parseFormURLEncoded parses an application/x-www-form-urlencoded string into
+// name-value pairs, as URLSearchParams does. url.ParseQuery isn't used as it
+// doesn't keep the order of the pairs and rejects invalid escapes, which are
+// decoded as they are.
+func parseFormURLEncoded(s string) [][2]string {
+	var pairs [][2]string
+	for _, sequence := range strings.Split(s, "&") {
+		if sequence == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(sequence, "=")
+		pairs = append(pairs, [2]string{formURLDecode(name), formURLDecode(value)})
+	}
+	return pairs
+}
+
+func formURLDecode(s string) string {
+	if decoded, err := url.QueryUnescape(s); err == nil {
+		return decodeUTF8WithoutBOM([]byte(decoded))
+	}
+	return decodeUTF8WithoutBOM(percentDecode(strings.ReplaceAll(s, "+", " ")))
+}
+
+// serializeFormURLEncoded serializes name-value pairs as an
+// application/x-www-form-urlencoded string.
+func serializeFormURLEncoded(pairs [][2]string) string {
+	var b strings.Builder
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteString("&")
+		}
+		b.WriteString(formURLEncode(pair[0]))
+		b.WriteString("=")
+		b.WriteString(formURLEncode(pair[1]))
+	}
+	return b.String()
+}
+
+var formURLEncoder = strings.NewReplacer("%2A", "*", "~", "%7E")
+
+// formURLEncode encodes s with url.QueryEscape, which differs from the
+// application/x-www-form-urlencoded percent-encode set only in "*" and "~".
+func formURLEncode(s string) string {
+	return formURLEncoder.Replace(url.QueryEscape(s))
+}
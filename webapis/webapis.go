@@ -0,0 +1,250 @@
+// Package webapis installs the web platform APIs that V8 leaves to the
+// embedder and that library code written for browsers and edge runtimes
+// assumes exist: TextEncoder, TextDecoder, URL, URLSearchParams, atob, btoa,
+// DOMException and structuredClone.
+//
+//	c, err := isolate.NewContext(ctx)
+//	if err != nil {
+//		return err
+//	} else if err := webapis.Install(ctx, c); err != nil {
+//		return err
+//	}
+//
+// URL is built on net/url, with the input brought to the form the WHATWG URL
+// Standard reads it in before it is parsed, and hosts mapped with the UTS #46
+// processing of golang.org/x/net/idna. TextDecoder supports UTF-8 and UTF-16.
+package webapis
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"net/url"
+	"reflect"
+
+	"github.com/grexie/isolates"
+)
+
+//go:embed webapis.js
+var source string
+
+// New returns an object with the APIs as properties, without defining them on
+// the global object, for module systems that export them instead, such as the
+// url module of the node package.
+func New(ctx context.Context, c *isolates.Context) (*isolates.Value, error) {
+	if bootstrap, err := c.Run(ctx, source, "webapis.js", nil); err != nil {
+		return nil, err
+	} else {
+		return bootstrap.Call(ctx, nil, &bindings{})
+	}
+}
+
+// Install defines the APIs on the global object of c. structuredClone is
+// already defined by NewContext, except in contexts created for a snapshot,
+// and is only defined by Install if it is missing.
+func Install(ctx context.Context, c *isolates.Context) error {
+	apis, err := New(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	global, err := c.Global(ctx)
+	if err != nil {
+		return err
+	}
+
+	if names, err := apis.Keys(ctx); err != nil {
+		return err
+	} else {
+		for _, name := range names {
+			if value, err := apis.Get(ctx, name); err != nil {
+				return err
+			} else if err := global.DefineProperty(ctx, name, &isolates.PropertyDescriptor{
+				Value:        value,
+				Writable:     true,
+				Configurable: true,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if structuredClone, err := global.Get(ctx, "structuredClone"); err != nil {
+		return err
+	} else if !structuredClone.IsKind(isolates.KindFunction) {
+		return c.InstallStructuredClone(ctx)
+	}
+
+	return nil
+}
+
+// bindings are the functions implemented in Go that webapis.js is bootstrapped
+// with.
+type bindings struct{}
+
+func (b *bindings) urlComponents(ctx context.Context, c *isolates.Context, u *url.URL) (*isolates.Value, error) {
+	components := map[string]any{}
+	for _, name := range []string{"href", "origin", "protocol", "username", "password", "host", "hostname", "port", "pathname", "search", "hash"} {
+		components[name] = getURL(u, name)
+	}
+	return c.Create(ctx, components)
+}
+
+// V8FuncParseURL parses a URL against an optional base, returning the values
+// of the attributes of URL or null if either is invalid.
+func (b *bindings) V8FuncParseURL(in isolates.FunctionArgs) (*isolates.Value, error) {
+	var base *url.URL
+
+	input, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext)
+	if err != nil {
+		return nil, err
+	}
+
+	if arg := in.Arg(in.ExecutionContext, 1); !arg.IsKind(isolates.KindUndefined) {
+		if s, err := arg.StringValue(in.ExecutionContext); err != nil {
+			return nil, err
+		} else if base, err = parseURL(s, nil); err != nil {
+			return in.Context.Null(in.ExecutionContext)
+		}
+	}
+
+	if u, err := parseURL(input, base); err != nil {
+		return in.Context.Null(in.ExecutionContext)
+	} else {
+		return b.urlComponents(in.ExecutionContext, in.Context, u)
+	}
+}
+
+// V8FuncSetURL sets an attribute of the URL at href, returning the values of
+// the attributes of the result, or null if it was set to an invalid href.
+func (b *bindings) V8FuncSetURL(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if href, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if name, err := in.Arg(in.ExecutionContext, 1).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if value, err := in.Arg(in.ExecutionContext, 2).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if u, err := parseURL(href, nil); err != nil {
+		return nil, err
+	} else if err := setURL(u, name, value); err != nil {
+		return in.Context.Null(in.ExecutionContext)
+	} else {
+		return b.urlComponents(in.ExecutionContext, in.Context, u)
+	}
+}
+
+// V8FuncParseSearchParams parses an application/x-www-form-urlencoded string
+// into an array of name-value pairs.
+func (b *bindings) V8FuncParseSearchParams(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if s, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else {
+		pairs := parseFormURLEncoded(s)
+		if pairs == nil {
+			pairs = [][2]string{}
+		}
+		return in.Context.Create(in.ExecutionContext, pairs)
+	}
+}
+
+// V8FuncSerializeSearchParams serializes an array of names and values, which
+// alternate, as an application/x-www-form-urlencoded string.
+func (b *bindings) V8FuncSerializeSearchParams(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if list, err := in.Arg(in.ExecutionContext, 0).Unmarshal(in.ExecutionContext, reflect.TypeOf([]string{})); err != nil {
+		return nil, err
+	} else {
+		values := list.Interface().([]string)
+		pairs := make([][2]string, len(values)/2)
+		for i := range pairs {
+			pairs[i] = [2]string{values[i*2], values[i*2+1]}
+		}
+		return in.Context.Create(in.ExecutionContext, serializeFormURLEncoded(pairs))
+	}
+}
+
+// V8FuncEncode returns the UTF-8 encoding of a string as an ArrayBuffer.
+func (b *bindings) V8FuncEncode(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if s, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else {
+		// a nil slice would be created as undefined
+		return in.Context.Create(in.ExecutionContext, append([]byte{}, s...))
+	}
+}
+
+// V8FuncEncodeInto encodes a string into a Uint8Array, returning the number
+// of code units read and bytes written.
+func (b *bindings) V8FuncEncodeInto(in isolates.FunctionArgs) (*isolates.Value, error) {
+	var read, written int
+
+	if s, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if err := in.Arg(in.ExecutionContext, 1).WithBytes(in.ExecutionContext, func(dst []byte) error {
+		read, written = encodeInto(s, dst)
+		return nil
+	}); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, []any{read, written})
+	}
+}
+
+// V8FuncEncodingForLabel returns the name of the encoding for a label, or ""
+// if it isn't supported.
+func (b *bindings) V8FuncEncodingForLabel(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if label, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else {
+		return in.Context.Create(in.ExecutionContext, encodingForLabel(label))
+	}
+}
+
+// V8FuncDecode decodes a Uint8Array, returning the string and the number of
+// bytes at its end that are left for the next chunk of a stream, or null if
+// fatal is true and the data is invalid.
+func (b *bindings) V8FuncDecode(in isolates.FunctionArgs) (*isolates.Value, error) {
+	var s string
+	var pending int
+	var decodeErr error
+
+	if encoding, err := in.Arg(in.ExecutionContext, 1).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if fatal, err := in.Arg(in.ExecutionContext, 2).Bool(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if stream, err := in.Arg(in.ExecutionContext, 3).Bool(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if err := in.Arg(in.ExecutionContext, 0).WithBytes(in.ExecutionContext, func(data []byte) error {
+		s, pending, decodeErr = decode(data, encoding, fatal, stream)
+		return nil
+	}); err != nil {
+		return nil, err
+	} else if decodeErr != nil {
+		return in.Context.Null(in.ExecutionContext)
+	} else {
+		return in.Context.Create(in.ExecutionContext, []any{s, pending})
+	}
+}
+
+// V8FuncAtob decodes base64 to a string of the decoded bytes, or null if the
+// string isn't valid base64.
+func (b *bindings) V8FuncAtob(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if s, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if data, ok := forgivingBase64Decode(s); !ok {
+		return in.Context.Null(in.ExecutionContext)
+	} else {
+		return in.Context.Create(in.ExecutionContext, fromLatin1(data))
+	}
+}
+
+// V8FuncBtoa encodes the characters of a string as bytes in base64, or
+// returns null if it has a character above U+00FF.
+func (b *bindings) V8FuncBtoa(in isolates.FunctionArgs) (*isolates.Value, error) {
+	if s, err := in.Arg(in.ExecutionContext, 0).StringValue(in.ExecutionContext); err != nil {
+		return nil, err
+	} else if data, ok := latin1(s); !ok {
+		return in.Context.Null(in.ExecutionContext)
+	} else {
+		return in.Context.Create(in.ExecutionContext, base64.StdEncoding.EncodeToString(data))
+	}
+}
@@ -0,0 +1,434 @@
+(function (binding) {
+	function toStringTag(constructor, tag) {
+		Object.defineProperty(constructor.prototype, Symbol.toStringTag, {
+			value: tag,
+			configurable: true,
+		});
+	}
+
+	// toUSVString converts a value to a string as WebIDL does for USVString
+	// arguments, replacing lone surrogates with U+FFFD.
+	function toUSVString(value) {
+		return String(value).replace(/[\uD800-\uDBFF](?![\uDC00-\uDFFF])|(?<![\uD800-\uDBFF])[\uDC00-\uDFFF]/g, '\uFFFD');
+	}
+
+	function requireArguments(name, args, count) {
+		if (args.length < count) {
+			throw new TypeError(`${name} requires at least ${count} argument${count === 1 ? '' : 's'}, but only ${args.length} present`);
+		}
+	}
+
+	const domExceptionCodes = {
+		IndexSizeError: 1,
+		HierarchyRequestError: 3,
+		WrongDocumentError: 4,
+		InvalidCharacterError: 5,
+		NoModificationAllowedError: 7,
+		NotFoundError: 8,
+		NotSupportedError: 9,
+		InUseAttributeError: 10,
+		InvalidStateError: 11,
+		SyntaxError: 12,
+		InvalidModificationError: 13,
+		NamespaceError: 14,
+		InvalidAccessError: 15,
+		TypeMismatchError: 17,
+		SecurityError: 18,
+		NetworkError: 19,
+		AbortError: 20,
+		URLMismatchError: 21,
+		QuotaExceededError: 22,
+		TimeoutError: 23,
+		InvalidNodeTypeError: 24,
+		DataCloneError: 25,
+	};
+
+	class DOMException extends Error {
+		#name;
+		#message;
+
+		constructor(message = '', name = 'Error') {
+			super(String(message));
+			this.#message = String(message);
+			this.#name = String(name);
+			// message is an accessor on the prototype, not an own property
+			delete this.message;
+		}
+
+		get name() {
+			return this.#name;
+		}
+
+		get message() {
+			return this.#message;
+		}
+
+		get code() {
+			return domExceptionCodes[this.#name] ?? 0;
+		}
+	}
+
+	for (const [name, code] of Object.entries(domExceptionCodes)) {
+		const constant = name.replace(/Error$/, '').replace(/([a-z])([A-Z])/g, '$1_$2').toUpperCase() + '_ERR';
+		Object.defineProperty(DOMException, constant, { value: code, enumerable: true });
+		Object.defineProperty(DOMException.prototype, constant, { value: code, enumerable: true });
+	}
+	toStringTag(DOMException, 'DOMException');
+
+	class TextEncoder {
+		get encoding() {
+			return 'utf-8';
+		}
+
+		encode(input = '') {
+			return new Uint8Array(binding.encode(toUSVString(input)));
+		}
+
+		encodeInto(source, destination) {
+			requireArguments('TextEncoder.encodeInto', arguments, 2);
+			if (!(destination instanceof Uint8Array)) {
+				throw new TypeError('The "destination" argument must be a Uint8Array');
+			}
+			const [read, written] = binding.encodeInto(toUSVString(source), destination);
+			return { read, written };
+		}
+	}
+	toStringTag(TextEncoder, 'TextEncoder');
+
+	function bufferSourceBytes(input) {
+		if (input === undefined) {
+			return new Uint8Array(0);
+		} else if (input instanceof ArrayBuffer || (typeof SharedArrayBuffer !== 'undefined' && input instanceof SharedArrayBuffer)) {
+			return new Uint8Array(input);
+		} else if (ArrayBuffer.isView(input)) {
+			return new Uint8Array(input.buffer, input.byteOffset, input.byteLength);
+		}
+		throw new TypeError('The "input" argument must be an ArrayBuffer or ArrayBufferView');
+	}
+
+	class TextDecoder {
+		#encoding;
+		#fatal;
+		#ignoreBOM;
+		#pending = new Uint8Array(0);
+		#bomSeen = false;
+
+		constructor(label = 'utf-8', options = {}) {
+			const encoding = binding.encodingForLabel(String(label));
+			if (!encoding) {
+				throw new RangeError(`The encoding label provided ('${label}') is invalid.`);
+			}
+			this.#encoding = encoding;
+			this.#fatal = Boolean(options?.fatal);
+			this.#ignoreBOM = Boolean(options?.ignoreBOM);
+		}
+
+		get encoding() {
+			return this.#encoding;
+		}
+
+		get fatal() {
+			return this.#fatal;
+		}
+
+		get ignoreBOM() {
+			return this.#ignoreBOM;
+		}
+
+		decode(input, options = {}) {
+			const stream = Boolean(options?.stream);
+
+			let data = bufferSourceBytes(input);
+			if (this.#pending.length > 0) {
+				const joined = new Uint8Array(this.#pending.length + data.length);
+				joined.set(this.#pending);
+				joined.set(data, this.#pending.length);
+				data = joined;
+			}
+
+			const result = binding.decode(data, this.#encoding, this.#fatal, stream);
+			if (result === null) {
+				this.#reset();
+				throw new TypeError('The encoded data was not valid for encoding ' + this.#encoding);
+			}
+
+			let [s, pending] = result;
+			this.#pending = data.slice(data.length - pending);
+
+			// the decoder outputs U+FEFF for a byte order mark, which is
+			// dropped from the start of the stream
+			if (!this.#ignoreBOM && !this.#bomSeen && s.length > 0) {
+				this.#bomSeen = true;
+				if (s.charCodeAt(0) === 0xfeff) {
+					s = s.slice(1);
+				}
+			}
+
+			if (!stream) {
+				this.#reset();
+			}
+			return s;
+		}
+
+		#reset() {
+			this.#pending = new Uint8Array(0);
+			this.#bomSeen = false;
+		}
+	}
+	toStringTag(TextDecoder, 'TextDecoder');
+
+	// setSearchParamsQuery and setURLQuery keep a URL and its searchParams in
+	// step, and are defined by the static blocks of the classes.
+	let setSearchParamsQuery;
+	let setURLQuery;
+
+	class URLSearchParams {
+		#list = [];
+		#url = null;
+
+		constructor(init = '') {
+			if (init !== null && (typeof init === 'object' || typeof init === 'function')) {
+				if (typeof init[Symbol.iterator] === 'function') {
+					for (const pair of init) {
+						if (pair === null || (typeof pair !== 'object' && typeof pair !== 'function')) {
+							throw new TypeError('Each query pair must be an iterable [name, value] tuple');
+						}
+						const values = Array.from(pair);
+						if (values.length !== 2) {
+							throw new TypeError('Each query pair must be an iterable [name, value] tuple');
+						}
+						this.#list.push([toUSVString(values[0]), toUSVString(values[1])]);
+					}
+				} else {
+					for (const key of Reflect.ownKeys(init)) {
+						const descriptor = Reflect.getOwnPropertyDescriptor(init, key);
+						if (typeof key === 'string' && descriptor?.enumerable) {
+							this.#list.push([toUSVString(key), toUSVString(init[key])]);
+						}
+					}
+				}
+			} else {
+				let query = toUSVString(init);
+				if (query.startsWith('?')) {
+					query = query.slice(1);
+				}
+				this.#list = binding.parseSearchParams(query);
+			}
+		}
+
+		static {
+			setSearchParamsQuery = (params, url, query) => {
+				params.#url = url;
+				params.#list = binding.parseSearchParams(query);
+			};
+		}
+
+		#update() {
+			if (this.#url !== null) {
+				setURLQuery(this.#url, this.toString());
+			}
+		}
+
+		get size() {
+			return this.#list.length;
+		}
+
+		append(name, value) {
+			requireArguments('URLSearchParams.append', arguments, 2);
+			this.#list.push([toUSVString(name), toUSVString(value)]);
+			this.#update();
+		}
+
+		delete(name, value) {
+			requireArguments('URLSearchParams.delete', arguments, 1);
+			name = toUSVString(name);
+			if (value === undefined) {
+				this.#list = this.#list.filter(([n]) => n !== name);
+			} else {
+				value = toUSVString(value);
+				this.#list = this.#list.filter(([n, v]) => n !== name || v !== value);
+			}
+			this.#update();
+		}
+
+		get(name) {
+			requireArguments('URLSearchParams.get', arguments, 1);
+			name = toUSVString(name);
+			return this.#list.find(([n]) => n === name)?.[1] ?? null;
+		}
+
+		getAll(name) {
+			requireArguments('URLSearchParams.getAll', arguments, 1);
+			name = toUSVString(name);
+			return this.#list.filter(([n]) => n === name).map(([, v]) => v);
+		}
+
+		has(name, value) {
+			requireArguments('URLSearchParams.has', arguments, 1);
+			name = toUSVString(name);
+			if (value === undefined) {
+				return this.#list.some(([n]) => n === name);
+			}
+			value = toUSVString(value);
+			return this.#list.some(([n, v]) => n === name && v === value);
+		}
+
+		set(name, value) {
+			requireArguments('URLSearchParams.set', arguments, 2);
+			name = toUSVString(name);
+			value = toUSVString(value);
+
+			const i = this.#list.findIndex(([n]) => n === name);
+			if (i === -1) {
+				this.#list.push([name, value]);
+			} else {
+				this.#list[i] = [name, value];
+				this.#list = this.#list.filter(([n], j) => j <= i || n !== name);
+			}
+			this.#update();
+		}
+
+		sort() {
+			// names are compared by UTF-16 code units, and Array.prototype.sort
+			// is stable
+			this.#list.sort(([a], [b]) => (a < b ? -1 : a > b ? 1 : 0));
+			this.#update();
+		}
+
+		forEach(callback, thisArg) {
+			if (typeof callback !== 'function') {
+				throw new TypeError('The "callback" argument must be a function');
+			}
+			for (let i = 0; i < this.#list.length; i++) {
+				const [name, value] = this.#list[i];
+				callback.call(thisArg, value, name, this);
+			}
+		}
+
+		*entries() {
+			// iteration is live, as it is in browsers
+			for (let i = 0; i < this.#list.length; i++) {
+				yield [...this.#list[i]];
+			}
+		}
+
+		*keys() {
+			for (const [name] of this.entries()) {
+				yield name;
+			}
+		}
+
+		*values() {
+			for (const [, value] of this.entries()) {
+				yield value;
+			}
+		}
+
+		[Symbol.iterator]() {
+			return this.entries();
+		}
+
+		toString() {
+			return binding.serializeSearchParams(this.#list.flat());
+		}
+	}
+	toStringTag(URLSearchParams, 'URLSearchParams');
+
+	const urlComponents = ['href', 'origin', 'protocol', 'username', 'password', 'host', 'hostname', 'port', 'pathname', 'search', 'hash'];
+
+	class URL {
+		#components;
+		#searchParams = new URLSearchParams();
+
+		constructor(url, base) {
+			requireArguments('URL', arguments, 1);
+			const components = binding.parseURL(toUSVString(url), base === undefined ? undefined : toUSVString(base));
+			if (components === null) {
+				throw new TypeError(`Invalid URL: ${url}`);
+			}
+			this.#components = components;
+			setSearchParamsQuery(this.#searchParams, this, components.search.slice(1));
+		}
+
+		static {
+			setURLQuery = (url, query) => {
+				url.#components = binding.setURL(url.#components.href, 'search', query);
+			};
+
+			for (const name of urlComponents) {
+				const descriptor = {
+					get() {
+						return this.#components[name];
+					},
+					enumerable: true,
+					configurable: true,
+				};
+				if (name !== 'origin') {
+					descriptor.set = function (value) {
+						this.#set(name, toUSVString(value));
+					};
+				}
+				Object.defineProperty(this.prototype, name, descriptor);
+			}
+		}
+
+		static canParse(url, base) {
+			requireArguments('URL.canParse', arguments, 1);
+			return binding.parseURL(toUSVString(url), base === undefined ? undefined : toUSVString(base)) !== null;
+		}
+
+		static parse(url, base) {
+			requireArguments('URL.parse', arguments, 1);
+			try {
+				return new URL(url, base);
+			} catch {
+				return null;
+			}
+		}
+
+		#set(name, value) {
+			const components = binding.setURL(this.#components.href, name, value);
+			if (components === null) {
+				throw new TypeError(`Invalid URL: ${value}`);
+			}
+			this.#components = components;
+			if (name === 'href' || name === 'search') {
+				setSearchParamsQuery(this.#searchParams, this, components.search.slice(1));
+			}
+		}
+
+		get searchParams() {
+			return this.#searchParams;
+		}
+
+		toString() {
+			return this.#components.href;
+		}
+
+		toJSON() {
+			return this.#components.href;
+		}
+	}
+	Object.defineProperty(URL.prototype, 'searchParams', { enumerable: true });
+	toStringTag(URL, 'URL');
+
+	function atob(data) {
+		requireArguments('atob', arguments, 1);
+		const decoded = binding.atob(String(data));
+		if (decoded === null) {
+			throw new DOMException('The string to be decoded is not correctly encoded.', 'InvalidCharacterError');
+		}
+		return decoded;
+	}
+
+	function btoa(data) {
+		requireArguments('btoa', arguments, 1);
+		const encoded = binding.btoa(String(data));
+		if (encoded === null) {
+			throw new DOMException('The string to be encoded contains characters outside of the Latin1 range.', 'InvalidCharacterError');
+		}
+		return encoded;
+	}
+
+	return { DOMException, TextEncoder, TextDecoder, URL, URLSearchParams, atob, btoa };
+});
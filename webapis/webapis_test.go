@@ -0,0 +1,497 @@
+package webapis
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grexie/isolates"
+)
+
+func TestMain(m *testing.M) {
+	isolates.Initialize()
+	os.Exit(m.Run())
+}
+
+// run runs source in a context with the APIs installed and returns its result
+// as a string.
+func run(t *testing.T, source string) string {
+	t.Helper()
+	return runWith(t, source, nil)
+}
+
+// runWith runs source as run does, with globals defined first.
+func runWith(t *testing.T, source string, globals map[string]any) string {
+	t.Helper()
+
+	ctx := isolates.WithContext(context.Background())
+	i := isolates.NewIsolate()
+	defer i.Terminate()
+
+	c, err := i.NewContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := Install(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if global, err := c.Global(ctx); err != nil {
+		t.Fatal(err)
+	} else {
+		for name, value := range globals {
+			if err := global.Set(ctx, name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if value, err := c.Run(ctx, source, "test.js", nil); err != nil {
+		t.Fatal(err)
+		return ""
+	} else {
+		return value.String()
+	}
+}
+
+// runWPT runs a test of the web platform tests against the JSON in a file of
+// testdata, passed to source as data. source returns a JSON array of the
+// names of the cases that fail, which must be those in expectedFailures.
+func runWPT(t *testing.T, file string, source string, expectedFailures []string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures []string
+	if err := json.Unmarshal([]byte(runWith(t, source, map[string]any{"data": string(data)})), &failures); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{}
+	for _, name := range expectedFailures {
+		expected[name] = true
+	}
+
+	for _, name := range failures {
+		if expected[name] {
+			delete(expected, name)
+		} else {
+			t.Errorf("%s: failed", name)
+		}
+	}
+	for name := range expected {
+		t.Errorf("%s: expected to fail, but passed", name)
+	}
+}
+
+// urlExpectedFailures are the cases of urltestdata.json that fail because URL
+// is built on net/url, which parses URLs as RFC 3986 does. The input is given
+// the form browsers read it in before it is parsed, which leaves these.
+var urlExpectedFailures = []string{
+	// net/url drops empty fragments, and the "//" of empty hosts with an
+	// empty path.
+	"<:#> against <http://example.org/foo/bar>",
+	"<#> against <http://example.org/foo/bar>",
+	"<foo://> against <http://example.org/foo/bar>",
+	"<http://www.google.com/foo?bar=baz#>",
+	"<#> against <test:test>",
+	"<#> against <test:test?test>",
+	"<sc://?>",
+	"<sc://#>",
+	"<http://example.org/test?#>",
+
+	// net/url percent-encodes more of the code points of credentials, paths
+	// and fragments than browsers do.
+	"<#\\> against <http://example.org/foo/bar>",
+	"<http://&a:foo(b]c@d:2/> against <http://example.org/foo/bar>",
+	"<http://foo/path;a??e#f#g> against <http://example.org/foo/bar>",
+	"<foo:// !\"$%&'()*+,-.;<=>@[\\]^_`{|}~@host/>",
+	"<wss:// !\"$%&'()*+,-.;<=>@[]^_`{|}~@host/>",
+	"<foo://joe: !\"$%&'()*+,-.:;<=>@[\\]^_`{|}~@host/>",
+	"<wss://joe: !\"$%&'()*+,-.:;<=>@[]^_`{|}~@host/>",
+	"<foo://host/ !\"$%&'()*+,-./:;<=>@[\\]^_`{|}~>",
+	"<wss://host/ !\"$%&'()*+,-./:;<=>@[\\]^_`{|}~>",
+	"<foo://host/dir/# !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~>",
+	"<wss://host/dir/# !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~>",
+
+	// net/url rejects percent signs that aren't followed by two hex digits,
+	// which are escaped as "%25".
+	"<http://example.com/foo/%2e%2>",
+	"<http://example.com/foo%>",
+	"<http://example.com/foo%2>",
+	"<http://example.com/foo%2zbar>",
+	"<http://example.com/foo%2Â©zbar>",
+	"<http://example.org/test?a#%GH>",
+
+	// net/url rejects percent-encoded ASCII and some of the other code points
+	// in hosts.
+	"<http://%30%78%63%30%2e%30%32%35%30.01> against <http://other.com/>",
+	"<http://%30%78%63%30%2e%30%32%35%30.01%2e> against <http://other.com/>",
+	"<sc://%/>",
+	"<http://!\"$&'()*+,-.;=_`{}~/>",
+	"<sc://\x01\x02\x03\x04\x05\x06\a\b\v\f\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f\x7f!\"$%&'()*+,-.;=_`{}~/>",
+	"<asdf://%43%7C/>",
+	"<non-special://H%4fSt/path>",
+	"<foo://!\"$%&'()*+,-.;=_`{}~/>",
+	"<wss://!\"$&'()*+,-.;=_`{}~/>",
+
+	// Paths that begin with an empty segment lose it when net/url removes
+	// dot segments, or have their first slash encoded rather than the "/."
+	// browsers prefix them with to keep them from being read as a host.
+	"</..//localhost//pig> against <file://lion/>",
+	"<non-spec:/.//>",
+	"<non-spec:/..//>",
+	"<non-spec:/a/..//>",
+	"<non-spec:/.//path>",
+	"<non-spec:/..//path>",
+	"<non-spec:/a/..//path>",
+	"</.//path> against <non-spec:/p>",
+	"</..//path> against <non-spec:/p>",
+	"<..//path> against <non-spec:/p>",
+	"<a/..//path> against <non-spec:/p>",
+	"<> against <non-spec:/..//p>",
+	"<path> against <non-spec:/..//p>",
+
+	// Windows drive letters in file URLs are treated as path segments.
+	"<file:c:\\foo\\bar.html> against <file:///tmp/mock/path>",
+	"<  File:c|////foo\\bar.html> against <file:///tmp/mock/path>",
+	"<C|/foo/bar> against <file:///tmp/mock/path>",
+	"</C|\\foo\\bar> against <file:///tmp/mock/path>",
+	"<//C|/foo/bar> against <file:///tmp/mock/path>",
+	"<..> against <file:///C:/>",
+	"</> against <file:///C:/a/b>",
+	"</> against <file://h/C:/a/b>",
+	"<//d:> against <file:///C:/a/b>",
+	"<//d:/..> against <file:///C:/a/b>",
+	"<C|> against <file://host/dir/file>",
+	"<C|> against <file://host/D:/dir1/dir2/file>",
+	"<C|#> against <file://host/dir/file>",
+	"<C|?> against <file://host/dir/file>",
+	"<C|/> against <file://host/dir/file>",
+	"<C|\n/> against <file://host/dir/file>",
+	"<C|\\> against <file://host/dir/file>",
+	"<C|a> against <file://host/dir/file>",
+	"</c|/foo/bar> against <file:///c:/baz/qux>",
+	"<C|/> against <file://host/>",
+	"<//C:/> against <file://host/>",
+	"<file://C:/> against <file://host/>",
+	"<file:/C|/>",
+	"<file://C|/>",
+
+	// net/url parses "a:" with an empty path rather than an opaque one.
+	"<test-a-colon.html> against <a:>",
+}
+
+// urlSettersExpectedFailures are the cases of setters_tests.json that fail
+// for the reasons urlExpectedFailures do.
+var urlSettersExpectedFailures = []string{
+	// net/url drops empty fragments, and the "//" of empty hosts with an
+	// empty path.
+	"<foo:///some/path> set pathname to <>",
+	"<https://example.net?lang=en-US#nav> set hash to <#>",
+
+	// net/url percent-encodes more of the code points of credentials, paths
+	// and fragments than browsers do.
+	"<http://example.net> set username to <\x00\x01\t\n\r\x1f !\"#$%&'()*+,-./09:;<=>?@AZ[\\]^_`az{|}~\x7f\u0080\u0081Éé>",
+	"<http://example.net> set username to <%c3%89té>",
+	"<http://example.net> set password to <\x00\x01\t\n\r\x1f !\"#$%&'()*+,-./09:;<=>?@AZ[\\]^_`az{|}~\x7f\u0080\u0081Éé>",
+	"<http://example.net> set password to <%c3%89té>",
+	"<view-source+http://example.net/home?lang=fr#nav> set pathname to <\\a\\%2E\\b\\%2e.\\c>",
+	"<a:/> set pathname to <\x00\x01\t\n\r\x1f !\"#$%&'()*+,-./09:;<=>?@AZ[\\]^_`az{|}~\x7f\u0080\u0081Éé>",
+	"<https://example.net?lang=en-US> set hash to <##nav>",
+	"<a:/> set hash to <\x00\x01\t\n\r\x1f !\"#$%&'()*+,-./09:;<=>?@AZ[\\]^_`az{|}~\x7f\u0080\u0081Éé>",
+
+	// Paths that begin with an empty segment lose it when net/url removes
+	// dot segments, or have their first slash encoded rather than the "/."
+	// browsers prefix them with to keep them from being read as a host.
+	"<non-spec:/.//p> set hostname to <h>",
+	"<non-spec:/.//p> set hostname to <>",
+	"<non-spec:/> set pathname to </.//p>",
+	"<non-spec:/> set pathname to </..//p>",
+	"<non-spec:/> set pathname to <//p>",
+	"<non-spec:/.//> set pathname to <p>",
+
+	// A host with an invalid port is ignored, rather than only the port.
+	"<http://example.net/path> set host to <example.com:65536>",
+}
+
+// TestURLConstructor runs url/url-constructor.any.js and url/url-origin.any.js
+// of the web platform tests.
+func TestURLConstructor(t *testing.T) {
+	runWPT(t, "urltestdata.json", `
+		const failures = [];
+		const attributes = ['href', 'origin', 'protocol', 'username', 'password', 'host', 'hostname', 'port', 'pathname', 'search', 'hash'];
+
+		for (const expected of JSON.parse(data)) {
+			if (typeof expected === 'string') {
+				continue;
+			}
+
+			const base = expected.base ?? undefined;
+			const name = '<' + expected.input + '>' + (base === undefined ? '' : ' against <' + base + '>');
+
+			let url;
+			try {
+				url = new URL(expected.input, base);
+			} catch (err) {
+				if (!expected.failure || !(err instanceof TypeError)) {
+					failures.push(name);
+				}
+				continue;
+			}
+
+			if (expected.failure ||
+				attributes.some((attribute) => attribute in expected && url[attribute] !== expected[attribute]) ||
+				('searchParams' in expected && url.searchParams.toString() !== expected.searchParams)) {
+				failures.push(name);
+			}
+		}
+
+		JSON.stringify(failures);
+	`, urlExpectedFailures)
+}
+
+// TestURLSetters runs url/url-setters.any.js of the web platform tests.
+func TestURLSetters(t *testing.T) {
+	runWPT(t, "setters_tests.json", `
+		const failures = [];
+
+		for (const [attribute, tests] of Object.entries(JSON.parse(data))) {
+			if (attribute === 'comment') {
+				continue;
+			}
+
+			for (const test of tests) {
+				const name = '<' + test.href + '> set ' + attribute + ' to <' + test.new_value + '>';
+				try {
+					const url = new URL(test.href);
+					url[attribute] = test.new_value;
+					if (Object.entries(test.expected).some(([key, value]) => url[key] !== value)) {
+						failures.push(name);
+					}
+				} catch {
+					failures.push(name);
+				}
+			}
+		}
+
+		JSON.stringify(failures);
+	`, urlSettersExpectedFailures)
+}
+
+// TestBase64WPT runs html/webappapis/atob/base64.any.js of the web platform
+// tests, and checks that btoa encodes what atob decodes.
+func TestBase64WPT(t *testing.T) {
+	runWPT(t, "base64.json", `
+		const failures = [];
+
+		for (const test of JSON.parse(data)) {
+			if (typeof test === 'string') {
+				continue;
+			}
+
+			const [input, output] = test;
+			const name = '<' + input + '>';
+			try {
+				const decoded = atob(input);
+				if (output === null || decoded !== String.fromCharCode(...output) || atob(btoa(decoded)) !== decoded) {
+					failures.push(name);
+				}
+			} catch (err) {
+				if (output !== null || !(err instanceof DOMException) || err.name !== 'InvalidCharacterError') {
+					failures.push(name);
+				}
+			}
+		}
+
+		JSON.stringify(failures);
+	`, nil)
+}
+
+func TestTextEncoding(t *testing.T) {
+	result := run(t, `
+		const encoder = new TextEncoder();
+		const decoder = new TextDecoder();
+		const bytes = encoder.encode('h\u00e9\ud83d\ude00\ud800');
+		const into = new Uint8Array(4);
+		const { read, written } = encoder.encodeInto('a\u00e9\ud83d\ude00', into);
+
+		const streaming = new TextDecoder('utf-8');
+		const chunks = [[0xef, 0xbb], [0xbf, 0x61, 0xe2, 0x82], [0xac]];
+		const streamed = chunks.map((chunk) => streaming.decode(new Uint8Array(chunk), { stream: true })).join('') + streaming.decode();
+
+		let fatal;
+		try {
+			new TextDecoder('utf-8', { fatal: true }).decode(new Uint8Array([0xff]));
+		} catch (err) {
+			fatal = err instanceof TypeError;
+		}
+
+		let invalid;
+		try {
+			new TextDecoder('klingon');
+		} catch (err) {
+			invalid = err instanceof RangeError;
+		}
+
+		[
+			Array.from(bytes).join(','),
+			read + '/' + written,
+			decoder.decode(bytes.buffer),
+			decoder.decode(new Uint8Array([0x61, 0xf0, 0x9f, 0x62, 0xc0])),
+			streamed,
+			new TextDecoder('UTF-16').encoding,
+			new TextDecoder('utf-16le').decode(new Uint8Array([0xff, 0xfe, 0x68, 0x00, 0x3d, 0xd8, 0x00, 0xde])),
+			new TextDecoder('utf-16be').decode(new Uint8Array([0x00, 0x68, 0xd8, 0x00])),
+			new TextDecoder('utf-8', { ignoreBOM: true }).decode(new Uint8Array([0xef, 0xbb, 0xbf])).length,
+			fatal,
+			invalid,
+		].join(' ');
+	`)
+
+	if expected := "104,195,169,240,159,152,128,239,191,189 2/3 hé😀� a�b� a€ utf-16le h😀 h� 1 true true"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestURL(t *testing.T) {
+	result := run(t, `
+		const u = new URL('../c?x=1#frag', 'https://user:pw@Example.COM:443/a/b');
+		const parts = [u.href, u.origin, u.host, u.pathname, u.search, u.hash, u.searchParams.get('x')];
+
+		u.port = '8443';
+		u.pathname = '/d e';
+		u.searchParams.append('y', 'a b&c');
+		u.hash = '';
+		parts.push(u.href);
+
+		u.search = '?z=2';
+		parts.push(u.searchParams.get('z'), u.searchParams.has('x'));
+
+		let invalid;
+		try {
+			new URL('not a url');
+		} catch (err) {
+			invalid = err instanceof TypeError;
+		}
+
+		parts.push(
+			invalid,
+			URL.canParse('/x', 'http://a'),
+			URL.canParse('/x'),
+			JSON.stringify({ u: new URL('http://a/') }),
+			Object.prototype.toString.call(u),
+		);
+		parts.join(' ');
+	`)
+
+	if expected := "https://user:pw@example.com/c?x=1#frag https://example.com example.com /c ?x=1 #frag 1 " +
+		"https://user:pw@example.com:8443/d%20e?x=1&y=a+b%26c 2 false true true false {\"u\":\"http://a/\"} [object URL]"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestURLSearchParams(t *testing.T) {
+	result := run(t, `
+		const params = new URLSearchParams('?b=2&a=1&b=3&c=%20x+y');
+		params.sort();
+		const sorted = params.toString();
+
+		params.set('b', '4');
+		params.delete('c');
+
+		[
+			sorted,
+			params.toString(),
+			params.getAll('b').length,
+			String(params.get('missing')),
+			params.size,
+			[...params.keys()].join(','),
+			new URLSearchParams([['x', '1'], ['y', '2']]).toString(),
+			new URLSearchParams({ 'é': '~' }).toString(),
+		].join(' ');
+	`)
+
+	if expected := "a=1&b=2&b=3&c=+x+y a=1&b=4 1 null 2 a,b x=1&y=2 %C3%A9=%7E"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBase64(t *testing.T) {
+	result := run(t, `
+		function error(fn) {
+			try {
+				fn();
+			} catch (err) {
+				return err instanceof DOMException && err.name + ':' + err.code;
+			}
+		}
+
+		[
+			btoa('hello\u00ff'),
+			atob(' aGVs\nbG// ') === 'hello\u00ff',
+			atob('YQ'),
+			error(() => btoa('\u0100')),
+			error(() => atob('a')),
+			DOMException.INVALID_CHARACTER_ERR,
+		].join(' ');
+	`)
+
+	if expected := "aGVsbG// true a InvalidCharacterError:5 InvalidCharacterError:5 5"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestStructuredClone(t *testing.T) {
+	result := run(t, `
+		const original = { date: new Date(0), map: new Map([[1, { nested: true }]]) };
+		original.self = original;
+		const clone = structuredClone(original);
+
+		[
+			clone !== original,
+			clone.self === clone,
+			clone.date instanceof Date,
+			clone.map.get(1).nested,
+		].join(' ');
+	`)
+
+	if expected := "true true true true"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestInstallSnapshot(t *testing.T) {
+	ctx := isolates.WithContext(context.Background())
+
+	// contexts created for a snapshot have no structuredClone until Install
+	// defines it
+	snapshot, err := isolates.CreateSnapshot(ctx, func(ctx context.Context, c *isolates.Context) error {
+		if err := Install(ctx, c); err != nil {
+			return err
+		}
+
+		_, err := c.Run(ctx, `
+			globalThis.cloned = [typeof structuredClone, structuredClone({ a: [1] }).a[0], new URL('http://a/b/../c').pathname].join(' ');
+		`, "snapshot.js", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := isolates.NewIsolateWithSnapshot(snapshot)
+	defer i.Terminate()
+
+	if c, err := i.NewContext(ctx); err != nil {
+		t.Fatal(err)
+	} else if result, err := c.Run(ctx, `cloned + ' ' + typeof structuredClone`, "index.js", nil); err != nil {
+		t.Fatal(err)
+	} else if expected := "function 1 /c function"; result.String() != expected {
+		t.Errorf("expected %q, got %q", expected, result.String())
+	}
+}